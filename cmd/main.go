@@ -10,6 +10,7 @@ import (
 	"log"
 	"log/slog"
 	"net/http"
+	"os"
 
 	_ "github.com/lib/pq"
 )
@@ -53,20 +54,58 @@ func main() {
 	inventService := service.NewDefaultInventService(inventRepo)
 	inventHandler := handlers.NewInventHandle(inventService)
 
+	unitRepo := dal.DefaultUnitRepo(db)
+	unitService := service.NewDefaultUnitService(unitRepo)
+	unitHandler := handlers.NewUnitHandle(unitService)
+
+	countRepo := dal.DefaultCountRepo(db)
+	countService := service.NewDefaultCountService(countRepo)
+	countHandler := handlers.NewCountHandle(countService)
+
+	supplierRepo := dal.DefaultSupplierRepo(db)
+	supplierService := service.NewDefaultSupplierService(supplierRepo)
+	supplierHandler := handlers.NewSupplierHandle(supplierService)
+
+	purchaseOrderRepo := dal.DefaultPurchaseOrderRepo(db)
+	purchaseOrderService := service.NewDefaultPurchaseOrderService(purchaseOrderRepo, supplierRepo)
+	purchaseOrderHandler := handlers.NewPurchaseOrderHandle(purchaseOrderService)
+
+	loyaltyRepo := dal.DefaultLoyaltyRepo(db)
+	loyaltyService := service.NewDefaultLoyaltyService(loyaltyRepo, menuRepo, customerRepo)
+	loyaltyHandler := handlers.NewLoyaltyHandle(loyaltyService)
+
+	promotionRepo := dal.DefaultPromotionRepo(db)
+	promotionService := service.NewDefaultPromotionService(promotionRepo, menuRepo, customerRepo)
+	promotionHandler := handlers.NewPromotionHandle(promotionService)
+
 	reportRepo := dal.DefaultReportRepo(db)
 	reportService := service.NewReportService(*reportRepo)
 	reportHandler := handlers.NewReportHandler(reportService)
 
+	idempotencyRepo := dal.DefaultIdempotencyRepo(db)
+	idempotencyService := service.NewIdempotencyService(*idempotencyRepo)
+	idempotencyHandler := handlers.NewIdempotencyHandler(idempotencyService)
+
+	adminHandler := handlers.NewAdminHandler(menuService, customerServ, inventService, os.Getenv("ADMIN_TOKEN"))
+
 	mux := http.NewServeMux()
 	// Customers mux
 	mux.HandleFunc("/customers", customerHandler.Customers_handle)
 	mux.HandleFunc("/customers/{id}", customerHandler.Customers_handle)
+	mux.HandleFunc("/customers/{id}/orders", customerHandler.Customers_handle)
+	mux.HandleFunc("/customers/{id}/summary", customerHandler.Customers_handle)
+	mux.HandleFunc("/customers/{id}/loyalty", loyaltyHandler.Balance_Handle)
+	mux.HandleFunc("/customers/{id}/loyalty/ledger", loyaltyHandler.Balance_Handle)
 
 	// Orders mux
-	mux.HandleFunc("/orders", orderHandler.Order_Handle)
+	mux.HandleFunc("/orders", idempotencyHandler.Idempotent(orderHandler.Order_Handle))
 	mux.HandleFunc("/orders/{id}", orderHandler.Order_Handle)
-	mux.HandleFunc("/orders/{id}/close", orderHandler.Order_Handle)
-	mux.HandleFunc("/orders/batch-process", orderHandler.Order_Handle)
+	mux.HandleFunc("/orders/{id}/close", idempotencyHandler.Idempotent(orderHandler.Order_Handle))
+	mux.HandleFunc("/orders/{id}/status", orderHandler.Order_Handle)
+	mux.HandleFunc("/orders/{id}/cancel", orderHandler.Order_Handle)
+	mux.HandleFunc("/orders/{id}/refund", orderHandler.Order_Handle)
+	mux.HandleFunc("/orders/{id}/refunds", orderHandler.Order_Handle)
+	mux.HandleFunc("/orders/batch-process", idempotencyHandler.Idempotent(orderHandler.Order_Handle))
 
 	// Orders Status mux
 	mux.HandleFunc("/order-status", orderStatusHandler.OrderStatus_handle)
@@ -75,15 +114,64 @@ func main() {
 	// Menu mux
 	mux.HandleFunc("/menu", menuHandler.Menu_Handle)
 	mux.HandleFunc("/menu/{id}", menuHandler.Menu_Handle)
+	mux.HandleFunc("/menu/available", menuHandler.Menu_Handle)
+	mux.HandleFunc("/menu/{id}/sold-out", menuHandler.Menu_Handle)
+	mux.HandleFunc("/menu/{id}/cost", menuHandler.Menu_Handle)
+	mux.HandleFunc("/menu/{id}/variants", menuHandler.Variant_Handle)
+	mux.HandleFunc("/menu/{id}/variants/{variant_id}", menuHandler.Variant_Handle)
+	mux.HandleFunc("/menu/{id}/modifiers", menuHandler.Modifier_Handle)
+	mux.HandleFunc("/menu/{id}/modifiers/{group_id}", menuHandler.Modifier_Handle)
 	mux.HandleFunc("/menu-price", menuHandler.Menu_Price_History_Handle)
 	mux.HandleFunc("/menu-price/{id}", menuHandler.Menu_Price_History_Handle)
 
 	// Inventory mux
 	mux.HandleFunc("/inventory", inventHandler.Inventory_Handle)
 	mux.HandleFunc("/inventory/{id}", inventHandler.Inventory_Handle)
+	mux.HandleFunc("/inventory/consistency", inventHandler.Consistency_Handle)
+	mux.HandleFunc("/inventory/waste", inventHandler.Waste_Handle)
+	mux.HandleFunc("/inventory/reorder-suggestions", inventHandler.Reorder_Handle)
+	mux.HandleFunc("/inventory/expiring", inventHandler.Expiring_Handle)
+	mux.HandleFunc("/inventory/expired/write-off", inventHandler.Expired_Handle)
+	mux.HandleFunc("/inventory/{id}/lots", inventHandler.Lot_Handle)
+	mux.HandleFunc("/inventory/{id}/movements", inventHandler.Movement_Handle)
+	mux.HandleFunc("/inventory/{id}/packs", inventHandler.Pack_Handle)
+	mux.HandleFunc("/inventory/{id}/packs/{pack_id}", inventHandler.Pack_Handle)
 	mux.HandleFunc("/inventory-transaction", inventHandler.InventoryTransaction_Handle)
 	mux.HandleFunc("/inventory-transaction/{id}", inventHandler.InventoryTransaction_Handle)
 
+	// Stock counts mux
+	mux.HandleFunc("/stock-counts", countHandler.Count_Handle)
+	mux.HandleFunc("/stock-counts/{id}", countHandler.Count_Handle)
+	mux.HandleFunc("/stock-counts/{id}/lines", countHandler.Count_Handle)
+	mux.HandleFunc("/stock-counts/{id}/post", countHandler.Count_Handle)
+
+	// Suppliers mux
+	mux.HandleFunc("/suppliers", supplierHandler.Supplier_Handle)
+	mux.HandleFunc("/suppliers/{id}", supplierHandler.Supplier_Handle)
+	mux.HandleFunc("/suppliers/{id}/items", supplierHandler.Supplier_Handle)
+	mux.HandleFunc("/suppliers/{id}/items/{inventory_id}", supplierHandler.Supplier_Handle)
+
+	// Purchase orders mux
+	mux.HandleFunc("/purchase-orders", purchaseOrderHandler.PurchaseOrder_Handle)
+	mux.HandleFunc("/purchase-orders/{id}", purchaseOrderHandler.PurchaseOrder_Handle)
+	mux.HandleFunc("/purchase-orders/{id}/send", purchaseOrderHandler.PurchaseOrder_Handle)
+	mux.HandleFunc("/purchase-orders/{id}/receive", purchaseOrderHandler.PurchaseOrder_Handle)
+	mux.HandleFunc("/purchase-orders/{id}/cancel", purchaseOrderHandler.PurchaseOrder_Handle)
+
+	// Loyalty mux
+	mux.HandleFunc("/loyalty/settings", loyaltyHandler.Loyalty_Handle)
+	mux.HandleFunc("/loyalty/rewards", loyaltyHandler.Loyalty_Handle)
+	mux.HandleFunc("/loyalty/rewards/{id}", loyaltyHandler.Loyalty_Handle)
+	mux.HandleFunc("/loyalty/expire", loyaltyHandler.Loyalty_Handle)
+
+	// Promotions mux
+	mux.HandleFunc("/promotions", promotionHandler.Promotion_Handle)
+	mux.HandleFunc("/promotions/{id}", promotionHandler.Promotion_Handle)
+
+	// Units mux
+	mux.HandleFunc("/units", unitHandler.Unit_Handle)
+	mux.HandleFunc("/units/{code}", unitHandler.Unit_Handle)
+
 	// Report mux
 	mux.HandleFunc("/reports/total-sales", reportHandler.Report_handler)
 	mux.HandleFunc("/reports/popular-items", reportHandler.Report_handler)
@@ -91,12 +179,21 @@ func main() {
 	mux.HandleFunc("/reports/search", reportHandler.Report_handler)
 	mux.HandleFunc("/reports/getLeftOvers", reportHandler.Report_handler)
 	mux.HandleFunc("/reports/orderedItemsByPeriod", reportHandler.Report_handler)
+	mux.HandleFunc("/reports/margins", reportHandler.Report_handler)
+	mux.HandleFunc("/reports/waste", reportHandler.Report_handler)
+	mux.HandleFunc("/reports/inventory-valuation", reportHandler.Report_handler)
+	mux.HandleFunc("/reports/forecast", reportHandler.Report_handler)
+	// Admin mux
+	mux.HandleFunc("/admin/menu/{id}", adminHandler.Purge_Handle)
+	mux.HandleFunc("/admin/customers/{id}", adminHandler.Purge_Handle)
+	mux.HandleFunc("/admin/inventory/{id}", adminHandler.Purge_Handle)
+
 	// Error mux
 	mux.HandleFunc("/", utils.Err_Handler)
 
 	slog.Info("Server is running on port " + *models.Port)
 	if err := http.ListenAndServe(":"+*models.Port, mux); err != nil {
-		slog.Error("Error starting server:", err)
+		slog.Error("Error starting server:", "error", err)
 		return
 	}
 }
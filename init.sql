@@ -1,20 +1,31 @@
-CREATE TYPE order_status_enum as ENUM('active','closed');
+CREATE TYPE order_status_enum as ENUM('pending','active','preparing','ready','picked_up','closed','cancelled');
+CREATE TYPE unit_dimension_enum as ENUM('mass','volume','count');
+CREATE TYPE stock_movement_enum as ENUM('purchase','sale_usage','refund_return','waste','count_adjustment','transfer');
+CREATE TYPE stock_count_status_enum as ENUM('open','posted');
+CREATE TYPE purchase_order_status_enum as ENUM('draft','sent','partially_received','received','cancelled');
+CREATE TYPE waste_reason_enum as ENUM('spilled','expired','remade','damaged','quality','other');
+CREATE TYPE loyalty_entry_enum as ENUM('earn','redeem','expire','reverse','restore');
+CREATE TYPE discount_source_enum as ENUM('loyalty_points','loyalty_reward','promotion');
+CREATE TYPE promotion_effect_enum as ENUM('percent_off','amount_off','free_item','bundle_price');
 
 
+-- archived_at marks rows hidden from listings and new orders, history keeps referencing them
 CREATE TABLE customers(
     customer_id SERIAL PRIMARY KEY,
     name VARCHAR(255) NOT NULL,
     email VARCHAR(255) UNIQUE NOT NULL,
-    number VARCHAR(20)
+    number VARCHAR(20),
+    archived_at TIMESTAMPTZ
 );
 
 CREATE TABLE orders(
     order_id SERIAL PRIMARY KEY, 
-    customer_id INT REFERENCES customers(customer_id) ON DELETE CASCADE,
+    customer_id INT REFERENCES customers(customer_id) ON DELETE RESTRICT,
     order_date TIMESTAMPTZ DEFAULT NOW(),
     status order_status_enum NOT NULL,
-    total_amount DECIMAL(10,2) NOT NULL CHECK(total_amount>0),
-    special_instructions JSONB
+    total_amount DECIMAL(10,2) NOT NULL CHECK(total_amount>=0),
+    special_instructions JSONB,
+    promo_code VARCHAR(50)
 );
 
 CREATE TABLE menu_items(
@@ -22,60 +33,405 @@ CREATE TABLE menu_items(
     description TEXT NOT NULL,
     name VARCHAR(100) NOT NULL ,
     price DECIMAL(10,2) NOT NULL CHECK(price>0),
-    tags TEXT[]
+    tags TEXT[],
+    sold_out BOOLEAN NOT NULL DEFAULT FALSE,
+    archived_at TIMESTAMPTZ
+);
+
+CREATE TABLE menu_item_variants(
+    variant_id SERIAL PRIMARY KEY,
+    menu_item_id INT REFERENCES menu_items(menu_item_id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    price DECIMAL(10,2) NOT NULL CHECK(price>0),
+    UNIQUE(menu_item_id, name)
 );
 
+-- variant_name is copied at order time, so reports keep it when the variant is deleted
 CREATE TABLE order_items(
     order_item_id SERIAL PRIMARY KEY,
-    menu_item_id INT REFERENCES menu_items(menu_item_id) ON DELETE CASCADE,
+    menu_item_id INT REFERENCES menu_items(menu_item_id) ON DELETE RESTRICT,
+    variant_id INT REFERENCES menu_item_variants(variant_id) ON DELETE SET NULL,
+    variant_name VARCHAR(100),
     order_id INT REFERENCES orders(order_id) ON DELETE CASCADE,
     customizations JSONB,
     price_at_order_time DECIMAL(10,2) NOT NULL CHECK(price_at_order_time>0),
     quantity INT NOT NULL CHECK (quantity >0)
 );
 
+-- to_base converts one unit to the base unit of its dimension: g, ml or pcs
+CREATE TABLE units(
+    unit_code VARCHAR(20) PRIMARY KEY,
+    name VARCHAR(50) NOT NULL,
+    dimension unit_dimension_enum NOT NULL,
+    to_base DECIMAL(14,6) NOT NULL CHECK(to_base>0)
+);
+
+-- stock_level is kept in unit_type, recipes and purchases are converted to it
 CREATE TABLE inventory(
     inventory_id SERIAL PRIMARY KEY,
     name VARCHAR(255) NOT NULL UNIQUE,
-    stock_level DECIMAL(10,2) NOT NULL CHECK(stock_level>0),
-    unit_type VARCHAR(50) NOT NULL,
+    stock_level DECIMAL(12,3) NOT NULL CHECK(stock_level>=0),
+    unit_type VARCHAR(20) NOT NULL REFERENCES units(unit_code),
     last_updated TIMESTAMPTZ DEFAULT NOW(),
-    reorder_level DECIMAL(10,2) NOT NULL CHECK(reorder_level>0)
+    reorder_level DECIMAL(10,2) NOT NULL CHECK(reorder_level>0),
+    -- par_level is the stock to refill up to when reordering, twice the reorder level when not set
+    par_level DECIMAL(10,2) CHECK(par_level>=reorder_level),
+    category VARCHAR(50),
+    archived_at TIMESTAMPTZ
 );
 
+-- a pack is a purchase unit of one inventory item, e.g. a 1 kg bag or a case of 24
+CREATE TABLE inventory_pack_units(
+    pack_id SERIAL PRIMARY KEY,
+    inventory_id INT REFERENCES inventory(inventory_id) ON DELETE CASCADE,
+    name VARCHAR(50) NOT NULL,
+    quantity DECIMAL(12,3) NOT NULL CHECK(quantity>0),
+    unit_code VARCHAR(20) NOT NULL REFERENCES units(unit_code),
+    UNIQUE(inventory_id, name)
+);
+
+-- recipes keep the unit they were written in, quantities are converted to the stock unit when used
 CREATE TABLE menu_item_ingredients(
     id SERIAL PRIMARY KEY,
-    inventory_id INT REFERENCES inventory(inventory_id) ON DELETE CASCADE,
+    inventory_id INT REFERENCES inventory(inventory_id) ON DELETE RESTRICT,
     menu_item_id INT REFERENCES menu_items(menu_item_id) ON DELETE CASCADE,
-    quantity DECIMAL(10,2) NOT NULL CHECK(quantity>0)
+    quantity DECIMAL(10,2) NOT NULL CHECK(quantity>0),
+    unit VARCHAR(20) NOT NULL REFERENCES units(unit_code)
+);
+
+-- a variant has its own recipe that replaces the recipe of the menu item
+CREATE TABLE variant_ingredients(
+    id SERIAL PRIMARY KEY,
+    variant_id INT REFERENCES menu_item_variants(variant_id) ON DELETE CASCADE,
+    inventory_id INT REFERENCES inventory(inventory_id) ON DELETE RESTRICT,
+    quantity DECIMAL(10,2) NOT NULL CHECK(quantity>0),
+    unit VARCHAR(20) NOT NULL REFERENCES units(unit_code),
+    UNIQUE(variant_id, inventory_id)
+);
+
+CREATE TABLE modifier_groups(
+    group_id SERIAL PRIMARY KEY,
+    menu_item_id INT REFERENCES menu_items(menu_item_id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    min_select INT NOT NULL DEFAULT 0 CHECK(min_select>=0),
+    max_select INT NOT NULL DEFAULT 1 CHECK(max_select>=1),
+    CHECK(min_select<=max_select),
+    UNIQUE(menu_item_id, name)
+);
+
+CREATE TABLE modifier_options(
+    option_id SERIAL PRIMARY KEY,
+    group_id INT REFERENCES modifier_groups(group_id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    price_delta DECIMAL(10,2) NOT NULL DEFAULT 0,
+    UNIQUE(group_id, name)
+);
+
+-- negative quantity means the option uses less of the ingredient than the base recipe
+CREATE TABLE modifier_option_ingredients(
+    id SERIAL PRIMARY KEY,
+    option_id INT REFERENCES modifier_options(option_id) ON DELETE CASCADE,
+    inventory_id INT REFERENCES inventory(inventory_id) ON DELETE RESTRICT,
+    quantity DECIMAL(10,2) NOT NULL CHECK(quantity<>0),
+    unit VARCHAR(20) NOT NULL REFERENCES units(unit_code),
+    UNIQUE(option_id, inventory_id)
+);
+
+-- names and price are copied at order time, so the order stays intact when the option changes
+CREATE TABLE order_item_modifiers(
+    id SERIAL PRIMARY KEY,
+    order_item_id INT REFERENCES order_items(order_item_id) ON DELETE CASCADE,
+    option_id INT REFERENCES modifier_options(option_id) ON DELETE SET NULL,
+    group_name VARCHAR(100) NOT NULL,
+    option_name VARCHAR(100) NOT NULL,
+    price_delta DECIMAL(10,2) NOT NULL
+);
+
+CREATE TABLE suppliers(
+    supplier_id SERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL UNIQUE,
+    contact_name VARCHAR(255),
+    email VARCHAR(255),
+    phone VARCHAR(20),
+    lead_time_days INT NOT NULL DEFAULT 1 CHECK(lead_time_days>=0),
+    created_at TIMESTAMPTZ DEFAULT NOW()
 );
 
+-- what a supplier sells: one pack holds pack_size of pack_unit, a registered unit;
+-- a pack of the inventory item is kept as the registered unit it holds, so deleting the pack does not break the offer
+CREATE TABLE supplier_items(
+    id SERIAL PRIMARY KEY,
+    supplier_id INT NOT NULL REFERENCES suppliers(supplier_id) ON DELETE CASCADE,
+    inventory_id INT NOT NULL REFERENCES inventory(inventory_id) ON DELETE CASCADE,
+    pack_size DECIMAL(12,3) NOT NULL CHECK(pack_size>0),
+    pack_unit VARCHAR(50) NOT NULL,
+    pack_price DECIMAL(10,2) NOT NULL CHECK(pack_price>0),
+    UNIQUE(supplier_id, inventory_id)
+);
+
+CREATE TABLE purchase_orders(
+    po_id SERIAL PRIMARY KEY,
+    supplier_id INT NOT NULL REFERENCES suppliers(supplier_id) ON DELETE RESTRICT,
+    status purchase_order_status_enum NOT NULL DEFAULT 'draft',
+    note TEXT,
+    expected_date DATE,
+    created_by VARCHAR(100),
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    sent_at TIMESTAMPTZ,
+    received_at TIMESTAMPTZ
+);
+
+-- the pack is copied from supplier_items when the line is added, so the order keeps the agreed price
+CREATE TABLE purchase_order_lines(
+    line_id SERIAL PRIMARY KEY,
+    po_id INT NOT NULL REFERENCES purchase_orders(po_id) ON DELETE CASCADE,
+    inventory_id INT NOT NULL REFERENCES inventory(inventory_id) ON DELETE RESTRICT,
+    packs_ordered DECIMAL(10,2) NOT NULL CHECK(packs_ordered>0),
+    packs_received DECIMAL(10,2) NOT NULL DEFAULT 0 CHECK(packs_received>=0),
+    pack_size DECIMAL(12,3) NOT NULL,
+    pack_unit VARCHAR(50) NOT NULL,
+    pack_price DECIMAL(10,2) NOT NULL,
+    UNIQUE(po_id, inventory_id)
+);
+
+-- quantity is in unit, the stock unit of the item when it was bought
 CREATE TABLE inventory_transactions(
     transaction_id SERIAL PRIMARY KEY,
-    inventory_id INT REFERENCES inventory(inventory_id) ON DELETE CASCADE,
+    inventory_id INT REFERENCES inventory(inventory_id) ON DELETE RESTRICT,
     price DECIMAL(10,2) NOT NULL CHECK(price>0),
-    quantity DECIMAL(10,2) NOT NULL CHECK(quantity>0),
+    quantity DECIMAL(12,3) NOT NULL CHECK(quantity>0),
+    unit VARCHAR(20) NOT NULL REFERENCES units(unit_code),
+    purchase_quantity DECIMAL(12,3),
+    purchase_unit VARCHAR(50),
+    po_line_id INT REFERENCES purchase_order_lines(line_id) ON DELETE SET NULL,
+    expiry_date DATE,
     transaction_date TIMESTAMPTZ DEFAULT NOW()
 );
 
+-- a lot is stock received at once, every purchase opens one with its expiry date;
+-- the remaining quantities of the lots of an item add up to its stock level
+CREATE TABLE inventory_lots(
+    lot_id SERIAL PRIMARY KEY,
+    inventory_id INT NOT NULL REFERENCES inventory(inventory_id) ON DELETE CASCADE,
+    transaction_id INT REFERENCES inventory_transactions(transaction_id) ON DELETE SET NULL,
+    quantity DECIMAL(12,3) NOT NULL CHECK(quantity>0),
+    remaining DECIMAL(12,3) NOT NULL CHECK(remaining>=0),
+    expiry_date DATE,
+    received_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+CREATE TABLE inventory_reservations(
+    reservation_id SERIAL PRIMARY KEY,
+    order_id INT REFERENCES orders(order_id) ON DELETE CASCADE,
+    inventory_id INT REFERENCES inventory(inventory_id) ON DELETE CASCADE,
+    quantity DECIMAL(12,3) NOT NULL CHECK(quantity>0),
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    UNIQUE(order_id, inventory_id)
+);
+
+-- every change of inventory.stock_level is one row here, quantity and balance_after are signed and in unit,
+-- the stock unit when the movement was made, so the sum of the movements converted to the stock unit equals its stock level
+CREATE TABLE stock_movements(
+    movement_id SERIAL PRIMARY KEY,
+    inventory_id INT NOT NULL REFERENCES inventory(inventory_id) ON DELETE CASCADE,
+    movement_type stock_movement_enum NOT NULL,
+    quantity DECIMAL(12,3) NOT NULL CHECK(quantity<>0),
+    balance_after DECIMAL(12,3) NOT NULL,
+    unit VARCHAR(20) NOT NULL REFERENCES units(unit_code),
+    order_id INT REFERENCES orders(order_id) ON DELETE SET NULL,
+    transaction_id INT REFERENCES inventory_transactions(transaction_id) ON DELETE SET NULL,
+    lot_id INT REFERENCES inventory_lots(lot_id) ON DELETE SET NULL,
+    reason TEXT,
+    created_by VARCHAR(100),
+    created_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+-- one row per wasted inventory item, a wasted menu item gives a row per ingredient of its recipe;
+-- quantity and unit_cost are in unit, the stock unit at the time of the waste, unit_cost is the weighted average cost then,
+-- an expired lot that is written off keeps the cost it was bought at
+CREATE TABLE waste_log(
+    waste_id SERIAL PRIMARY KEY,
+    inventory_id INT NOT NULL REFERENCES inventory(inventory_id) ON DELETE CASCADE,
+    menu_item_id INT REFERENCES menu_items(menu_item_id) ON DELETE SET NULL,
+    variant_id INT REFERENCES menu_item_variants(variant_id) ON DELETE SET NULL,
+    servings DECIMAL(10,2),
+    quantity DECIMAL(12,3) NOT NULL CHECK(quantity>0),
+    unit_cost DECIMAL(12,4) NOT NULL DEFAULT 0,
+    unit VARCHAR(20) NOT NULL REFERENCES units(unit_code),
+    reason waste_reason_enum NOT NULL,
+    note TEXT,
+    created_by VARCHAR(100),
+    created_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+-- a count session, counted lines can be changed while it is open and become count adjustments when it is posted
+CREATE TABLE stock_counts(
+    count_id SERIAL PRIMARY KEY,
+    status stock_count_status_enum NOT NULL DEFAULT 'open',
+    note TEXT,
+    opened_by VARCHAR(100),
+    opened_at TIMESTAMPTZ DEFAULT NOW(),
+    posted_by VARCHAR(100),
+    posted_at TIMESTAMPTZ
+);
+
+-- counted_quantity is in unit, the stock unit when the line was counted, expected_quantity and unit_cost are kept
+-- in it when the count is posted
+CREATE TABLE stock_count_lines(
+    line_id SERIAL PRIMARY KEY,
+    count_id INT NOT NULL REFERENCES stock_counts(count_id) ON DELETE CASCADE,
+    inventory_id INT NOT NULL REFERENCES inventory(inventory_id) ON DELETE CASCADE,
+    counted_quantity DECIMAL(12,3) NOT NULL CHECK(counted_quantity>=0),
+    unit VARCHAR(20) NOT NULL REFERENCES units(unit_code),
+    expected_quantity DECIMAL(12,3),
+    unit_cost DECIMAL(12,4),
+    counted_at TIMESTAMPTZ DEFAULT NOW(),
+    UNIQUE(count_id, inventory_id)
+);
+
 CREATE TABLE order_status_history(
     id SERIAL PRIMARY KEY,
     order_id INT REFERENCES orders(order_id) ON DELETE CASCADE,
     status order_status_enum NOT NULL,
+    reason TEXT,
     changed_at TIMESTAMPTZ DEFAULT NOW()
 );
 
+CREATE TABLE order_refunds(
+    refund_id SERIAL PRIMARY KEY,
+    order_id INT REFERENCES orders(order_id) ON DELETE CASCADE,
+    reason TEXT NOT NULL,
+    amount DECIMAL(10,2) NOT NULL CHECK(amount<=0),
+    created_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+CREATE TABLE order_refund_items(
+    id SERIAL PRIMARY KEY,
+    refund_id INT REFERENCES order_refunds(refund_id) ON DELETE CASCADE,
+    order_item_id INT REFERENCES order_items(order_item_id) ON DELETE CASCADE,
+    quantity INT NOT NULL CHECK(quantity>0),
+    amount DECIMAL(10,2) NOT NULL CHECK(amount<=0)
+);
+
+-- variant_id is empty for the price of the menu item itself
 CREATE TABLE price_history (
     id SERIAL PRIMARY KEY,
     menu_item_id INT REFERENCES menu_items(menu_item_id) ON DELETE CASCADE,
+    variant_id INT REFERENCES menu_item_variants(variant_id) ON DELETE CASCADE,
     old_price DECIMAL(10,2) CHECK(old_price>0),
     new_price DECIMAL(10,2) CHECK(new_price>0),
     changed_at TIMESTAMPTZ DEFAULT NOW()
 );
 
+-- a single row, points are earned per currency unit paid for a closed order and are worth point_value when redeemed;
+-- earned points expire after expiry_days, they never expire when it is empty
+CREATE TABLE loyalty_settings(
+    settings_id INT PRIMARY KEY DEFAULT 1 CHECK(settings_id=1),
+    points_per_unit DECIMAL(10,2) NOT NULL DEFAULT 1 CHECK(points_per_unit>=0),
+    point_value DECIMAL(10,4) NOT NULL DEFAULT 0.01 CHECK(point_value>0),
+    expiry_days INT CHECK(expiry_days>0),
+    enabled BOOLEAN NOT NULL DEFAULT TRUE
+);
+
+-- a line of a menu item with the tag earns multiplier times the points, the highest multiplier of its tags applies
+CREATE TABLE loyalty_tag_multipliers(
+    tag VARCHAR(50) PRIMARY KEY,
+    multiplier DECIMAL(5,2) NOT NULL CHECK(multiplier>0)
+);
+
+-- a reward gives one serving of the menu item for free
+CREATE TABLE loyalty_rewards(
+    reward_id SERIAL PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    menu_item_id INT NOT NULL REFERENCES menu_items(menu_item_id) ON DELETE CASCADE,
+    points INT NOT NULL CHECK(points>0),
+    active BOOLEAN NOT NULL DEFAULT TRUE
+);
+
+-- the points ledger, points are signed and add up to the balance of the customer;
+-- remaining is what is left of earned or restored points, spent, expired and reversed points are taken from it oldest first,
+-- so the remaining points of a customer add up to the balance too
+CREATE TABLE loyalty_ledger(
+    entry_id SERIAL PRIMARY KEY,
+    customer_id INT NOT NULL REFERENCES customers(customer_id) ON DELETE CASCADE,
+    order_id INT REFERENCES orders(order_id) ON DELETE SET NULL,
+    entry_type loyalty_entry_enum NOT NULL,
+    points INT NOT NULL CHECK(points<>0),
+    remaining INT NOT NULL DEFAULT 0 CHECK(remaining>=0),
+    expires_at TIMESTAMPTZ,
+    note TEXT,
+    created_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+-- a promotion takes its effect off the order lines it matches, lines of the menu items or tags, every line without them;
+-- it applies while every condition holds: the dates, the days of the week (ISO, 1 is Monday), the time of day
+-- (the window may pass midnight), the customer, the spend of the order and the promo code.
+-- value is the percent off, the amount off or the bundle price; a free item gives free_quantity units for every
+-- buy_quantity bought, a bundle sells buy_quantity units for value. Higher priority is applied first,
+-- a line takes one promotion only
+CREATE TABLE promotions(
+    promotion_id SERIAL PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    code VARCHAR(50),
+    effect promotion_effect_enum NOT NULL,
+    value DECIMAL(10,2) NOT NULL DEFAULT 0 CHECK(value>=0),
+    buy_quantity INT NOT NULL DEFAULT 0 CHECK(buy_quantity>=0),
+    free_quantity INT NOT NULL DEFAULT 0 CHECK(free_quantity>=0),
+    menu_item_ids INT[] NOT NULL DEFAULT '{}',
+    tags TEXT[] NOT NULL DEFAULT '{}',
+    customer_id INT REFERENCES customers(customer_id) ON DELETE CASCADE,
+    min_spend DECIMAL(10,2) NOT NULL DEFAULT 0 CHECK(min_spend>=0),
+    days_of_week INT[] NOT NULL DEFAULT '{}',
+    start_time TIME,
+    end_time TIME,
+    starts_at TIMESTAMPTZ,
+    ends_at TIMESTAMPTZ,
+    priority INT NOT NULL DEFAULT 0,
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    CHECK((start_time IS NULL) = (end_time IS NULL)),
+    CHECK(ends_at IS NULL OR starts_at IS NULL OR ends_at>starts_at)
+);
+
+-- discounts taken off the total amount of an order, a discount of a line has its order_item_id;
+-- points are the loyalty points the discount was redeemed for
+CREATE TABLE order_discounts(
+    discount_id SERIAL PRIMARY KEY,
+    order_id INT NOT NULL REFERENCES orders(order_id) ON DELETE CASCADE,
+    order_item_id INT REFERENCES order_items(order_item_id) ON DELETE CASCADE,
+    source discount_source_enum NOT NULL,
+    reward_id INT REFERENCES loyalty_rewards(reward_id) ON DELETE SET NULL,
+    promotion_id INT REFERENCES promotions(promotion_id) ON DELETE SET NULL,
+    description TEXT NOT NULL,
+    amount DECIMAL(10,2) NOT NULL CHECK(amount<0),
+    points INT NOT NULL DEFAULT 0 CHECK(points>=0)
+);
+
+CREATE TABLE idempotency_keys(
+    idempotency_key VARCHAR(255) NOT NULL,
+    endpoint VARCHAR(255) NOT NULL,
+    request_hash CHAR(64) NOT NULL,
+    status_code INT,
+    response_headers JSONB,
+    response_body BYTEA,
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    PRIMARY KEY(idempotency_key, endpoint)
+);
+
+-- converts a quantity given in a registered unit to the stock unit of the inventory item,
+-- the unit is expected to share the dimension of the stock unit, an empty unit means the stock unit itself
+CREATE FUNCTION to_stock_unit(NUMERIC, VARCHAR, INT) RETURNS NUMERIC AS $$
+    SELECT $1 * u.to_base / s.to_base
+    FROM inventory i
+    INNER JOIN units s ON s.unit_code = i.unit_type
+    INNER JOIN units u ON u.unit_code = COALESCE(NULLIF($2, ''), i.unit_type)
+    WHERE i.inventory_id = $3
+$$ LANGUAGE SQL STABLE;
+
 -- orders
 CREATE INDEX idx_orders_status ON orders(status);
 CREATE INDEX idx_orders_order_date ON orders(order_date);
+CREATE INDEX idx_orders_customer_id ON orders(customer_id, order_date);
 
 -- customers
 CREATE INDEX idx_customers_email ON customers(email);
@@ -93,15 +449,71 @@ CREATE INDEX idx_menu_items_tags ON menu_items USING GIN (tags);
 -- inventory
 CREATE INDEX idx_inventory_name ON inventory(name);
 CREATE INDEX idx_inventory_stock_level ON inventory(stock_level);
+CREATE INDEX idx_inventory_pack_units_inventory_id ON inventory_pack_units(inventory_id);
+
+-- variants
+CREATE INDEX idx_menu_item_variants_menu_item_id ON menu_item_variants(menu_item_id);
+CREATE INDEX idx_variant_ingredients_variant_id ON variant_ingredients(variant_id);
+CREATE INDEX idx_order_items_variant_id ON order_items(variant_id);
+
+-- modifiers
+CREATE INDEX idx_modifier_groups_menu_item_id ON modifier_groups(menu_item_id);
+CREATE INDEX idx_modifier_options_group_id ON modifier_options(group_id);
+CREATE INDEX idx_modifier_option_ingredients_option_id ON modifier_option_ingredients(option_id);
+CREATE INDEX idx_order_item_modifiers_order_item_id ON order_item_modifiers(order_item_id);
+
+-- suppliers and purchase orders
+CREATE INDEX idx_supplier_items_inventory_id ON supplier_items(inventory_id);
+CREATE INDEX idx_purchase_orders_supplier_id ON purchase_orders(supplier_id);
+CREATE INDEX idx_purchase_orders_status ON purchase_orders(status);
+CREATE INDEX idx_purchase_order_lines_po_id ON purchase_order_lines(po_id);
 
 -- inventory_transactions
 CREATE INDEX idx_inventory_transactions_inventory_id ON inventory_transactions(inventory_id);
 CREATE INDEX idx_inventory_transactions_date ON inventory_transactions(transaction_date);
 
+-- inventory_lots
+CREATE INDEX idx_inventory_lots_inventory_id ON inventory_lots(inventory_id) WHERE remaining > 0;
+CREATE INDEX idx_inventory_lots_expiry_date ON inventory_lots(expiry_date) WHERE remaining > 0;
+
+-- inventory_reservations
+CREATE INDEX idx_inventory_reservations_inventory_id ON inventory_reservations(inventory_id);
+
+-- stock_movements
+CREATE INDEX idx_stock_movements_inventory_id ON stock_movements(inventory_id, created_at);
+CREATE INDEX idx_stock_movements_order_id ON stock_movements(order_id);
+
+-- waste_log
+CREATE INDEX idx_waste_log_created_at ON waste_log(created_at);
+CREATE INDEX idx_waste_log_inventory_id ON waste_log(inventory_id);
+
+-- stock_counts
+CREATE UNIQUE INDEX idx_stock_counts_one_open ON stock_counts(status) WHERE status = 'open';
+CREATE INDEX idx_stock_count_lines_count_id ON stock_count_lines(count_id);
+
 -- order_status_history
 CREATE INDEX idx_order_status_history_order_id ON order_status_history(order_id);
 CREATE INDEX idx_order_status_history_composite ON order_status_history(order_id, changed_at);
 
+-- order_refunds
+CREATE INDEX idx_order_refunds_order_id ON order_refunds(order_id);
+CREATE INDEX idx_order_refund_items_order_item_id ON order_refund_items(order_item_id);
+
+-- loyalty
+CREATE INDEX idx_loyalty_ledger_customer_id ON loyalty_ledger(customer_id, created_at);
+CREATE INDEX idx_loyalty_ledger_order_id ON loyalty_ledger(order_id);
+CREATE INDEX idx_loyalty_ledger_expires_at ON loyalty_ledger(expires_at) WHERE remaining > 0;
+CREATE INDEX idx_order_discounts_order_id ON order_discounts(order_id);
+CREATE INDEX idx_order_discounts_order_item_id ON order_discounts(order_item_id);
+
+-- promotions
+CREATE UNIQUE INDEX idx_promotions_code ON promotions(LOWER(code));
+CREATE INDEX idx_promotions_active ON promotions(priority DESC) WHERE active;
+CREATE INDEX idx_order_discounts_promotion_id ON order_discounts(promotion_id);
+
+-- idempotency_keys
+CREATE INDEX idx_idempotency_keys_created_at ON idempotency_keys(created_at);
+
 -- price_history
 CREATE INDEX idx_price_history_menu_item_id ON price_history(menu_item_id);
 CREATE INDEX idx_price_history_changed_at ON price_history(changed_at);
@@ -223,57 +635,141 @@ VALUES
     (9, 29, '{"spread": "cream cheese"}', 2.00, 2),
     (10, 30, '{"topping": "extra cinnamon"}', 2.50, 1);
 
-INSERT INTO inventory (name, stock_level, unit_type, reorder_level) 
+INSERT INTO units (unit_code, name, dimension, to_base)
 VALUES
-    ('Espresso Beans', 50000.00, 'kg', 10.00),
-    ('Milk', 30000.00, 'liters', 5.00),
-    ('Sugar', 100000.00, 'kg', 20.00),
-    ('Flavored Syrup', 25000.00, 'liters', 5.00),
-    ('Cinnamon', 5000.00, 'kg', 1.00),
-    ('Caramel Syrup', 15000.00, 'liters', 3.00),
-    ('Butter', 10000.00, 'kg', 2.00),
-    ('Cream Cheese', 20000.00, 'kg', 4.00),
-    ('Bagels', 6000.00, 'pieces', 10.00),
-    ('Muffins', 4000.00, 'pieces', 8.00),
-    ('Cold Brew Coffee', 35000.00, 'liters', 7.00),
-    ('Iced Coffee', 4000.00, 'liters', 6.00),
-    ('Macchiato Syrup', 1000.00, 'liters', 2.00),
-    ('Milk Foam', 2500.00, 'liters', 4.00),
-    ('Vanilla Syrup', 1200.00, 'liters', 2.00),
-    ('Coffee Cups', 5000.00, 'pieces', 50.00),
-    ('Straws', 10000.00, 'pieces', 100.00),
-    ('Coffee Filters', 2000.00, 'pieces', 20.00),
-    ('Napkins', 100000.00, 'pieces', 100.00);
-
-INSERT INTO menu_item_ingredients (inventory_id, menu_item_id, quantity)
+    ('mg', 'milligram', 'mass', 0.001),
+    ('g', 'gram', 'mass', 1),
+    ('kg', 'kilogram', 'mass', 1000),
+    ('oz', 'ounce', 'mass', 28.349523),
+    ('lb', 'pound', 'mass', 453.59237),
+    ('ml', 'millilitre', 'volume', 1),
+    ('cl', 'centilitre', 'volume', 10),
+    ('l', 'litre', 'volume', 1000),
+    ('fl_oz', 'fluid ounce', 'volume', 29.573530),
+    ('pcs', 'piece', 'count', 1),
+    ('dozen', 'dozen', 'count', 12);
+
+INSERT INTO inventory (name, stock_level, unit_type, reorder_level, par_level, category)
 VALUES
-    (1, 1, 10), 
-    (1, 2, 8), 
-    (14, 2, 10), 
-    (1, 3, 8),  
-    (2, 3, 15), 
-    (1, 4, 10), 
-    (1, 5, 8), 
-    (14, 5, 5),  
-    (1, 6, 8), 
-    (2, 6, 10), 
-    (1, 7, 8), 
-    (6, 7, 5), 
-    (1, 8, 8),
-    (9, 9, 1),  
-    (8, 9, 2), 
-    (10, 10, 1), 
-    (3, 10, 1); 
-
-
-INSERT INTO inventory_transactions (inventory_id, price, quantity, transaction_date) 
+    ('Espresso Beans', 50.000, 'kg', 10.00, 30.00, 'coffee'),
+    ('Milk', 30.000, 'l', 5.00, 15.00, 'dairy'),
+    ('Sugar', 100.000, 'kg', 20.00, 60.00, 'pantry'),
+    ('Flavored Syrup', 25.000, 'l', 5.00, 15.00, 'syrups'),
+    ('Cinnamon', 5.000, 'kg', 1.00, 3.00, 'pantry'),
+    ('Caramel Syrup', 15.000, 'l', 3.00, 9.00, 'syrups'),
+    ('Butter', 10.000, 'kg', 2.00, 6.00, 'dairy'),
+    ('Cream Cheese', 20.000, 'kg', 4.00, 12.00, 'dairy'),
+    ('Bagels', 6000.00, 'pcs', 10.00, 30.00, 'bakery'),
+    ('Muffins', 4000.00, 'pcs', 8.00, 24.00, 'bakery'),
+    ('Cold Brew Coffee', 35.000, 'l', 7.00, 21.00, 'coffee'),
+    ('Iced Coffee', 4.000, 'l', 6.00, 18.00, 'coffee'),
+    ('Macchiato Syrup', 1.000, 'l', 2.00, 6.00, 'syrups'),
+    ('Milk Foam', 2.500, 'l', 4.00, 12.00, 'dairy'),
+    ('Vanilla Syrup', 1.200, 'l', 2.00, 6.00, 'syrups'),
+    ('Coffee Cups', 5000.00, 'pcs', 50.00, 150.00, 'packaging'),
+    ('Straws', 10000.00, 'pcs', 100.00, 300.00, 'packaging'),
+    ('Coffee Filters', 2000.00, 'pcs', 20.00, 60.00, 'packaging'),
+    ('Napkins', 100000.00, 'pcs', 100.00, 300.00, 'packaging'),
+    ('Oat Milk', 8.000, 'l', 2.00, 6.00, 'dairy');
+
+INSERT INTO inventory_pack_units (inventory_id, name, quantity, unit_code)
 VALUES
+    (1, 'bag', 1, 'kg'),
+    (2, 'case', 12, 'l'),
+    (10, 'case', 24, 'pcs'),
+    (16, 'sleeve', 50, 'pcs'),
+    (20, 'carton', 1, 'l');
+
+INSERT INTO menu_item_ingredients (inventory_id, menu_item_id, quantity, unit)
+VALUES
+    (1, 1, 18, 'g'),
+    (1, 2, 8, 'g'),
+    (14, 2, 10, 'ml'),
+    (1, 3, 8, 'g'),
+    (2, 3, 15, 'ml'),
+    (1, 4, 10, 'g'),
+    (1, 5, 8, 'g'),
+    (14, 5, 5, 'ml'),
+    (1, 6, 8, 'g'),
+    (2, 6, 10, 'ml'),
+    (1, 7, 8, 'g'),
+    (6, 7, 5, 'ml'),
+    (1, 8, 8, 'g'),
+    (9, 9, 1, 'pcs'),
+    (8, 9, 2, 'g'),
+    (10, 10, 1, 'pcs'),
+    (3, 10, 1, 'g'); 
+
+INSERT INTO menu_item_variants (menu_item_id, name, price)
+VALUES
+    (2, 'Small', 2.70),
+    (2, 'Medium', 3.00),
+    (2, 'Large', 3.50),
+    (8, 'Medium', 3.50),
+    (8, 'Large', 4.20);
+
+INSERT INTO variant_ingredients (variant_id, inventory_id, quantity, unit)
+VALUES
+    (1, 1, 8, 'g'),
+    (1, 14, 7, 'ml'),
+    (2, 1, 8, 'g'),
+    (2, 14, 10, 'ml'),
+    (3, 1, 16, 'g'),
+    (3, 14, 14, 'ml'),
+    (4, 1, 8, 'g'),
+    (5, 1, 12, 'g');
+
+INSERT INTO modifier_groups (menu_item_id, name, min_select, max_select)
+VALUES
+    (3, 'Size', 1, 1),
+    (3, 'Milk', 0, 1),
+    (3, 'Extras', 0, 3),
+    (2, 'Extras', 0, 2);
+
+INSERT INTO modifier_options (group_id, name, price_delta)
+VALUES
+    (1, 'Regular', 0.00),
+    (1, 'Large', 0.70),
+    (2, 'Oat milk', 0.60),
+    (3, 'Extra shot', 0.80),
+    (3, 'Vanilla syrup', 0.50),
+    (3, 'Caramel syrup', 0.50),
+    (4, 'Extra shot', 0.80),
+    (4, 'Extra foam', 0.00);
+
+INSERT INTO modifier_option_ingredients (option_id, inventory_id, quantity, unit)
+VALUES
+    (2, 1, 4, 'g'),
+    (2, 2, 5, 'ml'),
+    (3, 2, -15, 'ml'),
+    (3, 20, 15, 'ml'),
+    (4, 1, 8, 'g'),
+    (5, 15, 5, 'ml'),
+    (6, 6, 5, 'ml'),
+    (7, 1, 8, 'g'),
+    (8, 14, 5, 'ml');
+
+
+-- active orders hold the ingredients they need until they are closed or cancelled
+INSERT INTO inventory_reservations (order_id, inventory_id, quantity)
+SELECT oi.order_id, mii.inventory_id, SUM(to_stock_unit(mii.quantity, mii.unit, mii.inventory_id) * oi.quantity)
+FROM order_items oi
+INNER JOIN orders o ON o.order_id = oi.order_id
+INNER JOIN menu_item_ingredients mii ON mii.menu_item_id = oi.menu_item_id
+WHERE o.status = 'active'
+GROUP BY oi.order_id, mii.inventory_id;
+
+INSERT INTO inventory_transactions (inventory_id, price, quantity, unit, transaction_date)
+SELECT t.inventory_id, t.price, t.quantity, i.unit_type, t.transaction_date::timestamptz
+FROM (VALUES
     (1, 2.50, 5.00, '2024-12-01'),
     (2, 3.00, 10.00, '2024-12-01'),
     (3, 1.00, 50.00, '2024-12-02'),
     (4, 2.00, 15.00, '2024-12-03'),
     (5, 3.00, 20.00, '2024-12-04'),
-    (6, 4.00, 30.00, '2024-12-05');
+    (6, 4.00, 30.00, '2024-12-05')
+) t(inventory_id, price, quantity, transaction_date)
+INNER JOIN inventory i USING(inventory_id);
 
 INSERT INTO order_status_history (order_id, status, changed_at) 
 VALUES
@@ -333,4 +829,76 @@ VALUES
     (3, 3.50, 3.60, '2024-08-01'),
     (4, 2.75, 3.00, '2024-09-01'),
     (5, 2.85, 3.00, '2024-10-01'),
-    (6, 3.00, 3.20, '2024-11-01');
\ No newline at end of file
+    (6, 3.00, 3.20, '2024-11-01');
+
+INSERT INTO price_history (menu_item_id, variant_id, old_price, new_price, changed_at) 
+VALUES
+    (2, 3, 3.30, 3.50, '2024-11-15');
+
+INSERT INTO suppliers (name, contact_name, email, phone, lead_time_days)
+VALUES
+    ('Bean Roasters Co', 'Aigerim S.', 'orders@beanroasters.example', '+77010000001', 3),
+    ('Dairy Fresh', 'Marat K.', 'sales@dairyfresh.example', '+77010000002', 1),
+    ('Cafe Supply House', 'Dana T.', 'hello@cafesupply.example', '+77010000003', 5);
+
+INSERT INTO supplier_items (supplier_id, inventory_id, pack_size, pack_unit, pack_price)
+VALUES
+    (1, 1, 1, 'kg', 28.00),
+    (1, 11, 5, 'l', 22.50),
+    (2, 2, 12, 'l', 14.40),
+    (2, 7, 1, 'kg', 9.50),
+    (2, 8, 2, 'kg', 15.00),
+    (2, 20, 1, 'l', 2.40),
+    (3, 3, 25, 'kg', 21.00),
+    (3, 4, 1, 'l', 8.00),
+    (3, 16, 50, 'pcs', 4.50),
+    (3, 17, 500, 'pcs', 6.00),
+    (3, 19, 1000, 'pcs', 7.50);
+
+-- the seeded stock levels are the opening balances of the ledger
+INSERT INTO stock_movements (inventory_id, movement_type, quantity, balance_after, unit, reason, created_by)
+SELECT inventory_id, 'count_adjustment', stock_level, stock_level, unit_type, 'opening balance', 'system'
+FROM inventory
+WHERE stock_level <> 0;
+
+-- and the opening lots, the fresh items have an expiry date
+INSERT INTO inventory_lots (inventory_id, quantity, remaining, expiry_date)
+SELECT inventory_id, stock_level, stock_level,
+    CASE name
+        WHEN 'Milk' THEN CURRENT_DATE + 5
+        WHEN 'Oat Milk' THEN CURRENT_DATE + 2
+        WHEN 'Cream Cheese' THEN CURRENT_DATE + 10
+        WHEN 'Bagels' THEN CURRENT_DATE + 1
+        WHEN 'Muffins' THEN CURRENT_DATE + 1
+    END
+FROM inventory
+WHERE stock_level > 0;
+
+INSERT INTO loyalty_settings (points_per_unit, point_value, expiry_days)
+VALUES (10, 0.01, 365);
+
+INSERT INTO loyalty_tag_multipliers (tag, multiplier)
+VALUES
+    ('breakfast', 2),
+    ('cold', 1.5);
+
+INSERT INTO loyalty_rewards (name, menu_item_id, points)
+SELECT 'Free ' || name, menu_item_id, CEIL(price * 100 / 50) * 50
+FROM menu_items
+WHERE name IN ('Espresso', 'Latte', 'Muffin');
+
+INSERT INTO promotions (name, effect, value, tags, start_time, end_time, priority)
+VALUES ('Morning pastries 10% off', 'percent_off', 10, ARRAY['food'], '06:00', '10:00', 10);
+
+INSERT INTO promotions (name, effect, buy_quantity, free_quantity, menu_item_ids, priority)
+SELECT 'Muffins 3 for 2', 'free_item', 2, 1, ARRAY[menu_item_id], 20
+FROM menu_items
+WHERE name = 'Muffin';
+
+INSERT INTO promotions (name, effect, value, buy_quantity, menu_item_ids, days_of_week, priority)
+SELECT 'Two lattes for 6 on weekdays', 'bundle_price', 6, 2, ARRAY[menu_item_id], ARRAY[1,2,3,4,5], 20
+FROM menu_items
+WHERE name = 'Latte';
+
+INSERT INTO promotions (name, code, effect, value, min_spend)
+VALUES ('Welcome 5 off', 'WELCOME5', 'amount_off', 5, 15);
@@ -3,27 +3,59 @@ package dal
 import (
 	//"encoding/json"
 	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
 
-	//"errors"
 	"frappuccino/models"
 	//"io"
 	//"os"
+
+	"github.com/lib/pq"
 )
 
+// ErrNotEnoughInventory is returned when a deduction would take the stock level below zero
+var ErrNotEnoughInventory = errors.New("not enough inventory")
+
 type InventRepo interface {
 	Get_AllInventory() ([]models.InventoryItem, error)
 	GetInventory(id int) (models.InventoryItem, error)
-	Use_Inventory(need_inventory map[string]float64) error
-	Save_Inventory(inventory models.InventoryItem) error
+	Use_Inventory(tx *sql.Tx, order_id int, need_inventory map[string]float64) error
+	GetStockLevels(q DBTX, ids []string) (map[string]float64, error)
+	ReserveInventory(tx *sql.Tx, order_id int, need_inventory map[string]float64) error
+	ReleaseReservation(tx *sql.Tx, order_id int) error
+	Save_Inventory(inventory models.InventoryItem, user string) (int, error)
 	IsInventExist(id int) (bool, error)
+	IsInventArchived(id int) (bool, error)
 	IsInventUnique(name string) (bool, error)
 	CheckReordering() ([]models.InventoryItem, error)
-	Update_Inventory(inventory models.InventoryItem) error
-	Delete_Inventory(id int) error
+	Update_Inventory(inventory models.InventoryItem, user string) error
+	Archive_Inventory(id int) error
+	Purge_Inventory(id int) error
 	IsInventTransactionExist(id int) (bool, error)
 	GetAllInventoryTransactions() ([]models.InventoryTransaction, error)
 	GetInventoryTransaction(inventory_id int) ([]models.InventoryTransaction, error)
-	FillInventory(transaction models.InventoryTransaction) error
+	FillInventory(transaction models.InventoryTransaction, user string) error
+	ApplyStockMovement(tx *sql.Tx, movement models.StockMovement) error
+	GetStockMovements(inventory_id int, from, to string) ([]models.StockMovement, error)
+	TransferStock(inventory_id int, transfer models.TransferRequest, user string) (models.StockMovement, error)
+	GetStockDiscrepancies() ([]models.StockDiscrepancy, error)
+	ReconcileStock() ([]models.StockDiscrepancy, error)
+	IsWasteMenuItemExist(menu_item_id, variant_id int) (bool, error)
+	SaveWaste(waste models.WasteRequest, user string) ([]models.WasteEntry, error)
+	GetUnitDimension(code string) (string, error)
+	GetStockDimension(inventory_id int) (string, error)
+	GetPackUnits(inventory_id int) ([]models.PackUnit, error)
+	IsPackUnitExist(inventory_id, pack_id int) (bool, error)
+	SavePackUnit(pack models.PackUnit) (int, error)
+	DeletePackUnit(pack_id int) error
+	GetReorderSuggestions(days int) ([]models.ReorderSuggestion, error)
+	CreateReorderDrafts(days int, user string) (models.ReorderDrafts, error)
+	GetLots(inventory_id int) ([]models.InventoryLot, error)
+	GetExpiringLots(within int) ([]models.InventoryLot, error)
+	WriteOffExpiredLots(user string) ([]models.WasteEntry, error)
 }
 
 type NewInventRepo struct {
@@ -34,9 +66,14 @@ func DefaultInventRepo(db *sql.DB) *NewInventRepo {
 	return &NewInventRepo{DB: db}
 }
 
-// Gets information about all inventory from Database
+// Gets information about all inventory from Database, archived items are skipped
 func (repo *NewInventRepo) Get_AllInventory() ([]models.InventoryItem, error) {
-	rows, err := repo.DB.Query("SELECT inventory_id, name, stock_level,unit_type,last_updated,reorder_level FROM inventory")
+	rows, err := repo.DB.Query(`SELECT inventory_id, name, stock_level, COALESCE(r.reserved, 0), unit_type, last_updated, reorder_level,
+	COALESCE(par_level, 0), COALESCE(category, '')
+	FROM inventory
+	LEFT JOIN (SELECT inventory_id, SUM(quantity) AS reserved FROM inventory_reservations GROUP BY inventory_id) r USING(inventory_id)
+	WHERE archived_at IS NULL
+	ORDER BY inventory_id`)
 	if err != nil {
 		return nil, err
 	}
@@ -45,9 +82,10 @@ func (repo *NewInventRepo) Get_AllInventory() ([]models.InventoryItem, error) {
 	var items []models.InventoryItem
 	for rows.Next() {
 		var item models.InventoryItem
-		if err := rows.Scan(&item.ID, &item.Name, &item.StockLevel, &item.UnitType, &item.LastUpdated, &item.ReorderLevel); err != nil {
+		if err := rows.Scan(&item.ID, &item.Name, &item.StockLevel, &item.Reserved, &item.UnitType, &item.LastUpdated, &item.ReorderLevel, &item.ParLevel, &item.Category); err != nil {
 			return nil, err
 		}
+		item.Available = item.StockLevel - item.Reserved
 		items = append(items, item)
 	}
 	if err := rows.Err(); err != nil {
@@ -59,51 +97,229 @@ func (repo *NewInventRepo) Get_AllInventory() ([]models.InventoryItem, error) {
 // Get information about Inventory from database
 func (repo *NewInventRepo) GetInventory(id int) (models.InventoryItem, error) {
 	var item models.InventoryItem
-	err := repo.DB.QueryRow(`SELECT inventory_id, name, stock_level,unit_type,last_updated,reorder_level 
-	FROM inventory
+	err := repo.DB.QueryRow(`SELECT inventory_id, name, stock_level,
+	COALESCE((SELECT SUM(quantity) FROM inventory_reservations r WHERE r.inventory_id = i.inventory_id), 0),
+	unit_type, last_updated, reorder_level, COALESCE(par_level, 0), COALESCE(category, ''), archived_at
+	FROM inventory i
 	WHERE inventory_id=$1
-	`, id).Scan(&item.ID, &item.Name, &item.StockLevel, &item.UnitType, &item.LastUpdated, &item.ReorderLevel)
+	`, id).Scan(&item.ID, &item.Name, &item.StockLevel, &item.Reserved, &item.UnitType, &item.LastUpdated, &item.ReorderLevel, &item.ParLevel,
+		&item.Category, &item.ArchivedAt)
 	if err != nil {
 		return item, err
 	}
+	item.Available = item.StockLevel - item.Reserved
 	return item, nil
 }
 
-// Changes the quantity of inventory based on the required ingredients
-func (repo *NewInventRepo) Use_Inventory(need_inventory map[string]float64) error {
-	tx, err := repo.DB.Begin() // Start a transaction
-	if err != nil {
+// Changes the quantity of inventory based on the required ingredients within the given transaction,
+// each deduction is recorded as sale usage of the order.
+// The inventory rows stay locked until the transaction ends, so concurrent deductions cannot both pass the stock check.
+// Stock reserved by open orders is not available, release the reservation of the consuming order first.
+func (repo *NewInventRepo) Use_Inventory(tx *sql.Tx, order_id int, need_inventory map[string]float64) error {
+	ids := sortedInventoryIDs(need_inventory)
+	if err := checkAvailable(tx, ids, need_inventory); err != nil {
 		return err
 	}
+	return applyOrderMovements(tx, order_id, models.MovementSaleUsage, -1, need_inventory)
+}
 
-	for ingredientID, quantity := range need_inventory {
-		_, err := tx.Exec(
-			"UPDATE inventory SET stock_level = stock_level - $1 WHERE inventory_id = $2 AND stock_level >= $3",
-			quantity, ingredientID, quantity,
-		)
-		if err != nil {
-			tx.Rollback()
-			return err
+// Reserves the ingredients needed by the order, so other orders cannot take them before it is closed.
+// Quantities are added to what the order already holds, negative quantities give part of the reservation back
+func (repo *NewInventRepo) ReserveInventory(tx *sql.Tx, order_id int, need_inventory map[string]float64) error {
+	ids := sortedInventoryIDs(need_inventory)
+	var increased []string
+	for _, ingredientID := range ids {
+		if need_inventory[ingredientID] > 0 {
+			increased = append(increased, ingredientID)
+		}
+	}
+	if err := checkAvailable(tx, increased, need_inventory); err != nil {
+		return err
+	}
+	for _, ingredientID := range ids {
+		quantity := need_inventory[ingredientID]
+		if quantity > 0 {
+			_, err := tx.Exec(`INSERT INTO inventory_reservations (order_id, inventory_id, quantity)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (order_id, inventory_id) DO UPDATE
+			SET quantity = inventory_reservations.quantity + EXCLUDED.quantity
+			`, order_id, ingredientID, quantity)
+			if err != nil {
+				return err
+			}
+		} else if quantity < 0 {
+			// A reservation that would drop to zero or below is removed instead
+			_, err := tx.Exec(`DELETE FROM inventory_reservations
+			WHERE order_id=$1 AND inventory_id=$2 AND quantity + $3 <= 0
+			`, order_id, ingredientID, quantity)
+			if err != nil {
+				return err
+			}
+			_, err = tx.Exec(`UPDATE inventory_reservations
+			SET quantity = quantity + $3
+			WHERE order_id=$1 AND inventory_id=$2
+			`, order_id, ingredientID, quantity)
+			if err != nil {
+				return err
+			}
 		}
 	}
+	return nil
+}
 
-	return tx.Commit() // Commit the transaction
+// Releases everything reserved by the order
+func (repo *NewInventRepo) ReleaseReservation(tx *sql.Tx, order_id int) error {
+	_, err := tx.Exec(`DELETE FROM inventory_reservations WHERE order_id=$1`, order_id)
+	return err
 }
 
-// Inserts information about new inventory to the database
-func (repo *NewInventRepo) Save_Inventory(inventory models.InventoryItem) error {
-	tx, err := repo.DB.Begin()
+// Locks the inventory rows and checks that stock not reserved by other orders and not expired covers the need
+func checkAvailable(tx *sql.Tx, ids []string, need_inventory map[string]float64) error {
+	stockLevels, err := lockInventory(tx, ids)
 	if err != nil {
 		return err
 	}
-	_, err = tx.Exec(`INSERT INTO inventory (name, stock_level, unit_type, reorder_level)
-	VALUES ($1, $2, $3, $4)
-	`, inventory.Name, inventory.StockLevel, inventory.UnitType, inventory.ReorderLevel)
+	reserved, err := reservedQuantities(tx, ids)
 	if err != nil {
-		tx.Rollback()
 		return err
 	}
-	return tx.Commit()
+	expired, err := expiredQuantities(tx, ids)
+	if err != nil {
+		return err
+	}
+	for _, ingredientID := range ids {
+		stockLevel, ok := stockLevels[ingredientID]
+		if !ok || stockLevel-reserved[ingredientID]-expired[ingredientID] < need_inventory[ingredientID] {
+			return fmt.Errorf("%w: inventory item %s", ErrNotEnoughInventory, ingredientID)
+		}
+	}
+	return nil
+}
+
+// Gets the quantities of the inventory items reserved by open orders
+func reservedQuantities(q DBTX, ids []string) (map[string]float64, error) {
+	reserved := make(map[string]float64)
+	rows, err := q.Query(`SELECT inventory_id, SUM(quantity)
+	FROM inventory_reservations
+	WHERE inventory_id = ANY($1::int[])
+	GROUP BY inventory_id
+	`, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int
+		var quantity float64
+		if err := rows.Scan(&id, &quantity); err != nil {
+			return nil, err
+		}
+		reserved[strconv.Itoa(id)] = quantity
+	}
+	return reserved, rows.Err()
+}
+
+// Gets what is left in the expired lots of the inventory items
+func expiredQuantities(q DBTX, ids []string) (map[string]float64, error) {
+	expired := make(map[string]float64)
+	rows, err := q.Query(`SELECT inventory_id, expired
+	FROM (`+expiredLotsQuery+`) e
+	WHERE inventory_id = ANY($1::int[])
+	`, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int
+		var quantity float64
+		if err := rows.Scan(&id, &quantity); err != nil {
+			return nil, err
+		}
+		expired[strconv.Itoa(id)] = quantity
+	}
+	return expired, rows.Err()
+}
+
+// Locks the inventory rows with SELECT ... FOR UPDATE and returns their stock levels.
+// Rows are always locked in ascending inventory_id order to avoid deadlocks between concurrent transactions.
+func lockInventory(tx *sql.Tx, ids []string) (map[string]float64, error) {
+	stockLevels := make(map[string]float64)
+	rows, err := tx.Query(`SELECT inventory_id, stock_level
+	FROM inventory
+	WHERE inventory_id = ANY($1::int[])
+	ORDER BY inventory_id
+	FOR UPDATE
+	`, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int
+		var stockLevel float64
+		if err := rows.Scan(&id, &stockLevel); err != nil {
+			return nil, err
+		}
+		stockLevels[strconv.Itoa(id)] = stockLevel
+	}
+	return stockLevels, rows.Err()
+}
+
+// Returns inventory IDs of the map sorted numerically, giving every transaction the same locking order
+func sortedInventoryIDs(need_inventory map[string]float64) []string {
+	ids := make([]string, 0, len(need_inventory))
+	for ingredientID := range need_inventory {
+		ids = append(ids, ingredientID)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		a, _ := strconv.Atoi(ids[i])
+		b, _ := strconv.Atoi(ids[j])
+		return a < b
+	})
+	return ids
+}
+
+// Gets current stock levels of the given inventory items
+func (repo *NewInventRepo) GetStockLevels(q DBTX, ids []string) (map[string]float64, error) {
+	levels := make(map[string]float64)
+	for _, id := range ids {
+		var stockLevel float64
+		err := q.QueryRow(`SELECT stock_level FROM inventory WHERE inventory_id=$1`, id).Scan(&stockLevel)
+		if err != nil {
+			return nil, err
+		}
+		levels[id] = stockLevel
+	}
+	return levels, nil
+}
+
+// Puts the ingredients of refunded or returned items of the order back to inventory
+func restoreInventory(tx *sql.Tx, order_id int, need_inventory map[string]float64) error {
+	return applyOrderMovements(tx, order_id, models.MovementRefundReturn, 1, need_inventory)
+}
+
+// Inserts information about new inventory to the database, returns the new inventory ID.
+// The initial stock level is recorded as the opening balance of the item
+func (repo *NewInventRepo) Save_Inventory(inventory models.InventoryItem, user string) (int, error) {
+	var id int
+	err := WithTx(repo.DB, func(tx *sql.Tx) error {
+		err := tx.QueryRow(`INSERT INTO inventory (name, stock_level, unit_type, reorder_level, par_level, category)
+		VALUES ($1, 0, $2, $3, NULLIF($4::numeric, 0), NULLIF($5, ''))
+		RETURNING inventory_id
+		`, inventory.Name, inventory.UnitType, inventory.ReorderLevel, inventory.ParLevel, inventory.Category).Scan(&id)
+		if err != nil {
+			return err
+		}
+		return applyStockMovement(tx, models.StockMovement{
+			InventoryID: id,
+			Type:        models.MovementCountAdjustment,
+			Quantity:    inventory.StockLevel,
+			Reason:      "opening balance",
+			CreatedBy:   user,
+		})
+	})
+	return id, err
 }
 
 // Checks is inventory exist by ID
@@ -116,6 +332,16 @@ func (repo *NewInventRepo) IsInventExist(id int) (bool, error) {
 	return count != 0, nil
 }
 
+// Checks is inventory item archived, archived items can not be changed or used in new recipes
+func (repo *NewInventRepo) IsInventArchived(id int) (bool, error) {
+	var count int
+	err := repo.DB.QueryRow("SELECT COUNT(*) FROM inventory WHERE inventory_id = $1 AND archived_at IS NOT NULL", id).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+	return count != 0, nil
+}
+
 // Checks is inventory name unique from database
 func (repo *NewInventRepo) IsInventUnique(name string) (bool, error) {
 	var count int
@@ -128,7 +354,7 @@ func (repo *NewInventRepo) IsInventUnique(name string) (bool, error) {
 
 // Checks the reorder level of each inventory item in the database and returns the inventory items that need to be reordered.
 func (repo *NewInventRepo) CheckReordering() ([]models.InventoryItem, error) {
-	rows, err := repo.DB.Query("SELECT inventory_id,name,stock_level,reorder_level FROM inventory")
+	rows, err := repo.DB.Query("SELECT inventory_id,name,stock_level,reorder_level FROM inventory WHERE archived_at IS NULL")
 	if err != nil {
 		return nil, err
 	}
@@ -149,37 +375,76 @@ func (repo *NewInventRepo) CheckReordering() ([]models.InventoryItem, error) {
 	return nil, nil
 }
 
-// Updates information about inventory from database
-func (repo *NewInventRepo) Update_Inventory(inventory models.InventoryItem) error {
-	tx, err := repo.DB.Begin()
-	if err != nil {
-		return err
+// Updates information about inventory from database, a changed stock level is recorded as a count adjustment.
+// When the stock unit changes its size, the stock held in the old unit is rescaled to the new one first,
+// recorded purchases, movements, waste and counts keep the unit they were recorded in
+func (repo *NewInventRepo) Update_Inventory(inventory models.InventoryItem, user string) error {
+	return WithTx(repo.DB, func(tx *sql.Tx) error {
+		var stockLevel, factor float64
+		err := tx.QueryRow(`SELECT i.stock_level, s.to_base / u.to_base
+		FROM inventory i
+		INNER JOIN units s ON s.unit_code = i.unit_type
+		INNER JOIN units u ON u.unit_code = $2
+		WHERE i.inventory_id = $1
+		FOR UPDATE OF i
+		`, inventory.ID, inventory.UnitType).Scan(&stockLevel, &factor)
+		if err != nil {
+			return err
+		}
+		if factor != 1 {
+			if err := rescaleStock(tx, inventory.ID, factor); err != nil {
+				return err
+			}
+			stockLevel *= factor
+		}
+		_, err = tx.Exec(`UPDATE inventory
+		SET name=$1, unit_type=$2, last_updated=NOW(), reorder_level=$3, par_level=NULLIF($4::numeric, 0), category=NULLIF($5, '')
+		WHERE inventory_id=$6
+		`, inventory.Name, inventory.UnitType, inventory.ReorderLevel, inventory.ParLevel, inventory.Category, inventory.ID)
+		if err != nil {
+			return err
+		}
+		return applyStockMovement(tx, models.StockMovement{
+			InventoryID: inventory.ID,
+			Type:        models.MovementCountAdjustment,
+			Quantity:    math.Round((inventory.StockLevel-stockLevel)*1000) / 1000,
+			Reason:      "manual edit",
+			CreatedBy:   user,
+		})
+	})
+}
+
+// rescaleStock multiplies the stock held of the item, its level, reservations and lots, by the factor
+func rescaleStock(tx *sql.Tx, inventory_id int, factor float64) error {
+	queries := []string{
+		`UPDATE inventory SET stock_level = stock_level * $2 WHERE inventory_id = $1`,
+		`UPDATE inventory_reservations SET quantity = quantity * $2 WHERE inventory_id = $1`,
+		`UPDATE inventory_lots SET quantity = quantity * $2, remaining = remaining * $2 WHERE inventory_id = $1`,
 	}
-	_, err = tx.Exec(`UPDATE inventory
-	SET name=$1, stock_level=$2, unit_type=$3, last_updated=$4, reorder_level=$5
-	WHERE inventory_id=$6
-	`, inventory.Name, inventory.StockLevel, inventory.UnitType, inventory.LastUpdated, inventory.ReorderLevel, inventory.ID)
-	if err != nil {
-		tx.Rollback()
-		return err
+	for _, query := range queries {
+		if _, err := tx.Exec(query, inventory_id, factor); err != nil {
+			return err
+		}
 	}
-	return tx.Commit()
+	return nil
 }
 
-// Delete inventory information from database
-func (repo *NewInventRepo) Delete_Inventory(id int) error {
-	tx, err := repo.DB.Begin()
-	if err != nil {
-		return err
-	}
-	_, err = tx.Exec(`DELETE FROM inventory
+// Archives the inventory item, its purchases and the recipes using it stay untouched
+func (repo *NewInventRepo) Archive_Inventory(id int) error {
+	_, err := repo.DB.Exec(`UPDATE inventory
+	SET archived_at=NOW()
+	WHERE inventory_id=$1 AND archived_at IS NULL
+	`, id)
+	return err
+}
+
+// Delete inventory information from database,
+// fails with ErrStillReferenced while the item has purchases or is used in a recipe
+func (repo *NewInventRepo) Purge_Inventory(id int) error {
+	_, err := repo.DB.Exec(`DELETE FROM inventory
 	WHERE inventory_id=$1
 	`, id)
-	if err != nil {
-		tx.Rollback()
-		return err
-	}
-	return tx.Commit()
+	return referencedErr(err)
 }
 
 // Checks is inventory transaction exists by ID from database
@@ -195,7 +460,8 @@ func (repo *NewInventRepo) IsInventTransactionExist(id int) (bool, error) {
 // Gets information about inventory transaction by ID from database
 func (repo *NewInventRepo) GetInventoryTransaction(inventory_id int) ([]models.InventoryTransaction, error) {
 	var transactions []models.InventoryTransaction
-	rows, err := repo.DB.Query(`SELECT transaction_id, inventory_id, price, quantity, transaction_date
+	rows, err := repo.DB.Query(`SELECT transaction_id, inventory_id, price, quantity, unit, transaction_date,
+	COALESCE(purchase_quantity, quantity), COALESCE(purchase_unit, ''), po_line_id, COALESCE(TO_CHAR(expiry_date, 'YYYY-MM-DD'), '')
 	FROM inventory_transactions
 	WHERE inventory_id=$1
 	`, inventory_id)
@@ -204,7 +470,7 @@ func (repo *NewInventRepo) GetInventoryTransaction(inventory_id int) ([]models.I
 	}
 	for rows.Next() {
 		var transaction models.InventoryTransaction
-		err := rows.Scan(&transaction.ID, &transaction.Inventory_id, &transaction.Price, &transaction.Quantity, &transaction.Transaction_date)
+		err := rows.Scan(&transaction.ID, &transaction.Inventory_id, &transaction.Price, &transaction.Quantity, &transaction.StockUnit, &transaction.Transaction_date, &transaction.PurchaseQuantity, &transaction.PurchaseUnit, &transaction.POLineID, &transaction.ExpiryDate)
 		if err != nil {
 			return transactions, err
 		}
@@ -216,7 +482,8 @@ func (repo *NewInventRepo) GetInventoryTransaction(inventory_id int) ([]models.I
 // Gets information about all inventory transactions from database
 func (repo *NewInventRepo) GetAllInventoryTransactions() ([]models.InventoryTransaction, error) {
 	var transactions []models.InventoryTransaction
-	rows, err := repo.DB.Query(`SELECT transaction_id, inventory_id, price, quantity, transaction_date
+	rows, err := repo.DB.Query(`SELECT transaction_id, inventory_id, price, quantity, unit, transaction_date,
+	COALESCE(purchase_quantity, quantity), COALESCE(purchase_unit, ''), po_line_id, COALESCE(TO_CHAR(expiry_date, 'YYYY-MM-DD'), '')
 	FROM inventory_transactions
 	`)
 	if err != nil {
@@ -224,7 +491,7 @@ func (repo *NewInventRepo) GetAllInventoryTransactions() ([]models.InventoryTran
 	}
 	for rows.Next() {
 		var transaction models.InventoryTransaction
-		err := rows.Scan(&transaction.ID, &transaction.Inventory_id, &transaction.Price, &transaction.Quantity, &transaction.Transaction_date)
+		err := rows.Scan(&transaction.ID, &transaction.Inventory_id, &transaction.Price, &transaction.Quantity, &transaction.StockUnit, &transaction.Transaction_date, &transaction.PurchaseQuantity, &transaction.PurchaseUnit, &transaction.POLineID, &transaction.ExpiryDate)
 		if err != nil {
 			return transactions, err
 		}
@@ -233,26 +500,37 @@ func (repo *NewInventRepo) GetAllInventoryTransactions() ([]models.InventoryTran
 	return transactions, nil
 }
 
-// Updates information about inventory
-func (repo *NewInventRepo) FillInventory(transaction models.InventoryTransaction) error {
-	tx, err := repo.DB.Begin()
-	if err != nil {
-		return err
-	}
-	_, err = tx.Exec(`INSERT INTO inventory_transactions (inventory_id,price,quantity)
-	VALUES($1, $2, $3)
-	`, transaction.Inventory_id, transaction.Price, transaction.Quantity)
+// Updates information about inventory, the bought quantity is converted from its unit or pack to the stock unit
+// and kept as bought in purchase_quantity and purchase_unit. The stock increase is recorded as a purchase
+func (repo *NewInventRepo) FillInventory(transaction models.InventoryTransaction, user string) error {
+	return WithTx(repo.DB, func(tx *sql.Tx) error {
+		return recordPurchase(tx, transaction, nil, user)
+	})
+}
+
+// recordPurchase saves the purchase transaction, optionally received against a purchase order line,
+// and adds the bought quantity to the stock as a new lot
+func recordPurchase(tx *sql.Tx, transaction models.InventoryTransaction, po_line_id *int, user string) error {
+	factor, err := stockUnitFactor(tx, transaction.Inventory_id, transaction.Unit, true)
 	if err != nil {
-		tx.Rollback()
 		return err
 	}
-	_, err = tx.Exec(`UPDATE inventory
-	SET stock_level=stock_level+$1
-	WHERE inventory_id=$2
-	`, transaction.Quantity, transaction.Inventory_id)
+	stockQuantity := transaction.Quantity * factor
+	var transactionID int
+	err = tx.QueryRow(`INSERT INTO inventory_transactions (inventory_id, price, quantity, unit, purchase_quantity, purchase_unit, po_line_id, expiry_date)
+	SELECT $1, $2, $3, unit_type, $4, COALESCE(NULLIF($5, ''), unit_type), $6, NULLIF($7, '')::date
+	FROM inventory
+	WHERE inventory_id=$1
+	RETURNING transaction_id
+	`, transaction.Inventory_id, transaction.Price, stockQuantity, transaction.Quantity, transaction.Unit, po_line_id, transaction.ExpiryDate).Scan(&transactionID)
 	if err != nil {
-		tx.Rollback()
 		return err
 	}
-	return tx.Commit()
+	return applyStockMovement(tx, models.StockMovement{
+		InventoryID:   transaction.Inventory_id,
+		Type:          models.MovementPurchase,
+		Quantity:      stockQuantity,
+		TransactionID: &transactionID,
+		CreatedBy:     user,
+	})
 }
@@ -14,15 +14,36 @@ type MenuRepo interface {
 	GetMenu(id int) (models.Menu, error)
 	Check_UniqueMenu(name string) (bool, error)
 	IsMenuExist(id int) (bool, error)
-	Save_Menu(menu models.Menu, ingredients []models.MenuItemIngredient) error
+	IsMenuArchived(id int) (bool, error)
+	Save_Menu(menu models.Menu, ingredients []models.MenuItemIngredient) (int, error)
 	Get_Ingredients(menuItemID int) ([]models.MenuItemIngredient, error)
 	Check_Menu_Inventory(Menu models.Menu) (bool, error)
+	CheckRecipeUnit(inventory_id int, unit string) error
 	GetOldPrice(menu_id int) (float64, error)
 	Update_Menu(menu models.Menu, id int) (int, error)
-	Delete_Menu(id int) error
+	Archive_Menu(id int) error
+	Purge_Menu(id int) error
+	Set_SoldOut(id int, soldOut bool) error
+	GetMenuCost(id int, method string) (models.RecipeCost, error)
 	GetAllMenuPriceHistory() ([]models.MenuPriceHistory, error)
 	GetMenuPriceHistory(id int) (models.MenuPriceHistory, error)
 	IsPriceHistoryExist(id int) (bool, error)
+	GetVariants(menu_item_id int) ([]models.MenuVariant, error)
+	GetVariant(variant_id int) (models.MenuVariant, error)
+	IsVariantExist(menu_item_id, variant_id int) (bool, error)
+	IsVariantUnique(menu_item_id, variant_id int, name string) (bool, error)
+	Check_Variant_Inventory(variant models.MenuVariant) (bool, error)
+	SaveVariant(variant models.MenuVariant) (int, error)
+	UpdateVariant(variant models.MenuVariant) error
+	DeleteVariant(variant_id int) error
+	GetModifierGroups(menu_item_id int) ([]models.ModifierGroup, error)
+	GetModifierGroup(group_id int) (models.ModifierGroup, error)
+	IsModifierGroupExist(menu_item_id, group_id int) (bool, error)
+	IsModifierGroupUnique(menu_item_id, group_id int, name string) (bool, error)
+	Check_Modifier_Inventory(group models.ModifierGroup) (bool, error)
+	SaveModifierGroup(group models.ModifierGroup) (int, error)
+	UpdateModifierGroup(group models.ModifierGroup) error
+	DeleteModifierGroup(group_id int) error
 }
 
 type NewMenuRepo struct {
@@ -33,9 +54,9 @@ func DefaultMenuRepo(db *sql.DB) *NewMenuRepo {
 	return &NewMenuRepo{DB: db}
 }
 
-// Get_Menu retrieves all menu items from the database
+// Get_Menu retrieves all menu items from the database, archived items are skipped
 func (repo *NewMenuRepo) Get_AllMenu() ([]models.Menu, error) {
-	rows, err := repo.DB.Query("SELECT menu_item_id, name, description, price, tags FROM menu_items")
+	rows, err := repo.DB.Query("SELECT menu_item_id, name, description, price, tags, sold_out FROM menu_items WHERE archived_at IS NULL ORDER BY menu_item_id")
 	if err != nil {
 		return nil, err
 	}
@@ -44,7 +65,7 @@ func (repo *NewMenuRepo) Get_AllMenu() ([]models.Menu, error) {
 	var menus []models.Menu
 	for rows.Next() {
 		var menu models.Menu
-		if err := rows.Scan(&menu.ID, &menu.Name, &menu.Description, &menu.Price, pq.Array(&menu.Tags)); err != nil {
+		if err := rows.Scan(&menu.ID, &menu.Name, &menu.Description, &menu.Price, pq.Array(&menu.Tags), &menu.SoldOut); err != nil {
 			return nil, err
 		}
 		menu.ItemIngredient, err = repo.Get_Ingredients(menu.ID)
@@ -56,15 +77,28 @@ func (repo *NewMenuRepo) Get_AllMenu() ([]models.Menu, error) {
 	if err := rows.Err(); err != nil {
 		return nil, err
 	}
+	for i := range menus {
+		menus[i].Variants, err = repo.GetVariants(menus[i].ID)
+		if err != nil {
+			return nil, err
+		}
+		menus[i].Modifiers, err = repo.GetModifierGroups(menus[i].ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := repo.setAvailability(menus); err != nil {
+		return nil, err
+	}
 	return menus, nil
 }
 
 // Retrieves information about menu by ID from database
 func (repo *NewMenuRepo) GetMenu(id int) (models.Menu, error) {
 	var menu models.Menu
-	err := repo.DB.QueryRow(`SELECT menu_item_id, name, description, price, tags 
+	err := repo.DB.QueryRow(`SELECT menu_item_id, name, description, price, tags, sold_out, archived_at
 	FROM menu_items
-	WHERE menu_item_id=$1`, id).Scan(&menu.ID, &menu.Name, &menu.Description, &menu.Price, pq.Array(&menu.Tags))
+	WHERE menu_item_id=$1`, id).Scan(&menu.ID, &menu.Name, &menu.Description, &menu.Price, pq.Array(&menu.Tags), &menu.SoldOut, &menu.ArchivedAt)
 	if err != nil {
 		return menu, err
 	}
@@ -72,7 +106,19 @@ func (repo *NewMenuRepo) GetMenu(id int) (models.Menu, error) {
 	if err != nil {
 		return menu, err
 	}
-	return menu, nil
+	menu.Variants, err = repo.GetVariants(id)
+	if err != nil {
+		return menu, err
+	}
+	menu.Modifiers, err = repo.GetModifierGroups(id)
+	if err != nil {
+		return menu, err
+	}
+	menus := []models.Menu{menu}
+	if err := repo.setAvailability(menus); err != nil {
+		return menu, err
+	}
+	return menus[0], nil
 }
 
 // Retrieves the previous price of the menu item
@@ -107,11 +153,21 @@ func (repo *NewMenuRepo) IsMenuExist(id int) (bool, error) {
 	return count > 0, nil
 }
 
-// Save_Menu saves a menu item and its ingredients
-func (repo *NewMenuRepo) Save_Menu(menu models.Menu, ingredients []models.MenuItemIngredient) error {
+// IsMenuArchived checks is menu item archived, archived items can not be changed or ordered
+func (repo *NewMenuRepo) IsMenuArchived(id int) (bool, error) {
+	var count int
+	err := repo.DB.QueryRow("SELECT COUNT(*) FROM menu_items WHERE menu_item_id = $1 AND archived_at IS NOT NULL", id).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// Save_Menu saves a menu item and its ingredients, returns the new menu item ID
+func (repo *NewMenuRepo) Save_Menu(menu models.Menu, ingredients []models.MenuItemIngredient) (int, error) {
 	tx, err := repo.DB.Begin() // Start a transaction
 	if err != nil {
-		return err
+		return 0, err
 	}
 
 	// Insert menu item
@@ -122,22 +178,22 @@ func (repo *NewMenuRepo) Save_Menu(menu models.Menu, ingredients []models.MenuIt
 	`, menu.Name, menu.Description, menu.Price, pq.Array(menu.Tags)).Scan(&menuItemID)
 	if err != nil {
 		tx.Rollback()
-		return err
+		return 0, err
 	}
 
 	// Insert ingredients
 	for _, ingredient := range ingredients {
 		_, err = tx.Exec(`
-			INSERT INTO menu_item_ingredients (menu_item_id, inventory_id, quantity)
-			VALUES ($1, $2, $3)
-		`, menuItemID, ingredient.InventoryID, ingredient.Quantity)
+			INSERT INTO menu_item_ingredients (menu_item_id, inventory_id, quantity, unit)
+			VALUES ($1, $2, $3, COALESCE(NULLIF($4, ''), (SELECT unit_type FROM inventory WHERE inventory_id=$2)))
+		`, menuItemID, ingredient.InventoryID, ingredient.Quantity, ingredient.Unit)
 		if err != nil {
 			tx.Rollback()
-			return err
+			return 0, err
 		}
 	}
 
-	return tx.Commit() // Commit the transaction
+	return menuItemID, tx.Commit() // Commit the transaction
 }
 
 // Checks if the ingredients of menu item are available in inventory
@@ -166,7 +222,7 @@ func (repo *NewMenuRepo) Check_Menu_Inventory(Menu models.Menu) (bool, error) {
 // Get_Ingredients retrieves ingredients for a menu item
 func (repo *NewMenuRepo) Get_Ingredients(menuItemID int) ([]models.MenuItemIngredient, error) {
 	rows, err := repo.DB.Query(`
-		SELECT id, inventory_id, menu_item_id, quantity
+		SELECT id, inventory_id, menu_item_id, quantity, unit, to_stock_unit(quantity, unit, inventory_id)
 		FROM menu_item_ingredients
 		WHERE menu_item_id = $1
 	`, menuItemID)
@@ -178,7 +234,7 @@ func (repo *NewMenuRepo) Get_Ingredients(menuItemID int) ([]models.MenuItemIngre
 	var ingredients []models.MenuItemIngredient
 	for rows.Next() {
 		var ingredient models.MenuItemIngredient
-		if err := rows.Scan(&ingredient.ID, &ingredient.InventoryID, &ingredient.MenuItemID, &ingredient.Quantity); err != nil {
+		if err := rows.Scan(&ingredient.ID, &ingredient.InventoryID, &ingredient.MenuItemID, &ingredient.Quantity, &ingredient.Unit, &ingredient.StockQuantity); err != nil {
 			return nil, err
 		}
 		ingredients = append(ingredients, ingredient)
@@ -186,7 +242,7 @@ func (repo *NewMenuRepo) Get_Ingredients(menuItemID int) ([]models.MenuItemIngre
 	return ingredients, nil
 }
 
-// Updates infromation about menu item from database
+// Updates infromation about menu item in place, so its orders and modifiers stay linked to it
 func (repo *NewMenuRepo) Update_Menu(menu models.Menu, id int) (int, error) {
 	menu.ID = id
 	exist, err := repo.IsMenuExist(id)
@@ -196,56 +252,69 @@ func (repo *NewMenuRepo) Update_Menu(menu models.Menu, id int) (int, error) {
 	if !exist {
 		return http.StatusBadRequest, errors.New("menu id is not exist")
 	}
-	oldprice, err := repo.GetOldPrice(id)
+	archived, err := repo.IsMenuArchived(id)
 	if err != nil {
 		return http.StatusInternalServerError, err
 	}
-	tx, err := repo.DB.Begin()
-	if err != nil {
-		return http.StatusInternalServerError, err
+	if archived {
+		return http.StatusConflict, errors.New("menu item is archived")
 	}
-	_, err = tx.Exec(`DELETE FROM menu_items
-		WHERE menu_item_id=$1
-	`, id)
+	oldprice, err := repo.GetOldPrice(id)
 	if err != nil {
-		tx.Rollback()
 		return http.StatusInternalServerError, err
 	}
-	unique, err := repo.Check_UniqueMenu(menu.Name)
+	var count int
+	err = repo.DB.QueryRow(`SELECT COUNT(*) FROM menu_items
+	WHERE name=$1 AND menu_item_id<>$2
+	`, menu.Name, id).Scan(&count)
 	if err != nil {
-		tx.Rollback()
 		return http.StatusInternalServerError, err
 	}
-	if !unique {
-		tx.Rollback()
+	if count > 0 {
 		return http.StatusBadRequest, errors.New("menu name must be unique")
 	}
 	exist, err = repo.Check_Menu_Inventory(menu)
 	if err != nil {
-		tx.Rollback()
 		return http.StatusInternalServerError, err
 	}
 	if !exist {
-		tx.Rollback()
 		return http.StatusBadRequest, errors.New("menu item ingredient is not exist in inventory")
 	}
+	for _, ingredient := range menu.ItemIngredient {
+		err = repo.CheckRecipeUnit(ingredient.InventoryID, ingredient.Unit)
+		if IsUnitErr(err) {
+			return http.StatusBadRequest, err
+		}
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+	}
+	tx, err := repo.DB.Begin()
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
 
-	// Insert menu item
-	_, err = tx.Exec(`
-		INSERT INTO menu_items (menu_item_id, name, description, price, tags)
-		VALUES ($1, $2, $3, $4, $5)
-	`, menu.ID, menu.Name, menu.Description, menu.Price, pq.Array(menu.Tags))
+	// Update menu item
+	_, err = tx.Exec(`UPDATE menu_items
+	SET name=$1, description=$2, price=$3, tags=$4
+	WHERE menu_item_id=$5
+	`, menu.Name, menu.Description, menu.Price, pq.Array(menu.Tags), menu.ID)
 	if err != nil {
 		tx.Rollback()
 		return http.StatusInternalServerError, err
 	}
 
-	// Insert ingredients
+	// Replace ingredients
+	_, err = tx.Exec(`DELETE FROM menu_item_ingredients WHERE menu_item_id=$1`, menu.ID)
+	if err != nil {
+		tx.Rollback()
+		return http.StatusInternalServerError, err
+	}
 	for _, ingredient := range menu.ItemIngredient {
 		_, err = tx.Exec(`
-			INSERT INTO menu_item_ingredients (menu_item_id, inventory_id, quantity)
-			VALUES ($1, $2, $3)
-		`, menu.ID, ingredient.InventoryID, ingredient.Quantity)
+			INSERT INTO menu_item_ingredients (menu_item_id, inventory_id, quantity, unit)
+			VALUES ($1, $2, $3, COALESCE(NULLIF($4, ''), (SELECT unit_type FROM inventory WHERE inventory_id=$2)))
+		`, menu.ID, ingredient.InventoryID, ingredient.Quantity, ingredient.Unit)
 		if err != nil {
 			tx.Rollback()
 			return http.StatusInternalServerError, err
@@ -260,32 +329,34 @@ func (repo *NewMenuRepo) Update_Menu(menu models.Menu, id int) (int, error) {
 			return http.StatusInternalServerError, err
 		}
 	}
-	if tx.Commit() != nil {
+	if err = tx.Commit(); err != nil {
 		return http.StatusInternalServerError, err
 	}
-	return http.StatusOK, nil // Commit the transaction
+	return http.StatusOK, nil
 }
 
-// Deletes information about menu item from database
-func (repo *NewMenuRepo) Delete_Menu(id int) error {
-	tx, err := repo.DB.Begin()
-	if err != nil {
-		return err
-	}
-	_, err = tx.Exec(`DELETE FROM menu_items
+// Archives the menu item, ordered items and reports keep referencing it
+func (repo *NewMenuRepo) Archive_Menu(id int) error {
+	_, err := repo.DB.Exec(`UPDATE menu_items
+		SET archived_at=NOW()
+		WHERE menu_item_id=$1 AND archived_at IS NULL
+	`, id)
+	return err
+}
+
+// Deletes the menu item with its recipe, variants and modifiers from database,
+// fails with ErrStillReferenced while the item is in any order
+func (repo *NewMenuRepo) Purge_Menu(id int) error {
+	_, err := repo.DB.Exec(`DELETE FROM menu_items
 		WHERE menu_item_id=$1
 	`, id)
-	if err != nil {
-		tx.Rollback()
-		return err
-	}
-	return tx.Commit()
+	return referencedErr(err)
 }
 
 // Retrieves price historyof all menu items from database
 func (repo *NewMenuRepo) GetAllMenuPriceHistory() ([]models.MenuPriceHistory, error) {
 	var data []models.MenuPriceHistory
-	rows, err := repo.DB.Query(`SELECT id, menu_item_id, old_price, new_price, changed_at
+	rows, err := repo.DB.Query(`SELECT id, menu_item_id, COALESCE(variant_id, 0), old_price, new_price, changed_at
 	FROM price_history
 `)
 	if err != nil {
@@ -294,7 +365,7 @@ func (repo *NewMenuRepo) GetAllMenuPriceHistory() ([]models.MenuPriceHistory, er
 	defer rows.Close()
 	for rows.Next() {
 		var price_history models.MenuPriceHistory
-		err := rows.Scan(&price_history.ID, &price_history.MenuItemID, &price_history.OldPrice, &price_history.NewPrice, &price_history.ChangedAt)
+		err := rows.Scan(&price_history.ID, &price_history.MenuItemID, &price_history.VariantID, &price_history.OldPrice, &price_history.NewPrice, &price_history.ChangedAt)
 		if err != nil {
 			return data, err
 		}
@@ -306,10 +377,10 @@ func (repo *NewMenuRepo) GetAllMenuPriceHistory() ([]models.MenuPriceHistory, er
 // Retrieves price histore of menu item from database by ID
 func (repo *NewMenuRepo) GetMenuPriceHistory(id int) (models.MenuPriceHistory, error) {
 	var price_history models.MenuPriceHistory
-	err := repo.DB.QueryRow(`SELECT id, menu_item_id, old_price, new_price, changed_at
+	err := repo.DB.QueryRow(`SELECT id, menu_item_id, COALESCE(variant_id, 0), old_price, new_price, changed_at
 	FROM price_history
 	WHERE id=$1
-	`, id).Scan(&price_history.ID, &price_history.MenuItemID, &price_history.OldPrice, &price_history.NewPrice, &price_history.ChangedAt)
+	`, id).Scan(&price_history.ID, &price_history.MenuItemID, &price_history.VariantID, &price_history.OldPrice, &price_history.NewPrice, &price_history.ChangedAt)
 	if err != nil {
 		return price_history, err
 	}
@@ -4,32 +4,57 @@ import (
 	"database/sql"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"frappuccino/models"
+	"math"
 	"net/http"
 	"strconv"
 	"time"
+
+	"github.com/lib/pq"
 )
 
 type OrderRepo interface {
 	Get_Need_Inventory(order models.Order) (map[string]float64, error)
-	Is_Enough(need_invent map[string]float64) (bool, error)
+	Is_Enough(q DBTX, need_invent map[string]float64) (bool, error)
 	ProductID_Exists(product_id string) (bool, error)
 	IsOrderExist(order_id int) (bool, error)
-	SaveOrder(order models.Order) error
+	SaveOrder(tx *sql.Tx, order models.Order) (int, error)
 	Get_Orders() ([]models.Order, error)
 	GetOrder(order_id int) (models.Order, error)
 	Get_Order_Items(order_id int) ([]models.OrderItem, error)
 	GetOrderItemsArray(order_id int) ([]string, error)
-	CheckOrder(newOrder models.Order) (int, error)
+	CheckOrder(q DBTX, newOrder models.Order) (int, error)
+	CheckProducts(newOrder models.Order) (int, error)
+	CheckItemVariant(item models.OrderItem) (int, error)
+	CheckItemModifiers(item models.OrderItem) (int, error)
 	GetPriceAtOrderItems(order *models.Order) error
 	GetTotalAmount(order *models.Order) error
 	UpdateOrder(order models.Order, id int) (int, error)
+	PatchOrder(tx *sql.Tx, order models.Order, added, updated []models.OrderItem, removed []int) error
+	RedeemLoyalty(tx *sql.Tx, order models.Order) error
+	GetLineNetAmounts(order_id int) (map[int]float64, error)
 	DeleteOrder(order_id int) error
-	CloseOrder(order_id int) error
-	UseInventory(needInventory map[string]float64) error
-	GetLastOrderId() (int, error)
+	CloseOrder(tx *sql.Tx, order_id int) error
+	ChangeOrderStatus(order_id int, from, to, reason string) error
+	GetRefundedQuantities(order_id int) (map[int]int, error)
+	SaveRefund(refund models.OrderRefund, needInventory map[string]float64) (int, error)
+	GetRefunds(order_id int) ([]models.OrderRefund, error)
 }
 
+// ErrOrderStatusConflict is returned when the order status was changed by another request in between
+var ErrOrderStatusConflict = errors.New("order status has been changed by another request")
+
+// ErrRefundOverQuantity is returned when a refund takes more of an order line than is left after earlier refunds
+var ErrRefundOverQuantity = errors.New("refund exceeds the quantity left to refund")
+
+// ErrOrderNotEditable is returned when the items of an order that is already in preparation or finished are changed
+var ErrOrderNotEditable = errors.New("only pending or active orders can be edited")
+
+// ErrOrderHasRedemptions is returned when an order with loyalty points redeemed on its lines is replaced as a whole,
+// its lines have to be changed one by one so the redemptions of the kept lines stay
+var ErrOrderHasRedemptions = errors.New("loyalty points are redeemed on the order, change its lines with PATCH")
+
 type NewOrderRepo struct {
 	DB *sql.DB
 }
@@ -38,60 +63,55 @@ func DefaultOrderRepo(db *sql.DB) *NewOrderRepo {
 	return &NewOrderRepo{DB: db}
 }
 
-// Get_Need_Inventory calculates the inventory required for an order
+// Get_Need_Inventory calculates the inventory required for an order, including the chosen modifiers
 func (repo *NewOrderRepo) Get_Need_Inventory(order models.Order) (map[string]float64, error) {
 	needInventory := make(map[string]float64)
 
 	for _, item := range order.Items {
-		rows, err := repo.DB.Query(`
-			SELECT inventory_id,
-			quantity * $1
-			FROM menu_item_ingredients 
-			WHERE menu_item_id = $2
-		`, item.Quantity, item.MenuItemID)
+		serving, err := servingIngredients(repo.DB, item)
 		if err != nil {
 			return nil, err
 		}
-		defer rows.Close()
-
-		for rows.Next() {
-			var ingredientID string
-			var quantity float64
-			if err := rows.Scan(&ingredientID, &quantity); err != nil {
-				return nil, err
+		for ingredientID, quantity := range serving {
+			// A modifier can take an ingredient out of the recipe, but never adds it to the stock
+			if quantity <= 0 {
+				continue
 			}
-			needInventory[ingredientID] += quantity
+			needInventory[ingredientID] += quantity * float64(item.Quantity)
 		}
 	}
 	return needInventory, nil
 }
 
-// Is_Enough checks if the inventory is sufficient for an order
-func (repo *NewOrderRepo) Is_Enough(needInventory map[string]float64) (bool, error) {
+// Is_Enough checks if the inventory not reserved by other orders and not expired is sufficient for an order,
+// run it inside the transaction that deducts the inventory to see its earlier deductions
+func (repo *NewOrderRepo) Is_Enough(q DBTX, needInventory map[string]float64) (bool, error) {
 	for ingredientID, requiredQuantity := range needInventory {
 		var availableQuantity float64
-		err := repo.DB.QueryRow(`
-			SELECT stock_level
-			FROM inventory
-			WHERE inventory_id = $1
+		err := q.QueryRow(`
+			SELECT i.stock_level - COALESCE((SELECT SUM(r.quantity) FROM inventory_reservations r WHERE r.inventory_id = i.inventory_id), 0)
+				- COALESCE(e.expired, 0)
+			FROM inventory i
+			LEFT JOIN (`+expiredLotsQuery+`) e USING(inventory_id)
+			WHERE i.inventory_id = $1
 		`, ingredientID).Scan(&availableQuantity)
 		if err != nil {
 			return false, err
 		}
-		if availableQuantity <= requiredQuantity {
+		if availableQuantity < requiredQuantity {
 			return false, nil
 		}
 	}
 	return true, nil
 }
 
-// ProductID_Exists checks if a product exists in the menu
+// ProductID_Exists checks if a product exists in the menu and is not archived
 func (repo *NewOrderRepo) ProductID_Exists(productID string) (bool, error) {
 	var count int
 	err := repo.DB.QueryRow(`
 		SELECT COUNT(*)
 		FROM menu_items
-		WHERE menu_item_id = $1
+		WHERE menu_item_id = $1 AND archived_at IS NULL
 	`, productID).Scan(&count)
 	if err != nil {
 		return false, err
@@ -99,64 +119,79 @@ func (repo *NewOrderRepo) ProductID_Exists(productID string) (bool, error) {
 	return count > 0, nil
 }
 
-// SaveOrder inserts a new order into the database
-func (repo *NewOrderRepo) SaveOrder(order models.Order) error {
+// SaveOrder inserts a new order into the database within the given transaction and returns its ID
+func (repo *NewOrderRepo) SaveOrder(tx *sql.Tx, order models.Order) (int, error) {
 	time := time.Now()
 	items := order.Items
-	tx, err := repo.DB.Begin() // Start a transaction
-	if err != nil {
-		return err
-	}
 
 	// Marshal `special_instructions` to JSON
 	specialInstructionsJSON, err := json.Marshal(order.SpecialInstructions)
 	if err != nil {
-		tx.Rollback()
-		return err
+		return 0, err
 	}
 
 	// Insert order
 	var orderID int
 	err = tx.QueryRow(`
-		INSERT INTO orders (customer_id, total_amount, status, special_Instructions)
-		VALUES ($1, $2, $3, $4) RETURNING order_id
-	`, order.CustomerID, order.TotalAmount, order.Status, specialInstructionsJSON).Scan(&orderID)
+		INSERT INTO orders (customer_id, total_amount, status, special_Instructions, promo_code)
+		VALUES ($1, $2, $3, $4, NULLIF($5::text, '')) RETURNING order_id
+	`, order.CustomerID, order.TotalAmount, order.Status, specialInstructionsJSON, order.PromoCode).Scan(&orderID)
 	if err != nil {
-		tx.Rollback()
-		return err
+		return 0, err
 	}
 
 	// Insert order items
-	for _, item := range items {
+	err = insertOrderItems(tx, orderID, items)
+	if err != nil {
+		return 0, err
+	}
+	// Insert the promotion discounts priced by GetTotalAmount on the lines just saved
+	for _, discount := range order.Discounts {
+		if discount.Line > 0 {
+			discount.OrderItemID = items[discount.Line-1].ID
+		}
+		err = insertOrderDiscount(tx, orderID, discount)
+		if err != nil {
+			return 0, err
+		}
+	}
+	_, err = tx.Exec(`INSERT INTO order_status_history(order_id,status,changed_at)
+	VALUES($1, $2, $3)
+	`, orderID, order.Status, time)
+	if err != nil {
+		return 0, err
+	}
+	return orderID, nil
+}
+
+// Inserts the items of the order with their modifiers, the IDs of the saved lines are set on the items
+func insertOrderItems(tx *sql.Tx, order_id int, items []models.OrderItem) error {
+	for i, item := range items {
 		customizationsJSON, err := json.Marshal(item.Customizations)
 		if err != nil {
-			tx.Rollback()
 			return err
 		}
-		_, err = tx.Exec(`
-			INSERT INTO order_items (menu_item_id, order_id, customizations, price_at_order_time, quantity)
-			VALUES ($1, $2, $3, $4, $5)
-		`, item.MenuItemID, orderID, customizationsJSON, item.PriceAtOrderTime, item.Quantity)
+		var orderItemID int
+		err = tx.QueryRow(`
+			INSERT INTO order_items (menu_item_id, variant_id, variant_name, order_id, customizations, price_at_order_time, quantity)
+			VALUES ($1, NULLIF($2, 0), NULLIF($3, ''), $4, $5, $6, $7) RETURNING order_item_id
+		`, item.MenuItemID, item.VariantID, item.VariantName, order_id, customizationsJSON, item.PriceAtOrderTime, item.Quantity).Scan(&orderItemID)
+		if err != nil {
+			return err
+		}
+		items[i].ID = orderItemID
+		err = insertOrderItemModifiers(tx, orderItemID, item.Modifiers)
 		if err != nil {
-			tx.Rollback()
 			return err
 		}
 	}
-	order.ID = orderID
-	_, err = tx.Exec(`INSERT INTO order_status_history(order_id,status,changed_at)
-	VALUES($1,'active', $2)
-	`, order.ID, time)
-	if err != nil {
-		tx.Rollback()
-		return err
-	}
-	return tx.Commit() // Commit the transaction
+	return nil
 }
 
 // Get_Orders retrieves all orders from the database
 func (repo *NewOrderRepo) Get_Orders() ([]models.Order, error) {
 	rows, err := repo.DB.Query(`
-		SELECT order_id, customer_id,order_date, status, total_amount, special_instructions
+		SELECT order_id, customer_id,order_date, status, total_amount, special_instructions, COALESCE(promo_code, '')
 		FROM orders
 	`)
 	if err != nil {
@@ -168,7 +203,7 @@ func (repo *NewOrderRepo) Get_Orders() ([]models.Order, error) {
 	for rows.Next() {
 		var order models.Order
 		var specialInstructions []byte // To store the raw JSONB data
-		if err := rows.Scan(&order.ID, &order.CustomerID, &order.CreatedAt, &order.Status, &order.TotalAmount, &specialInstructions); err != nil {
+		if err := rows.Scan(&order.ID, &order.CustomerID, &order.CreatedAt, &order.Status, &order.TotalAmount, &specialInstructions, &order.PromoCode); err != nil {
 			return nil, err
 		}
 
@@ -184,6 +219,10 @@ func (repo *NewOrderRepo) Get_Orders() ([]models.Order, error) {
 			return nil, err
 		}
 		order.Items = orderItems
+		order.Discounts, err = getOrderDiscounts(repo.DB, order.ID)
+		if err != nil {
+			return nil, err
+		}
 		orders = append(orders, order)
 	}
 
@@ -192,18 +231,23 @@ func (repo *NewOrderRepo) Get_Orders() ([]models.Order, error) {
 
 // Get_Order_Items finds order items that belong to a specific order.
 func (repo *NewOrderRepo) Get_Order_Items(order_id int) ([]models.OrderItem, error) {
+	return getOrderItems(repo.DB, order_id)
+}
+
+func getOrderItems(q DBTX, order_id int) ([]models.OrderItem, error) {
 	var orderItems []models.OrderItem
 	var customizations []byte
-	rows, err := repo.DB.Query(`SELECT order_item_id, menu_item_id, order_id, customizations, price_at_order_time, quantity 
+	rows, err := q.Query(`SELECT order_item_id, menu_item_id, COALESCE(variant_id, 0), COALESCE(variant_name, ''), order_id, customizations, price_at_order_time, quantity 
 	FROM order_items
 	WHERE order_id=$1`, order_id)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
+	var orderItemIDs []int
 	for rows.Next() {
 		var orderItem models.OrderItem
-		err := rows.Scan(&orderItem.ID, &orderItem.MenuItemID, &orderItem.OrderID, &customizations, &orderItem.PriceAtOrderTime, &orderItem.Quantity)
+		err := rows.Scan(&orderItem.ID, &orderItem.MenuItemID, &orderItem.VariantID, &orderItem.VariantName, &orderItem.OrderID, &customizations, &orderItem.PriceAtOrderTime, &orderItem.Quantity)
 		if err != nil {
 			return nil, err
 		}
@@ -214,6 +258,18 @@ func (repo *NewOrderRepo) Get_Order_Items(order_id int) ([]models.OrderItem, err
 			}
 		}
 		orderItems = append(orderItems, orderItem)
+		orderItemIDs = append(orderItemIDs, orderItem.ID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	modifiers, err := getOrderItemModifiers(q, orderItemIDs)
+	if err != nil {
+		return nil, err
+	}
+	for i := range orderItems {
+		orderItems[i].Modifiers = modifiers[orderItems[i].ID]
 	}
 	return orderItems, nil
 }
@@ -241,16 +297,10 @@ func (repo *NewOrderRepo) GetOrderItemsArray(order_id int) ([]string, error) {
 }
 
 // CheckOrder validates an order before saving
-func (repo *NewOrderRepo) CheckOrder(newOrder models.Order) (int, error) {
-	// Check if products exist
-	for _, item := range newOrder.Items {
-		exists, err := repo.ProductID_Exists(strconv.Itoa(item.MenuItemID))
-		if err != nil {
-			return http.StatusInternalServerError, err
-		}
-		if !exists {
-			return http.StatusBadRequest, errors.New("ordered item does not exist: " + strconv.Itoa(item.MenuItemID))
-		}
+func (repo *NewOrderRepo) CheckOrder(q DBTX, newOrder models.Order) (int, error) {
+	code, err := repo.CheckProducts(newOrder)
+	if err != nil {
+		return code, err
 	}
 
 	// Check inventory requirements
@@ -259,7 +309,7 @@ func (repo *NewOrderRepo) CheckOrder(newOrder models.Order) (int, error) {
 		return http.StatusInternalServerError, err
 	}
 
-	enough, err := repo.Is_Enough(needInventory)
+	enough, err := repo.Is_Enough(q, needInventory)
 	if err != nil {
 		return http.StatusInternalServerError, err
 	}
@@ -269,27 +319,72 @@ func (repo *NewOrderRepo) CheckOrder(newOrder models.Order) (int, error) {
 	return http.StatusOK, nil
 }
 
-// GetPriceAtOrderItems sets the value of price_at_order_items for the order
+// CheckProducts checks that every ordered item exists in the menu and is not sold out
+func (repo *NewOrderRepo) CheckProducts(newOrder models.Order) (int, error) {
+	for _, item := range newOrder.Items {
+		exists, err := repo.ProductID_Exists(strconv.Itoa(item.MenuItemID))
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+		if !exists {
+			return http.StatusBadRequest, errors.New("ordered item does not exist or is archived: " + strconv.Itoa(item.MenuItemID))
+		}
+		soldOut, err := repo.IsSoldOut(item.MenuItemID)
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+		if soldOut {
+			return http.StatusBadRequest, errors.New("ordered item is sold out: " + strconv.Itoa(item.MenuItemID))
+		}
+		code, err := repo.CheckItemVariant(item)
+		if err != nil {
+			return code, err
+		}
+		code, err = repo.CheckItemModifiers(item)
+		if err != nil {
+			return code, err
+		}
+	}
+	return http.StatusOK, nil
+}
+
+// GetPriceAtOrderItems sets the value of price_at_order_items for the order,
+// the chosen variant replaces the menu item price and chosen modifiers change it
 func (repo *NewOrderRepo) GetPriceAtOrderItems(order *models.Order) error {
 	for index, orderItem := range order.Items {
-		var PriceAtOrderTime float64
-		err := repo.DB.QueryRow("SELECT price*$1 FROM menu_items WHERE menu_item_id=$2", orderItem.Quantity, orderItem.MenuItemID).
-			Scan(&PriceAtOrderTime)
+		price, variantName, err := repo.itemBasePrice(orderItem)
 		if err != nil {
 			return err
 		}
-		order.Items[index].PriceAtOrderTime = PriceAtOrderTime
+		order.Items[index].VariantName = variantName
+		price, err = repo.priceItemModifiers(&order.Items[index], price)
+		if err != nil {
+			return err
+		}
+		order.Items[index].PriceAtOrderTime = math.Round(price*float64(orderItem.Quantity)*100) / 100
 	}
 	return nil
 }
 
-// GetTotalAmount Sets the value of TotalAmount for the order
+// GetTotalAmount Sets the value of TotalAmount for the order, its lines less the discounts of the promotions
+// that apply to it now. The discounts are set on the order to be saved with it
 func (repo *NewOrderRepo) GetTotalAmount(order *models.Order) error {
 	var total float64
 	for _, orderItem := range order.Items {
 		total += orderItem.PriceAtOrderTime
 	}
-	order.TotalAmount = total
+	discounts, codeUsed, err := evaluatePromotions(repo.DB, *order)
+	if err != nil {
+		return err
+	}
+	if order.PromoCode != "" && !codeUsed {
+		return ErrPromoCodeNotApplicable
+	}
+	for _, discount := range discounts {
+		total += discount.Amount
+	}
+	order.Discounts = discounts
+	order.TotalAmount = roundMoney(math.Max(total, 0))
 	return nil
 }
 
@@ -302,15 +397,26 @@ func (repo *NewOrderRepo) IsOrderExist(order_id int) (bool, error) {
 	return count > 0, nil
 }
 
+// Retrieves the date the order was created
+func (repo *NewOrderRepo) orderDate(order_id int) (time.Time, error) {
+	var date time.Time
+	err := repo.DB.QueryRow(`SELECT order_date FROM orders WHERE order_id=$1`, order_id).Scan(&date)
+	return date, err
+}
+
 // Finds the order by order_id in the database
 func (repo *NewOrderRepo) GetOrder(order_id int) (models.Order, error) {
+	return getOrder(repo.DB, order_id)
+}
+
+func getOrder(q DBTX, order_id int) (models.Order, error) {
 	var order models.Order
 	var specialInstructions []byte // To handle JSONB data
 
-	err := repo.DB.QueryRow(`SELECT order_id,customer_id,order_date,status,total_amount,special_instructions
+	err := q.QueryRow(`SELECT order_id,customer_id,order_date,status,total_amount,special_instructions,COALESCE(promo_code, '')
 	FROM orders
 	WHERE order_id=$1
-	`, order_id).Scan(&order.ID, &order.CustomerID, &order.CreatedAt, &order.Status, &order.TotalAmount, &specialInstructions)
+	`, order_id).Scan(&order.ID, &order.CustomerID, &order.CreatedAt, &order.Status, &order.TotalAmount, &specialInstructions, &order.PromoCode)
 	if err != nil {
 		return order, err
 	}
@@ -323,7 +429,11 @@ func (repo *NewOrderRepo) GetOrder(order_id int) (models.Order, error) {
 		}
 	}
 
-	order.Items, err = repo.Get_Order_Items(order.ID)
+	order.Items, err = getOrderItems(q, order.ID)
+	if err != nil {
+		return order, err
+	}
+	order.Discounts, err = getOrderDiscounts(q, order.ID)
 	if err != nil {
 		return order, err
 	}
@@ -336,6 +446,12 @@ func (repo *NewOrderRepo) DeleteOrder(order_id int) error {
 	if err != nil {
 		return err
 	}
+	// Points redeemed on the order go back to the customer, the ledger keeps its entries
+	err = restoreRedeemedPoints(tx, order_id, nil)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
 	_, err = tx.Exec(`DELETE FROM orders
 		WHERE order_id=$1
 	`, order_id)
@@ -346,9 +462,21 @@ func (repo *NewOrderRepo) DeleteOrder(order_id int) error {
 	return tx.Commit()
 }
 
-// Closes the order and deducts required inventory from database
-func (repo *NewOrderRepo) CloseOrder(order_id int) error {
-	order, err := repo.GetOrder(order_id)
+// Closes the order and deducts required inventory within the given transaction.
+// The order is locked before its items are read, so an edit committed meanwhile is either seen or waits for the close
+func (repo *NewOrderRepo) CloseOrder(tx *sql.Tx, order_id int) error {
+	var status string
+	err := tx.QueryRow(`SELECT status FROM orders
+	WHERE order_id=$1 AND status IN ('active', 'ready', 'picked_up')
+	FOR UPDATE
+	`, order_id).Scan(&status)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrOrderStatusConflict
+	}
+	if err != nil {
+		return err
+	}
+	order, err := getOrder(tx, order_id)
 	if err != nil {
 		return err
 	}
@@ -356,43 +484,230 @@ func (repo *NewOrderRepo) CloseOrder(order_id int) error {
 	if err != nil {
 		return err
 	}
+	err = setOrderStatus(tx, order_id, status, models.StatusClosed, "")
+	if err != nil {
+		return err
+	}
+	// The reservation turns into consumption
+	inventRepo := DefaultInventRepo(repo.DB)
+	err = inventRepo.ReleaseReservation(tx, order_id)
+	if err != nil {
+		return err
+	}
+	err = inventRepo.Use_Inventory(tx, order_id, need_invent)
+	if err != nil {
+		return err
+	}
+	return earnLoyaltyPoints(tx, order_id)
+}
+
+// Moves the order from one status to another and records the transition in status history
+func (repo *NewOrderRepo) ChangeOrderStatus(order_id int, from, to, reason string) error {
 	tx, err := repo.DB.Begin()
 	if err != nil {
 		return err
 	}
-	_, err = tx.Exec(`UPDATE orders
-	SET status='closed'
-	WHERE order_id=$1
-	`, order_id)
+	err = setOrderStatus(tx, order_id, from, to, reason)
 	if err != nil {
 		tx.Rollback()
 		return err
 	}
-	_, err = tx.Exec(`INSERT INTO order_status_history (order_id, status)
-	VALUES($1,'closed')
+	if to == models.StatusCancelled {
+		err = DefaultInventRepo(repo.DB).ReleaseReservation(tx, order_id)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		// Redeemed points go back to the customer
+		err = restoreRedeemedPoints(tx, order_id, nil)
+		if err == nil {
+			err = refreshOrderTotal(tx, order_id)
+		}
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Updates the order status only if it still equals the expected one, so concurrent transitions cannot both succeed
+func setOrderStatus(tx *sql.Tx, order_id int, from, to, reason string) error {
+	result, err := tx.Exec(`UPDATE orders
+	SET status=$1
+	WHERE order_id=$2 AND status=$3
+	`, to, order_id, from)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrOrderStatusConflict
+	}
+	_, err = tx.Exec(`INSERT INTO order_status_history (order_id, status, reason)
+	VALUES($1, $2, NULLIF($3, ''))
+	`, order_id, to, reason)
+	return err
+}
+
+// Retrieves how many units of every order item have already been refunded
+func (repo *NewOrderRepo) GetRefundedQuantities(order_id int) (map[int]int, error) {
+	return getRefundedQuantities(repo.DB, order_id)
+}
+
+func getRefundedQuantities(q DBTX, order_id int) (map[int]int, error) {
+	refunded := make(map[int]int)
+	rows, err := q.Query(`SELECT ori.order_item_id, SUM(ori.quantity)
+	FROM order_refund_items ori
+	INNER JOIN order_refunds r USING(refund_id)
+	WHERE r.order_id=$1
+	GROUP BY ori.order_item_id
 	`, order_id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var orderItemID, quantity int
+		if err := rows.Scan(&orderItemID, &quantity); err != nil {
+			return nil, err
+		}
+		refunded[orderItemID] = quantity
+	}
+	return refunded, rows.Err()
+}
+
+// Saves the refund with its items and puts the refunded ingredients back to inventory.
+// The order is locked and the refunded quantities are checked again, so concurrent refunds cannot take a line twice
+func (repo *NewOrderRepo) SaveRefund(refund models.OrderRefund, needInventory map[string]float64) (int, error) {
+	tx, err := repo.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	var status string
+	err = tx.QueryRow(`SELECT status FROM orders WHERE order_id=$1 FOR UPDATE`, refund.OrderID).Scan(&status)
 	if err != nil {
 		tx.Rollback()
-		return err
+		return 0, err
 	}
-	err = DefaultInventRepo(repo.DB).Use_Inventory(need_invent)
+	if status != models.StatusClosed {
+		tx.Rollback()
+		return 0, ErrOrderStatusConflict
+	}
+	refunded, err := getRefundedQuantities(tx, refund.OrderID)
 	if err != nil {
 		tx.Rollback()
-		return err
+		return 0, err
+	}
+	for _, item := range refund.Items {
+		var quantity int
+		err = tx.QueryRow(`SELECT quantity FROM order_items WHERE order_item_id=$1 AND order_id=$2
+		`, item.OrderItemID, refund.OrderID).Scan(&quantity)
+		if err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+		if item.Quantity > quantity-refunded[item.OrderItemID] {
+			tx.Rollback()
+			return 0, fmt.Errorf("%w: order item %d has %d left", ErrRefundOverQuantity, item.OrderItemID, quantity-refunded[item.OrderItemID])
+		}
 	}
+	var refundID int
+	err = tx.QueryRow(`INSERT INTO order_refunds (order_id, reason, amount)
+	VALUES ($1, $2, $3) RETURNING refund_id
+	`, refund.OrderID, refund.Reason, refund.Amount).Scan(&refundID)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	for _, item := range refund.Items {
+		_, err = tx.Exec(`INSERT INTO order_refund_items (refund_id, order_item_id, quantity, amount)
+		VALUES ($1, $2, $3, $4)
+		`, refundID, item.OrderItemID, item.Quantity, item.Amount)
+		if err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+	}
+	err = restoreInventory(tx, refund.OrderID, needInventory)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	err = reverseLoyaltyPoints(tx, refund.OrderID)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	return refundID, tx.Commit()
+}
 
-	return tx.Commit()
+// Retrieves all refunds made for the order
+func (repo *NewOrderRepo) GetRefunds(order_id int) ([]models.OrderRefund, error) {
+	var refunds []models.OrderRefund
+	rows, err := repo.DB.Query(`SELECT refund_id, order_id, reason, amount, created_at
+	FROM order_refunds
+	WHERE order_id=$1
+	ORDER BY created_at
+	`, order_id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var refund models.OrderRefund
+		if err := rows.Scan(&refund.ID, &refund.OrderID, &refund.Reason, &refund.Amount, &refund.CreatedAt); err != nil {
+			return nil, err
+		}
+		refunds = append(refunds, refund)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for i := range refunds {
+		refunds[i].Items, err = repo.getRefundItems(refunds[i].ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return refunds, nil
 }
 
-// Update order information from database
+// Retrieves items of the refund
+func (repo *NewOrderRepo) getRefundItems(refund_id int) ([]models.RefundItem, error) {
+	var items []models.RefundItem
+	rows, err := repo.DB.Query(`SELECT id, order_item_id, quantity, amount
+	FROM order_refund_items
+	WHERE refund_id=$1
+	`, refund_id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var item models.RefundItem
+		if err := rows.Scan(&item.ID, &item.OrderItemID, &item.Quantity, &item.Amount); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// Replaces the items and details of an open order in place, keeping its ID, creation date and status.
+// Orders with loyalty points redeemed on them are refused, their lines are changed with PATCH
 func (repo *NewOrderRepo) UpdateOrder(order models.Order, id int) (int, error) {
-	date := time.Now()
-	code, err := repo.CheckOrder(order)
+	code, err := repo.CheckProducts(order)
 	if err != nil {
 		return code, err
 	}
-	order.CreatedAt = date
-	order.Status = "active"
+	needInventory, err := repo.Get_Need_Inventory(order)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
 
 	// Marshal `special_instructions` to JSON
 	specialInstructionsJSON, err := json.Marshal(order.SpecialInstructions)
@@ -404,10 +719,6 @@ func (repo *NewOrderRepo) UpdateOrder(order models.Order, id int) (int, error) {
 	if err != nil {
 		return http.StatusInternalServerError, err
 	}
-	err = repo.GetTotalAmount(&order)
-	if err != nil {
-		return http.StatusInternalServerError, err
-	}
 	exist, err := repo.IsOrderExist(id)
 	if err != nil {
 		return http.StatusInternalServerError, err
@@ -415,83 +726,148 @@ func (repo *NewOrderRepo) UpdateOrder(order models.Order, id int) (int, error) {
 	if !exist {
 		return http.StatusNotFound, errors.New("order not found")
 	}
-	if exist := DefaultCustomerRepo(repo.DB).IsCustomerExist(order.CustomerID); !exist {
-		return http.StatusBadRequest, errors.New("customer id is not exist")
+	if exist := DefaultCustomerRepo(repo.DB).IsCustomerActive(order.CustomerID); !exist {
+		return http.StatusBadRequest, errors.New("customer id is not exist or archived")
+	}
+	// The promotions are priced as of the date the order was created
+	order.CreatedAt, err = repo.orderDate(id)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	err = repo.GetTotalAmount(&order)
+	if errors.Is(err, ErrPromoCodeNotApplicable) {
+		return http.StatusBadRequest, err
+	}
+	if err != nil {
+		return http.StatusInternalServerError, err
 	}
 	tx, err := repo.DB.Begin()
 	if err != nil {
 		return http.StatusInternalServerError, err
 	}
-	_, err = tx.Exec(`DELETE FROM orders
-		WHERE order_id=$1
-	`, id)
+	// Only orders that are not being prepared yet can be changed
+	result, err := tx.Exec(`UPDATE orders
+	SET customer_id=$1, total_amount=$2, special_instructions=$3, promo_code=NULLIF($4::text, '')
+	WHERE order_id=$5 AND status IN ('pending', 'active')
+	`, order.CustomerID, order.TotalAmount, specialInstructionsJSON, order.PromoCode, id)
 	if err != nil {
 		tx.Rollback()
 		return http.StatusInternalServerError, err
 	}
-	order.ID = id
-	items := order.Items
-
-	// Insert order
-	_, err = tx.Exec(`
-		INSERT INTO orders (order_id, customer_id, total_amount, status, special_instructions)
-		VALUES ($1, $2, $3, $4, $5)
-	`, order.ID, order.CustomerID, order.TotalAmount, order.Status, specialInstructionsJSON)
+	affected, err := result.RowsAffected()
 	if err != nil {
 		tx.Rollback()
 		return http.StatusInternalServerError, err
 	}
-
-	// Insert order items
-	for _, item := range items {
-		customizationsJSON, err := json.Marshal(item.Customizations)
-		if err != nil {
-			tx.Rollback()
-			return http.StatusInternalServerError, err
-		}
-		_, err = tx.Exec(`
-			INSERT INTO order_items (menu_item_id, order_id, customizations, price_at_order_time, quantity)
-			VALUES ($1, $2, $3, $4, $5)
-		`, item.MenuItemID, order.ID, customizationsJSON, item.PriceAtOrderTime, item.Quantity)
-		if err != nil {
-			tx.Rollback()
-			return http.StatusInternalServerError, err
-		}
+	if affected == 0 {
+		tx.Rollback()
+		return http.StatusConflict, ErrOrderNotEditable
 	}
-	_, err = tx.Exec(`INSERT INTO order_status_history(order_id,status,changed_at)
-	VALUES($1,'active', $2)
-	`, order.ID, date)
+	// Replacing the lines would drop the redemptions on them, the order row is locked by the update above
+	var redeemed bool
+	err = tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM order_discounts WHERE order_id=$1 AND points > 0)`, id).Scan(&redeemed)
+	if err != nil {
+		tx.Rollback()
+		return http.StatusInternalServerError, err
+	}
+	if redeemed {
+		tx.Rollback()
+		return http.StatusConflict, ErrOrderHasRedemptions
+	}
+	_, err = tx.Exec(`DELETE FROM order_items WHERE order_id=$1`, id)
+	if err != nil {
+		tx.Rollback()
+		return http.StatusInternalServerError, err
+	}
+	err = insertOrderItems(tx, id, order.Items)
+	if err != nil {
+		tx.Rollback()
+		return http.StatusInternalServerError, err
+	}
+	err = repricePromotions(tx, id)
+	if err != nil {
+		tx.Rollback()
+		return http.StatusInternalServerError, err
+	}
+	// Reserve the new items instead of the old ones
+	inventRepo := DefaultInventRepo(repo.DB)
+	err = inventRepo.ReleaseReservation(tx, id)
 	if err != nil {
 		tx.Rollback()
 		return http.StatusInternalServerError, err
 	}
-	if tx.Commit() != nil {
+	err = inventRepo.ReserveInventory(tx, id, needInventory)
+	if errors.Is(err, ErrNotEnoughInventory) {
 		tx.Rollback()
+		return http.StatusConflict, err
+	}
+	if err != nil {
+		tx.Rollback()
+		return http.StatusInternalServerError, err
+	}
+	if err = tx.Commit(); err != nil {
 		return http.StatusInternalServerError, err
 	}
-	return http.StatusOK, nil // Commit the transaction
+	return http.StatusOK, nil
 }
 
-// Deducts are required inventory items from database
-func (repo *NewOrderRepo) UseInventory(needInventory map[string]float64) error {
-	for ingredientID, quantityUsed := range needInventory {
-		_, err := repo.DB.Exec(`
-			UPDATE inventory
-			SET stock_level = stock_level - $1
-			WHERE inventory_id = $2 AND stock_level >= $1
-		`, quantityUsed, ingredientID)
+// Applies line-item edits to an open order within the given transaction.
+// The order carries the special instructions, prices of the given items are already set.
+// The promotions are priced again and the total amount is set from the lines less the discounts left on the order
+func (repo *NewOrderRepo) PatchOrder(tx *sql.Tx, order models.Order, added, updated []models.OrderItem, removed []int) error {
+	specialInstructionsJSON, err := json.Marshal(order.SpecialInstructions)
+	if err != nil {
+		return err
+	}
+	result, err := tx.Exec(`UPDATE orders
+	SET special_instructions=$1
+	WHERE order_id=$2 AND status IN ('pending', 'active')
+	`, specialInstructionsJSON, order.ID)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrOrderNotEditable
+	}
+	for _, item := range updated {
+		_, err = tx.Exec(`UPDATE order_items
+		SET quantity=$1, price_at_order_time=$2
+		WHERE order_item_id=$3 AND order_id=$4
+		`, item.Quantity, item.PriceAtOrderTime, item.ID, order.ID)
 		if err != nil {
 			return err
 		}
 	}
-	return nil
+	if len(removed) > 0 {
+		// Points redeemed on removed lines go back to the customer
+		err = restoreRedeemedPoints(tx, order.ID, removed)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`DELETE FROM order_items
+		WHERE order_id=$1 AND order_item_id = ANY($2::int[])
+		`, order.ID, pq.Array(removed))
+		if err != nil {
+			return err
+		}
+	}
+	err = insertOrderItems(tx, order.ID, added)
+	if err != nil {
+		return err
+	}
+	return repricePromotions(tx, order.ID)
+}
+
+// Redeems the loyalty points or reward of the order within the transaction the order is saved in
+func (repo *NewOrderRepo) RedeemLoyalty(tx *sql.Tx, order models.Order) error {
+	return redeemLoyalty(tx, order)
 }
 
-func (repo *NewOrderRepo) GetLastOrderId() (int, error) {
-	var lastID int
-	err := repo.DB.QueryRow(`SELECT order_id FROM orders
-	ORDER BY order_date DESC
-	LIMIT 1;
-	`).Scan(&lastID)
-	return lastID, err
+// Retrieves what was charged for every line of the order after discounts, keyed by order_item_id
+func (repo *NewOrderRepo) GetLineNetAmounts(order_id int) (map[int]float64, error) {
+	return lineNetAmounts(repo.DB, order_id)
 }
@@ -0,0 +1,126 @@
+package dal
+
+import (
+	"frappuccino/models"
+
+	"github.com/lib/pq"
+)
+
+// Retrieves how many servings of each menu item can be made from current stock, keyed by menu_item_id.
+// Stock held by open orders and expired stock are not counted, each ingredient gives its stock divided by the recipe quantity in stock units
+func (repo *NewMenuRepo) getItemServings(ids []int) (map[int]int, error) {
+	rows, err := repo.DB.Query(`SELECT ing.menu_item_id, MIN(GREATEST(FLOOR((i.stock_level - COALESCE(r.reserved, 0) - COALESCE(e.expired, 0)) / to_stock_unit(ing.quantity, ing.unit, ing.inventory_id)), 0)::int)
+	FROM menu_item_ingredients ing
+	INNER JOIN inventory i USING(inventory_id)
+	LEFT JOIN (SELECT inventory_id, SUM(quantity) AS reserved FROM inventory_reservations GROUP BY inventory_id) r USING(inventory_id)
+	LEFT JOIN (`+expiredLotsQuery+`) e USING(inventory_id)
+	WHERE ing.menu_item_id = ANY($1::int[])
+	GROUP BY ing.menu_item_id
+	`, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	servings := make(map[int]int)
+	for rows.Next() {
+		var id, count int
+		if err := rows.Scan(&id, &count); err != nil {
+			return nil, err
+		}
+		servings[id] = count
+	}
+	return servings, rows.Err()
+}
+
+// Retrieves how many servings of each variant of the menu items can be made from current stock, keyed by variant_id
+func (repo *NewMenuRepo) getVariantServings(ids []int) (map[int]int, error) {
+	rows, err := repo.DB.Query(`SELECT ing.variant_id, MIN(GREATEST(FLOOR((i.stock_level - COALESCE(r.reserved, 0) - COALESCE(e.expired, 0)) / to_stock_unit(ing.quantity, ing.unit, ing.inventory_id)), 0)::int)
+	FROM variant_ingredients ing
+	INNER JOIN menu_item_variants v USING(variant_id)
+	INNER JOIN inventory i USING(inventory_id)
+	LEFT JOIN (SELECT inventory_id, SUM(quantity) AS reserved FROM inventory_reservations GROUP BY inventory_id) r USING(inventory_id)
+	LEFT JOIN (`+expiredLotsQuery+`) e USING(inventory_id)
+	WHERE v.menu_item_id = ANY($1::int[])
+	GROUP BY ing.variant_id
+	`, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	servings := make(map[int]int)
+	for rows.Next() {
+		var id, count int
+		if err := rows.Scan(&id, &count); err != nil {
+			return nil, err
+		}
+		servings[id] = count
+	}
+	return servings, rows.Err()
+}
+
+// setAvailability fills the available flag and max servings of the menu items, the variants already carry their servings.
+// An item with variants is made through them, so it can make as many servings as its best stocked variant.
+// Modifiers are optional extras and do not limit the servings.
+func (repo *NewMenuRepo) setAvailability(menus []models.Menu) error {
+	if len(menus) == 0 {
+		return nil
+	}
+	ids := make([]int, 0, len(menus))
+	for _, menu := range menus {
+		ids = append(ids, menu.ID)
+	}
+	itemServings, err := repo.getItemServings(ids)
+	if err != nil {
+		return err
+	}
+	for i := range menus {
+		menu := &menus[i]
+		if len(menu.Variants) == 0 {
+			menu.MaxServings = servingsOf(itemServings, menu.ID)
+		} else {
+			menu.MaxServings = new(int)
+			for j := range menu.Variants {
+				variant := &menu.Variants[j]
+				variant.Available = variant.Available && !menu.SoldOut && menu.ArchivedAt == nil
+				if variant.MaxServings == nil {
+					menu.MaxServings = nil
+				} else if menu.MaxServings != nil && *variant.MaxServings > *menu.MaxServings {
+					*menu.MaxServings = *variant.MaxServings
+				}
+			}
+		}
+		menu.Available = !menu.SoldOut && menu.ArchivedAt == nil && canMake(menu.MaxServings)
+	}
+	return nil
+}
+
+// servingsOf returns nil when the recipe is empty, so the servings are not limited by stock
+func servingsOf(servings map[int]int, id int) *int {
+	count, ok := servings[id]
+	if !ok {
+		return nil
+	}
+	return &count
+}
+
+func canMake(maxServings *int) bool {
+	return maxServings == nil || *maxServings > 0
+}
+
+// Marks the menu item as sold out or back on sale, regardless of the stock
+func (repo *NewMenuRepo) Set_SoldOut(id int, soldOut bool) error {
+	_, err := repo.DB.Exec(`UPDATE menu_items
+	SET sold_out=$1
+	WHERE menu_item_id=$2
+	`, soldOut, id)
+	return err
+}
+
+// Checks is the menu item marked as sold out
+func (repo *NewOrderRepo) IsSoldOut(menu_item_id int) (bool, error) {
+	var soldOut bool
+	err := repo.DB.QueryRow(`SELECT sold_out FROM menu_items
+	WHERE menu_item_id=$1
+	`, menu_item_id).Scan(&soldOut)
+	return soldOut, err
+}
@@ -0,0 +1,113 @@
+package dal
+
+import (
+	"database/sql"
+	"frappuccino/models"
+	"math"
+	"sort"
+)
+
+// Gets the unit cost of every inventory item from its purchases in inventory_transactions.
+// The price of a transaction is paid for its whole quantity, converted to the current stock unit, weighted_average divides all paid prices by all bought quantities,
+// last_purchase takes the latest transaction only. Items that were never purchased have no cost and are not priced.
+func (repo *NewInventRepo) GetUnitCosts(method string) (map[int]models.IngredientCost, error) {
+	return getUnitCosts(repo.DB, method)
+}
+
+func getUnitCosts(q DBTX, method string) (map[int]models.IngredientCost, error) {
+	rows, err := q.Query(`SELECT i.inventory_id, i.name,
+	CASE WHEN $1::text = 'last_purchase'
+		THEN (ARRAY_AGG(t.price / to_stock_unit(t.quantity, t.unit, i.inventory_id) ORDER BY t.transaction_date DESC, t.transaction_id DESC))[1]
+		ELSE SUM(t.price) / NULLIF(SUM(to_stock_unit(t.quantity, t.unit, i.inventory_id)), 0)
+	END AS unit_cost
+	FROM inventory i
+	LEFT JOIN inventory_transactions t USING(inventory_id)
+	GROUP BY i.inventory_id, i.name
+	`, method)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	costs := make(map[int]models.IngredientCost)
+	for rows.Next() {
+		var cost models.IngredientCost
+		var unitCost sql.NullFloat64
+		if err := rows.Scan(&cost.InventoryID, &cost.Name, &unitCost); err != nil {
+			return nil, err
+		}
+		cost.UnitCost = unitCost.Float64
+		cost.Priced = unitCost.Valid
+		costs[cost.InventoryID] = cost
+	}
+	return costs, rows.Err()
+}
+
+// Calculates the recipe cost of the menu item and each of its variants by the costing method
+func (repo *NewMenuRepo) GetMenuCost(id int, method string) (models.RecipeCost, error) {
+	menu, err := repo.GetMenu(id)
+	if err != nil {
+		return models.RecipeCost{}, err
+	}
+	unitCosts, err := DefaultInventRepo(repo.DB).GetUnitCosts(method)
+	if err != nil {
+		return models.RecipeCost{}, err
+	}
+	quantities := make(map[int]float64)
+	for _, ingredient := range menu.ItemIngredient {
+		quantities[ingredient.InventoryID] += ingredient.StockQuantity
+	}
+	cost := recipeCost(unitCosts, quantities, menu.Price)
+	cost.MenuItemID = menu.ID
+	cost.Name = menu.Name
+	cost.Method = method
+	for _, variant := range menu.Variants {
+		quantities := make(map[int]float64)
+		for _, ingredient := range variant.Ingredients {
+			quantities[ingredient.InventoryID] += ingredient.StockQuantity
+		}
+		variantCost := recipeCost(unitCosts, quantities, variant.Price)
+		variantCost.MenuItemID = menu.ID
+		variantCost.VariantID = variant.ID
+		variantCost.Name = menu.Name
+		variantCost.Variant = variant.Name
+		variantCost.Method = method
+		cost.Variants = append(cost.Variants, variantCost)
+	}
+	return cost, nil
+}
+
+// recipeCost prices one serving of the recipe, quantities are keyed by inventory_id
+func recipeCost(unitCosts map[int]models.IngredientCost, quantities map[int]float64, price float64) models.RecipeCost {
+	cost := models.RecipeCost{Price: price, Complete: true}
+	for inventoryID, quantity := range quantities {
+		ingredient := unitCosts[inventoryID]
+		ingredient.InventoryID = inventoryID
+		ingredient.Quantity = quantity
+		ingredient.Cost = roundMoney(quantity * ingredient.UnitCost)
+		ingredient.UnitCost = math.Round(ingredient.UnitCost*10000) / 10000
+		cost.Cost += quantity * unitCosts[inventoryID].UnitCost
+		if !ingredient.Priced {
+			cost.Complete = false
+		}
+		cost.Ingredients = append(cost.Ingredients, ingredient)
+	}
+	sort.Slice(cost.Ingredients, func(i, j int) bool {
+		return cost.Ingredients[i].InventoryID < cost.Ingredients[j].InventoryID
+	})
+	cost.Cost = roundMoney(cost.Cost)
+	cost.Margin = roundMoney(price - cost.Cost)
+	cost.MarginPercent = marginPercent(cost.Margin, price)
+	return cost
+}
+
+// marginPercent is the share of the margin in the price, zero when nothing was charged
+func marginPercent(margin, price float64) float64 {
+	if price == 0 {
+		return 0
+	}
+	return roundMoney(margin / price * 100)
+}
+
+func roundMoney(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
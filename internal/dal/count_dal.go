@@ -0,0 +1,306 @@
+package dal
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"frappuccino/models"
+	"math"
+	"strconv"
+
+	"github.com/lib/pq"
+)
+
+// ErrCountNotOpen is returned when a posted stock count is changed
+var ErrCountNotOpen = errors.New("stock count is already posted")
+
+// ErrCountAlreadyOpen is returned when a count is opened while another one is still open
+var ErrCountAlreadyOpen = errors.New("another stock count is still open")
+
+// ErrCountEmpty is returned when a count without counted lines is posted
+var ErrCountEmpty = errors.New("stock count has no counted items")
+
+type CountRepo interface {
+	GetCounts() ([]models.StockCount, error)
+	GetCount(id int) (models.StockCount, error)
+	IsCountExist(id int) (bool, error)
+	OpenCount(note, user string) (int, error)
+	SaveCountLines(id int, lines []models.CountLineRequest) error
+	PostCount(id int, user string) error
+	DeleteCount(id int) error
+}
+
+type NewCountRepo struct {
+	DB *sql.DB
+}
+
+func DefaultCountRepo(db *sql.DB) *NewCountRepo {
+	return &NewCountRepo{DB: db}
+}
+
+// Retrieves all stock counts, newest first, with their variance cost but without lines
+func (repo *NewCountRepo) GetCounts() ([]models.StockCount, error) {
+	unitCosts, err := DefaultInventRepo(repo.DB).GetUnitCosts("weighted_average")
+	if err != nil {
+		return nil, err
+	}
+	counts, err := repo.getCountHeaders(0)
+	if err != nil {
+		return nil, err
+	}
+	for i := range counts {
+		lines, err := repo.getCountLines(counts[i].ID, unitCosts)
+		if err != nil {
+			return nil, err
+		}
+		setCountTotals(&counts[i], lines)
+	}
+	return counts, nil
+}
+
+// Retrieves the stock count with its lines. While the count is open the lines are compared with the current stock
+func (repo *NewCountRepo) GetCount(id int) (models.StockCount, error) {
+	unitCosts, err := DefaultInventRepo(repo.DB).GetUnitCosts("weighted_average")
+	if err != nil {
+		return models.StockCount{}, err
+	}
+	counts, err := repo.getCountHeaders(id)
+	if err != nil {
+		return models.StockCount{}, err
+	}
+	if len(counts) == 0 {
+		return models.StockCount{}, sql.ErrNoRows
+	}
+	count := counts[0]
+	count.Lines, err = repo.getCountLines(id, unitCosts)
+	if err != nil {
+		return count, err
+	}
+	setCountTotals(&count, count.Lines)
+	return count, nil
+}
+
+// getCountHeaders loads one count by ID, or all of them when the ID is 0
+func (repo *NewCountRepo) getCountHeaders(id int) ([]models.StockCount, error) {
+	rows, err := repo.DB.Query(`SELECT count_id, status, COALESCE(note, ''), COALESCE(opened_by, ''), opened_at,
+	COALESCE(posted_by, ''), posted_at
+	FROM stock_counts
+	WHERE $1::int = 0 OR count_id = $1
+	ORDER BY opened_at DESC, count_id DESC
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	counts := []models.StockCount{}
+	for rows.Next() {
+		var count models.StockCount
+		err := rows.Scan(&count.ID, &count.Status, &count.Note, &count.OpenedBy, &count.OpenedAt, &count.PostedBy, &count.PostedAt)
+		if err != nil {
+			return nil, err
+		}
+		counts = append(counts, count)
+	}
+	return counts, rows.Err()
+}
+
+// getCountLines loads the counted lines, lines of a posted count keep the stock, cost and unit they were posted with,
+// lines of an open count are shown in the current stock unit
+func (repo *NewCountRepo) getCountLines(id int, unitCosts map[int]models.IngredientCost) ([]models.StockCountLine, error) {
+	rows, err := repo.DB.Query(`SELECT l.inventory_id, i.name,
+	CASE WHEN l.expected_quantity IS NULL THEN i.unit_type ELSE l.unit END,
+	CASE WHEN l.expected_quantity IS NULL THEN to_stock_unit(l.counted_quantity, l.unit, l.inventory_id) ELSE l.counted_quantity END,
+	COALESCE(l.expected_quantity, i.stock_level), l.unit_cost, l.counted_at
+	FROM stock_count_lines l
+	INNER JOIN inventory i USING(inventory_id)
+	WHERE l.count_id = $1
+	ORDER BY l.inventory_id
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var lines []models.StockCountLine
+	for rows.Next() {
+		var line models.StockCountLine
+		var unitCost sql.NullFloat64
+		err := rows.Scan(&line.InventoryID, &line.Name, &line.Unit, &line.Counted, &line.Expected, &unitCost, &line.CountedAt)
+		if err != nil {
+			return nil, err
+		}
+		line.UnitCost = unitCost.Float64
+		if !unitCost.Valid {
+			line.UnitCost = unitCosts[line.InventoryID].UnitCost
+		}
+		line.Variance = math.Round((line.Counted-line.Expected)*1000) / 1000
+		line.VarianceCost = roundMoney(line.Variance * line.UnitCost)
+		line.UnitCost = math.Round(line.UnitCost*10000) / 10000
+		lines = append(lines, line)
+	}
+	return lines, rows.Err()
+}
+
+func setCountTotals(count *models.StockCount, lines []models.StockCountLine) {
+	count.ItemsCounted = len(lines)
+	count.VarianceCost = 0
+	for _, line := range lines {
+		count.VarianceCost += line.VarianceCost
+	}
+	count.VarianceCost = roundMoney(count.VarianceCost)
+}
+
+// Checks is the stock count exist
+func (repo *NewCountRepo) IsCountExist(id int) (bool, error) {
+	var count int
+	err := repo.DB.QueryRow(`SELECT COUNT(*) FROM stock_counts WHERE count_id=$1`, id).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// Opens a new stock count, returns its ID. Only one count can be open at a time
+func (repo *NewCountRepo) OpenCount(note, user string) (int, error) {
+	var id int
+	err := repo.DB.QueryRow(`INSERT INTO stock_counts (note, opened_by)
+	VALUES (NULLIF($1, ''), NULLIF($2, ''))
+	RETURNING count_id
+	`, note, user).Scan(&id)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return 0, ErrCountAlreadyOpen
+	}
+	return id, err
+}
+
+// Saves counted quantities converted to the stock unit, counting an item again replaces its earlier quantity
+func (repo *NewCountRepo) SaveCountLines(id int, lines []models.CountLineRequest) error {
+	return WithTx(repo.DB, func(tx *sql.Tx) error {
+		if err := lockOpenCount(tx, id); err != nil {
+			return err
+		}
+		for _, line := range lines {
+			factor, err := stockUnitFactor(tx, line.InventoryID, line.Unit, true)
+			if err != nil {
+				return err
+			}
+			_, err = tx.Exec(`INSERT INTO stock_count_lines (count_id, inventory_id, counted_quantity, unit)
+			SELECT $1, inventory_id, $3, unit_type
+			FROM inventory
+			WHERE inventory_id = $2
+			ON CONFLICT (count_id, inventory_id) DO UPDATE
+			SET counted_quantity = EXCLUDED.counted_quantity, unit = EXCLUDED.unit, counted_at = NOW()
+			`, id, line.InventoryID, line.Quantity*factor)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Posts the stock count: every counted item gets a count adjustment from its current stock level to the counted quantity,
+// the stock level and weighted average cost at that moment are kept on the line in the stock unit of that moment
+func (repo *NewCountRepo) PostCount(id int, user string) error {
+	return WithTx(repo.DB, func(tx *sql.Tx) error {
+		if err := lockOpenCount(tx, id); err != nil {
+			return err
+		}
+		counted, err := countedQuantities(tx, id)
+		if err != nil {
+			return err
+		}
+		if len(counted) == 0 {
+			return ErrCountEmpty
+		}
+		ids := sortedInventoryIDs(counted)
+		stockLevels, err := lockInventory(tx, ids)
+		if err != nil {
+			return err
+		}
+		unitCosts, err := getUnitCosts(tx, "weighted_average")
+		if err != nil {
+			return err
+		}
+		for _, ingredientID := range ids {
+			inventoryID, err := strconv.Atoi(ingredientID)
+			if err != nil {
+				return err
+			}
+			_, err = tx.Exec(`UPDATE stock_count_lines l
+			SET expected_quantity = $1, unit_cost = $2,
+				counted_quantity = to_stock_unit(l.counted_quantity, l.unit, l.inventory_id), unit = i.unit_type
+			FROM inventory i
+			WHERE l.count_id = $3 AND l.inventory_id = $4 AND i.inventory_id = l.inventory_id
+			`, stockLevels[ingredientID], unitCosts[inventoryID].UnitCost, id, inventoryID)
+			if err != nil {
+				return err
+			}
+			err = applyStockMovement(tx, models.StockMovement{
+				InventoryID: inventoryID,
+				Type:        models.MovementCountAdjustment,
+				Quantity:    math.Round((counted[ingredientID]-stockLevels[ingredientID])*1000) / 1000,
+				Reason:      fmt.Sprintf("stock count %d", id),
+				CreatedBy:   user,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		_, err = tx.Exec(`UPDATE stock_counts
+		SET status = 'posted', posted_by = NULLIF($1, ''), posted_at = NOW()
+		WHERE count_id = $2
+		`, user, id)
+		return err
+	})
+}
+
+// Deletes an open stock count with its lines, posted counts stay in history
+func (repo *NewCountRepo) DeleteCount(id int) error {
+	result, err := repo.DB.Exec(`DELETE FROM stock_counts WHERE count_id=$1 AND status='open'`, id)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrCountNotOpen
+	}
+	return nil
+}
+
+// lockOpenCount locks the count row and checks that it is still open
+func lockOpenCount(tx *sql.Tx, id int) error {
+	var status string
+	err := tx.QueryRow(`SELECT status FROM stock_counts WHERE count_id=$1 FOR UPDATE`, id).Scan(&status)
+	if err != nil {
+		return err
+	}
+	if status != models.CountOpen {
+		return ErrCountNotOpen
+	}
+	return nil
+}
+
+// countedQuantities gets the counted quantities of the count in the stock unit keyed by inventory_id
+func countedQuantities(tx *sql.Tx, id int) (map[string]float64, error) {
+	rows, err := tx.Query(`SELECT inventory_id, ROUND(to_stock_unit(counted_quantity, unit, inventory_id), 3)
+	FROM stock_count_lines
+	WHERE count_id=$1`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	counted := make(map[string]float64)
+	for rows.Next() {
+		var inventoryID int
+		var quantity float64
+		if err := rows.Scan(&inventoryID, &quantity); err != nil {
+			return nil, err
+		}
+		counted[strconv.Itoa(inventoryID)] = quantity
+	}
+	return counted, rows.Err()
+}
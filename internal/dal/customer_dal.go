@@ -2,17 +2,22 @@ package dal
 
 import (
 	"database/sql"
+	"encoding/json"
 	"frappuccino/models"
 )
 
 type CustomerRepo interface {
-	SaveCustomer(customer models.Customer) error
+	SaveCustomer(customer models.Customer) (int, error)
 	IsEmailUnique(email string) (bool, error)
 	GetAllCustomers() ([]models.Customer, error)
 	GetCustomerByID(id int) (models.Customer, error)
 	UpdateCustomer(customer models.Customer, id int) error
-	DeleteCustomer(id int) error
+	ArchiveCustomer(id int) error
+	PurgeCustomer(id int) error
 	IsCustomerExist(id int) bool
+	IsCustomerActive(id int) bool
+	GetCustomerOrders(id int, status, startDate, endDate string, page, pageSize int) ([]models.Order, int, error)
+	GetCustomerSummary(id int) (models.CustomerSummary, error)
 }
 
 type NewCustomerRepo struct {
@@ -23,19 +28,21 @@ func DefaultCustomerRepo(db *sql.DB) *NewCustomerRepo {
 	return &NewCustomerRepo{DB: db}
 }
 
-// Saves Customer information to the Database
-func (repo *NewCustomerRepo) SaveCustomer(customer models.Customer) error {
+// Saves Customer information to the Database, returns the new customer ID
+func (repo *NewCustomerRepo) SaveCustomer(customer models.Customer) (int, error) {
 	tx, err := repo.DB.Begin()
 	if err != nil {
-		return err
+		return 0, err
 	}
-	_, err = tx.Exec(`INSERT INTO customers(name, email, number)
-	VALUES($1,$2,$3)`, customer.Name, customer.Email, customer.Number)
+	var id int
+	err = tx.QueryRow(`INSERT INTO customers(name, email, number)
+	VALUES($1,$2,$3)
+	RETURNING customer_id`, customer.Name, customer.Email, customer.Number).Scan(&id)
 	if err != nil {
 		tx.Rollback()
-		return err
+		return 0, err
 	}
-	return tx.Commit()
+	return id, tx.Commit()
 }
 
 // Checks is customer's email unique in the database
@@ -51,9 +58,9 @@ func (repo *NewCustomerRepo) IsEmailUnique(email string) (bool, error) {
 	return count == 0, nil
 }
 
-// Retrieves all Customers information from database
+// Retrieves all Customers information from database, archived customers are skipped
 func (repo *NewCustomerRepo) GetAllCustomers() ([]models.Customer, error) {
-	rows, err := repo.DB.Query("SELECT customer_id, name, email, number FROM customers")
+	rows, err := repo.DB.Query("SELECT customer_id, name, email, number FROM customers WHERE archived_at IS NULL")
 	if err != nil {
 		return nil, err
 	}
@@ -72,8 +79,8 @@ func (repo *NewCustomerRepo) GetAllCustomers() ([]models.Customer, error) {
 // Retrieve information about customer by ID from database
 func (repo *NewCustomerRepo) GetCustomerByID(id int) (models.Customer, error) {
 	var customer models.Customer
-	err := repo.DB.QueryRow("SELECT customer_id, name, email, number FROM customers WHERE customer_id=$1", id).
-		Scan(&customer.Customer_id, &customer.Name, &customer.Email, &customer.Number)
+	err := repo.DB.QueryRow("SELECT customer_id, name, email, number, archived_at FROM customers WHERE customer_id=$1", id).
+		Scan(&customer.Customer_id, &customer.Name, &customer.Email, &customer.Number, &customer.ArchivedAt)
 	if err != nil {
 		return customer, err
 	}
@@ -97,19 +104,19 @@ func (repo *NewCustomerRepo) UpdateCustomer(customer models.Customer, id int) er
 	return tx.Commit()
 }
 
-// Delete information about Customer
-func (repo *NewCustomerRepo) DeleteCustomer(id int) error {
-	tx, err := repo.DB.Begin()
-	if err != nil {
-		return err
-	}
-	_, err = tx.Exec(`DELETE FROM customers
+// Archives the Customer, orders of the customer stay untouched
+func (repo *NewCustomerRepo) ArchiveCustomer(id int) error {
+	_, err := repo.DB.Exec(`UPDATE customers
+	SET archived_at=NOW()
+	WHERE customer_id=$1 AND archived_at IS NULL`, id)
+	return err
+}
+
+// Deletes the Customer from database, fails with ErrStillReferenced while the customer has orders
+func (repo *NewCustomerRepo) PurgeCustomer(id int) error {
+	_, err := repo.DB.Exec(`DELETE FROM customers
 	WHERE customer_id=$1`, id)
-	if err != nil {
-		tx.Rollback()
-		return err
-	}
-	return tx.Commit()
+	return referencedErr(err)
 }
 
 // Check is Customer exist by ID
@@ -118,3 +125,118 @@ func (repo *NewCustomerRepo) IsCustomerExist(id int) bool {
 	repo.DB.QueryRow("SELECT COUNT(*) FROM customers WHERE customer_id=$1", id).Scan(&count)
 	return count != 0
 }
+
+// Check is Customer exist by ID and not archived, only such customers can make new orders
+func (repo *NewCustomerRepo) IsCustomerActive(id int) bool {
+	var count int
+	repo.DB.QueryRow("SELECT COUNT(*) FROM customers WHERE customer_id=$1 AND archived_at IS NULL", id).Scan(&count)
+	return count != 0
+}
+
+// favouriteItemsLimit is how many favourite items the customer summary lists
+const favouriteItemsLimit = 5
+
+// Retrieves one page of the orders of the customer with their items, newest first, and the number of orders matching.
+// Status and the order dates between start and end, both included, are left out of the filter when empty
+func (repo *NewCustomerRepo) GetCustomerOrders(id int, status, startDate, endDate string, page, pageSize int) ([]models.Order, int, error) {
+	const filter = `WHERE customer_id = $1
+	AND ($2::text = '' OR status::text = $2::text)
+	AND ($3::text = '' OR order_date >= NULLIF($3::text, '')::date)
+	AND ($4::text = '' OR order_date < NULLIF($4::text, '')::date + 1)`
+	var total int
+	err := repo.DB.QueryRow(`SELECT COUNT(*) FROM orders `+filter, id, status, startDate, endDate).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+	rows, err := repo.DB.Query(`SELECT order_id, customer_id, order_date, status, total_amount, special_instructions
+	FROM orders `+filter+`
+	ORDER BY order_date DESC, order_id DESC
+	LIMIT $5 OFFSET $6
+	`, id, status, startDate, endDate, pageSize, (page-1)*pageSize)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+	orders := []models.Order{}
+	for rows.Next() {
+		var order models.Order
+		var specialInstructions []byte
+		if err := rows.Scan(&order.ID, &order.CustomerID, &order.CreatedAt, &order.Status, &order.TotalAmount, &specialInstructions); err != nil {
+			return nil, 0, err
+		}
+		if len(specialInstructions) > 0 {
+			if err := json.Unmarshal(specialInstructions, &order.SpecialInstructions); err != nil {
+				return nil, 0, err
+			}
+		}
+		orders = append(orders, order)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+	for i := range orders {
+		orders[i].Items, err = getOrderItems(repo.DB, orders[i].ID)
+		if err != nil {
+			return nil, 0, err
+		}
+		orders[i].Discounts, err = getOrderDiscounts(repo.DB, orders[i].ID)
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+	return orders, total, nil
+}
+
+// Retrieves the lifetime spend, visits and favourite items of the customer. Visits are the dates of orders not cancelled
+func (repo *NewCustomerRepo) GetCustomerSummary(id int) (models.CustomerSummary, error) {
+	summary := models.CustomerSummary{CustomerID: id, FavouriteItems: []models.FavouriteItem{}}
+	err := repo.DB.QueryRow(`SELECT c.name,
+	COALESCE(SUM(o.total_amount) FILTER (WHERE o.status = 'closed'), 0),
+	COALESCE(SUM(r.refunded) FILTER (WHERE o.status = 'closed'), 0),
+	COUNT(o.order_id) FILTER (WHERE o.status = 'closed'),
+	COUNT(o.order_id) FILTER (WHERE o.status NOT IN ('closed', 'cancelled')),
+	MIN(o.order_date) FILTER (WHERE o.status <> 'cancelled'),
+	MAX(o.order_date) FILTER (WHERE o.status <> 'cancelled')
+	FROM customers c
+	LEFT JOIN orders o USING(customer_id)
+	LEFT JOIN (SELECT order_id, SUM(amount) AS refunded FROM order_refunds GROUP BY order_id) r USING(order_id)
+	WHERE c.customer_id = $1
+	GROUP BY c.customer_id, c.name
+	`, id).Scan(&summary.Name, &summary.LifetimeSpend, &summary.Refunded, &summary.OrderCount, &summary.OpenOrders,
+		&summary.FirstVisit, &summary.LastVisit)
+	if err != nil {
+		return summary, err
+	}
+	summary.LifetimeSpend = roundMoney(summary.LifetimeSpend + summary.Refunded)
+	summary.Refunded = roundMoney(-summary.Refunded)
+	if summary.OrderCount > 0 {
+		summary.AverageTicket = roundMoney(summary.LifetimeSpend / float64(summary.OrderCount))
+	}
+	rows, err := repo.DB.Query(`SELECT oi.menu_item_id, m.name, SUM(oi.quantity - COALESCE(r.refunded, 0)),
+	COUNT(DISTINCT oi.order_id), SUM(oi.price_at_order_time + COALESCE(r.amount, 0))
+	FROM orders o
+	INNER JOIN order_items oi USING(order_id)
+	INNER JOIN menu_items m ON m.menu_item_id = oi.menu_item_id
+	LEFT JOIN (SELECT order_item_id, SUM(quantity) AS refunded, SUM(amount) AS amount FROM order_refund_items GROUP BY order_item_id) r
+		ON r.order_item_id = oi.order_item_id
+	WHERE o.customer_id = $1 AND o.status = 'closed'
+	GROUP BY oi.menu_item_id, m.name
+	HAVING SUM(oi.quantity - COALESCE(r.refunded, 0)) > 0
+	ORDER BY 3 DESC, 4 DESC, m.name
+	LIMIT $2
+	`, id, favouriteItemsLimit)
+	if err != nil {
+		return summary, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var item models.FavouriteItem
+		if err := rows.Scan(&item.MenuItemID, &item.Name, &item.Quantity, &item.Orders, &item.Spend); err != nil {
+			return summary, err
+		}
+		item.Spend = roundMoney(item.Spend)
+		summary.FavouriteItems = append(summary.FavouriteItems, item)
+	}
+	return summary, rows.Err()
+}
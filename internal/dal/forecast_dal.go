@@ -0,0 +1,176 @@
+package dal
+
+import (
+	"frappuccino/models"
+	"math"
+	"sort"
+	"time"
+)
+
+// forecastAverageWindow is the number of last history days the moving average is taken over,
+// shorter histories use their whole weeks so every weekday weighs the same
+const forecastAverageWindow = 28
+
+// Projects the usage of every inventory item over the next days from the orders closed in the history days before today.
+// The level is the moving average of the daily usage over the last days of history, it is spread over the week by
+// the weekday index, the average usage on a weekday against the average day. The stock-out date is the first day
+// the expected usage from today runs past the stock level. Items running out first come first
+func (repo *DefReportRepo) GetForecast(days, history int) (models.ForecastReport, error) {
+	report := models.ForecastReport{Days: days, HistoryDays: history, AverageWindow: min(forecastAverageWindow, history/7*7), Items: []models.ItemForecast{}}
+	today := time.Now()
+	today = time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, time.UTC)
+	start := today.AddDate(0, 0, -history)
+	usage, err := repo.dailyUsage(start.Format("2006-01-02"), today.AddDate(0, 0, -1).Format("2006-01-02"))
+	if err != nil {
+		return report, err
+	}
+	rows, err := repo.DB.Query(`SELECT inventory_id, name, unit_type, stock_level
+	FROM inventory
+	WHERE archived_at IS NULL
+	ORDER BY inventory_id
+	`)
+	if err != nil {
+		return report, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var item models.ItemForecast
+		if err := rows.Scan(&item.InventoryID, &item.Name, &item.Unit, &item.StockLevel); err != nil {
+			return report, err
+		}
+		series := make([]float64, history)
+		for day, quantity := range usage[item.InventoryID] {
+			if i := int(day.Sub(start).Hours() / 24); i >= 0 && i < history {
+				series[i] = quantity
+			}
+		}
+		average := movingAverage(series, report.AverageWindow)
+		item.WeekdayIndex = weekdayIndex(series, start)
+		item.Days = make([]models.ForecastDay, days)
+		cumulative := 0.0
+		for i := range item.Days {
+			day := today.AddDate(0, 0, i)
+			quantity := average * item.WeekdayIndex[day.Weekday()]
+			cumulative += quantity
+			if item.StockOutDate == "" && cumulative > item.StockLevel {
+				item.StockOutDate = day.Format("2006-01-02")
+			}
+			item.Days[i] = models.ForecastDay{Date: day.Format("2006-01-02"), Weekday: day.Weekday().String(), Quantity: roundQuantity(quantity)}
+		}
+		if item.StockOutDate == "" && item.StockLevel <= 0 {
+			item.StockOutDate = today.Format("2006-01-02")
+		}
+		if average > 0 {
+			cover := math.Round(math.Max(item.StockLevel, 0)/average*10) / 10
+			item.DaysOfCover = &cover
+		}
+		for i := range item.WeekdayIndex {
+			item.WeekdayIndex[i] = math.Round(item.WeekdayIndex[i]*100) / 100
+		}
+		item.AverageDailyUsage = roundQuantity(average)
+		item.ForecastUsage = roundQuantity(cumulative)
+		report.Items = append(report.Items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return report, err
+	}
+	sort.SliceStable(report.Items, func(i, j int) bool {
+		a, b := report.Items[i].StockOutDate, report.Items[j].StockOutDate
+		if a == "" || b == "" {
+			return a != "" && b == ""
+		}
+		return a < b
+	})
+	return report, nil
+}
+
+// dailyUsage sums the ingredients of the order lines net of refunds by the day their order was closed, keyed by
+// inventory_id and day. A line uses the recipe of its variant or else of its menu item, plus the ingredients of its modifiers
+func (repo *DefReportRepo) dailyUsage(startDate, endDate string) (map[int]map[time.Time]float64, error) {
+	rows, err := repo.DB.Query(`WITH closed AS (
+		SELECT order_id, MAX(changed_at)::date AS day
+		FROM order_status_history
+		WHERE status = 'closed'
+		GROUP BY order_id
+	), sold AS (
+		SELECT c.day, oi.order_item_id, oi.menu_item_id, oi.variant_id, oi.quantity - COALESCE(r.refunded, 0) AS quantity
+		FROM closed c
+		INNER JOIN order_items oi USING(order_id)
+		LEFT JOIN (SELECT order_item_id, SUM(quantity) AS refunded FROM order_refund_items GROUP BY order_item_id) r
+			ON r.order_item_id = oi.order_item_id
+		WHERE c.day BETWEEN $1::date AND $2::date
+	), used AS (
+		SELECT s.day, mii.inventory_id, s.quantity * to_stock_unit(mii.quantity, mii.unit, mii.inventory_id) AS quantity
+		FROM sold s
+		INNER JOIN menu_item_ingredients mii ON mii.menu_item_id = s.menu_item_id AND s.variant_id IS NULL
+		UNION ALL
+		SELECT s.day, vi.inventory_id, s.quantity * to_stock_unit(vi.quantity, vi.unit, vi.inventory_id)
+		FROM sold s
+		INNER JOIN variant_ingredients vi ON vi.variant_id = s.variant_id
+		UNION ALL
+		SELECT s.day, moi.inventory_id, s.quantity * to_stock_unit(moi.quantity, moi.unit, moi.inventory_id)
+		FROM sold s
+		INNER JOIN order_item_modifiers oim ON oim.order_item_id = s.order_item_id
+		INNER JOIN modifier_option_ingredients moi ON moi.option_id = oim.option_id
+	)
+	SELECT inventory_id, day, SUM(quantity)
+	FROM used
+	GROUP BY inventory_id, day
+	`, startDate, endDate)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	usage := make(map[int]map[time.Time]float64)
+	for rows.Next() {
+		var inventoryID int
+		var day time.Time
+		var quantity float64
+		if err := rows.Scan(&inventoryID, &day, &quantity); err != nil {
+			return nil, err
+		}
+		if usage[inventoryID] == nil {
+			usage[inventoryID] = make(map[time.Time]float64)
+		}
+		day = time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.UTC)
+		usage[inventoryID][day] += quantity
+	}
+	return usage, rows.Err()
+}
+
+// movingAverage averages the last days of the daily series, never below zero
+func movingAverage(series []float64, window int) float64 {
+	window = min(window, len(series))
+	if window == 0 {
+		return 0
+	}
+	var sum float64
+	for _, quantity := range series[len(series)-window:] {
+		sum += quantity
+	}
+	return math.Max(sum/float64(window), 0)
+}
+
+// weekdayIndex compares the average usage on every weekday of the series starting on the start day with the average day.
+// A weekday without history or a series without usage keeps an index of one
+func weekdayIndex(series []float64, start time.Time) [7]float64 {
+	var sums, counts [7]float64
+	var total float64
+	for i, quantity := range series {
+		weekday := start.AddDate(0, 0, i).Weekday()
+		sums[weekday] += quantity
+		counts[weekday]++
+		total += quantity
+	}
+	index := [7]float64{1, 1, 1, 1, 1, 1, 1}
+	if total <= 0 {
+		return index
+	}
+	average := total / float64(len(series))
+	for weekday := range index {
+		if counts[weekday] > 0 {
+			index[weekday] = math.Max(sums[weekday]/counts[weekday]/average, 0)
+		}
+	}
+	return index
+}
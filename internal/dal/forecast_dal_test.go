@@ -0,0 +1,62 @@
+package dal
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestMovingAverage(t *testing.T) {
+	tests := []struct {
+		name   string
+		series []float64
+		window int
+		want   float64
+	}{
+		{"empty series", nil, 7, 0},
+		{"empty window", []float64{1, 2}, 0, 0},
+		{"last days only", []float64{10, 1, 2, 3, 4}, 2, 3.5},
+		{"window longer than the series", []float64{1, 2, 3}, 7, 2},
+		{"returns outweigh usage", []float64{-3, 1}, 2, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := movingAverage(test.series, test.window); math.Abs(got-test.want) > 1e-9 {
+				t.Errorf("movingAverage = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestWeekdayIndex(t *testing.T) {
+	monday := time.Date(2024, time.June, 3, 0, 0, 0, 0, time.UTC)
+	ones := [7]float64{1, 1, 1, 1, 1, 1, 1}
+	twoWeeks := make([]float64, 14)
+	for i := range twoWeeks {
+		twoWeeks[i] = 1
+	}
+	twoWeeks[0], twoWeeks[7] = 4, 4
+	tests := []struct {
+		name   string
+		series []float64
+		start  time.Time
+		want   [7]float64
+	}{
+		{"no history", nil, monday, ones},
+		{"no usage", []float64{0, 0, 0}, monday, ones},
+		{"busy mondays", twoWeeks, monday, [7]float64{0.7, 2.8, 0.7, 0.7, 0.7, 0.7, 0.7}},
+		{"flat usage", []float64{2, 2, 2}, monday, ones},
+		{"weekdays without history keep one", []float64{3, 0, 0}, monday.AddDate(0, 0, -1), [7]float64{3, 0, 0, 1, 1, 1, 1}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := weekdayIndex(test.series, test.start)
+			for weekday := range got {
+				if math.Abs(got[weekday]-test.want[weekday]) > 1e-9 {
+					t.Errorf("weekdayIndex = %v, want %v", got, test.want)
+					break
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package dal
+
+import (
+	"database/sql"
+	"encoding/json"
+	"frappuccino/models"
+)
+
+type IdempotencyRepo interface {
+	ClaimKey(record models.IdempotencyRecord) (models.IdempotencyRecord, bool, error)
+	SaveResponse(record models.IdempotencyRecord) error
+	ReleaseKey(key, endpoint string) error
+}
+
+type NewIdempotencyRepo struct {
+	DB *sql.DB
+}
+
+func DefaultIdempotencyRepo(db *sql.DB) *NewIdempotencyRepo {
+	return &NewIdempotencyRepo{DB: db}
+}
+
+// Claims the idempotency key for the request. Returns true when the key is new,
+// otherwise returns the record stored by the earlier request with the same key
+func (repo *NewIdempotencyRepo) ClaimKey(record models.IdempotencyRecord) (models.IdempotencyRecord, bool, error) {
+	// Keys are kept for one day, after that the same key can be used again
+	_, err := repo.DB.Exec(`DELETE FROM idempotency_keys
+	WHERE idempotency_key=$1 AND endpoint=$2 AND created_at < NOW() - INTERVAL '24 hours'
+	`, record.Key, record.Endpoint)
+	if err != nil {
+		return record, false, err
+	}
+	result, err := repo.DB.Exec(`INSERT INTO idempotency_keys (idempotency_key, endpoint, request_hash)
+	VALUES ($1, $2, $3)
+	ON CONFLICT (idempotency_key, endpoint) DO NOTHING
+	`, record.Key, record.Endpoint, record.RequestHash)
+	if err != nil {
+		return record, false, err
+	}
+	inserted, err := result.RowsAffected()
+	if err != nil {
+		return record, false, err
+	}
+	if inserted == 1 {
+		return record, true, nil
+	}
+
+	var stored models.IdempotencyRecord
+	var statusCode sql.NullInt64
+	var headers []byte
+	err = repo.DB.QueryRow(`SELECT idempotency_key, endpoint, request_hash, status_code, response_headers, response_body, created_at
+	FROM idempotency_keys
+	WHERE idempotency_key=$1 AND endpoint=$2
+	`, record.Key, record.Endpoint).Scan(&stored.Key, &stored.Endpoint, &stored.RequestHash, &statusCode, &headers, &stored.Body, &stored.CreatedAt)
+	if err != nil {
+		return stored, false, err
+	}
+	stored.StatusCode = int(statusCode.Int64)
+	if len(headers) > 0 {
+		if err := json.Unmarshal(headers, &stored.Headers); err != nil {
+			return stored, false, err
+		}
+	}
+	return stored, false, nil
+}
+
+// Stores the response produced for the claimed key
+func (repo *NewIdempotencyRepo) SaveResponse(record models.IdempotencyRecord) error {
+	headersJSON, err := json.Marshal(record.Headers)
+	if err != nil {
+		return err
+	}
+	_, err = repo.DB.Exec(`UPDATE idempotency_keys
+	SET status_code=$1, response_headers=$2, response_body=$3
+	WHERE idempotency_key=$4 AND endpoint=$5
+	`, record.StatusCode, headersJSON, record.Body, record.Key, record.Endpoint)
+	return err
+}
+
+// Removes the claimed key, so the request can be retried
+func (repo *NewIdempotencyRepo) ReleaseKey(key, endpoint string) error {
+	_, err := repo.DB.Exec(`DELETE FROM idempotency_keys
+	WHERE idempotency_key=$1 AND endpoint=$2
+	`, key, endpoint)
+	return err
+}
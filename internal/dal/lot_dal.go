@@ -0,0 +1,260 @@
+package dal
+
+import (
+	"database/sql"
+	"fmt"
+	"frappuccino/models"
+	"math"
+
+	"github.com/lib/pq"
+)
+
+// expiredLotsQuery sums what is left in the expired lots of every inventory item, expired stock cannot be sold
+const expiredLotsQuery = `SELECT inventory_id, SUM(remaining) AS expired
+	FROM inventory_lots
+	WHERE remaining > 0 AND expiry_date < CURRENT_DATE
+	GROUP BY inventory_id`
+
+// moveLots keeps the lots of the item in step with a stock movement. A purchase opens a new lot with the expiry date
+// of its transaction and the movement is linked to it, other increases join the newest lot. A decrease draws from
+// the lot of the movement when it names one, otherwise from the oldest unexpired lots first and from expired lots last.
+// Sale usage never draws from expired lots and fails with ErrNotEnoughInventory when the unexpired lots run out
+func moveLots(tx *sql.Tx, movement *models.StockMovement) error {
+	if movement.Quantity > 0 {
+		return addToLots(tx, movement)
+	}
+	sale := movement.Type == models.MovementSaleUsage
+	rows, err := tx.Query(`SELECT lot_id, remaining
+	FROM inventory_lots
+	WHERE inventory_id = $1 AND remaining > 0 AND ($2::int IS NULL OR lot_id = $2)
+	AND NOT ($3 AND expiry_date IS NOT NULL AND expiry_date < CURRENT_DATE)
+	ORDER BY expiry_date IS NOT NULL AND expiry_date < CURRENT_DATE, received_at, lot_id
+	FOR UPDATE
+	`, movement.InventoryID, movement.LotID, sale)
+	if err != nil {
+		return err
+	}
+	type lot struct {
+		id        int
+		remaining float64
+	}
+	var lots []lot
+	for rows.Next() {
+		var l lot
+		if err := rows.Scan(&l.id, &l.remaining); err != nil {
+			rows.Close()
+			return err
+		}
+		lots = append(lots, l)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	need := -movement.Quantity
+	for _, l := range lots {
+		if need <= 0 {
+			break
+		}
+		take := math.Min(l.remaining, need)
+		_, err := tx.Exec(`UPDATE inventory_lots SET remaining = remaining - $1 WHERE lot_id = $2`, take, l.id)
+		if err != nil {
+			return err
+		}
+		need -= take
+	}
+	if movement.LotID != nil && need > 0.0005 {
+		return fmt.Errorf("%w: lot %d", ErrNotEnoughInventory, *movement.LotID)
+	}
+	if sale && need > 0.0005 {
+		return fmt.Errorf("%w: only expired stock is left of inventory item %d", ErrNotEnoughInventory, movement.InventoryID)
+	}
+	return nil
+}
+
+// addToLots opens the lot of a purchase or puts an increase into the newest lot of the item
+func addToLots(tx *sql.Tx, movement *models.StockMovement) error {
+	if movement.Type == models.MovementPurchase && movement.TransactionID != nil {
+		var lotID int
+		err := tx.QueryRow(`INSERT INTO inventory_lots (inventory_id, transaction_id, quantity, remaining, expiry_date)
+		SELECT $1, transaction_id, $3, $3, expiry_date
+		FROM inventory_transactions
+		WHERE transaction_id = $2
+		RETURNING lot_id
+		`, movement.InventoryID, *movement.TransactionID, movement.Quantity).Scan(&lotID)
+		if err != nil {
+			return err
+		}
+		movement.LotID = &lotID
+		return nil
+	}
+	result, err := tx.Exec(`UPDATE inventory_lots
+	SET remaining = remaining + $2
+	WHERE lot_id = (SELECT MAX(lot_id) FROM inventory_lots WHERE inventory_id = $1)
+	`, movement.InventoryID, movement.Quantity)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected > 0 {
+		return nil
+	}
+	_, err = tx.Exec(`INSERT INTO inventory_lots (inventory_id, quantity, remaining)
+	VALUES ($1, $2, $2)
+	`, movement.InventoryID, movement.Quantity)
+	return err
+}
+
+// lotsQuery selects lots in stock with their expiry and cost, the weighted average cost stands in for lots without a purchase
+const lotsQuery = `SELECT l.lot_id, l.inventory_id, i.name, l.transaction_id, l.quantity, l.remaining, i.unit_type,
+	COALESCE(TO_CHAR(l.expiry_date, 'YYYY-MM-DD'), ''), l.expiry_date - CURRENT_DATE, t.price / to_stock_unit(t.quantity, t.unit, t.inventory_id), l.received_at
+	FROM inventory_lots l
+	INNER JOIN inventory i USING(inventory_id)
+	LEFT JOIN inventory_transactions t USING(transaction_id)
+	WHERE l.remaining > 0`
+
+// Retrieves the lots of the inventory item still in stock, in the order they are consumed
+func (repo *NewInventRepo) GetLots(inventory_id int) ([]models.InventoryLot, error) {
+	return repo.getLots(lotsQuery+`
+	AND l.inventory_id = $1
+	ORDER BY l.expiry_date IS NOT NULL AND l.expiry_date < CURRENT_DATE, l.received_at, l.lot_id`, inventory_id)
+}
+
+// Retrieves the lots in stock that expire within the days, expired lots included, soonest first
+func (repo *NewInventRepo) GetExpiringLots(within int) ([]models.InventoryLot, error) {
+	return repo.getLots(lotsQuery+`
+	AND l.expiry_date <= CURRENT_DATE + $1::int
+	ORDER BY l.expiry_date, l.inventory_id, l.lot_id`, within)
+}
+
+func (repo *NewInventRepo) getLots(query string, args ...any) ([]models.InventoryLot, error) {
+	unitCosts, err := repo.GetUnitCosts("weighted_average")
+	if err != nil {
+		return nil, err
+	}
+	rows, err := repo.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	lots := []models.InventoryLot{}
+	for rows.Next() {
+		var lot models.InventoryLot
+		var daysLeft sql.NullInt64
+		var unitCost sql.NullFloat64
+		err := rows.Scan(&lot.ID, &lot.InventoryID, &lot.Name, &lot.TransactionID, &lot.Quantity, &lot.Remaining, &lot.Unit,
+			&lot.ExpiryDate, &daysLeft, &unitCost, &lot.ReceivedAt)
+		if err != nil {
+			return nil, err
+		}
+		if daysLeft.Valid {
+			days := int(daysLeft.Int64)
+			lot.DaysLeft = &days
+			lot.Expired = days < 0
+		}
+		lot.UnitCost = unitCost.Float64
+		if !unitCost.Valid {
+			lot.UnitCost = unitCosts[lot.InventoryID].UnitCost
+		}
+		lot.Value = roundMoney(lot.Remaining * lot.UnitCost)
+		lot.UnitCost = math.Round(lot.UnitCost*10000) / 10000
+		lots = append(lots, lot)
+	}
+	return lots, rows.Err()
+}
+
+// Writes off what is left of every expired lot as waste made by the user at the cost of the lot, returns the logged entries.
+// The inventory items are locked before their lots, in the order closing an order locks them
+func (repo *NewInventRepo) WriteOffExpiredLots(user string) ([]models.WasteEntry, error) {
+	entries := []models.WasteEntry{}
+	err := WithTx(repo.DB, func(tx *sql.Tx) error {
+		rows, err := tx.Query(`SELECT DISTINCT inventory_id
+		FROM inventory_lots
+		WHERE remaining > 0 AND expiry_date < CURRENT_DATE
+		`)
+		if err != nil {
+			return err
+		}
+		expiring := make(map[string]float64)
+		for rows.Next() {
+			var inventoryID string
+			if err := rows.Scan(&inventoryID); err != nil {
+				rows.Close()
+				return err
+			}
+			expiring[inventoryID] = 0
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		ids := sortedInventoryIDs(expiring)
+		if _, err := lockInventory(tx, ids); err != nil {
+			return err
+		}
+		unitCosts, err := getUnitCosts(tx, "weighted_average")
+		if err != nil {
+			return err
+		}
+		rows, err = tx.Query(`SELECT l.lot_id, l.inventory_id, l.remaining, TO_CHAR(l.expiry_date, 'YYYY-MM-DD'), t.price / to_stock_unit(t.quantity, t.unit, t.inventory_id)
+		FROM inventory_lots l
+		LEFT JOIN inventory_transactions t USING(transaction_id)
+		WHERE l.remaining > 0 AND l.expiry_date < CURRENT_DATE AND l.inventory_id = ANY($1::int[])
+		ORDER BY l.inventory_id, l.lot_id
+		FOR UPDATE OF l
+		`, pq.Array(ids))
+		if err != nil {
+			return err
+		}
+		var lots []models.InventoryLot
+		for rows.Next() {
+			var lot models.InventoryLot
+			var unitCost sql.NullFloat64
+			if err := rows.Scan(&lot.ID, &lot.InventoryID, &lot.Remaining, &lot.ExpiryDate, &unitCost); err != nil {
+				rows.Close()
+				return err
+			}
+			lot.UnitCost = unitCost.Float64
+			if !unitCost.Valid {
+				lot.UnitCost = unitCosts[lot.InventoryID].UnitCost
+			}
+			lots = append(lots, lot)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		for _, lot := range lots {
+			lotID := lot.ID
+			err := applyStockMovement(tx, models.StockMovement{
+				InventoryID: lot.InventoryID,
+				Type:        models.MovementWaste,
+				Quantity:    -lot.Remaining,
+				LotID:       &lotID,
+				Reason:      "expired",
+				CreatedBy:   user,
+			})
+			if err != nil {
+				return err
+			}
+			entry := models.WasteEntry{
+				InventoryID: lot.InventoryID,
+				Name:        unitCosts[lot.InventoryID].Name,
+				Quantity:    lot.Remaining,
+				UnitCost:    lot.UnitCost,
+				Reason:      "expired",
+				Note:        fmt.Sprintf("lot %d expired %s", lot.ID, lot.ExpiryDate),
+				CreatedBy:   user,
+			}
+			if err := insertWaste(tx, &entry); err != nil {
+				return err
+			}
+			entries = append(entries, entry)
+		}
+		return nil
+	})
+	return entries, err
+}
@@ -0,0 +1,652 @@
+package dal
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"frappuccino/models"
+	"math"
+
+	"github.com/lib/pq"
+)
+
+// ErrLoyaltyDisabled is returned when points are redeemed while the loyalty program is switched off
+var ErrLoyaltyDisabled = errors.New("loyalty program is disabled")
+
+// ErrNotEnoughPoints is returned when the customer redeems more points than the balance
+var ErrNotEnoughPoints = errors.New("not enough loyalty points")
+
+// ErrRewardNotAvailable is returned when the redeemed reward does not exist or is not active
+var ErrRewardNotAvailable = errors.New("loyalty reward does not exist or is not active")
+
+// ErrRewardNotInOrder is returned when the order has no line of the menu item the reward gives for free
+var ErrRewardNotInOrder = errors.New("order has no item the reward gives for free")
+
+// ErrDiscountOverTotal is returned when the discounts of an order would take its total amount below zero
+var ErrDiscountOverTotal = errors.New("discounts exceed the order total")
+
+// expiringWithinDays is how far ahead the balance reports the points that are about to expire
+const expiringWithinDays = 30
+
+type LoyaltyRepo interface {
+	GetSettings() (models.LoyaltySettings, error)
+	UpdateSettings(settings models.LoyaltySettings) error
+	GetRewards() ([]models.LoyaltyReward, error)
+	GetReward(id int) (models.LoyaltyReward, error)
+	IsRewardExist(id int) (bool, error)
+	SaveReward(reward models.LoyaltyReward) (int, error)
+	UpdateReward(reward models.LoyaltyReward, id int) error
+	DeleteReward(id int) error
+	GetBalance(customer_id int) (models.LoyaltyBalance, error)
+	GetLedger(customer_id int) ([]models.LoyaltyEntry, error)
+	ExpirePoints() (int, error)
+}
+
+type NewLoyaltyRepo struct {
+	DB *sql.DB
+}
+
+func DefaultLoyaltyRepo(db *sql.DB) *NewLoyaltyRepo {
+	return &NewLoyaltyRepo{DB: db}
+}
+
+// Retrieves the loyalty rule with the tag multipliers
+func (repo *NewLoyaltyRepo) GetSettings() (models.LoyaltySettings, error) {
+	return getLoyaltySettings(repo.DB)
+}
+
+func getLoyaltySettings(q DBTX) (models.LoyaltySettings, error) {
+	settings := models.LoyaltySettings{TagMultipliers: map[string]float64{}}
+	err := q.QueryRow(`SELECT points_per_unit, point_value, COALESCE(expiry_days, 0), enabled
+	FROM loyalty_settings
+	`).Scan(&settings.PointsPerUnit, &settings.PointValue, &settings.ExpiryDays, &settings.Enabled)
+	if err != nil {
+		return settings, err
+	}
+	rows, err := q.Query(`SELECT tag, multiplier FROM loyalty_tag_multipliers`)
+	if err != nil {
+		return settings, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var tag string
+		var multiplier float64
+		if err := rows.Scan(&tag, &multiplier); err != nil {
+			return settings, err
+		}
+		settings.TagMultipliers[tag] = multiplier
+	}
+	return settings, rows.Err()
+}
+
+// Replaces the loyalty rule and the tag multipliers, points already earned keep their expiry date
+func (repo *NewLoyaltyRepo) UpdateSettings(settings models.LoyaltySettings) error {
+	return WithTx(repo.DB, func(tx *sql.Tx) error {
+		_, err := tx.Exec(`UPDATE loyalty_settings
+		SET points_per_unit=$1, point_value=$2, expiry_days=NULLIF($3::int, 0), enabled=$4
+		`, settings.PointsPerUnit, settings.PointValue, settings.ExpiryDays, settings.Enabled)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`DELETE FROM loyalty_tag_multipliers`)
+		if err != nil {
+			return err
+		}
+		for tag, multiplier := range settings.TagMultipliers {
+			_, err = tx.Exec(`INSERT INTO loyalty_tag_multipliers (tag, multiplier) VALUES ($1, $2)`, tag, multiplier)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Retrieves all rewards, active ones first
+func (repo *NewLoyaltyRepo) GetRewards() ([]models.LoyaltyReward, error) {
+	rows, err := repo.DB.Query(`SELECT reward_id, name, menu_item_id, points, active
+	FROM loyalty_rewards
+	ORDER BY active DESC, points, reward_id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	rewards := []models.LoyaltyReward{}
+	for rows.Next() {
+		var reward models.LoyaltyReward
+		if err := rows.Scan(&reward.ID, &reward.Name, &reward.MenuItemID, &reward.Points, &reward.Active); err != nil {
+			return nil, err
+		}
+		rewards = append(rewards, reward)
+	}
+	return rewards, rows.Err()
+}
+
+// Retrieves the reward by ID
+func (repo *NewLoyaltyRepo) GetReward(id int) (models.LoyaltyReward, error) {
+	var reward models.LoyaltyReward
+	err := repo.DB.QueryRow(`SELECT reward_id, name, menu_item_id, points, active
+	FROM loyalty_rewards
+	WHERE reward_id=$1
+	`, id).Scan(&reward.ID, &reward.Name, &reward.MenuItemID, &reward.Points, &reward.Active)
+	return reward, err
+}
+
+// Checks is reward exist by ID
+func (repo *NewLoyaltyRepo) IsRewardExist(id int) (bool, error) {
+	var count int
+	err := repo.DB.QueryRow(`SELECT COUNT(*) FROM loyalty_rewards WHERE reward_id=$1`, id).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// Saves the reward, returns the new reward ID
+func (repo *NewLoyaltyRepo) SaveReward(reward models.LoyaltyReward) (int, error) {
+	var id int
+	err := repo.DB.QueryRow(`INSERT INTO loyalty_rewards (name, menu_item_id, points, active)
+	VALUES ($1, $2, $3, $4)
+	RETURNING reward_id
+	`, reward.Name, reward.MenuItemID, reward.Points, reward.Active).Scan(&id)
+	return id, err
+}
+
+// Updates the reward, discounts already given keep their amount
+func (repo *NewLoyaltyRepo) UpdateReward(reward models.LoyaltyReward, id int) error {
+	_, err := repo.DB.Exec(`UPDATE loyalty_rewards
+	SET name=$1, menu_item_id=$2, points=$3, active=$4
+	WHERE reward_id=$5
+	`, reward.Name, reward.MenuItemID, reward.Points, reward.Active, id)
+	return err
+}
+
+// Deletes the reward, discounts already given stay on their orders
+func (repo *NewLoyaltyRepo) DeleteReward(id int) error {
+	_, err := repo.DB.Exec(`DELETE FROM loyalty_rewards WHERE reward_id=$1`, id)
+	return err
+}
+
+// Retrieves the points balance of the customer after expiring the points that are due
+func (repo *NewLoyaltyRepo) GetBalance(customer_id int) (models.LoyaltyBalance, error) {
+	balance := models.LoyaltyBalance{CustomerID: customer_id}
+	if _, err := expireLoyaltyPoints(repo.DB, customer_id); err != nil {
+		return balance, err
+	}
+	var pointValue float64
+	err := repo.DB.QueryRow(`SELECT COALESCE(SUM(l.points), 0),
+	COALESCE(SUM(l.remaining) FILTER (WHERE l.expires_at <= NOW() + make_interval(days => $2::int)), 0),
+	MIN(l.expires_at) FILTER (WHERE l.remaining > 0),
+	(SELECT point_value FROM loyalty_settings)
+	FROM loyalty_ledger l
+	WHERE l.customer_id = $1
+	`, customer_id, expiringWithinDays).Scan(&balance.Balance, &balance.ExpiringPoints, &balance.NextExpiry, &pointValue)
+	if err != nil {
+		return balance, err
+	}
+	balance.Value = roundMoney(float64(balance.Balance) * pointValue)
+	return balance, nil
+}
+
+// Retrieves the points ledger of the customer, newest first
+func (repo *NewLoyaltyRepo) GetLedger(customer_id int) ([]models.LoyaltyEntry, error) {
+	rows, err := repo.DB.Query(`SELECT entry_id, customer_id, order_id, entry_type, points, remaining, expires_at, COALESCE(note, ''), created_at
+	FROM loyalty_ledger
+	WHERE customer_id = $1
+	ORDER BY created_at DESC, entry_id DESC
+	`, customer_id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	entries := []models.LoyaltyEntry{}
+	for rows.Next() {
+		var entry models.LoyaltyEntry
+		err := rows.Scan(&entry.ID, &entry.CustomerID, &entry.OrderID, &entry.Type, &entry.Points, &entry.Remaining,
+			&entry.ExpiresAt, &entry.Note, &entry.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+// Expires the points of every customer that are due, returns how many earned entries expired
+func (repo *NewLoyaltyRepo) ExpirePoints() (int, error) {
+	return expireLoyaltyPoints(repo.DB, 0)
+}
+
+// expireLoyaltyPoints writes off what is left of the due points of the customer, of every customer when it is 0
+func expireLoyaltyPoints(q DBTX, customer_id int) (int, error) {
+	result, err := q.Exec(`WITH due AS (
+		SELECT entry_id, customer_id, remaining
+		FROM loyalty_ledger
+		WHERE remaining > 0 AND expires_at <= NOW() AND ($1::int = 0 OR customer_id = $1::int)
+		FOR UPDATE
+	), cleared AS (
+		UPDATE loyalty_ledger l SET remaining = 0 FROM due WHERE l.entry_id = due.entry_id
+	)
+	INSERT INTO loyalty_ledger (customer_id, entry_type, points, note)
+	SELECT customer_id, 'expire', -remaining, 'points of entry ' || entry_id || ' expired'
+	FROM due
+	`, customer_id)
+	if err != nil {
+		return 0, err
+	}
+	expired, err := result.RowsAffected()
+	return int(expired), err
+}
+
+// lockLoyaltyAccount locks the customer, so points of one customer are changed by one transaction at a time
+func lockLoyaltyAccount(tx *sql.Tx, customer_id int) error {
+	_, err := tx.Exec(`SELECT customer_id FROM customers WHERE customer_id=$1 FOR UPDATE`, customer_id)
+	return err
+}
+
+// addLoyaltyEntry adds an entry to the ledger, earned and restored points expire by the settings
+func addLoyaltyEntry(tx *sql.Tx, settings models.LoyaltySettings, entry models.LoyaltyEntry) error {
+	_, err := tx.Exec(`INSERT INTO loyalty_ledger (customer_id, order_id, entry_type, points, remaining, expires_at, note)
+	VALUES ($1, $2, $3, $4, $5,
+		CASE WHEN $5::int > 0 AND $6::int > 0 THEN NOW() + make_interval(days => $6::int) END,
+		NULLIF($7::text, ''))
+	`, entry.CustomerID, entry.OrderID, entry.Type, entry.Points, entry.Remaining, settings.ExpiryDays, entry.Note)
+	return err
+}
+
+// consumePoints takes up to the points from what is left of the earned and restored points of the customer,
+// points of the order come first, then the ones expiring soonest. Returns the points taken
+func consumePoints(tx *sql.Tx, customer_id, points, order_id int) (int, error) {
+	rows, err := tx.Query(`SELECT entry_id, remaining
+	FROM loyalty_ledger
+	WHERE customer_id = $1 AND remaining > 0
+	ORDER BY COALESCE(order_id = $2::int, FALSE) DESC, expires_at NULLS LAST, entry_id
+	FOR UPDATE
+	`, customer_id, order_id)
+	if err != nil {
+		return 0, err
+	}
+	type bucket struct {
+		id        int
+		remaining int
+	}
+	var buckets []bucket
+	for rows.Next() {
+		var b bucket
+		if err := rows.Scan(&b.id, &b.remaining); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		buckets = append(buckets, b)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	taken := 0
+	for _, b := range buckets {
+		if taken == points {
+			break
+		}
+		take := min(b.remaining, points-taken)
+		_, err := tx.Exec(`UPDATE loyalty_ledger SET remaining = remaining - $1 WHERE entry_id = $2`, take, b.id)
+		if err != nil {
+			return 0, err
+		}
+		taken += take
+	}
+	return taken, nil
+}
+
+// redeemLoyalty takes the redeemed reward and points off the saved order as discounts and spends the points.
+// A reward makes the cheapest serving of its menu item on the order free, points are a discount of the order
+// capped at what is left of its total
+func redeemLoyalty(tx *sql.Tx, order models.Order) error {
+	redemption := order.Loyalty
+	settings, err := getLoyaltySettings(tx)
+	if err != nil {
+		return err
+	}
+	if !settings.Enabled {
+		return ErrLoyaltyDisabled
+	}
+	if err := lockLoyaltyAccount(tx, order.CustomerID); err != nil {
+		return err
+	}
+	if _, err := expireLoyaltyPoints(tx, order.CustomerID); err != nil {
+		return err
+	}
+	var balance int
+	err = tx.QueryRow(`SELECT COALESCE(SUM(points), 0) FROM loyalty_ledger WHERE customer_id=$1`, order.CustomerID).Scan(&balance)
+	if err != nil {
+		return err
+	}
+	var total float64
+	err = tx.QueryRow(`SELECT total_amount FROM orders WHERE order_id=$1`, order.ID).Scan(&total)
+	if err != nil {
+		return err
+	}
+	spent := 0
+	if redemption.RewardID != 0 {
+		var reward models.LoyaltyReward
+		err := tx.QueryRow(`SELECT reward_id, name, menu_item_id, points, active
+		FROM loyalty_rewards
+		WHERE reward_id=$1
+		`, redemption.RewardID).Scan(&reward.ID, &reward.Name, &reward.MenuItemID, &reward.Points, &reward.Active)
+		if errors.Is(err, sql.ErrNoRows) || (err == nil && !reward.Active) {
+			return ErrRewardNotAvailable
+		}
+		if err != nil {
+			return err
+		}
+		var orderItemID int
+		var unitPrice float64
+		// A line a promotion already discounted gives no more than what is left of it
+		err = tx.QueryRow(`SELECT oi.order_item_id,
+			LEAST(ROUND(oi.price_at_order_time / oi.quantity, 2), oi.price_at_order_time + COALESCE(SUM(d.amount), 0))
+		FROM order_items oi
+		LEFT JOIN order_discounts d ON d.order_item_id = oi.order_item_id
+		WHERE oi.order_id=$1 AND oi.menu_item_id=$2
+		GROUP BY oi.order_item_id
+		ORDER BY 2, oi.order_item_id
+		LIMIT 1
+		`, order.ID, reward.MenuItemID).Scan(&orderItemID, &unitPrice)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrRewardNotInOrder
+		}
+		if err != nil {
+			return err
+		}
+		if unitPrice <= 0 {
+			return fmt.Errorf("%w: the item of the reward is already free", ErrDiscountOverTotal)
+		}
+		err = insertOrderDiscount(tx, order.ID, models.OrderDiscount{
+			OrderItemID: orderItemID,
+			Source:      models.DiscountLoyaltyReward,
+			RewardID:    reward.ID,
+			Description: reward.Name,
+			Amount:      -unitPrice,
+			Points:      reward.Points,
+		})
+		if err != nil {
+			return err
+		}
+		total -= unitPrice
+		spent += reward.Points
+	}
+	if redemption.Points > 0 {
+		points := min(redemption.Points, int(math.Floor(total/settings.PointValue+1e-9)))
+		amount := roundMoney(float64(points) * settings.PointValue)
+		if amount <= 0 {
+			return fmt.Errorf("%w: nothing is left to pay with points", ErrDiscountOverTotal)
+		}
+		err = insertOrderDiscount(tx, order.ID, models.OrderDiscount{
+			Source:      models.DiscountLoyaltyPoints,
+			Description: fmt.Sprintf("%d loyalty points", points),
+			Amount:      -amount,
+			Points:      points,
+		})
+		if err != nil {
+			return err
+		}
+		spent += points
+	}
+	if spent > balance {
+		return fmt.Errorf("%w: %d needed, %d available", ErrNotEnoughPoints, spent, balance)
+	}
+	if _, err := consumePoints(tx, order.CustomerID, spent, 0); err != nil {
+		return err
+	}
+	orderID := order.ID
+	err = addLoyaltyEntry(tx, settings, models.LoyaltyEntry{
+		CustomerID: order.CustomerID,
+		OrderID:    &orderID,
+		Type:       models.LoyaltyRedeem,
+		Points:     -spent,
+		Note:       fmt.Sprintf("redeemed on order %d", order.ID),
+	})
+	if err != nil {
+		return err
+	}
+	return refreshOrderTotal(tx, order.ID)
+}
+
+// earnLoyaltyPoints credits the customer of the closed order with points for what was paid for every line,
+// a line earns the highest multiplier of the tags of its menu item
+func earnLoyaltyPoints(tx *sql.Tx, order_id int) error {
+	settings, err := getLoyaltySettings(tx)
+	if err != nil {
+		return err
+	}
+	if !settings.Enabled || settings.PointsPerUnit == 0 {
+		return nil
+	}
+	var customerID int
+	err = tx.QueryRow(`SELECT customer_id FROM orders WHERE order_id=$1`, order_id).Scan(&customerID)
+	if err != nil {
+		return err
+	}
+	netAmounts, err := lineNetAmounts(tx, order_id)
+	if err != nil {
+		return err
+	}
+	rows, err := tx.Query(`SELECT oi.order_item_id,
+	COALESCE((SELECT MAX(t.multiplier) FROM loyalty_tag_multipliers t WHERE t.tag = ANY(m.tags)), 1)
+	FROM order_items oi
+	INNER JOIN menu_items m USING(menu_item_id)
+	WHERE oi.order_id = $1
+	`, order_id)
+	if err != nil {
+		return err
+	}
+	var base float64
+	for rows.Next() {
+		var orderItemID int
+		var multiplier float64
+		if err := rows.Scan(&orderItemID, &multiplier); err != nil {
+			rows.Close()
+			return err
+		}
+		base += netAmounts[orderItemID] * multiplier
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	points := int(math.Floor(base*settings.PointsPerUnit + 1e-9))
+	if points <= 0 {
+		return nil
+	}
+	if err := lockLoyaltyAccount(tx, customerID); err != nil {
+		return err
+	}
+	return addLoyaltyEntry(tx, settings, models.LoyaltyEntry{
+		CustomerID: customerID,
+		OrderID:    &order_id,
+		Type:       models.LoyaltyEarn,
+		Points:     points,
+		Remaining:  points,
+		Note:       fmt.Sprintf("earned on order %d", order_id),
+	})
+}
+
+// reverseLoyaltyPoints takes back the share of the points earned on the order that was refunded so far,
+// all of them once the order is fully refunded. Points the customer has already spent can not be taken back,
+// they are taken by a later refund of the order when the customer earned points again
+func reverseLoyaltyPoints(tx *sql.Tx, order_id int) error {
+	var customerID, earned, reversed int
+	var paid, refunded float64
+	err := tx.QueryRow(`SELECT o.customer_id, o.total_amount,
+	COALESCE((SELECT -SUM(amount) FROM order_refunds WHERE order_id = o.order_id), 0),
+	COALESCE((SELECT SUM(points) FROM loyalty_ledger WHERE order_id = o.order_id AND entry_type = 'earn'), 0),
+	COALESCE((SELECT -SUM(points) FROM loyalty_ledger WHERE order_id = o.order_id AND entry_type = 'reverse'), 0)
+	FROM orders o
+	WHERE o.order_id = $1
+	`, order_id).Scan(&customerID, &paid, &refunded, &earned, &reversed)
+	if err != nil {
+		return err
+	}
+	if earned == 0 || paid <= 0 {
+		return nil
+	}
+	target := earned
+	if refunded < paid-0.005 {
+		target = int(math.Floor(float64(earned) * refunded / paid))
+	}
+	if target <= reversed {
+		return nil
+	}
+	if err := lockLoyaltyAccount(tx, customerID); err != nil {
+		return err
+	}
+	taken, err := consumePoints(tx, customerID, target-reversed, order_id)
+	if err != nil || taken == 0 {
+		return err
+	}
+	settings, err := getLoyaltySettings(tx)
+	if err != nil {
+		return err
+	}
+	note := fmt.Sprintf("refund of order %d", order_id)
+	if taken < target-reversed {
+		note += fmt.Sprintf(", %d points already spent", target-reversed-taken)
+	}
+	return addLoyaltyEntry(tx, settings, models.LoyaltyEntry{
+		CustomerID: customerID,
+		OrderID:    &order_id,
+		Type:       models.LoyaltyReverse,
+		Points:     -taken,
+		Note:       note,
+	})
+}
+
+// restoreRedeemedPoints drops the loyalty discounts of the given lines of the order, of the whole order when
+// lines is nil, and gives their points back to the customer. The total amount of the order is left to the caller
+func restoreRedeemedPoints(tx *sql.Tx, order_id int, lines []int) error {
+	var points int
+	err := tx.QueryRow(`WITH dropped AS (
+		DELETE FROM order_discounts
+		WHERE order_id = $1 AND points > 0 AND ($2::boolean OR order_item_id = ANY($3::int[]))
+		RETURNING points
+	)
+	SELECT COALESCE(SUM(points), 0) FROM dropped
+	`, order_id, lines == nil, pq.Array(lines)).Scan(&points)
+	if err != nil || points == 0 {
+		return err
+	}
+	var customerID int
+	err = tx.QueryRow(`SELECT customer_id FROM orders WHERE order_id=$1`, order_id).Scan(&customerID)
+	if err != nil {
+		return err
+	}
+	settings, err := getLoyaltySettings(tx)
+	if err != nil {
+		return err
+	}
+	if err := lockLoyaltyAccount(tx, customerID); err != nil {
+		return err
+	}
+	return addLoyaltyEntry(tx, settings, models.LoyaltyEntry{
+		CustomerID: customerID,
+		OrderID:    &order_id,
+		Type:       models.LoyaltyRestore,
+		Points:     points,
+		Remaining:  points,
+		Note:       fmt.Sprintf("redeemed on order %d, given back", order_id),
+	})
+}
+
+// insertOrderDiscount adds a discount to the order, a discount of the whole order has no order_item_id
+func insertOrderDiscount(tx *sql.Tx, order_id int, discount models.OrderDiscount) error {
+	_, err := tx.Exec(`INSERT INTO order_discounts (order_id, order_item_id, source, reward_id, promotion_id, description, amount, points)
+	VALUES ($1, NULLIF($2::int, 0), $3, NULLIF($4::int, 0), NULLIF($5::int, 0), $6, $7, $8)
+	`, order_id, discount.OrderItemID, discount.Source, discount.RewardID, discount.PromotionID, discount.Description, discount.Amount,
+		discount.Points)
+	return err
+}
+
+// refreshOrderTotal sets the total amount of the order to its lines less its discounts
+func refreshOrderTotal(tx *sql.Tx, order_id int) error {
+	var total float64
+	err := tx.QueryRow(`SELECT
+	COALESCE((SELECT SUM(price_at_order_time) FROM order_items WHERE order_id = $1), 0) +
+	COALESCE((SELECT SUM(amount) FROM order_discounts WHERE order_id = $1), 0)
+	`, order_id).Scan(&total)
+	if err != nil {
+		return err
+	}
+	if total < 0 {
+		return ErrDiscountOverTotal
+	}
+	_, err = tx.Exec(`UPDATE orders SET total_amount=$1 WHERE order_id=$2`, roundMoney(total), order_id)
+	return err
+}
+
+// getOrderDiscounts retrieves the discounts of the order
+func getOrderDiscounts(q DBTX, order_id int) ([]models.OrderDiscount, error) {
+	rows, err := q.Query(`SELECT discount_id, COALESCE(order_item_id, 0), source, COALESCE(reward_id, 0), COALESCE(promotion_id, 0),
+	description, amount, points
+	FROM order_discounts
+	WHERE order_id = $1
+	ORDER BY discount_id
+	`, order_id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var discounts []models.OrderDiscount
+	for rows.Next() {
+		var discount models.OrderDiscount
+		err := rows.Scan(&discount.ID, &discount.OrderItemID, &discount.Source, &discount.RewardID, &discount.PromotionID,
+			&discount.Description, &discount.Amount, &discount.Points)
+		if err != nil {
+			return nil, err
+		}
+		discounts = append(discounts, discount)
+	}
+	return discounts, rows.Err()
+}
+
+// lineNetAmounts is what was charged for every line of the order, keyed by order_item_id. A line pays its price
+// less its own discounts, discounts of the whole order are spread over the lines by what they pay
+func lineNetAmounts(q DBTX, order_id int) (map[int]float64, error) {
+	rows, err := q.Query(`SELECT oi.order_item_id, oi.price_at_order_time + COALESCE(SUM(d.amount), 0)
+	FROM order_items oi
+	LEFT JOIN order_discounts d ON d.order_item_id = oi.order_item_id
+	WHERE oi.order_id = $1
+	GROUP BY oi.order_item_id
+	`, order_id)
+	if err != nil {
+		return nil, err
+	}
+	netAmounts := make(map[int]float64)
+	var subtotal float64
+	for rows.Next() {
+		var orderItemID int
+		var amount float64
+		if err := rows.Scan(&orderItemID, &amount); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		netAmounts[orderItemID] = amount
+		subtotal += amount
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	var orderDiscount float64
+	err = q.QueryRow(`SELECT COALESCE(SUM(amount), 0)
+	FROM order_discounts
+	WHERE order_id = $1 AND order_item_id IS NULL
+	`, order_id).Scan(&orderDiscount)
+	if err != nil || orderDiscount == 0 || subtotal <= 0 {
+		return netAmounts, err
+	}
+	share := math.Max(subtotal+orderDiscount, 0) / subtotal
+	for orderItemID := range netAmounts {
+		netAmounts[orderItemID] *= share
+	}
+	return netAmounts, nil
+}
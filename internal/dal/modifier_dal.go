@@ -0,0 +1,476 @@
+package dal
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"frappuccino/models"
+	"math"
+	"net/http"
+
+	"github.com/lib/pq"
+)
+
+// ErrModifierOptionNotFound is returned when an updated option does not belong to the modifier group
+var ErrModifierOptionNotFound = errors.New("modifier option does not belong to the group")
+
+// modifierOption is an option together with the group and menu item it belongs to
+type modifierOption struct {
+	models.OrderItemModifier
+	GroupID    int
+	MenuItemID int
+}
+
+// Retrieves modifier groups of the menu item with their options and ingredients
+func (repo *NewMenuRepo) GetModifierGroups(menu_item_id int) ([]models.ModifierGroup, error) {
+	rows, err := repo.DB.Query(`SELECT group_id, menu_item_id, name, min_select, max_select
+	FROM modifier_groups
+	WHERE menu_item_id=$1
+	ORDER BY group_id
+	`, menu_item_id)
+	if err != nil {
+		return nil, err
+	}
+	var groups []models.ModifierGroup
+	for rows.Next() {
+		var group models.ModifierGroup
+		if err := rows.Scan(&group.ID, &group.MenuItemID, &group.Name, &group.MinSelect, &group.MaxSelect); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		groups = append(groups, group)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for i := range groups {
+		groups[i].Options, err = repo.getModifierOptions(groups[i].ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return groups, nil
+}
+
+// Retrieves the modifier group by ID with its options and ingredients
+func (repo *NewMenuRepo) GetModifierGroup(group_id int) (models.ModifierGroup, error) {
+	var group models.ModifierGroup
+	err := repo.DB.QueryRow(`SELECT group_id, menu_item_id, name, min_select, max_select
+	FROM modifier_groups
+	WHERE group_id=$1
+	`, group_id).Scan(&group.ID, &group.MenuItemID, &group.Name, &group.MinSelect, &group.MaxSelect)
+	if err != nil {
+		return group, err
+	}
+	group.Options, err = repo.getModifierOptions(group_id)
+	return group, err
+}
+
+func (repo *NewMenuRepo) getModifierOptions(group_id int) ([]models.ModifierOption, error) {
+	rows, err := repo.DB.Query(`SELECT option_id, group_id, name, price_delta
+	FROM modifier_options
+	WHERE group_id=$1
+	ORDER BY option_id
+	`, group_id)
+	if err != nil {
+		return nil, err
+	}
+	var options []models.ModifierOption
+	for rows.Next() {
+		var option models.ModifierOption
+		if err := rows.Scan(&option.ID, &option.GroupID, &option.Name, &option.PriceDelta); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		options = append(options, option)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for i := range options {
+		options[i].Ingredients, err = repo.getModifierIngredients(options[i].ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return options, nil
+}
+
+func (repo *NewMenuRepo) getModifierIngredients(option_id int) ([]models.ModifierIngredient, error) {
+	rows, err := repo.DB.Query(`SELECT id, option_id, inventory_id, quantity, unit, to_stock_unit(quantity, unit, inventory_id)
+	FROM modifier_option_ingredients
+	WHERE option_id=$1
+	`, option_id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ingredients []models.ModifierIngredient
+	for rows.Next() {
+		var ingredient models.ModifierIngredient
+		if err := rows.Scan(&ingredient.ID, &ingredient.OptionID, &ingredient.InventoryID, &ingredient.Quantity, &ingredient.Unit, &ingredient.StockQuantity); err != nil {
+			return nil, err
+		}
+		ingredients = append(ingredients, ingredient)
+	}
+	return ingredients, rows.Err()
+}
+
+// Checks is the modifier group exist for the menu item
+func (repo *NewMenuRepo) IsModifierGroupExist(menu_item_id, group_id int) (bool, error) {
+	var count int
+	err := repo.DB.QueryRow(`SELECT COUNT(*) FROM modifier_groups
+	WHERE menu_item_id=$1 AND group_id=$2
+	`, menu_item_id, group_id).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// Checks is the group name unique within the menu item, the group itself is skipped
+func (repo *NewMenuRepo) IsModifierGroupUnique(menu_item_id, group_id int, name string) (bool, error) {
+	var count int
+	err := repo.DB.QueryRow(`SELECT COUNT(*) FROM modifier_groups
+	WHERE menu_item_id=$1 AND name=$2 AND group_id<>$3
+	`, menu_item_id, name, group_id).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+	return count == 0, nil
+}
+
+// Checks if the ingredients of the modifier options are available in inventory
+func (repo *NewMenuRepo) Check_Modifier_Inventory(group models.ModifierGroup) (bool, error) {
+	var ids []int
+	for _, option := range group.Options {
+		for _, ingredient := range option.Ingredients {
+			ids = append(ids, ingredient.InventoryID)
+		}
+	}
+	if len(ids) == 0 {
+		return true, nil
+	}
+	var missing int
+	err := repo.DB.QueryRow(`SELECT COUNT(*)
+	FROM unnest($1::int[]) AS ids(inventory_id)
+	WHERE NOT EXISTS (SELECT 1 FROM inventory i WHERE i.inventory_id = ids.inventory_id AND i.archived_at IS NULL)
+	`, pq.Array(ids)).Scan(&missing)
+	if err != nil {
+		return false, err
+	}
+	return missing == 0, nil
+}
+
+// Saves the modifier group with its options and ingredients, returns the new group ID
+func (repo *NewMenuRepo) SaveModifierGroup(group models.ModifierGroup) (int, error) {
+	var groupID int
+	err := WithTx(repo.DB, func(tx *sql.Tx) error {
+		err := tx.QueryRow(`INSERT INTO modifier_groups (menu_item_id, name, min_select, max_select)
+		VALUES ($1, $2, $3, $4) RETURNING group_id
+		`, group.MenuItemID, group.Name, group.MinSelect, group.MaxSelect).Scan(&groupID)
+		if err != nil {
+			return err
+		}
+		for _, option := range group.Options {
+			if err := insertModifierOption(tx, groupID, option); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return groupID, err
+}
+
+// Updates the modifier group in place. Options with an ID are updated, options without one are added
+// and options missing from the group are deleted, orders keep their copy of deleted options
+func (repo *NewMenuRepo) UpdateModifierGroup(group models.ModifierGroup) error {
+	return WithTx(repo.DB, func(tx *sql.Tx) error {
+		_, err := tx.Exec(`UPDATE modifier_groups
+		SET name=$1, min_select=$2, max_select=$3
+		WHERE group_id=$4
+		`, group.Name, group.MinSelect, group.MaxSelect, group.ID)
+		if err != nil {
+			return err
+		}
+		keep := []int{}
+		for _, option := range group.Options {
+			if option.ID != 0 {
+				keep = append(keep, option.ID)
+			}
+		}
+		_, err = tx.Exec(`DELETE FROM modifier_options
+		WHERE group_id=$1 AND NOT (option_id = ANY($2::int[]))
+		`, group.ID, pq.Array(keep))
+		if err != nil {
+			return err
+		}
+		for _, option := range group.Options {
+			if option.ID == 0 {
+				if err := insertModifierOption(tx, group.ID, option); err != nil {
+					return err
+				}
+				continue
+			}
+			result, err := tx.Exec(`UPDATE modifier_options
+			SET name=$1, price_delta=$2
+			WHERE option_id=$3 AND group_id=$4
+			`, option.Name, option.PriceDelta, option.ID, group.ID)
+			if err != nil {
+				return err
+			}
+			affected, err := result.RowsAffected()
+			if err != nil {
+				return err
+			}
+			if affected == 0 {
+				return fmt.Errorf("%w: %d", ErrModifierOptionNotFound, option.ID)
+			}
+			_, err = tx.Exec(`DELETE FROM modifier_option_ingredients WHERE option_id=$1`, option.ID)
+			if err != nil {
+				return err
+			}
+			if err := insertModifierIngredients(tx, option.ID, option.Ingredients); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Deletes the modifier group with its options
+func (repo *NewMenuRepo) DeleteModifierGroup(group_id int) error {
+	_, err := repo.DB.Exec(`DELETE FROM modifier_groups WHERE group_id=$1`, group_id)
+	return err
+}
+
+func insertModifierOption(tx *sql.Tx, group_id int, option models.ModifierOption) error {
+	var optionID int
+	err := tx.QueryRow(`INSERT INTO modifier_options (group_id, name, price_delta)
+	VALUES ($1, $2, $3) RETURNING option_id
+	`, group_id, option.Name, option.PriceDelta).Scan(&optionID)
+	if err != nil {
+		return err
+	}
+	return insertModifierIngredients(tx, optionID, option.Ingredients)
+}
+
+func insertModifierIngredients(tx *sql.Tx, option_id int, ingredients []models.ModifierIngredient) error {
+	for _, ingredient := range ingredients {
+		_, err := tx.Exec(`INSERT INTO modifier_option_ingredients (option_id, inventory_id, quantity, unit)
+		VALUES ($1, $2, $3, COALESCE(NULLIF($4, ''), (SELECT unit_type FROM inventory WHERE inventory_id=$2)))
+		`, option_id, ingredient.InventoryID, ingredient.Quantity, ingredient.Unit)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Loads the chosen options of an order item with their group and menu item
+func getChosenOptions(q DBTX, modifiers []models.OrderItemModifier) (map[int]modifierOption, error) {
+	options := make(map[int]modifierOption)
+	var ids []int
+	for _, modifier := range modifiers {
+		if modifier.OptionID != 0 {
+			ids = append(ids, modifier.OptionID)
+		}
+	}
+	if len(ids) == 0 {
+		return options, nil
+	}
+	rows, err := q.Query(`SELECT o.option_id, o.name, o.price_delta, g.group_id, g.name, g.menu_item_id
+	FROM modifier_options o
+	INNER JOIN modifier_groups g USING(group_id)
+	WHERE o.option_id = ANY($1::int[])
+	`, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var option modifierOption
+		err := rows.Scan(&option.OptionID, &option.OptionName, &option.PriceDelta, &option.GroupID, &option.GroupName, &option.MenuItemID)
+		if err != nil {
+			return nil, err
+		}
+		options[option.OptionID] = option
+	}
+	return options, rows.Err()
+}
+
+// CheckItemModifiers checks that the chosen options belong to the ordered menu item
+// and that every modifier group gets between min_select and max_select of them
+func (repo *NewOrderRepo) CheckItemModifiers(item models.OrderItem) (int, error) {
+	options, err := getChosenOptions(repo.DB, item.Modifiers)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	price, _, err := repo.itemBasePrice(item)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	chosen := make(map[int]int)
+	seen := make(map[int]bool)
+	for _, modifier := range item.Modifiers {
+		option, ok := options[modifier.OptionID]
+		if !ok || option.MenuItemID != item.MenuItemID {
+			return http.StatusBadRequest, fmt.Errorf("modifier option %d is not available for menu item %d", modifier.OptionID, item.MenuItemID)
+		}
+		if seen[modifier.OptionID] {
+			return http.StatusBadRequest, fmt.Errorf("modifier option %d is chosen more than once", modifier.OptionID)
+		}
+		seen[modifier.OptionID] = true
+		chosen[option.GroupID]++
+		price += option.PriceDelta
+	}
+	if price <= 0 {
+		return http.StatusBadRequest, fmt.Errorf("price of menu item %d with the chosen modifiers must be greater than 0", item.MenuItemID)
+	}
+
+	rows, err := repo.DB.Query(`SELECT group_id, name, min_select, max_select
+	FROM modifier_groups
+	WHERE menu_item_id=$1
+	`, item.MenuItemID)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var groupID, minSelect, maxSelect int
+		var name string
+		if err := rows.Scan(&groupID, &name, &minSelect, &maxSelect); err != nil {
+			return http.StatusInternalServerError, err
+		}
+		if chosen[groupID] < minSelect || chosen[groupID] > maxSelect {
+			return http.StatusBadRequest, fmt.Errorf("choose from %d to %d options of %s for menu item %d", minSelect, maxSelect, name, item.MenuItemID)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusOK, nil
+}
+
+// Gets the ingredients of one serving of the order item: the recipe of the menu item or its variant
+// adjusted by the chosen modifiers
+func servingIngredients(q DBTX, item models.OrderItem) (map[string]float64, error) {
+	serving := make(map[string]float64)
+	var rows *sql.Rows
+	var err error
+	if item.VariantID != 0 {
+		rows, err = q.Query(`SELECT inventory_id, to_stock_unit(quantity, unit, inventory_id)
+		FROM variant_ingredients
+		WHERE variant_id=$1
+		`, item.VariantID)
+	} else {
+		rows, err = q.Query(`SELECT inventory_id, to_stock_unit(quantity, unit, inventory_id)
+		FROM menu_item_ingredients
+		WHERE menu_item_id=$1
+		`, item.MenuItemID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var ingredientID string
+		var quantity float64
+		if err := rows.Scan(&ingredientID, &quantity); err != nil {
+			return nil, err
+		}
+		serving[ingredientID] += quantity
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var optionIDs []int
+	for _, modifier := range item.Modifiers {
+		if modifier.OptionID != 0 {
+			optionIDs = append(optionIDs, modifier.OptionID)
+		}
+	}
+	if len(optionIDs) == 0 {
+		return serving, nil
+	}
+	modifierRows, err := q.Query(`SELECT inventory_id, SUM(to_stock_unit(quantity, unit, inventory_id))
+	FROM modifier_option_ingredients
+	WHERE option_id = ANY($1::int[])
+	GROUP BY inventory_id
+	`, pq.Array(optionIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer modifierRows.Close()
+	for modifierRows.Next() {
+		var ingredientID string
+		var quantity float64
+		if err := modifierRows.Scan(&ingredientID, &quantity); err != nil {
+			return nil, err
+		}
+		serving[ingredientID] += quantity
+	}
+	return serving, modifierRows.Err()
+}
+
+// Copies group name, option name and price of the chosen options into the order item modifiers
+// and returns the unit price of the item with them
+func (repo *NewOrderRepo) priceItemModifiers(item *models.OrderItem, basePrice float64) (float64, error) {
+	options, err := getChosenOptions(repo.DB, item.Modifiers)
+	if err != nil {
+		return 0, err
+	}
+	price := basePrice
+	for i, modifier := range item.Modifiers {
+		option, ok := options[modifier.OptionID]
+		if !ok {
+			return 0, fmt.Errorf("modifier option %d does not exist", modifier.OptionID)
+		}
+		item.Modifiers[i] = option.OrderItemModifier
+		price += option.PriceDelta
+	}
+	return math.Round(price*100) / 100, nil
+}
+
+// Saves the modifiers chosen for the order item
+func insertOrderItemModifiers(tx *sql.Tx, order_item_id int, modifiers []models.OrderItemModifier) error {
+	for _, modifier := range modifiers {
+		_, err := tx.Exec(`INSERT INTO order_item_modifiers (order_item_id, option_id, group_name, option_name, price_delta)
+		VALUES ($1, NULLIF($2, 0), $3, $4, $5)
+		`, order_item_id, modifier.OptionID, modifier.GroupName, modifier.OptionName, modifier.PriceDelta)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Loads the modifiers of the given order items
+func getOrderItemModifiers(q DBTX, order_item_ids []int) (map[int][]models.OrderItemModifier, error) {
+	modifiers := make(map[int][]models.OrderItemModifier)
+	if len(order_item_ids) == 0 {
+		return modifiers, nil
+	}
+	rows, err := q.Query(`SELECT id, order_item_id, COALESCE(option_id, 0), group_name, option_name, price_delta
+	FROM order_item_modifiers
+	WHERE order_item_id = ANY($1::int[])
+	ORDER BY id
+	`, pq.Array(order_item_ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var modifier models.OrderItemModifier
+		var orderItemID int
+		err := rows.Scan(&modifier.ID, &orderItemID, &modifier.OptionID, &modifier.GroupName, &modifier.OptionName, &modifier.PriceDelta)
+		if err != nil {
+			return nil, err
+		}
+		modifiers[orderItemID] = append(modifiers[orderItemID], modifier)
+	}
+	return modifiers, rows.Err()
+}
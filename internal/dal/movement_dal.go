@@ -0,0 +1,211 @@
+package dal
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"frappuccino/models"
+	"math"
+	"strconv"
+)
+
+// ErrZeroQuantity is returned when a quantity rounds to zero in the stock unit
+var ErrZeroQuantity = errors.New("quantity is zero in the stock unit")
+
+// applyStockMovement changes the stock level of the inventory item by the movement quantity and records it in the ledger.
+// Every stock change goes through here, a movement that would take the stock below zero fails with ErrNotEnoughInventory.
+// The lots of the item follow the movement, see moveLots.
+func applyStockMovement(tx *sql.Tx, movement models.StockMovement) error {
+	if movement.Quantity == 0 {
+		return nil
+	}
+	var balance float64
+	var unit string
+	err := tx.QueryRow(`UPDATE inventory
+	SET stock_level = stock_level + $1, last_updated = NOW()
+	WHERE inventory_id = $2 AND stock_level + $1 >= 0
+	RETURNING stock_level, unit_type
+	`, movement.Quantity, movement.InventoryID).Scan(&balance, &unit)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("%w: inventory item %d", ErrNotEnoughInventory, movement.InventoryID)
+	}
+	if err != nil {
+		return err
+	}
+	if err := moveLots(tx, &movement); err != nil {
+		return err
+	}
+	_, err = tx.Exec(`INSERT INTO stock_movements (inventory_id, movement_type, quantity, balance_after, unit, order_id, transaction_id, lot_id, reason, created_by)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NULLIF($9, ''), NULLIF($10, ''))
+	`, movement.InventoryID, movement.Type, movement.Quantity, balance, unit, movement.OrderID, movement.TransactionID, movement.LotID, movement.Reason, movement.CreatedBy)
+	return err
+}
+
+// ApplyStockMovement changes the stock level within the given transaction and records the movement in the ledger
+func (repo *NewInventRepo) ApplyStockMovement(tx *sql.Tx, movement models.StockMovement) error {
+	return applyStockMovement(tx, movement)
+}
+
+// applyOrderMovements records one movement of the type per inventory item of the map, linked to the order.
+// Items are handled in ascending inventory_id order like every other stock change.
+func applyOrderMovements(tx *sql.Tx, order_id int, movementType string, sign float64, need_inventory map[string]float64) error {
+	for _, ingredientID := range sortedInventoryIDs(need_inventory) {
+		inventoryID, err := strconv.Atoi(ingredientID)
+		if err != nil {
+			return err
+		}
+		err = applyStockMovement(tx, models.StockMovement{
+			InventoryID: inventoryID,
+			Type:        movementType,
+			Quantity:    sign * need_inventory[ingredientID],
+			OrderID:     &order_id,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Records a transfer of the inventory item to or from another location, the quantity is converted from its unit or pack
+// to the stock unit. Returns the recorded movement
+func (repo *NewInventRepo) TransferStock(inventory_id int, transfer models.TransferRequest, user string) (models.StockMovement, error) {
+	movement := models.StockMovement{
+		InventoryID: inventory_id,
+		Type:        models.MovementTransfer,
+		Reason:      transfer.Reason,
+		CreatedBy:   user,
+	}
+	err := WithTx(repo.DB, func(tx *sql.Tx) error {
+		factor, err := stockUnitFactor(tx, inventory_id, transfer.Unit, true)
+		if err != nil {
+			return err
+		}
+		movement.Quantity = roundQuantity(transfer.Quantity * factor)
+		if movement.Quantity == 0 {
+			return ErrZeroQuantity
+		}
+		if err := applyStockMovement(tx, movement); err != nil {
+			return err
+		}
+		// the inventory row stays locked by the movement, so the newest movement of the item is this one
+		return tx.QueryRow(`SELECT movement_id, balance_after, unit, lot_id, created_at
+		FROM stock_movements
+		WHERE inventory_id = $1
+		ORDER BY movement_id DESC
+		LIMIT 1
+		`, inventory_id).Scan(&movement.ID, &movement.BalanceAfter, &movement.Unit, &movement.LotID, &movement.CreatedAt)
+	})
+	return movement, err
+}
+
+// Retrieves the ledger of the inventory item, from and to are optional dates in YYYY-MM-DD, both inclusive.
+// Every movement keeps the unit it was recorded in
+func (repo *NewInventRepo) GetStockMovements(inventory_id int, from, to string) ([]models.StockMovement, error) {
+	rows, err := repo.DB.Query(`SELECT movement_id, inventory_id, movement_type, quantity, balance_after, unit,
+	order_id, transaction_id, lot_id, COALESCE(reason, ''), COALESCE(created_by, ''), created_at
+	FROM stock_movements
+	WHERE inventory_id = $1
+	AND ($2::text = '' OR created_at >= NULLIF($2::text, '')::date)
+	AND ($3::text = '' OR created_at < NULLIF($3::text, '')::date + 1)
+	ORDER BY created_at, movement_id
+	`, inventory_id, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	movements := []models.StockMovement{}
+	for rows.Next() {
+		var movement models.StockMovement
+		var orderID, transactionID sql.NullInt64
+		err := rows.Scan(&movement.ID, &movement.InventoryID, &movement.Type, &movement.Quantity, &movement.BalanceAfter, &movement.Unit,
+			&orderID, &transactionID, &movement.LotID, &movement.Reason, &movement.CreatedBy, &movement.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		if orderID.Valid {
+			id := int(orderID.Int64)
+			movement.OrderID = &id
+		}
+		if transactionID.Valid {
+			id := int(transactionID.Int64)
+			movement.TransactionID = &id
+		}
+		movements = append(movements, movement)
+	}
+	return movements, rows.Err()
+}
+
+// Retrieves the inventory items whose stock level differs from the sum of their ledger or of their lots
+func (repo *NewInventRepo) GetStockDiscrepancies() ([]models.StockDiscrepancy, error) {
+	return stockDiscrepancies(repo.DB, false)
+}
+
+// Sets the stock level of every inconsistent inventory item to the sum of its ledger and brings its lots in line with it,
+// a surplus is taken from the lots in the order they are consumed and a shortfall joins the newest lot.
+// Returns the corrected items with the stock level and lots they had before
+func (repo *NewInventRepo) ReconcileStock() ([]models.StockDiscrepancy, error) {
+	var discrepancies []models.StockDiscrepancy
+	err := WithTx(repo.DB, func(tx *sql.Tx) error {
+		var err error
+		discrepancies, err = stockDiscrepancies(tx, true)
+		if err != nil {
+			return err
+		}
+		for _, discrepancy := range discrepancies {
+			_, err = tx.Exec(`UPDATE inventory
+			SET stock_level = $1, last_updated = NOW()
+			WHERE inventory_id = $2
+			`, discrepancy.LedgerBalance, discrepancy.InventoryID)
+			if err != nil {
+				return err
+			}
+			if drift := roundQuantity(discrepancy.LedgerBalance - discrepancy.LotBalance); drift != 0 {
+				err = moveLots(tx, &models.StockMovement{
+					InventoryID: discrepancy.InventoryID,
+					Type:        models.MovementCountAdjustment,
+					Quantity:    drift,
+				})
+				if err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	return discrepancies, err
+}
+
+// stockDiscrepancies compares stock levels with the ledger, converted to the stock unit, and the lots.
+// lock keeps the compared inventory rows locked until the transaction ends
+func stockDiscrepancies(q DBTX, lock bool) ([]models.StockDiscrepancy, error) {
+	query := `SELECT i.inventory_id, i.name, i.stock_level, COALESCE(m.balance, 0), COALESCE(l.remaining, 0)
+	FROM inventory i
+	LEFT JOIN (SELECT inventory_id, ROUND(SUM(to_stock_unit(quantity, unit, inventory_id)), 3) AS balance
+		FROM stock_movements GROUP BY inventory_id) m USING(inventory_id)
+	LEFT JOIN (SELECT inventory_id, SUM(remaining) AS remaining FROM inventory_lots GROUP BY inventory_id) l USING(inventory_id)
+	WHERE i.stock_level <> COALESCE(m.balance, 0) OR i.stock_level <> COALESCE(l.remaining, 0)
+	ORDER BY i.inventory_id`
+	if lock {
+		query += `
+	FOR UPDATE OF i`
+	}
+	rows, err := q.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	discrepancies := []models.StockDiscrepancy{}
+	for rows.Next() {
+		var discrepancy models.StockDiscrepancy
+		err := rows.Scan(&discrepancy.InventoryID, &discrepancy.Name, &discrepancy.StockLevel, &discrepancy.LedgerBalance,
+			&discrepancy.LotBalance)
+		if err != nil {
+			return nil, err
+		}
+		discrepancy.Difference = math.Round((discrepancy.StockLevel-discrepancy.LedgerBalance)*1000) / 1000
+		discrepancy.LotDifference = math.Round((discrepancy.StockLevel-discrepancy.LotBalance)*1000) / 1000
+		discrepancies = append(discrepancies, discrepancy)
+	}
+	return discrepancies, rows.Err()
+}
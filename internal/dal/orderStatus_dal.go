@@ -22,7 +22,7 @@ func DefaultOrderStatusRepo(db *sql.DB) *NewOrderStatusRepo {
 // Retrieves the information about all order status histories from database
 func (repo *NewOrderStatusRepo) GetAllOrderStatus() ([]models.OrderStatus, error) {
 	var data []models.OrderStatus
-	rows, err := repo.DB.Query(`SELECT id, order_id, status, changed_at 
+	rows, err := repo.DB.Query(`SELECT id, order_id, status, COALESCE(reason, ''), changed_at 
 		FROM order_status_history
 	`)
 	if err != nil {
@@ -31,7 +31,7 @@ func (repo *NewOrderStatusRepo) GetAllOrderStatus() ([]models.OrderStatus, error
 	defer rows.Close()
 	for rows.Next() {
 		var orderStatus models.OrderStatus
-		err := rows.Scan(&orderStatus.Id, &orderStatus.Order_id, &orderStatus.Status, &orderStatus.CreatedAt)
+		err := rows.Scan(&orderStatus.Id, &orderStatus.Order_id, &orderStatus.Status, &orderStatus.Reason, &orderStatus.CreatedAt)
 		if err != nil {
 			return data, err
 		}
@@ -43,7 +43,7 @@ func (repo *NewOrderStatusRepo) GetAllOrderStatus() ([]models.OrderStatus, error
 // Retrieves the order status history by id from database
 func (repo *NewOrderStatusRepo) GetOrderStatus(id int) ([]models.OrderStatus, error) {
 	var data []models.OrderStatus
-	rows, err := repo.DB.Query(`SELECT id, order_id, status, changed_at 
+	rows, err := repo.DB.Query(`SELECT id, order_id, status, COALESCE(reason, ''), changed_at 
 	FROM order_status_history
 	WHERE order_id=$1
 	`, id)
@@ -53,7 +53,7 @@ func (repo *NewOrderStatusRepo) GetOrderStatus(id int) ([]models.OrderStatus, er
 	defer rows.Close()
 	for rows.Next() {
 		var orderStatus models.OrderStatus
-		err := rows.Scan(&orderStatus.Id, &orderStatus.Order_id, &orderStatus.Status, &orderStatus.CreatedAt)
+		err := rows.Scan(&orderStatus.Id, &orderStatus.Order_id, &orderStatus.Status, &orderStatus.Reason, &orderStatus.CreatedAt)
 		if err != nil {
 			return data, err
 		}
@@ -0,0 +1,454 @@
+package dal
+
+import (
+	"database/sql"
+	"errors"
+	"frappuccino/models"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// ErrPromoCodeNotApplicable is returned when the promo code of an order matches no promotion that applies to it
+var ErrPromoCodeNotApplicable = errors.New("promo code does not exist or does not apply to this order")
+
+type PromotionRepo interface {
+	GetPromotions() ([]models.Promotion, error)
+	GetPromotion(id int) (models.Promotion, error)
+	IsPromotionExist(id int) (bool, error)
+	IsCodeTaken(code string, id int) (bool, error)
+	SavePromotion(promotion models.Promotion) (int, error)
+	UpdatePromotion(promotion models.Promotion, id int) error
+	DeletePromotion(id int) error
+}
+
+type NewPromotionRepo struct {
+	DB *sql.DB
+}
+
+func DefaultPromotionRepo(db *sql.DB) *NewPromotionRepo {
+	return &NewPromotionRepo{DB: db}
+}
+
+const promotionColumns = `promotion_id, name, COALESCE(code, ''), effect, value, buy_quantity, free_quantity, menu_item_ids, tags,
+	COALESCE(customer_id, 0), min_spend, days_of_week, COALESCE(TO_CHAR(start_time, 'HH24:MI'), ''),
+	COALESCE(TO_CHAR(end_time, 'HH24:MI'), ''), starts_at, ends_at, priority, active, created_at`
+
+// scanPromotion reads a row of promotionColumns
+func scanPromotion(row interface{ Scan(dest ...any) error }) (models.Promotion, error) {
+	var promotion models.Promotion
+	var menuItemIDs, daysOfWeek pq.Int64Array
+	err := row.Scan(&promotion.ID, &promotion.Name, &promotion.Code, &promotion.Effect, &promotion.Value, &promotion.BuyQuantity,
+		&promotion.FreeQuantity, &menuItemIDs, pq.Array(&promotion.Tags), &promotion.CustomerID, &promotion.MinSpend, &daysOfWeek,
+		&promotion.StartTime, &promotion.EndTime, &promotion.StartsAt, &promotion.EndsAt, &promotion.Priority, &promotion.Active,
+		&promotion.CreatedAt)
+	if err != nil {
+		return promotion, err
+	}
+	promotion.MenuItemIDs = make([]int, len(menuItemIDs))
+	for i, id := range menuItemIDs {
+		promotion.MenuItemIDs[i] = int(id)
+	}
+	promotion.DaysOfWeek = make([]int, len(daysOfWeek))
+	for i, day := range daysOfWeek {
+		promotion.DaysOfWeek[i] = int(day)
+	}
+	if promotion.Tags == nil {
+		promotion.Tags = []string{}
+	}
+	return promotion, nil
+}
+
+// Retrieves all promotions, the ones applied first come first
+func (repo *NewPromotionRepo) GetPromotions() ([]models.Promotion, error) {
+	rows, err := repo.DB.Query(`SELECT ` + promotionColumns + `
+	FROM promotions
+	ORDER BY active DESC, priority DESC, promotion_id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	promotions := []models.Promotion{}
+	for rows.Next() {
+		promotion, err := scanPromotion(rows)
+		if err != nil {
+			return nil, err
+		}
+		promotions = append(promotions, promotion)
+	}
+	return promotions, rows.Err()
+}
+
+// Retrieves the promotion by ID
+func (repo *NewPromotionRepo) GetPromotion(id int) (models.Promotion, error) {
+	return scanPromotion(repo.DB.QueryRow(`SELECT `+promotionColumns+`
+	FROM promotions
+	WHERE promotion_id=$1
+	`, id))
+}
+
+// Checks is promotion exist by ID
+func (repo *NewPromotionRepo) IsPromotionExist(id int) (bool, error) {
+	var count int
+	err := repo.DB.QueryRow(`SELECT COUNT(*) FROM promotions WHERE promotion_id=$1`, id).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// Checks if another promotion than the given one has the promo code, codes are compared ignoring case
+func (repo *NewPromotionRepo) IsCodeTaken(code string, id int) (bool, error) {
+	var count int
+	err := repo.DB.QueryRow(`SELECT COUNT(*) FROM promotions
+	WHERE LOWER(code) = LOWER($1::text) AND promotion_id <> $2::int
+	`, code, id).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// Saves the promotion, returns the new promotion ID
+func (repo *NewPromotionRepo) SavePromotion(promotion models.Promotion) (int, error) {
+	var id int
+	err := repo.DB.QueryRow(`INSERT INTO promotions (name, code, effect, value, buy_quantity, free_quantity, menu_item_ids, tags,
+		customer_id, min_spend, days_of_week, start_time, end_time, starts_at, ends_at, priority, active)
+	VALUES ($1, NULLIF($2::text, ''), $3, $4, $5, $6, $7::int[], $8::text[], NULLIF($9::int, 0), $10, $11::int[],
+		NULLIF($12::text, '')::time, NULLIF($13::text, '')::time, $14, $15, $16, $17)
+	RETURNING promotion_id
+	`, promotionArgs(promotion)...).Scan(&id)
+	return id, err
+}
+
+// Updates the promotion, discounts already given keep their amount
+func (repo *NewPromotionRepo) UpdatePromotion(promotion models.Promotion, id int) error {
+	_, err := repo.DB.Exec(`UPDATE promotions
+	SET name=$1, code=NULLIF($2::text, ''), effect=$3, value=$4, buy_quantity=$5, free_quantity=$6, menu_item_ids=$7::int[],
+		tags=$8::text[], customer_id=NULLIF($9::int, 0), min_spend=$10, days_of_week=$11::int[],
+		start_time=NULLIF($12::text, '')::time, end_time=NULLIF($13::text, '')::time, starts_at=$14, ends_at=$15,
+		priority=$16, active=$17
+	WHERE promotion_id=$18
+	`, append(promotionArgs(promotion), id)...)
+	return err
+}
+
+// Deletes the promotion, discounts already given stay on their orders
+func (repo *NewPromotionRepo) DeletePromotion(id int) error {
+	_, err := repo.DB.Exec(`DELETE FROM promotions WHERE promotion_id=$1`, id)
+	return err
+}
+
+// promotionArgs are the columns of the promotion in the order they are saved in
+func promotionArgs(promotion models.Promotion) []any {
+	return []any{promotion.Name, promotion.Code, promotion.Effect, promotion.Value, promotion.BuyQuantity, promotion.FreeQuantity,
+		pq.Array(promotion.MenuItemIDs), pq.Array(promotion.Tags), promotion.CustomerID, promotion.MinSpend,
+		pq.Array(promotion.DaysOfWeek), promotion.StartTime, promotion.EndTime, promotion.StartsAt, promotion.EndsAt,
+		promotion.Priority, promotion.Active}
+}
+
+// evaluatePromotions prices the order lines by the active promotions as of the order date, now for a new order,
+// see applyPromotions. Returns the discounts and whether the promo code of the order was used
+func evaluatePromotions(q DBTX, order models.Order) ([]models.OrderDiscount, bool, error) {
+	at := order.CreatedAt
+	if at.IsZero() {
+		at = time.Now()
+	}
+	at = at.In(time.Local)
+	rows, err := q.Query(`SELECT `+promotionColumns+`
+	FROM promotions
+	WHERE active AND (starts_at IS NULL OR starts_at <= $1) AND (ends_at IS NULL OR ends_at > $1)
+	ORDER BY priority DESC, promotion_id
+	`, at)
+	if err != nil {
+		return nil, false, err
+	}
+	var promotions []models.Promotion
+	for rows.Next() {
+		promotion, err := scanPromotion(rows)
+		if err != nil {
+			rows.Close()
+			return nil, false, err
+		}
+		promotions = append(promotions, promotion)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, false, err
+	}
+	if len(promotions) == 0 || len(order.Items) == 0 {
+		return nil, false, nil
+	}
+	tags, err := menuItemTags(q, order.Items)
+	if err != nil {
+		return nil, false, err
+	}
+	discounts, codeUsed := applyPromotions(promotions, tags, order, at)
+	return discounts, codeUsed, nil
+}
+
+// applyPromotions prices the order lines by the promotions, given by priority, at the time; tags are keyed by menu_item_id.
+// Promotions are tried by priority and a line takes the first one that discounts it; percent off, free items and
+// bundles are discounts of lines, an amount off is spread over the lines it matches or, without menu items and tags,
+// is a discount of the whole order, only one such discount applies. Lines with a loyalty discount are left alone.
+// Returns the discounts and whether the promo code of the order was used
+func applyPromotions(promotions []models.Promotion, tags map[int][]string, order models.Order, at time.Time) ([]models.OrderDiscount, bool) {
+	var subtotal float64
+	for _, item := range order.Items {
+		subtotal += item.PriceAtOrderTime
+	}
+	remaining := subtotal
+	claimed := make([]bool, len(order.Items))
+	// Lines the loyalty discounts of a saved order are on take no promotion
+	for _, discount := range order.Discounts {
+		if discount.Source == models.DiscountPromotion {
+			continue
+		}
+		remaining += discount.Amount
+		for i, item := range order.Items {
+			if discount.OrderItemID != 0 && item.ID == discount.OrderItemID {
+				claimed[i] = true
+			}
+		}
+	}
+	var discounts []models.OrderDiscount
+	var orderWide *models.Promotion
+	codeUsed := false
+	for _, promotion := range promotions {
+		if !promotionHolds(promotion, order, at, subtotal) {
+			continue
+		}
+		scoped := len(promotion.MenuItemIDs) > 0 || len(promotion.Tags) > 0
+		if promotion.Effect == models.PromotionAmountOff && !scoped {
+			// Discounts of the whole order come after the line discounts, so they are capped at what is left
+			if orderWide == nil {
+				orderWide = &promotion
+			}
+			continue
+		}
+		var lines []int
+		for i, item := range order.Items {
+			if !claimed[i] && item.PriceAtOrderTime > 0 && promotionMatches(promotion, item, tags[item.MenuItemID]) {
+				lines = append(lines, i)
+			}
+		}
+		amounts := promotionLineAmounts(promotion, order.Items, lines)
+		for _, i := range lines {
+			if amounts[i] <= 0 {
+				continue
+			}
+			claimed[i] = true
+			remaining -= amounts[i]
+			discounts = append(discounts, models.OrderDiscount{
+				OrderItemID: order.Items[i].ID,
+				Source:      models.DiscountPromotion,
+				PromotionID: promotion.ID,
+				Description: promotion.Name,
+				Amount:      -amounts[i],
+				Line:        i + 1,
+			})
+			if promotion.Code != "" {
+				codeUsed = true
+			}
+		}
+	}
+	if orderWide != nil {
+		amount := roundMoney(math.Min(orderWide.Value, math.Max(remaining, 0)))
+		if amount > 0 {
+			discounts = append(discounts, models.OrderDiscount{
+				Source:      models.DiscountPromotion,
+				PromotionID: orderWide.ID,
+				Description: orderWide.Name,
+				Amount:      -amount,
+			})
+			if orderWide.Code != "" {
+				codeUsed = true
+			}
+		}
+	}
+	return discounts, codeUsed
+}
+
+// promotionHolds checks the conditions of the promotion on the order at the time, but its lines
+func promotionHolds(promotion models.Promotion, order models.Order, at time.Time, subtotal float64) bool {
+	if promotion.Code != "" && !strings.EqualFold(promotion.Code, order.PromoCode) {
+		return false
+	}
+	if promotion.CustomerID != 0 && promotion.CustomerID != order.CustomerID {
+		return false
+	}
+	if subtotal < promotion.MinSpend {
+		return false
+	}
+	if len(promotion.DaysOfWeek) > 0 {
+		day := int(at.Weekday())
+		if day == 0 {
+			day = 7
+		}
+		if !slices.Contains(promotion.DaysOfWeek, day) {
+			return false
+		}
+	}
+	if promotion.StartTime != "" && promotion.EndTime != "" {
+		start, err1 := time.Parse("15:04", promotion.StartTime)
+		end, err2 := time.Parse("15:04", promotion.EndTime)
+		if err1 != nil || err2 != nil {
+			return false
+		}
+		minute := at.Hour()*60 + at.Minute()
+		from, to := start.Hour()*60+start.Minute(), end.Hour()*60+end.Minute()
+		if from <= to && (minute < from || minute >= to) {
+			return false
+		}
+		if from > to && minute < from && minute >= to {
+			return false
+		}
+	}
+	return true
+}
+
+// promotionMatches checks if the promotion applies to the line, every line matches a promotion without menu items and tags
+func promotionMatches(promotion models.Promotion, item models.OrderItem, tags []string) bool {
+	if len(promotion.MenuItemIDs) == 0 && len(promotion.Tags) == 0 {
+		return true
+	}
+	if slices.Contains(promotion.MenuItemIDs, item.MenuItemID) {
+		return true
+	}
+	for _, tag := range tags {
+		if slices.Contains(promotion.Tags, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// promotionLineAmounts is the discount the promotion gives to each of the lines, indexed like the items.
+// Free items are the cheapest units of every group of buy_quantity and free_quantity units, bundles are groups of
+// buy_quantity units, units are grouped from the most expensive down. No line gets more than its price
+func promotionLineAmounts(promotion models.Promotion, items []models.OrderItem, lines []int) []float64 {
+	amounts := make([]float64, len(items))
+	if len(lines) == 0 {
+		return amounts
+	}
+	var matched float64
+	for _, i := range lines {
+		matched += items[i].PriceAtOrderTime
+	}
+	switch promotion.Effect {
+	case models.PromotionPercentOff:
+		for _, i := range lines {
+			amounts[i] = items[i].PriceAtOrderTime * promotion.Value / 100
+		}
+	case models.PromotionAmountOff:
+		amount := math.Min(promotion.Value, matched)
+		for _, i := range lines {
+			amounts[i] = amount * items[i].PriceAtOrderTime / matched
+		}
+	case models.PromotionFreeItem, models.PromotionBundlePrice:
+		type unit struct {
+			line  int
+			price float64
+		}
+		var units []unit
+		for _, i := range lines {
+			if items[i].Quantity <= 0 {
+				continue
+			}
+			price := items[i].PriceAtOrderTime / float64(items[i].Quantity)
+			for range items[i].Quantity {
+				units = append(units, unit{line: i, price: price})
+			}
+		}
+		sort.SliceStable(units, func(a, b int) bool { return units[a].price > units[b].price })
+		if promotion.Effect == models.PromotionFreeItem {
+			group := promotion.BuyQuantity + promotion.FreeQuantity
+			for start := 0; promotion.FreeQuantity > 0 && start+group <= len(units); start += group {
+				for _, free := range units[start+promotion.BuyQuantity : start+group] {
+					amounts[free.line] += free.price
+				}
+			}
+			break
+		}
+		for start := 0; promotion.BuyQuantity > 0 && start+promotion.BuyQuantity <= len(units); start += promotion.BuyQuantity {
+			bundle := units[start : start+promotion.BuyQuantity]
+			var sum float64
+			for _, u := range bundle {
+				sum += u.price
+			}
+			if sum <= promotion.Value {
+				continue
+			}
+			for _, u := range bundle {
+				amounts[u.line] += (sum - promotion.Value) * u.price / sum
+			}
+		}
+	}
+	// Lines are rounded to cents, the rounding difference goes to the last discounted line
+	var total, rounded float64
+	last := -1
+	for _, i := range lines {
+		total += amounts[i]
+		amounts[i] = roundMoney(math.Min(amounts[i], items[i].PriceAtOrderTime))
+		rounded += amounts[i]
+		if amounts[i] > 0 {
+			last = i
+		}
+	}
+	if last >= 0 {
+		diff := roundMoney(math.Min(total, matched)) - roundMoney(rounded)
+		amounts[last] = roundMoney(math.Max(math.Min(amounts[last]+diff, items[last].PriceAtOrderTime), 0))
+	}
+	return amounts
+}
+
+// menuItemTags retrieves the tags of the menu items of the order lines, keyed by menu_item_id
+func menuItemTags(q DBTX, items []models.OrderItem) (map[int][]string, error) {
+	ids := make([]int, 0, len(items))
+	for _, item := range items {
+		ids = append(ids, item.MenuItemID)
+	}
+	rows, err := q.Query(`SELECT menu_item_id, tags FROM menu_items WHERE menu_item_id = ANY($1::int[])`, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	tags := make(map[int][]string)
+	for rows.Next() {
+		var id int
+		var itemTags []string
+		if err := rows.Scan(&id, pq.Array(&itemTags)); err != nil {
+			return nil, err
+		}
+		tags[id] = itemTags
+	}
+	return tags, rows.Err()
+}
+
+// repricePromotions prices the saved order again by the promotions as of its order date with its promo code,
+// after its lines changed, and sets its total amount. A promo code that no longer applies gives no discount
+func repricePromotions(tx *sql.Tx, order_id int) error {
+	order, err := getOrder(tx, order_id)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`DELETE FROM order_discounts WHERE order_id=$1 AND source='promotion'`, order_id)
+	if err != nil {
+		return err
+	}
+	discounts, _, err := evaluatePromotions(tx, order)
+	if err != nil {
+		return err
+	}
+	for _, discount := range discounts {
+		if err := insertOrderDiscount(tx, order_id, discount); err != nil {
+			return err
+		}
+	}
+	return refreshOrderTotal(tx, order_id)
+}
@@ -0,0 +1,294 @@
+package dal
+
+import (
+	"frappuccino/models"
+	"math"
+	"testing"
+	"time"
+)
+
+// sunday is 2 June 2024 at noon
+var sunday = time.Date(2024, time.June, 2, 12, 0, 0, 0, time.UTC)
+
+func at(day time.Time, hour, minute int) time.Time {
+	return time.Date(day.Year(), day.Month(), day.Day(), hour, minute, 0, 0, time.UTC)
+}
+
+func sameAmounts(got, want []float64) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		if math.Abs(got[i]-want[i]) > 0.0001 {
+			return false
+		}
+	}
+	return true
+}
+
+func TestPromotionHolds(t *testing.T) {
+	order := models.Order{CustomerID: 7, PromoCode: "Summer"}
+	tests := []struct {
+		name      string
+		promotion models.Promotion
+		at        time.Time
+		subtotal  float64
+		want      bool
+	}{
+		{"no conditions", models.Promotion{}, sunday, 10, true},
+		{"code matches whatever the case", models.Promotion{Code: "SUMMER"}, sunday, 10, true},
+		{"other code", models.Promotion{Code: "WINTER"}, sunday, 10, false},
+		{"customer of the promotion", models.Promotion{CustomerID: 7}, sunday, 10, true},
+		{"other customer", models.Promotion{CustomerID: 8}, sunday, 10, false},
+		{"min spend reached", models.Promotion{MinSpend: 10}, sunday, 10, true},
+		{"min spend missed", models.Promotion{MinSpend: 10.01}, sunday, 10, false},
+		{"sunday is 7", models.Promotion{DaysOfWeek: []int{7}}, sunday, 10, true},
+		{"sunday is not 0", models.Promotion{DaysOfWeek: []int{0}}, sunday, 10, false},
+		{"monday is 1", models.Promotion{DaysOfWeek: []int{1, 2}}, sunday.AddDate(0, 0, 1), 10, true},
+		{"saturday is not a weekday", models.Promotion{DaysOfWeek: []int{1, 2, 3, 4, 5}}, sunday.AddDate(0, 0, -1), 10, false},
+		{"window start is included", models.Promotion{StartTime: "08:00", EndTime: "11:00"}, at(sunday, 8, 0), 10, true},
+		{"inside the window", models.Promotion{StartTime: "08:00", EndTime: "11:00"}, at(sunday, 10, 59), 10, true},
+		{"window end is excluded", models.Promotion{StartTime: "08:00", EndTime: "11:00"}, at(sunday, 11, 0), 10, false},
+		{"before the window", models.Promotion{StartTime: "08:00", EndTime: "11:00"}, at(sunday, 7, 59), 10, false},
+		{"overnight window before midnight", models.Promotion{StartTime: "22:00", EndTime: "02:00"}, at(sunday, 23, 30), 10, true},
+		{"overnight window start", models.Promotion{StartTime: "22:00", EndTime: "02:00"}, at(sunday, 22, 0), 10, true},
+		{"overnight window after midnight", models.Promotion{StartTime: "22:00", EndTime: "02:00"}, at(sunday, 1, 0), 10, true},
+		{"overnight window end is excluded", models.Promotion{StartTime: "22:00", EndTime: "02:00"}, at(sunday, 2, 0), 10, false},
+		{"outside the overnight window", models.Promotion{StartTime: "22:00", EndTime: "02:00"}, at(sunday, 12, 0), 10, false},
+		{"malformed window", models.Promotion{StartTime: "8am", EndTime: "11:00"}, at(sunday, 9, 0), 10, false},
+		{"every condition holds", models.Promotion{Code: "summer", CustomerID: 7, MinSpend: 5, DaysOfWeek: []int{6, 7},
+			StartTime: "11:00", EndTime: "14:00"}, sunday, 10, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := promotionHolds(test.promotion, order, test.at, test.subtotal); got != test.want {
+				t.Errorf("promotionHolds = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestPromotionMatches(t *testing.T) {
+	item := models.OrderItem{MenuItemID: 3}
+	tests := []struct {
+		name      string
+		promotion models.Promotion
+		tags      []string
+		want      bool
+	}{
+		{"unscoped promotion matches every line", models.Promotion{}, nil, true},
+		{"menu item listed", models.Promotion{MenuItemIDs: []int{1, 3}}, nil, true},
+		{"menu item not listed", models.Promotion{MenuItemIDs: []int{1, 2}}, []string{"coffee"}, false},
+		{"tag shared", models.Promotion{Tags: []string{"pastry", "coffee"}}, []string{"coffee"}, true},
+		{"no tag shared", models.Promotion{Tags: []string{"pastry"}}, []string{"coffee"}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := promotionMatches(test.promotion, item, test.tags); got != test.want {
+				t.Errorf("promotionMatches = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestPromotionLineAmounts(t *testing.T) {
+	line := func(price float64, quantity int) models.OrderItem {
+		return models.OrderItem{PriceAtOrderTime: price, Quantity: quantity}
+	}
+	tests := []struct {
+		name      string
+		promotion models.Promotion
+		items     []models.OrderItem
+		lines     []int
+		want      []float64
+	}{
+		{
+			name:      "percent off every matched line",
+			promotion: models.Promotion{Effect: models.PromotionPercentOff, Value: 10},
+			items:     []models.OrderItem{line(4.5, 1), line(2, 2)},
+			lines:     []int{0, 1},
+			want:      []float64{0.45, 0.2},
+		},
+		{
+			name:      "percent off skips unmatched lines",
+			promotion: models.Promotion{Effect: models.PromotionPercentOff, Value: 50},
+			items:     []models.OrderItem{line(4, 1), line(2, 1)},
+			lines:     []int{1},
+			want:      []float64{0, 1},
+		},
+		{
+			name:      "amount off is spread by price",
+			promotion: models.Promotion{Effect: models.PromotionAmountOff, Value: 3},
+			items:     []models.OrderItem{line(4, 1), line(2, 1)},
+			lines:     []int{0, 1},
+			want:      []float64{2, 1},
+		},
+		{
+			name:      "amount off is capped at the matched lines",
+			promotion: models.Promotion{Effect: models.PromotionAmountOff, Value: 10},
+			items:     []models.OrderItem{line(3, 1), line(2, 1), line(5, 1)},
+			lines:     []int{0, 1},
+			want:      []float64{3, 2, 0},
+		},
+		{
+			name:      "cent rounding goes to the last line",
+			promotion: models.Promotion{Effect: models.PromotionAmountOff, Value: 1},
+			items:     []models.OrderItem{line(1, 1), line(1, 1), line(1, 1)},
+			lines:     []int{0, 1, 2},
+			want:      []float64{0.33, 0.33, 0.34},
+		},
+		{
+			name:      "buy two get one free takes the cheapest unit",
+			promotion: models.Promotion{Effect: models.PromotionFreeItem, BuyQuantity: 2, FreeQuantity: 1},
+			items:     []models.OrderItem{line(8, 2), line(3, 1)},
+			lines:     []int{0, 1},
+			want:      []float64{0, 3},
+		},
+		{
+			name:      "free units are grouped from the most expensive down",
+			promotion: models.Promotion{Effect: models.PromotionFreeItem, BuyQuantity: 2, FreeQuantity: 1},
+			items:     []models.OrderItem{line(20, 4), line(4, 2)},
+			lines:     []int{0, 1},
+			want:      []float64{5, 2},
+		},
+		{
+			name:      "incomplete group gets nothing free",
+			promotion: models.Promotion{Effect: models.PromotionFreeItem, BuyQuantity: 2, FreeQuantity: 1},
+			items:     []models.OrderItem{line(6, 2)},
+			lines:     []int{0},
+			want:      []float64{0},
+		},
+		{
+			name:      "bundle price is split by unit price",
+			promotion: models.Promotion{Effect: models.PromotionBundlePrice, Value: 5, BuyQuantity: 2},
+			items:     []models.OrderItem{line(4, 1), line(3, 1)},
+			lines:     []int{0, 1},
+			want:      []float64{1.14, 0.86},
+		},
+		{
+			name:      "units left out of a bundle pay full price",
+			promotion: models.Promotion{Effect: models.PromotionBundlePrice, Value: 6, BuyQuantity: 2},
+			items:     []models.OrderItem{line(10, 2), line(2, 1)},
+			lines:     []int{0, 1},
+			want:      []float64{4, 0},
+		},
+		{
+			name:      "bundle dearer than its units gives nothing",
+			promotion: models.Promotion{Effect: models.PromotionBundlePrice, Value: 8, BuyQuantity: 2},
+			items:     []models.OrderItem{line(4, 1), line(3, 1)},
+			lines:     []int{0, 1},
+			want:      []float64{0, 0},
+		},
+		{
+			name:      "no matched lines",
+			promotion: models.Promotion{Effect: models.PromotionPercentOff, Value: 10},
+			items:     []models.OrderItem{line(4, 1)},
+			lines:     nil,
+			want:      []float64{0},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := promotionLineAmounts(test.promotion, test.items, test.lines); !sameAmounts(got, test.want) {
+				t.Errorf("promotionLineAmounts = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestApplyPromotions(t *testing.T) {
+	items := []models.OrderItem{
+		{ID: 1, MenuItemID: 10, PriceAtOrderTime: 4, Quantity: 1},
+		{ID: 2, MenuItemID: 20, PriceAtOrderTime: 6, Quantity: 1},
+	}
+	tags := map[int][]string{10: {"coffee"}, 20: {"pastry"}}
+	tests := []struct {
+		name       string
+		promotions []models.Promotion
+		order      models.Order
+		want       []models.OrderDiscount
+		wantCode   bool
+	}{
+		{
+			name:       "line discount by tag",
+			promotions: []models.Promotion{{ID: 1, Name: "Coffee", Effect: models.PromotionPercentOff, Value: 25, Tags: []string{"coffee"}}},
+			order:      models.Order{Items: items},
+			want:       []models.OrderDiscount{{OrderItemID: 1, PromotionID: 1, Description: "Coffee", Amount: -1, Line: 1}},
+		},
+		{
+			name: "a line takes only the first promotion",
+			promotions: []models.Promotion{
+				{ID: 1, Name: "Half", Effect: models.PromotionPercentOff, Value: 50, MenuItemIDs: []int{20}},
+				{ID: 2, Name: "Tenth", Effect: models.PromotionPercentOff, Value: 10},
+			},
+			order: models.Order{Items: items},
+			want: []models.OrderDiscount{
+				{OrderItemID: 2, PromotionID: 1, Description: "Half", Amount: -3, Line: 2},
+				{OrderItemID: 1, PromotionID: 2, Description: "Tenth", Amount: -0.4, Line: 1},
+			},
+		},
+		{
+			name: "order-wide amount is capped at what the lines leave",
+			promotions: []models.Promotion{
+				{ID: 1, Name: "Half", Effect: models.PromotionPercentOff, Value: 50},
+				{ID: 2, Name: "Ten off", Effect: models.PromotionAmountOff, Value: 10},
+			},
+			order: models.Order{Items: items},
+			want: []models.OrderDiscount{
+				{OrderItemID: 1, PromotionID: 1, Description: "Half", Amount: -2, Line: 1},
+				{OrderItemID: 2, PromotionID: 1, Description: "Half", Amount: -3, Line: 2},
+				{PromotionID: 2, Description: "Ten off", Amount: -5},
+			},
+		},
+		{
+			name: "only the first order-wide amount applies",
+			promotions: []models.Promotion{
+				{ID: 1, Name: "Two off", Effect: models.PromotionAmountOff, Value: 2},
+				{ID: 2, Name: "Three off", Effect: models.PromotionAmountOff, Value: 3},
+			},
+			order: models.Order{Items: items},
+			want:  []models.OrderDiscount{{PromotionID: 1, Description: "Two off", Amount: -2}},
+		},
+		{
+			name: "loyalty lines are left alone and lower the order-wide cap",
+			promotions: []models.Promotion{
+				{ID: 1, Name: "Tenth", Effect: models.PromotionPercentOff, Value: 10, MenuItemIDs: []int{10}},
+				{ID: 2, Name: "Ten off", Effect: models.PromotionAmountOff, Value: 10},
+			},
+			order: models.Order{Items: items, Discounts: []models.OrderDiscount{
+				{OrderItemID: 1, Source: models.DiscountLoyaltyReward, Amount: -4},
+			}},
+			want: []models.OrderDiscount{{PromotionID: 2, Description: "Ten off", Amount: -6}},
+		},
+		{
+			name:       "promo code is reported as used",
+			promotions: []models.Promotion{{ID: 1, Name: "Code", Code: "SAVE", Effect: models.PromotionAmountOff, Value: 1}},
+			order:      models.Order{Items: items, PromoCode: "save"},
+			want:       []models.OrderDiscount{{PromotionID: 1, Description: "Code", Amount: -1}},
+			wantCode:   true,
+		},
+		{
+			name:       "promotion of another code does not apply",
+			promotions: []models.Promotion{{ID: 1, Name: "Code", Code: "SAVE", Effect: models.PromotionAmountOff, Value: 1}},
+			order:      models.Order{Items: items, PromoCode: "OTHER"},
+			want:       nil,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, codeUsed := applyPromotions(test.promotions, tags, test.order, sunday)
+			if codeUsed != test.wantCode {
+				t.Errorf("code used = %v, want %v", codeUsed, test.wantCode)
+			}
+			if len(got) != len(test.want) {
+				t.Fatalf("applyPromotions = %+v, want %+v", got, test.want)
+			}
+			for i, want := range test.want {
+				want.Source = models.DiscountPromotion
+				if got[i] != want {
+					t.Errorf("discount %d = %+v, want %+v", i, got[i], want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,322 @@
+package dal
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"frappuccino/models"
+)
+
+// ErrPOStatus is returned when the purchase order status does not allow the change
+var ErrPOStatus = errors.New("purchase order status does not allow this")
+
+// ErrItemNotSupplied is returned when an order line asks a supplier for an item it does not sell
+var ErrItemNotSupplied = errors.New("inventory item is not sold by the supplier")
+
+// ErrPOLineNotFound is returned when a delivery names a line of another purchase order
+var ErrPOLineNotFound = errors.New("purchase order line not found")
+
+// ErrOverReceived is returned when a delivery brings more packs than are still due on the line
+var ErrOverReceived = errors.New("received more packs than ordered")
+
+type PurchaseOrderRepo interface {
+	GetPurchaseOrders(status string, supplier_id int) ([]models.PurchaseOrder, error)
+	GetPurchaseOrder(id int) (models.PurchaseOrder, error)
+	IsPurchaseOrderExist(id int) (bool, error)
+	SavePurchaseOrder(order models.PurchaseOrder) (int, error)
+	UpdatePurchaseOrder(order models.PurchaseOrder) error
+	SendPurchaseOrder(id int) error
+	CancelPurchaseOrder(id int) error
+	ReceivePurchaseOrder(id int, receive models.ReceiveRequest, user string) error
+}
+
+type NewPurchaseOrderRepo struct {
+	DB *sql.DB
+}
+
+func DefaultPurchaseOrderRepo(db *sql.DB) *NewPurchaseOrderRepo {
+	return &NewPurchaseOrderRepo{DB: db}
+}
+
+// Retrieves purchase orders with their lines, newest first, optionally only of a status or a supplier
+func (repo *NewPurchaseOrderRepo) GetPurchaseOrders(status string, supplier_id int) ([]models.PurchaseOrder, error) {
+	rows, err := repo.DB.Query(`SELECT p.po_id, p.supplier_id, s.name, p.status, COALESCE(p.note, ''),
+	COALESCE(TO_CHAR(p.expected_date, 'YYYY-MM-DD'), ''), COALESCE(p.created_by, ''), p.created_at, p.sent_at, p.received_at
+	FROM purchase_orders p
+	INNER JOIN suppliers s USING(supplier_id)
+	WHERE ($1::text = '' OR p.status::text = $1)
+	AND ($2::int = 0 OR p.supplier_id = $2)
+	ORDER BY p.created_at DESC, p.po_id DESC
+	`, status, supplier_id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	orders := []models.PurchaseOrder{}
+	for rows.Next() {
+		var order models.PurchaseOrder
+		err := rows.Scan(&order.ID, &order.SupplierID, &order.SupplierName, &order.Status, &order.Note,
+			&order.ExpectedDate, &order.CreatedBy, &order.CreatedAt, &order.SentAt, &order.ReceivedAt)
+		if err != nil {
+			return nil, err
+		}
+		orders = append(orders, order)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for i := range orders {
+		if err := repo.setPurchaseOrderLines(&orders[i]); err != nil {
+			return nil, err
+		}
+	}
+	return orders, nil
+}
+
+// Retrieves the purchase order with its lines
+func (repo *NewPurchaseOrderRepo) GetPurchaseOrder(id int) (models.PurchaseOrder, error) {
+	var order models.PurchaseOrder
+	err := repo.DB.QueryRow(`SELECT p.po_id, p.supplier_id, s.name, p.status, COALESCE(p.note, ''),
+	COALESCE(TO_CHAR(p.expected_date, 'YYYY-MM-DD'), ''), COALESCE(p.created_by, ''), p.created_at, p.sent_at, p.received_at
+	FROM purchase_orders p
+	INNER JOIN suppliers s USING(supplier_id)
+	WHERE p.po_id=$1
+	`, id).Scan(&order.ID, &order.SupplierID, &order.SupplierName, &order.Status, &order.Note,
+		&order.ExpectedDate, &order.CreatedBy, &order.CreatedAt, &order.SentAt, &order.ReceivedAt)
+	if err != nil {
+		return order, err
+	}
+	err = repo.setPurchaseOrderLines(&order)
+	return order, err
+}
+
+// setPurchaseOrderLines loads the lines of the order and sums its total
+func (repo *NewPurchaseOrderRepo) setPurchaseOrderLines(order *models.PurchaseOrder) error {
+	rows, err := repo.DB.Query(`SELECT l.line_id, l.inventory_id, i.name, l.packs_ordered, l.packs_received,
+	l.pack_size, l.pack_unit, l.pack_price
+	FROM purchase_order_lines l
+	INNER JOIN inventory i USING(inventory_id)
+	WHERE l.po_id=$1
+	ORDER BY l.line_id
+	`, order.ID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	order.Lines = []models.PurchaseOrderLine{}
+	order.Total = 0
+	for rows.Next() {
+		var line models.PurchaseOrderLine
+		err := rows.Scan(&line.ID, &line.InventoryID, &line.Name, &line.PacksOrdered, &line.PacksReceived,
+			&line.PackSize, &line.PackUnit, &line.PackPrice)
+		if err != nil {
+			return err
+		}
+		line.LineTotal = roundMoney(line.PacksOrdered * line.PackPrice)
+		order.Total += line.LineTotal
+		order.Lines = append(order.Lines, line)
+	}
+	order.Total = roundMoney(order.Total)
+	return rows.Err()
+}
+
+// Checks is the purchase order exist
+func (repo *NewPurchaseOrderRepo) IsPurchaseOrderExist(id int) (bool, error) {
+	var count int
+	err := repo.DB.QueryRow(`SELECT COUNT(*) FROM purchase_orders WHERE po_id=$1`, id).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// Saves a draft purchase order, returns its ID. Every line takes the pack and price of the supplier for the item
+func (repo *NewPurchaseOrderRepo) SavePurchaseOrder(order models.PurchaseOrder) (int, error) {
+	var id int
+	err := WithTx(repo.DB, func(tx *sql.Tx) error {
+		var err error
+		id, err = insertPurchaseOrder(tx, order)
+		return err
+	})
+	return id, err
+}
+
+// insertPurchaseOrder saves the draft with its lines within the given transaction
+func insertPurchaseOrder(tx *sql.Tx, order models.PurchaseOrder) (int, error) {
+	var id int
+	err := tx.QueryRow(`INSERT INTO purchase_orders (supplier_id, note, expected_date, created_by)
+	VALUES ($1, NULLIF($2, ''), NULLIF($3, '')::date, NULLIF($4, ''))
+	RETURNING po_id
+	`, order.SupplierID, order.Note, order.ExpectedDate, order.CreatedBy).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+	return id, insertPurchaseOrderLines(tx, id, order.SupplierID, order.Lines)
+}
+
+// Replaces note, expected date and lines of a draft purchase order
+func (repo *NewPurchaseOrderRepo) UpdatePurchaseOrder(order models.PurchaseOrder) error {
+	return WithTx(repo.DB, func(tx *sql.Tx) error {
+		var status string
+		var supplierID int
+		err := tx.QueryRow(`SELECT status, supplier_id FROM purchase_orders WHERE po_id=$1 FOR UPDATE`, order.ID).Scan(&status, &supplierID)
+		if err != nil {
+			return err
+		}
+		if status != models.POStatusDraft {
+			return fmt.Errorf("%w: only a draft can be changed, the order is %s", ErrPOStatus, status)
+		}
+		_, err = tx.Exec(`UPDATE purchase_orders
+		SET note=NULLIF($1, ''), expected_date=NULLIF($2, '')::date
+		WHERE po_id=$3
+		`, order.Note, order.ExpectedDate, order.ID)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`DELETE FROM purchase_order_lines WHERE po_id=$1`, order.ID)
+		if err != nil {
+			return err
+		}
+		return insertPurchaseOrderLines(tx, order.ID, supplierID, order.Lines)
+	})
+}
+
+// insertPurchaseOrderLines copies the pack and price of the supplier to every line,
+// a pack of the inventory item is copied as the registered unit it holds
+func insertPurchaseOrderLines(tx *sql.Tx, po_id, supplier_id int, lines []models.PurchaseOrderLine) error {
+	for _, line := range lines {
+		result, err := tx.Exec(`INSERT INTO purchase_order_lines (po_id, inventory_id, packs_ordered, pack_size, pack_unit, pack_price)
+		SELECT $1, s.inventory_id, $2, s.pack_size * COALESCE(p.quantity, 1), COALESCE(p.unit_code, s.pack_unit), s.pack_price
+		FROM supplier_items s
+		LEFT JOIN inventory_pack_units p ON p.inventory_id = s.inventory_id AND p.name = s.pack_unit
+		WHERE s.supplier_id=$3 AND s.inventory_id=$4
+		`, po_id, line.PacksOrdered, supplier_id, line.InventoryID)
+		if err != nil {
+			return err
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if affected == 0 {
+			return fmt.Errorf("%w: inventory item %d", ErrItemNotSupplied, line.InventoryID)
+		}
+	}
+	return nil
+}
+
+// Marks a draft purchase order as sent, the expected date defaults to today plus the supplier lead time
+func (repo *NewPurchaseOrderRepo) SendPurchaseOrder(id int) error {
+	result, err := repo.DB.Exec(`UPDATE purchase_orders p
+	SET status='sent', sent_at=NOW(), expected_date=COALESCE(p.expected_date, CURRENT_DATE + s.lead_time_days)
+	FROM suppliers s
+	WHERE s.supplier_id = p.supplier_id AND p.po_id=$1 AND p.status='draft'
+	`, id)
+	return statusChanged(result, err, "only a draft can be sent")
+}
+
+// Cancels a purchase order that nothing was received for yet
+func (repo *NewPurchaseOrderRepo) CancelPurchaseOrder(id int) error {
+	result, err := repo.DB.Exec(`UPDATE purchase_orders
+	SET status='cancelled'
+	WHERE po_id=$1 AND status IN ('draft', 'sent')
+	`, id)
+	return statusChanged(result, err, "only a draft or sent order can be cancelled")
+}
+
+// statusChanged turns a status update that changed no row into ErrPOStatus
+func statusChanged(result sql.Result, err error, message string) error {
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return fmt.Errorf("%w: %s", ErrPOStatus, message)
+	}
+	return nil
+}
+
+// Receives a delivery against a sent purchase order. Every delivered line becomes a purchase in inventory_transactions
+// priced at the order pack price. The order is received once every line is complete or when the delivery closes it,
+// lines that came short stay short; otherwise it is partially received and waits for the rest
+func (repo *NewPurchaseOrderRepo) ReceivePurchaseOrder(id int, receive models.ReceiveRequest, user string) error {
+	return WithTx(repo.DB, func(tx *sql.Tx) error {
+		var status string
+		err := tx.QueryRow(`SELECT status FROM purchase_orders WHERE po_id=$1 FOR UPDATE`, id).Scan(&status)
+		if err != nil {
+			return err
+		}
+		if status != models.POStatusSent && status != models.POStatusPartiallyReceived {
+			return fmt.Errorf("%w: only a sent order can be received, the order is %s", ErrPOStatus, status)
+		}
+		lines, err := purchaseOrderLines(tx, id)
+		if err != nil {
+			return err
+		}
+		for _, delivered := range receive.Lines {
+			line, ok := lines[delivered.LineID]
+			if !ok {
+				return fmt.Errorf("%w: %d", ErrPOLineNotFound, delivered.LineID)
+			}
+			if line.PacksReceived+delivered.Packs > line.PacksOrdered {
+				return fmt.Errorf("%w: line %d has %g of %g packs left", ErrOverReceived, line.ID, line.PacksOrdered-line.PacksReceived, line.PacksOrdered)
+			}
+			_, err = tx.Exec(`UPDATE purchase_order_lines SET packs_received = packs_received + $1 WHERE line_id=$2`, delivered.Packs, line.ID)
+			if err != nil {
+				return err
+			}
+			line.PacksReceived += delivered.Packs
+			lines[line.ID] = line
+			transaction := models.InventoryTransaction{
+				Inventory_id: line.InventoryID,
+				Price:        roundMoney(delivered.Packs * line.PackPrice),
+				Quantity:     delivered.Packs * line.PackSize,
+				Unit:         line.PackUnit,
+				ExpiryDate:   delivered.ExpiryDate,
+			}
+			if err := recordPurchase(tx, transaction, &line.ID, user); err != nil {
+				return err
+			}
+		}
+		complete := receive.Complete
+		if !complete {
+			complete = true
+			for _, line := range lines {
+				if line.PacksReceived < line.PacksOrdered {
+					complete = false
+				}
+			}
+		}
+		if complete {
+			_, err = tx.Exec(`UPDATE purchase_orders SET status='received', received_at=NOW() WHERE po_id=$1`, id)
+		} else {
+			_, err = tx.Exec(`UPDATE purchase_orders SET status='partially_received' WHERE po_id=$1`, id)
+		}
+		return err
+	})
+}
+
+// purchaseOrderLines gets the lines of the order keyed by line_id
+func purchaseOrderLines(tx *sql.Tx, po_id int) (map[int]models.PurchaseOrderLine, error) {
+	rows, err := tx.Query(`SELECT line_id, inventory_id, packs_ordered, packs_received, pack_size, pack_unit, pack_price
+	FROM purchase_order_lines
+	WHERE po_id=$1
+	`, po_id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	lines := make(map[int]models.PurchaseOrderLine)
+	for rows.Next() {
+		var line models.PurchaseOrderLine
+		err := rows.Scan(&line.ID, &line.InventoryID, &line.PacksOrdered, &line.PacksReceived, &line.PackSize, &line.PackUnit, &line.PackPrice)
+		if err != nil {
+			return nil, err
+		}
+		lines[line.ID] = line
+	}
+	return lines, rows.Err()
+}
@@ -0,0 +1,244 @@
+package dal
+
+import (
+	"database/sql"
+	"frappuccino/models"
+	"math"
+	"sort"
+)
+
+// supplierOffer is a supplier pack of an inventory item with the pack converted to the stock unit
+type supplierOffer struct {
+	SupplierID   int
+	SupplierName string
+	LeadTimeDays int
+	PackSize     float64
+	PackUnit     string
+	PackPrice    float64
+	PackQuantity float64
+}
+
+// Suggests what to reorder from recent sales. Average daily usage is the net sales usage of the last days.
+// An item is suggested once its stock less reservations plus what is still on order falls to the reorder level
+// plus the usage expected during the supplier lead time, it is then refilled up to the par level plus that usage.
+// The supplier with the lowest price per stock unit is chosen and the quantity is rounded up to whole packs
+func (repo *NewInventRepo) GetReorderSuggestions(days int) ([]models.ReorderSuggestion, error) {
+	offers, err := repo.cheapestOffers()
+	if err != nil {
+		return nil, err
+	}
+	onOrder, err := repo.onOrderQuantities()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := repo.DB.Query(`SELECT i.inventory_id, i.name, i.unit_type, i.stock_level, COALESCE(r.reserved, 0),
+	i.reorder_level, COALESCE(i.par_level, i.reorder_level * 2), COALESCE(u.used, 0) / $1::int
+	FROM inventory i
+	LEFT JOIN (SELECT inventory_id, SUM(quantity) AS reserved FROM inventory_reservations GROUP BY inventory_id) r USING(inventory_id)
+	LEFT JOIN (SELECT inventory_id, -SUM(to_stock_unit(quantity, unit, inventory_id)) AS used
+		FROM stock_movements
+		WHERE movement_type IN ('sale_usage', 'refund_return') AND created_at >= NOW() - make_interval(days => $1::int)
+		GROUP BY inventory_id) u USING(inventory_id)
+	WHERE i.archived_at IS NULL
+	ORDER BY i.inventory_id
+	`, days)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	suggestions := []models.ReorderSuggestion{}
+	for rows.Next() {
+		var suggestion models.ReorderSuggestion
+		err := rows.Scan(&suggestion.InventoryID, &suggestion.Name, &suggestion.Unit, &suggestion.StockLevel, &suggestion.Reserved,
+			&suggestion.ReorderLevel, &suggestion.ParLevel, &suggestion.AverageDailyUsage)
+		if err != nil {
+			return nil, err
+		}
+		if suggestion.AverageDailyUsage < 0 {
+			suggestion.AverageDailyUsage = 0
+		}
+		offer, supplied := offers[suggestion.InventoryID]
+		if supplied {
+			suggestion.LeadTimeDays = offer.LeadTimeDays
+		}
+		leadTimeUsage := suggestion.AverageDailyUsage * float64(suggestion.LeadTimeDays)
+		suggestion.OnOrder = onOrder[suggestion.InventoryID]
+		suggestion.Projected = suggestion.StockLevel - suggestion.Reserved + suggestion.OnOrder
+		suggestion.ReorderPoint = suggestion.ReorderLevel + leadTimeUsage
+		if suggestion.Projected > suggestion.ReorderPoint {
+			continue
+		}
+		suggestion.TargetLevel = suggestion.ParLevel + leadTimeUsage
+		shortfall := suggestion.TargetLevel - suggestion.Projected
+		if supplied {
+			suggestion.SupplierID = offer.SupplierID
+			suggestion.SupplierName = offer.SupplierName
+			suggestion.PackSize = offer.PackSize
+			suggestion.PackUnit = offer.PackUnit
+			suggestion.PackPrice = offer.PackPrice
+			suggestion.PackQuantity = roundQuantity(offer.PackQuantity)
+			suggestion.Packs = math.Max(1, math.Ceil(shortfall/offer.PackQuantity-1e-9))
+			suggestion.SuggestedQuantity = suggestion.Packs * offer.PackQuantity
+			suggestion.EstimatedCost = roundMoney(suggestion.Packs * offer.PackPrice)
+		} else {
+			suggestion.SuggestedQuantity = shortfall
+		}
+		suggestion.AverageDailyUsage = roundQuantity(suggestion.AverageDailyUsage)
+		suggestion.Projected = roundQuantity(suggestion.Projected)
+		suggestion.OnOrder = roundQuantity(suggestion.OnOrder)
+		suggestion.ReorderPoint = roundQuantity(suggestion.ReorderPoint)
+		suggestion.TargetLevel = roundQuantity(suggestion.TargetLevel)
+		suggestion.SuggestedQuantity = roundQuantity(suggestion.SuggestedQuantity)
+		suggestions = append(suggestions, suggestion)
+	}
+	return suggestions, rows.Err()
+}
+
+// Turns the reorder suggestions into draft purchase orders, one per supplier, created by the user.
+// Suggestions no supplier sells are returned apart
+func (repo *NewInventRepo) CreateReorderDrafts(days int, user string) (models.ReorderDrafts, error) {
+	drafts := models.ReorderDrafts{
+		PurchaseOrders:  []models.PurchaseOrder{},
+		WithoutSupplier: []models.ReorderSuggestion{},
+	}
+	suggestions, err := repo.GetReorderSuggestions(days)
+	if err != nil {
+		return drafts, err
+	}
+	orders := make(map[int]*models.PurchaseOrder)
+	for _, suggestion := range suggestions {
+		if suggestion.SupplierID == 0 {
+			drafts.WithoutSupplier = append(drafts.WithoutSupplier, suggestion)
+			continue
+		}
+		order, ok := orders[suggestion.SupplierID]
+		if !ok {
+			order = &models.PurchaseOrder{SupplierID: suggestion.SupplierID, Note: "reorder suggestion", CreatedBy: user}
+			orders[suggestion.SupplierID] = order
+		}
+		order.Lines = append(order.Lines, models.PurchaseOrderLine{InventoryID: suggestion.InventoryID, PacksOrdered: suggestion.Packs})
+	}
+	supplierIDs := make([]int, 0, len(orders))
+	for supplierID := range orders {
+		supplierIDs = append(supplierIDs, supplierID)
+	}
+	sort.Ints(supplierIDs)
+	var ids []int
+	err = WithTx(repo.DB, func(tx *sql.Tx) error {
+		for _, supplierID := range supplierIDs {
+			id, err := insertPurchaseOrder(tx, *orders[supplierID])
+			if err != nil {
+				return err
+			}
+			ids = append(ids, id)
+		}
+		return nil
+	})
+	if err != nil {
+		return drafts, err
+	}
+	purchaseOrders := DefaultPurchaseOrderRepo(repo.DB)
+	for _, id := range ids {
+		order, err := purchaseOrders.GetPurchaseOrder(id)
+		if err != nil {
+			return drafts, err
+		}
+		drafts.PurchaseOrders = append(drafts.PurchaseOrders, order)
+	}
+	return drafts, nil
+}
+
+// cheapestOffers picks for every inventory item the supplier with the lowest price per stock unit,
+// the shorter lead time wins a tie
+func (repo *NewInventRepo) cheapestOffers() (map[int]supplierOffer, error) {
+	rows, err := repo.DB.Query(`SELECT si.inventory_id, s.supplier_id, s.name, s.lead_time_days, si.pack_size, si.pack_unit, si.pack_price
+	FROM supplier_items si
+	INNER JOIN suppliers s USING(supplier_id)
+	ORDER BY si.inventory_id, s.supplier_id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	type itemOffer struct {
+		inventoryID int
+		offer       supplierOffer
+	}
+	var all []itemOffer
+	for rows.Next() {
+		var item itemOffer
+		err := rows.Scan(&item.inventoryID, &item.offer.SupplierID, &item.offer.SupplierName, &item.offer.LeadTimeDays,
+			&item.offer.PackSize, &item.offer.PackUnit, &item.offer.PackPrice)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	// Packs are converted after the rows are closed, the conversion runs its own query
+	offers := make(map[int]supplierOffer)
+	for _, item := range all {
+		factor, err := stockUnitFactor(repo.DB, item.inventoryID, item.offer.PackUnit, true)
+		if err != nil {
+			return nil, err
+		}
+		item.offer.PackQuantity = item.offer.PackSize * factor
+		best, ok := offers[item.inventoryID]
+		if !ok {
+			offers[item.inventoryID] = item.offer
+			continue
+		}
+		price := item.offer.PackPrice / item.offer.PackQuantity
+		bestPrice := best.PackPrice / best.PackQuantity
+		if price < bestPrice || (price == bestPrice && item.offer.LeadTimeDays < best.LeadTimeDays) {
+			offers[item.inventoryID] = item.offer
+		}
+	}
+	return offers, nil
+}
+
+// onOrderQuantities sums what is still due on draft and sent purchase orders in the stock unit, keyed by inventory_id
+func (repo *NewInventRepo) onOrderQuantities() (map[int]float64, error) {
+	rows, err := repo.DB.Query(`SELECT l.inventory_id, l.packs_ordered - l.packs_received, l.pack_size, l.pack_unit
+	FROM purchase_order_lines l
+	INNER JOIN purchase_orders p USING(po_id)
+	WHERE p.status IN ('draft', 'sent', 'partially_received') AND l.packs_received < l.packs_ordered
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	type dueLine struct {
+		inventoryID int
+		packs       float64
+		packSize    float64
+		packUnit    string
+	}
+	var lines []dueLine
+	for rows.Next() {
+		var line dueLine
+		if err := rows.Scan(&line.inventoryID, &line.packs, &line.packSize, &line.packUnit); err != nil {
+			return nil, err
+		}
+		lines = append(lines, line)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	onOrder := make(map[int]float64)
+	for _, line := range lines {
+		factor, err := stockUnitFactor(repo.DB, line.inventoryID, line.packUnit, true)
+		if err != nil {
+			return nil, err
+		}
+		onOrder[line.inventoryID] += line.packs * line.packSize * factor
+	}
+	return onOrder, nil
+}
+
+// roundQuantity rounds a stock quantity to the precision it is stored with
+func roundQuantity(quantity float64) float64 {
+	return math.Round(quantity*1000) / 1000
+}
@@ -7,14 +7,18 @@ import (
 )
 
 type ReportRepo interface {
-	Get_Popular_List() ([]models.PopularItems, error)
+	Get_Popular_List(groupBy string) ([]models.PopularItems, error)
 	GetTotalSales() (models.TotalSale, error)
-	GetOrderedItems(startDate, endDate string) ([]models.OrderedItemsNum, error)
+	GetOrderedItems(startDate, endDate, groupBy string) ([]models.OrderedItemsNum, error)
 	GetLeftOvers(sortBy string, page, pageSize int) ([]models.LeftoverItem, int, error)
 	FullSearchMenu(q string, minPrice, maxPrice float64) ([]models.Menu, error)
 	FullSearchOrder(q string, minPrice, maxPrice float64) ([]models.OrderSearchResult, error)
 	GetDayPeriod(month int, orderRequest *models.OrderByDayRequest) error
 	GetMonthPeriod(year int, orderRequest *models.OrderByMonthRequest) error
+	GetMargins(method, startDate, endDate string) (models.MarginsReport, error)
+	GetWasteReport(startDate, endDate string) (models.WasteReport, error)
+	GetInventoryValuation(method, asOf, groupBy string) (models.ValuationReport, error)
+	GetForecast(days, history int) (models.ForecastReport, error)
 }
 
 type DefReportRepo struct {
@@ -25,21 +29,24 @@ func DefaultReportRepo(DB *sql.DB) *DefReportRepo {
 	return &DefReportRepo{DB: DB}
 }
 
-// Gets Popular Ordered items list by ID
-func (repo *DefReportRepo) Get_Popular_List() ([]models.PopularItems, error) {
+// Gets Popular Ordered items list by ID, grouped by menu item or by its variants
+func (repo *DefReportRepo) Get_Popular_List(groupBy string) ([]models.PopularItems, error) {
 	var Popular_Items []models.PopularItems
-	rows, err := repo.DB.Query(`SELECT menu_item_id,name ,SUM(quantity) as sale_count 
+	rows, err := repo.DB.Query(`SELECT menu_item_id, name,
+	CASE WHEN $1::text = 'variant' THEN COALESCE(variant_id, 0) ELSE 0 END AS variant_id,
+	CASE WHEN $1::text = 'variant' THEN COALESCE(variant_name, '') ELSE '' END AS variant,
+	SUM(quantity) as sale_count 
 	FROM order_items INNER JOIN menu_items using (menu_item_id)
-    GROUP BY menu_item_id,name
+    GROUP BY 1, 2, 3, 4
 	ORDER BY sale_count DESC
-    LIMIT 10;`)
+    LIMIT 10;`, groupBy)
 	if err != nil {
 		return Popular_Items, err
 	}
 	defer rows.Close()
 	for rows.Next() {
 		var popular_item models.PopularItems
-		err := rows.Scan(&popular_item.Menu_item_id, &popular_item.Name, &popular_item.Sale_count)
+		err := rows.Scan(&popular_item.Menu_item_id, &popular_item.Name, &popular_item.Variant_id, &popular_item.Variant, &popular_item.Sale_count)
 		if err != nil {
 			return Popular_Items, err
 		}
@@ -48,38 +55,47 @@ func (repo *DefReportRepo) Get_Popular_List() ([]models.PopularItems, error) {
 	return Popular_Items, nil
 }
 
-// Gets summary of total amount From Database
+// Gets summary of total amount From Database, refunds are negative revenue entries and reduce the total
 func (repo *DefReportRepo) GetTotalSales() (models.TotalSale, error) {
 	var totalsale models.TotalSale
-	err := repo.DB.QueryRow(`SELECT SUM(total_amount) FROM orders WHERE status='closed'`).Scan(&totalsale.TotalSaleAmount)
+	err := repo.DB.QueryRow(`SELECT 
+	COALESCE((SELECT SUM(total_amount) FROM orders WHERE status='closed'), 0)
+	+ COALESCE((SELECT SUM(amount) FROM order_refunds), 0),
+	COALESCE((SELECT SUM(oi.price_at_order_time) FROM order_items oi INNER JOIN orders o USING(order_id) WHERE o.status='closed'), 0),
+	COALESCE((SELECT SUM(d.amount) FROM order_discounts d INNER JOIN orders o USING(order_id) WHERE o.status='closed'), 0),
+	COALESCE((SELECT SUM(amount) FROM order_refunds), 0)`).Scan(&totalsale.TotalSaleAmount, &totalsale.GrossSaleAmount,
+		&totalsale.DiscountAmount, &totalsale.RefundAmount)
 	return totalsale, err
 }
 
-// Retrieves Infromation about ordered items by period
-func (repo *DefReportRepo) GetOrderedItems(startDate, endDate string) ([]models.OrderedItemsNum, error) {
+// Retrieves Infromation about ordered items by period, grouped by menu item or by its variants
+func (repo *DefReportRepo) GetOrderedItems(startDate, endDate, groupBy string) ([]models.OrderedItemsNum, error) {
 	var orderedItems []models.OrderedItemsNum
 	rows, err := repo.DB.Query(`SELECT 
     mi.name, 
-    COALESCE(SUM(oi.quantity), 0) AS total_quantity
+    CASE WHEN $3::text = 'variant' THEN COALESCE(oi.variant_name, '') ELSE '' END AS variant,
+    COALESCE(SUM(oi.quantity - COALESCE(r.refunded, 0)), 0) AS total_quantity
 FROM 
     menu_items mi
 INNER JOIN order_items oi 
     ON oi.menu_item_id = mi.menu_item_id
+LEFT JOIN (SELECT order_item_id, SUM(quantity) AS refunded FROM order_refund_items GROUP BY order_item_id) r
+    ON r.order_item_id = oi.order_item_id
 INNER JOIN order_status_history osh 
     ON oi.order_id = osh.order_id
     AND osh.status = 'closed'
     AND osh.changed_at BETWEEN $1 AND $2
 GROUP BY 
-    mi.menu_item_id, mi.name
+    mi.menu_item_id, mi.name, 2
 ORDER BY 
-    total_quantity DESC;`, startDate, endDate)
+    total_quantity DESC;`, startDate, endDate, groupBy)
 	if err != nil {
 		return orderedItems, err
 	}
 	defer rows.Close()
 	for rows.Next() {
 		var orderedItem models.OrderedItemsNum
-		err := rows.Scan(&orderedItem.Name, &orderedItem.Quantity)
+		err := rows.Scan(&orderedItem.Name, &orderedItem.Variant, &orderedItem.Quantity)
 		if err != nil {
 			return orderedItems, err
 		}
@@ -119,6 +135,7 @@ FROM
 WHERE 
     (LOWER(name) LIKE '%'||$1||'%' OR LOWER(description) LIKE '%'||$1||'%') 
     AND price BETWEEN $2 AND $3
+    AND archived_at IS NULL
 ORDER BY 
 	relevance DESC
 	`, q, minPrice, maxPrice)
@@ -226,7 +243,7 @@ func (repo *DefReportRepo) GetLeftOvers(sortBy string, page, pageSize int) ([]mo
 	rows, err := repo.DB.Query(`WITH ingredient_prices AS (
     SELECT 
         it.inventory_id,
-        COALESCE(SUM(it.price) / NULLIF(SUM(it.quantity), 0), 0) AS avg_price
+        COALESCE(SUM(it.price) / NULLIF(SUM(to_stock_unit(it.quantity, it.unit, it.inventory_id)), 0), 0) AS avg_price
     FROM 
         inventory_transactions it
     GROUP BY 
@@ -286,9 +303,10 @@ ORDER BY row_num;
 
 // Retrieve of sum of totally ordered items by day period
 func (repo *DefReportRepo) GetDayPeriod(month int, orderRequest *models.OrderByDayRequest) error {
-	rows, err := repo.DB.Query(`SELECT EXTRACT(day FROM order_date) ,SUM(quantity)
+	rows, err := repo.DB.Query(`SELECT EXTRACT(day FROM order_date) ,SUM(quantity - COALESCE(refunded, 0))
     FROM orders 
     INNER JOIN order_items USING(order_id)
+    LEFT JOIN (SELECT order_item_id, SUM(quantity) AS refunded FROM order_refund_items GROUP BY order_item_id) r USING(order_item_id)
     WHERE EXTRACT(month FROM order_date)=$1 AND EXTRACT (YEAR FROM order_date)=2024 AND status='closed'
     GROUP BY EXTRACT(day FROM order_date)
     ORDER BY EXTRACT(day FROM order_date);`, month)
@@ -311,9 +329,10 @@ func (repo *DefReportRepo) GetDayPeriod(month int, orderRequest *models.OrderByD
 
 // Retrieve of sum of totally ordered items by Month period
 func (repo *DefReportRepo) GetMonthPeriod(year int, orderRequest *models.OrderByMonthRequest) error {
-	rows, err := repo.DB.Query(`SELECT TO_CHAR(order_date, 'FMMonth') AS month_name, SUM(quantity)
+	rows, err := repo.DB.Query(`SELECT TO_CHAR(order_date, 'FMMonth') AS month_name, SUM(quantity - COALESCE(refunded, 0))
 	FROM orders
 	INNER JOIN order_items USING(order_id)
+	LEFT JOIN (SELECT order_item_id, SUM(quantity) AS refunded FROM order_refund_items GROUP BY order_item_id) r USING(order_item_id)
 	WHERE EXTRACT(year FROM order_date) = $1 AND status='closed'
 	GROUP BY EXTRACT(month FROM order_date), TO_CHAR(order_date, 'FMMonth')
 	ORDER BY EXTRACT(month FROM order_date);`, year)
@@ -333,3 +352,191 @@ func (repo *DefReportRepo) GetMonthPeriod(year int, orderRequest *models.OrderBy
 	orderRequest.OrderedItems = orderedItems
 	return nil
 }
+
+type soldKey struct {
+	menuItemID int
+	variantID  int
+}
+
+type soldVolume struct {
+	quantity  int
+	gross     float64
+	discounts float64
+	revenue   float64
+	cost      float64
+}
+
+// lineAmounts is the gross price and what was charged after discounts of every order line, a line pays its price
+// less its own discounts and discounts of the whole order are spread over its lines by what they pay
+const lineAmounts = `(SELECT l.order_item_id, l.gross,
+		l.after_line * GREATEST(1 + COALESCE(od.amount, 0) / NULLIF(SUM(l.after_line) OVER (PARTITION BY l.order_id), 0), 0) AS net
+	FROM (SELECT oi.order_item_id, oi.order_id, oi.price_at_order_time AS gross,
+			oi.price_at_order_time + COALESCE((SELECT SUM(d.amount) FROM order_discounts d WHERE d.order_item_id = oi.order_item_id), 0) AS after_line
+		FROM order_items oi) l
+	LEFT JOIN (SELECT order_id, SUM(amount) AS amount FROM order_discounts WHERE order_item_id IS NULL GROUP BY order_id) od
+		ON od.order_id = l.order_id)`
+
+// Gets price, recipe cost and margin of every menu item or variant, and the same over the volume sold by orders closed in the period.
+// Sold servings are costed with the current recipes and unit costs, modifier ingredients of the sold lines are added, refunds are taken off.
+func (repo *DefReportRepo) GetMargins(method, startDate, endDate string) (models.MarginsReport, error) {
+	report := models.MarginsReport{Method: method, StartDate: startDate, EndDate: endDate}
+	unitCosts, err := DefaultInventRepo(repo.DB).GetUnitCosts(method)
+	if err != nil {
+		return report, err
+	}
+	sold, err := repo.getSoldVolume(startDate, endDate)
+	if err != nil {
+		return report, err
+	}
+	if err := repo.addModifierCosts(startDate, endDate, unitCosts, sold); err != nil {
+		return report, err
+	}
+
+	menuRepo := DefaultMenuRepo(repo.DB)
+	menus, err := menuRepo.Get_AllMenu()
+	if err != nil {
+		return report, err
+	}
+	listed := make(map[int]bool)
+	for _, menu := range menus {
+		listed[menu.ID] = true
+	}
+	// archived items still show up while they have sales in the period
+	for key := range sold {
+		if !listed[key.menuItemID] {
+			menu, err := menuRepo.GetMenu(key.menuItemID)
+			if err != nil {
+				return report, err
+			}
+			listed[key.menuItemID] = true
+			menus = append(menus, menu)
+		}
+	}
+
+	for _, menu := range menus {
+		itemKey := soldKey{menuItemID: menu.ID}
+		if _, ok := sold[itemKey]; ok || len(menu.Variants) == 0 {
+			quantities := make(map[int]float64)
+			for _, ingredient := range menu.ItemIngredient {
+				quantities[ingredient.InventoryID] += ingredient.StockQuantity
+			}
+			item := marginItem(recipeCost(unitCosts, quantities, menu.Price), sold[itemKey])
+			item.MenuItemID = menu.ID
+			item.Name = menu.Name
+			report.Items = append(report.Items, item)
+		}
+		for _, variant := range menu.Variants {
+			quantities := make(map[int]float64)
+			for _, ingredient := range variant.Ingredients {
+				quantities[ingredient.InventoryID] += ingredient.StockQuantity
+			}
+			item := marginItem(recipeCost(unitCosts, quantities, variant.Price), sold[soldKey{menu.ID, variant.ID}])
+			item.MenuItemID = menu.ID
+			item.VariantID = variant.ID
+			item.Name = menu.Name
+			item.Variant = variant.Name
+			report.Items = append(report.Items, item)
+		}
+	}
+	for _, item := range report.Items {
+		report.GrossRevenue += item.GrossRevenue
+		report.Discounts += item.Discounts
+		report.Revenue += item.Revenue
+		report.Cost += item.SoldCost
+	}
+	report.GrossRevenue = roundMoney(report.GrossRevenue)
+	report.Discounts = roundMoney(report.Discounts)
+	report.Revenue = roundMoney(report.Revenue)
+	report.Cost = roundMoney(report.Cost)
+	report.Margin = roundMoney(report.Revenue - report.Cost)
+	report.MarginPercent = marginPercent(report.Margin, report.Revenue)
+	return report, nil
+}
+
+func marginItem(cost models.RecipeCost, sold *soldVolume) models.MarginItem {
+	item := models.MarginItem{
+		Price:         cost.Price,
+		Cost:          cost.Cost,
+		Margin:        cost.Margin,
+		MarginPercent: cost.MarginPercent,
+		Complete:      cost.Complete,
+	}
+	if sold == nil {
+		return item
+	}
+	item.SoldQuantity = sold.quantity
+	item.GrossRevenue = roundMoney(sold.gross)
+	item.Discounts = roundMoney(sold.discounts)
+	item.Revenue = roundMoney(sold.revenue)
+	item.SoldCost = roundMoney(float64(sold.quantity)*cost.Cost + sold.cost)
+	item.SoldMargin = roundMoney(item.Revenue - item.SoldCost)
+	item.SoldMarginPercent = marginPercent(item.SoldMargin, item.Revenue)
+	return item
+}
+
+// Gets the servings and revenue of the lines of orders closed in the period, keyed by menu item and variant.
+// Revenue is net of discounts and refunds, the gross revenue is the price of the lines
+func (repo *DefReportRepo) getSoldVolume(startDate, endDate string) (map[soldKey]*soldVolume, error) {
+	rows, err := repo.DB.Query(`SELECT oi.menu_item_id, COALESCE(oi.variant_id, 0),
+	SUM(oi.quantity - COALESCE(r.refunded, 0)),
+	SUM(la.gross),
+	SUM(la.net - la.gross),
+	SUM(la.net + COALESCE(r.amount, 0))
+	FROM order_items oi
+	INNER JOIN `+lineAmounts+` la ON la.order_item_id = oi.order_item_id
+	INNER JOIN order_status_history osh
+		ON oi.order_id = osh.order_id
+		AND osh.status = 'closed'
+		AND osh.changed_at BETWEEN $1 AND $2
+	LEFT JOIN (SELECT order_item_id, SUM(quantity) AS refunded, SUM(amount) AS amount FROM order_refund_items GROUP BY order_item_id) r
+		ON r.order_item_id = oi.order_item_id
+	GROUP BY 1, 2
+	`, startDate, endDate)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	sold := make(map[soldKey]*soldVolume)
+	for rows.Next() {
+		var key soldKey
+		volume := &soldVolume{}
+		if err := rows.Scan(&key.menuItemID, &key.variantID, &volume.quantity, &volume.gross, &volume.discounts, &volume.revenue); err != nil {
+			return nil, err
+		}
+		sold[key] = volume
+	}
+	return sold, rows.Err()
+}
+
+// Adds the cost of the modifier ingredients used by the sold lines to their sold volume
+func (repo *DefReportRepo) addModifierCosts(startDate, endDate string, unitCosts map[int]models.IngredientCost, sold map[soldKey]*soldVolume) error {
+	rows, err := repo.DB.Query(`SELECT oi.menu_item_id, COALESCE(oi.variant_id, 0), moi.inventory_id,
+	SUM((oi.quantity - COALESCE(r.refunded, 0)) * to_stock_unit(moi.quantity, moi.unit, moi.inventory_id))
+	FROM order_items oi
+	INNER JOIN order_status_history osh
+		ON oi.order_id = osh.order_id
+		AND osh.status = 'closed'
+		AND osh.changed_at BETWEEN $1 AND $2
+	INNER JOIN order_item_modifiers oim ON oim.order_item_id = oi.order_item_id
+	INNER JOIN modifier_option_ingredients moi ON moi.option_id = oim.option_id
+	LEFT JOIN (SELECT order_item_id, SUM(quantity) AS refunded FROM order_refund_items GROUP BY order_item_id) r
+		ON r.order_item_id = oi.order_item_id
+	GROUP BY 1, 2, 3
+	`, startDate, endDate)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var key soldKey
+		var inventoryID int
+		var quantity float64
+		if err := rows.Scan(&key.menuItemID, &key.variantID, &inventoryID, &quantity); err != nil {
+			return err
+		}
+		if volume, ok := sold[key]; ok {
+			volume.cost += quantity * unitCosts[inventoryID].UnitCost
+		}
+	}
+	return rows.Err()
+}
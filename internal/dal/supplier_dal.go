@@ -0,0 +1,188 @@
+package dal
+
+import (
+	"database/sql"
+	"frappuccino/models"
+)
+
+type SupplierRepo interface {
+	GetSuppliers() ([]models.Supplier, error)
+	GetSupplier(id int) (models.Supplier, error)
+	IsSupplierExist(id int) (bool, error)
+	IsSupplierUnique(id int, name string) (bool, error)
+	SaveSupplier(supplier models.Supplier) (int, error)
+	UpdateSupplier(supplier models.Supplier) error
+	DeleteSupplier(id int) error
+	GetSupplierItems(supplier_id int) ([]models.SupplierItem, error)
+	IsSupplierItemExist(supplier_id, inventory_id int) (bool, error)
+	SaveSupplierItem(item models.SupplierItem) error
+	DeleteSupplierItem(supplier_id, inventory_id int) error
+}
+
+type NewSupplierRepo struct {
+	DB *sql.DB
+}
+
+func DefaultSupplierRepo(db *sql.DB) *NewSupplierRepo {
+	return &NewSupplierRepo{DB: db}
+}
+
+// Retrieves all suppliers ordered by name, without their items
+func (repo *NewSupplierRepo) GetSuppliers() ([]models.Supplier, error) {
+	rows, err := repo.DB.Query(`SELECT supplier_id, name, COALESCE(contact_name, ''), COALESCE(email, ''), COALESCE(phone, ''),
+	lead_time_days, created_at
+	FROM suppliers
+	ORDER BY name
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	suppliers := []models.Supplier{}
+	for rows.Next() {
+		var supplier models.Supplier
+		err := rows.Scan(&supplier.ID, &supplier.Name, &supplier.ContactName, &supplier.Email, &supplier.Phone,
+			&supplier.LeadTimeDays, &supplier.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		suppliers = append(suppliers, supplier)
+	}
+	return suppliers, rows.Err()
+}
+
+// Retrieves the supplier with the items it sells
+func (repo *NewSupplierRepo) GetSupplier(id int) (models.Supplier, error) {
+	var supplier models.Supplier
+	err := repo.DB.QueryRow(`SELECT supplier_id, name, COALESCE(contact_name, ''), COALESCE(email, ''), COALESCE(phone, ''),
+	lead_time_days, created_at
+	FROM suppliers
+	WHERE supplier_id=$1
+	`, id).Scan(&supplier.ID, &supplier.Name, &supplier.ContactName, &supplier.Email, &supplier.Phone,
+		&supplier.LeadTimeDays, &supplier.CreatedAt)
+	if err != nil {
+		return supplier, err
+	}
+	supplier.Items, err = repo.GetSupplierItems(id)
+	return supplier, err
+}
+
+// Checks is the supplier exist
+func (repo *NewSupplierRepo) IsSupplierExist(id int) (bool, error) {
+	var count int
+	err := repo.DB.QueryRow(`SELECT COUNT(*) FROM suppliers WHERE supplier_id=$1`, id).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// Checks that no other supplier has the name
+func (repo *NewSupplierRepo) IsSupplierUnique(id int, name string) (bool, error) {
+	var count int
+	err := repo.DB.QueryRow(`SELECT COUNT(*) FROM suppliers WHERE name=$1 AND supplier_id<>$2`, name, id).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+	return count == 0, nil
+}
+
+// Saves a new supplier, returns its ID
+func (repo *NewSupplierRepo) SaveSupplier(supplier models.Supplier) (int, error) {
+	var id int
+	err := repo.DB.QueryRow(`INSERT INTO suppliers (name, contact_name, email, phone, lead_time_days)
+	VALUES ($1, NULLIF($2, ''), NULLIF($3, ''), NULLIF($4, ''), $5)
+	RETURNING supplier_id
+	`, supplier.Name, supplier.ContactName, supplier.Email, supplier.Phone, supplier.LeadTimeDays).Scan(&id)
+	return id, err
+}
+
+// Updates contact info and lead time of the supplier
+func (repo *NewSupplierRepo) UpdateSupplier(supplier models.Supplier) error {
+	_, err := repo.DB.Exec(`UPDATE suppliers
+	SET name=$1, contact_name=NULLIF($2, ''), email=NULLIF($3, ''), phone=NULLIF($4, ''), lead_time_days=$5
+	WHERE supplier_id=$6
+	`, supplier.Name, supplier.ContactName, supplier.Email, supplier.Phone, supplier.LeadTimeDays, supplier.ID)
+	return err
+}
+
+// Deletes the supplier with its items, fails with ErrStillReferenced while it has purchase orders
+func (repo *NewSupplierRepo) DeleteSupplier(id int) error {
+	_, err := repo.DB.Exec(`DELETE FROM suppliers WHERE supplier_id=$1`, id)
+	return referencedErr(err)
+}
+
+// Retrieves the items the supplier sells with one pack converted to the stock unit
+func (repo *NewSupplierRepo) GetSupplierItems(supplier_id int) ([]models.SupplierItem, error) {
+	rows, err := repo.DB.Query(`SELECT s.supplier_id, s.inventory_id, i.name, s.pack_size, s.pack_unit, s.pack_price, i.unit_type
+	FROM supplier_items s
+	INNER JOIN inventory i USING(inventory_id)
+	WHERE s.supplier_id=$1
+	ORDER BY s.inventory_id
+	`, supplier_id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []models.SupplierItem{}
+	for rows.Next() {
+		var item models.SupplierItem
+		err := rows.Scan(&item.SupplierID, &item.InventoryID, &item.Name, &item.PackSize, &item.PackUnit, &item.PackPrice, &item.Unit)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	// Packs are converted after the rows are closed, the conversion runs its own query
+	for i := range items {
+		factor, err := stockUnitFactor(repo.DB, items[i].InventoryID, items[i].PackUnit, true)
+		if err != nil {
+			return nil, err
+		}
+		items[i].StockQuantity = items[i].PackSize * factor
+	}
+	return items, nil
+}
+
+// Checks is the inventory item sold by the supplier
+func (repo *NewSupplierRepo) IsSupplierItemExist(supplier_id, inventory_id int) (bool, error) {
+	var count int
+	err := repo.DB.QueryRow(`SELECT COUNT(*) FROM supplier_items
+	WHERE supplier_id=$1 AND inventory_id=$2
+	`, supplier_id, inventory_id).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// Saves the pack and price the supplier sells the inventory item in, replacing the earlier one.
+// The pack unit must be a registered unit or a pack of the item measuring the same as its stock unit,
+// a pack of the item is saved as the registered unit it holds
+func (repo *NewSupplierRepo) SaveSupplierItem(item models.SupplierItem) error {
+	if _, err := stockUnitFactor(repo.DB, item.InventoryID, item.PackUnit, true); err != nil {
+		return err
+	}
+	var err error
+	item.PackSize, item.PackUnit, err = packContents(repo.DB, item.InventoryID, item.PackSize, item.PackUnit)
+	if err != nil {
+		return err
+	}
+	_, err = repo.DB.Exec(`INSERT INTO supplier_items (supplier_id, inventory_id, pack_size, pack_unit, pack_price)
+	VALUES ($1, $2, $3, $4, $5)
+	ON CONFLICT (supplier_id, inventory_id) DO UPDATE
+	SET pack_size = EXCLUDED.pack_size, pack_unit = EXCLUDED.pack_unit, pack_price = EXCLUDED.pack_price
+	`, item.SupplierID, item.InventoryID, item.PackSize, item.PackUnit, item.PackPrice)
+	return err
+}
+
+// Removes the inventory item from what the supplier sells, its purchase orders keep their lines
+func (repo *NewSupplierRepo) DeleteSupplierItem(supplier_id, inventory_id int) error {
+	_, err := repo.DB.Exec(`DELETE FROM supplier_items
+	WHERE supplier_id=$1 AND inventory_id=$2
+	`, supplier_id, inventory_id)
+	return err
+}
@@ -0,0 +1,46 @@
+package dal
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/lib/pq"
+)
+
+// DBTX is implemented by both *sql.DB and *sql.Tx, so reads can run inside or outside a shared transaction
+type DBTX interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// WithTx runs fn as a single unit of work: the transaction is committed when fn succeeds and rolled back otherwise
+func WithTx(db *sql.DB, fn func(tx *sql.Tx) error) (err error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		}
+	}()
+	if err = fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// ErrStillReferenced is returned when a purged row is still referenced by orders, recipes or history
+var ErrStillReferenced = errors.New("entity is still referenced by orders or history")
+
+// referencedErr turns a foreign key violation into ErrStillReferenced
+func referencedErr(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23503" {
+		return ErrStillReferenced
+	}
+	return err
+}
@@ -0,0 +1,235 @@
+package dal
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"frappuccino/models"
+)
+
+// ErrUnknownUnit is returned when a unit is neither registered nor a pack of the inventory item
+var ErrUnknownUnit = errors.New("unknown unit")
+
+// ErrUnitDimension is returned when a unit measures another dimension than the stock unit, e.g. ml of an item kept in kg
+var ErrUnitDimension = errors.New("unit dimension does not match the stock unit")
+
+// ErrPackUnitExists is returned when the inventory item already has a pack with the same name
+var ErrPackUnitExists = errors.New("pack unit already exists for the inventory item")
+
+// ErrPackUnitInUse is returned when a pack unit is still named by a supplier item or an open purchase order line
+var ErrPackUnitInUse = errors.New("pack unit is used by a supplier item or an open purchase order")
+
+// IsUnitErr reports whether the error is caused by a unit given in the request
+func IsUnitErr(err error) bool {
+	return errors.Is(err, ErrUnknownUnit) || errors.Is(err, ErrUnitDimension)
+}
+
+type UnitRepo interface {
+	GetUnits() ([]models.Unit, error)
+	GetUnit(code string) (models.Unit, error)
+	IsUnitExist(code string) (bool, error)
+	SaveUnit(unit models.Unit) error
+}
+
+type NewUnitRepo struct {
+	DB *sql.DB
+}
+
+func DefaultUnitRepo(db *sql.DB) *NewUnitRepo {
+	return &NewUnitRepo{DB: db}
+}
+
+// Retrieves all registered units ordered by dimension and size
+func (repo *NewUnitRepo) GetUnits() ([]models.Unit, error) {
+	rows, err := repo.DB.Query(`SELECT unit_code, name, dimension, to_base
+	FROM units
+	ORDER BY dimension, to_base
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var units []models.Unit
+	for rows.Next() {
+		var unit models.Unit
+		if err := rows.Scan(&unit.Code, &unit.Name, &unit.Dimension, &unit.ToBase); err != nil {
+			return nil, err
+		}
+		units = append(units, unit)
+	}
+	return units, rows.Err()
+}
+
+// Retrieves the unit by its code
+func (repo *NewUnitRepo) GetUnit(code string) (models.Unit, error) {
+	var unit models.Unit
+	err := repo.DB.QueryRow(`SELECT unit_code, name, dimension, to_base
+	FROM units
+	WHERE unit_code=$1
+	`, code).Scan(&unit.Code, &unit.Name, &unit.Dimension, &unit.ToBase)
+	return unit, err
+}
+
+// Checks is the unit registered
+func (repo *NewUnitRepo) IsUnitExist(code string) (bool, error) {
+	var count int
+	err := repo.DB.QueryRow(`SELECT COUNT(*) FROM units WHERE unit_code=$1`, code).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// Saves a new unit to the registry
+func (repo *NewUnitRepo) SaveUnit(unit models.Unit) error {
+	_, err := repo.DB.Exec(`INSERT INTO units (unit_code, name, dimension, to_base)
+	VALUES ($1, $2, $3, $4)
+	`, unit.Code, unit.Name, unit.Dimension, unit.ToBase)
+	return err
+}
+
+// stockUnitFactor gets the factor that converts a quantity in the unit to the stock unit of the inventory item.
+// An empty unit is the stock unit itself, pack units of the item are looked up first when allowPacks is set.
+func stockUnitFactor(q DBTX, inventory_id int, unit string, allowPacks bool) (float64, error) {
+	var stockDimension string
+	var stockToBase float64
+	var dimension sql.NullString
+	var toBase sql.NullFloat64
+	err := q.QueryRow(`SELECT s.dimension, s.to_base, u.dimension, u.to_base * COALESCE(p.quantity, 1)
+	FROM inventory i
+	INNER JOIN units s ON s.unit_code = i.unit_type
+	LEFT JOIN inventory_pack_units p ON $3 AND p.inventory_id = i.inventory_id AND p.name = $2
+	LEFT JOIN units u ON u.unit_code = COALESCE(p.unit_code, NULLIF($2, ''), i.unit_type)
+	WHERE i.inventory_id = $1
+	`, inventory_id, unit, allowPacks).Scan(&stockDimension, &stockToBase, &dimension, &toBase)
+	if err != nil {
+		return 0, err
+	}
+	if !dimension.Valid {
+		return 0, fmt.Errorf("%w %q for inventory item %d", ErrUnknownUnit, unit, inventory_id)
+	}
+	if dimension.String != stockDimension {
+		return 0, fmt.Errorf("%w: %s is %s, inventory item %d is counted in %s", ErrUnitDimension, unit, dimension.String, inventory_id, stockDimension)
+	}
+	return toBase.Float64 / stockToBase, nil
+}
+
+// CheckRecipeUnit checks that a recipe quantity of the inventory item can be given in the unit,
+// recipes use registered units of the same dimension as the stock unit
+func (repo *NewMenuRepo) CheckRecipeUnit(inventory_id int, unit string) error {
+	_, err := stockUnitFactor(repo.DB, inventory_id, unit, false)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	return err
+}
+
+// Retrieves the pack units of the inventory item
+func (repo *NewInventRepo) GetPackUnits(inventory_id int) ([]models.PackUnit, error) {
+	rows, err := repo.DB.Query(`SELECT pack_id, inventory_id, name, quantity, unit_code
+	FROM inventory_pack_units
+	WHERE inventory_id=$1
+	ORDER BY pack_id
+	`, inventory_id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var packs []models.PackUnit
+	for rows.Next() {
+		var pack models.PackUnit
+		if err := rows.Scan(&pack.ID, &pack.InventoryID, &pack.Name, &pack.Quantity, &pack.Unit); err != nil {
+			return nil, err
+		}
+		packs = append(packs, pack)
+	}
+	return packs, rows.Err()
+}
+
+// Checks is the pack unit exist for the inventory item
+func (repo *NewInventRepo) IsPackUnitExist(inventory_id, pack_id int) (bool, error) {
+	var count int
+	err := repo.DB.QueryRow(`SELECT COUNT(*) FROM inventory_pack_units
+	WHERE inventory_id=$1 AND pack_id=$2
+	`, inventory_id, pack_id).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// Saves a pack unit of the inventory item, returns the new pack ID.
+// The pack content must be a registered unit of the stock dimension and its name must be unique for the item.
+func (repo *NewInventRepo) SavePackUnit(pack models.PackUnit) (int, error) {
+	if _, err := stockUnitFactor(repo.DB, pack.InventoryID, pack.Unit, false); err != nil {
+		return 0, err
+	}
+	var id int
+	err := repo.DB.QueryRow(`INSERT INTO inventory_pack_units (inventory_id, name, quantity, unit_code)
+	VALUES ($1, $2, $3, $4)
+	ON CONFLICT (inventory_id, name) DO NOTHING
+	RETURNING pack_id
+	`, pack.InventoryID, pack.Name, pack.Quantity, pack.Unit).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, ErrPackUnitExists
+	}
+	return id, err
+}
+
+// packContents turns a quantity of packs of the inventory item into the registered unit the pack holds,
+// a registered unit is returned as it is
+func packContents(q DBTX, inventory_id int, size float64, unit string) (float64, string, error) {
+	var quantity float64
+	var code string
+	err := q.QueryRow(`SELECT quantity, unit_code FROM inventory_pack_units
+	WHERE inventory_id=$1 AND name=$2
+	`, inventory_id, unit).Scan(&quantity, &code)
+	if err == sql.ErrNoRows {
+		return size, unit, nil
+	}
+	if err != nil {
+		return 0, "", err
+	}
+	return size * quantity, code, nil
+}
+
+// Deletes the pack unit, purchases keep the pack name they were made in.
+// Fails with ErrPackUnitInUse while a supplier item or a purchase order line still to be received is in the pack
+func (repo *NewInventRepo) DeletePackUnit(pack_id int) error {
+	result, err := repo.DB.Exec(`DELETE FROM inventory_pack_units p
+	WHERE p.pack_id=$1
+	AND NOT EXISTS (SELECT 1 FROM supplier_items s WHERE s.inventory_id = p.inventory_id AND s.pack_unit = p.name)
+	AND NOT EXISTS (SELECT 1 FROM purchase_order_lines l
+		INNER JOIN purchase_orders o USING(po_id)
+		WHERE l.inventory_id = p.inventory_id AND l.pack_unit = p.name AND o.status IN ('draft', 'sent', 'partially_received'))
+	`, pack_id)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrPackUnitInUse
+	}
+	return nil
+}
+
+// Gets the dimension of the stock unit of the inventory item
+func (repo *NewInventRepo) GetStockDimension(inventory_id int) (string, error) {
+	var dimension string
+	err := repo.DB.QueryRow(`SELECT u.dimension
+	FROM inventory i
+	INNER JOIN units u ON u.unit_code = i.unit_type
+	WHERE i.inventory_id=$1
+	`, inventory_id).Scan(&dimension)
+	return dimension, err
+}
+
+// Gets the dimension of a registered unit, empty when the unit is not registered
+func (repo *NewInventRepo) GetUnitDimension(code string) (string, error) {
+	var dimension string
+	err := repo.DB.QueryRow(`SELECT COALESCE((SELECT dimension::text FROM units WHERE unit_code=$1), '')`, code).Scan(&dimension)
+	return dimension, err
+}
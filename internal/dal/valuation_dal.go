@@ -0,0 +1,138 @@
+package dal
+
+import (
+	"frappuccino/models"
+	"math"
+	"sort"
+)
+
+// purchaseLayer is one purchase of an inventory item in the current stock unit
+type purchaseLayer struct {
+	price    float64
+	quantity float64
+}
+
+// Values the stock of every inventory item at the end of the as-of day, or now when it is empty.
+// The stock at a past date is the sum of the ledger up to then and only purchases made by then are used,
+// both converted from the unit they were recorded in to the current stock unit.
+// Weighted average values the stock at the average cost of those purchases. FIFO assumes the oldest stock was
+// used first, so the stock is valued at the latest purchases, stock older than every purchase at the average cost.
+// Items are grouped by category or unit type, items without a category are grouped as uncategorized
+func (repo *DefReportRepo) GetInventoryValuation(method, asOf, groupBy string) (models.ValuationReport, error) {
+	report := models.ValuationReport{Method: method, AsOf: asOf, GroupBy: groupBy, Complete: true, Groups: []models.ValuationGroup{}}
+	purchases, err := repo.purchaseLayers(asOf)
+	if err != nil {
+		return report, err
+	}
+	rows, err := repo.DB.Query(`SELECT i.inventory_id, i.name, COALESCE(i.category, ''), i.unit_type,
+	CASE WHEN $1::text = '' THEN i.stock_level
+		ELSE COALESCE((SELECT SUM(to_stock_unit(m.quantity, m.unit, m.inventory_id)) FROM stock_movements m
+			WHERE m.inventory_id = i.inventory_id AND m.created_at < NULLIF($1::text, '')::date + 1), 0)
+	END AS quantity
+	FROM inventory i
+	ORDER BY i.inventory_id
+	`, asOf)
+	if err != nil {
+		return report, err
+	}
+	defer rows.Close()
+	groups := make(map[string]*models.ValuationGroup)
+	for rows.Next() {
+		var item models.ValuationItem
+		if err := rows.Scan(&item.InventoryID, &item.Name, &item.Category, &item.UnitType, &item.Quantity); err != nil {
+			return report, err
+		}
+		if item.Quantity <= 0 {
+			continue
+		}
+		item.Value, item.Priced = stockValue(purchases[item.InventoryID], item.Quantity, method)
+		if !item.Priced {
+			report.Complete = false
+		}
+		item.UnitCost = math.Round(item.Value/item.Quantity*10000) / 10000
+		item.Value = roundMoney(item.Value)
+		if item.Category == "" {
+			item.Category = "uncategorized"
+		}
+		key := item.Category
+		if groupBy == "unit_type" {
+			key = item.UnitType
+		}
+		group, ok := groups[key]
+		if !ok {
+			group = &models.ValuationGroup{Group: key}
+			groups[key] = group
+		}
+		if groupBy == "unit_type" {
+			group.Quantity = roundQuantity(group.Quantity + item.Quantity)
+		}
+		group.Value += item.Value
+		group.Items = append(group.Items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return report, err
+	}
+	for _, group := range groups {
+		group.Value = roundMoney(group.Value)
+		report.Total += group.Value
+		report.Groups = append(report.Groups, *group)
+	}
+	sort.Slice(report.Groups, func(i, j int) bool {
+		return report.Groups[i].Group < report.Groups[j].Group
+	})
+	report.Total = roundMoney(report.Total)
+	return report, nil
+}
+
+// purchaseLayers gets the purchases made by the end of the as-of day, newest first, keyed by inventory_id
+func (repo *DefReportRepo) purchaseLayers(asOf string) (map[int][]purchaseLayer, error) {
+	rows, err := repo.DB.Query(`SELECT inventory_id, price, to_stock_unit(quantity, unit, inventory_id)
+	FROM inventory_transactions
+	WHERE $1::text = '' OR transaction_date < NULLIF($1::text, '')::date + 1
+	ORDER BY inventory_id, transaction_date DESC, transaction_id DESC
+	`, asOf)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	purchases := make(map[int][]purchaseLayer)
+	for rows.Next() {
+		var inventoryID int
+		var layer purchaseLayer
+		if err := rows.Scan(&inventoryID, &layer.price, &layer.quantity); err != nil {
+			return nil, err
+		}
+		purchases[inventoryID] = append(purchases[inventoryID], layer)
+	}
+	return purchases, rows.Err()
+}
+
+// stockValue values the quantity by the purchases of the item, newest first. It is not priced without purchases
+func stockValue(layers []purchaseLayer, quantity float64, method string) (float64, bool) {
+	var price, bought float64
+	for _, layer := range layers {
+		price += layer.price
+		bought += layer.quantity
+	}
+	if bought == 0 {
+		return 0, false
+	}
+	averageCost := price / bought
+	if method != "fifo" {
+		return quantity * averageCost, true
+	}
+	var value float64
+	left := quantity
+	for _, layer := range layers {
+		if left <= 0 {
+			break
+		}
+		take := math.Min(left, layer.quantity)
+		value += take * layer.price / layer.quantity
+		left -= take
+	}
+	if left > 0 {
+		value += left * averageCost
+	}
+	return value, true
+}
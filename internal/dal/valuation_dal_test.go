@@ -0,0 +1,36 @@
+package dal
+
+import (
+	"math"
+	"testing"
+)
+
+func TestStockValue(t *testing.T) {
+	// newest first: 5 units bought for 10, 4 units bought for 4 before them, the average cost is 14/9
+	layers := []purchaseLayer{{price: 10, quantity: 5}, {price: 4, quantity: 4}}
+	tests := []struct {
+		name       string
+		layers     []purchaseLayer
+		quantity   float64
+		method     string
+		want       float64
+		wantPriced bool
+	}{
+		{"never purchased", nil, 3, "weighted_average", 0, false},
+		{"never purchased by fifo", nil, 3, "fifo", 0, false},
+		{"weighted average", layers, 3, "weighted_average", 3 * 14.0 / 9, true},
+		{"fifo within the newest purchase", layers, 3, "fifo", 6, true},
+		{"fifo spans purchases", layers, 7, "fifo", 10 + 2*1, true},
+		{"fifo exactly every purchase", layers, 9, "fifo", 14, true},
+		{"stock older than every purchase at the average cost", layers, 12, "fifo", 14 + 3*14.0/9, true},
+		{"no stock", layers, 0, "fifo", 0, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, priced := stockValue(test.layers, test.quantity, test.method)
+			if priced != test.wantPriced || math.Abs(got-test.want) > 1e-9 {
+				t.Errorf("stockValue = %v, %v, want %v, %v", got, priced, test.want, test.wantPriced)
+			}
+		})
+	}
+}
@@ -0,0 +1,252 @@
+package dal
+
+import (
+	"database/sql"
+	"fmt"
+	"frappuccino/models"
+	"net/http"
+
+	"github.com/lib/pq"
+)
+
+// Retrieves variants of the menu item with their recipes and the servings makeable from stock
+func (repo *NewMenuRepo) GetVariants(menu_item_id int) ([]models.MenuVariant, error) {
+	rows, err := repo.DB.Query(`SELECT variant_id, menu_item_id, name, price
+	FROM menu_item_variants
+	WHERE menu_item_id=$1
+	ORDER BY price, variant_id
+	`, menu_item_id)
+	if err != nil {
+		return nil, err
+	}
+	var variants []models.MenuVariant
+	for rows.Next() {
+		var variant models.MenuVariant
+		if err := rows.Scan(&variant.ID, &variant.MenuItemID, &variant.Name, &variant.Price); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		variants = append(variants, variant)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	servings, err := repo.getVariantServings([]int{menu_item_id})
+	if err != nil {
+		return nil, err
+	}
+	for i := range variants {
+		variants[i].Ingredients, err = repo.getVariantIngredients(variants[i].ID)
+		if err != nil {
+			return nil, err
+		}
+		variants[i].MaxServings = servingsOf(servings, variants[i].ID)
+		variants[i].Available = canMake(variants[i].MaxServings)
+	}
+	return variants, nil
+}
+
+// Retrieves the variant by ID with its recipe and the servings makeable from stock
+func (repo *NewMenuRepo) GetVariant(variant_id int) (models.MenuVariant, error) {
+	var variant models.MenuVariant
+	err := repo.DB.QueryRow(`SELECT variant_id, menu_item_id, name, price
+	FROM menu_item_variants
+	WHERE variant_id=$1
+	`, variant_id).Scan(&variant.ID, &variant.MenuItemID, &variant.Name, &variant.Price)
+	if err != nil {
+		return variant, err
+	}
+	variant.Ingredients, err = repo.getVariantIngredients(variant_id)
+	if err != nil {
+		return variant, err
+	}
+	servings, err := repo.getVariantServings([]int{variant.MenuItemID})
+	if err != nil {
+		return variant, err
+	}
+	variant.MaxServings = servingsOf(servings, variant_id)
+	variant.Available = canMake(variant.MaxServings)
+	return variant, nil
+}
+
+func (repo *NewMenuRepo) getVariantIngredients(variant_id int) ([]models.VariantIngredient, error) {
+	rows, err := repo.DB.Query(`SELECT id, variant_id, inventory_id, quantity, unit, to_stock_unit(quantity, unit, inventory_id)
+	FROM variant_ingredients
+	WHERE variant_id=$1
+	`, variant_id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ingredients []models.VariantIngredient
+	for rows.Next() {
+		var ingredient models.VariantIngredient
+		if err := rows.Scan(&ingredient.ID, &ingredient.VariantID, &ingredient.InventoryID, &ingredient.Quantity, &ingredient.Unit, &ingredient.StockQuantity); err != nil {
+			return nil, err
+		}
+		ingredients = append(ingredients, ingredient)
+	}
+	return ingredients, rows.Err()
+}
+
+// Checks is the variant exist for the menu item
+func (repo *NewMenuRepo) IsVariantExist(menu_item_id, variant_id int) (bool, error) {
+	var count int
+	err := repo.DB.QueryRow(`SELECT COUNT(*) FROM menu_item_variants
+	WHERE menu_item_id=$1 AND variant_id=$2
+	`, menu_item_id, variant_id).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// Checks is the variant name unique within the menu item, the variant itself is skipped
+func (repo *NewMenuRepo) IsVariantUnique(menu_item_id, variant_id int, name string) (bool, error) {
+	var count int
+	err := repo.DB.QueryRow(`SELECT COUNT(*) FROM menu_item_variants
+	WHERE menu_item_id=$1 AND name=$2 AND variant_id<>$3
+	`, menu_item_id, name, variant_id).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+	return count == 0, nil
+}
+
+// Checks if the ingredients of the variant recipe are available in inventory
+func (repo *NewMenuRepo) Check_Variant_Inventory(variant models.MenuVariant) (bool, error) {
+	var ids []int
+	for _, ingredient := range variant.Ingredients {
+		ids = append(ids, ingredient.InventoryID)
+	}
+	if len(ids) == 0 {
+		return true, nil
+	}
+	var missing int
+	err := repo.DB.QueryRow(`SELECT COUNT(*)
+	FROM unnest($1::int[]) AS ids(inventory_id)
+	WHERE NOT EXISTS (SELECT 1 FROM inventory i WHERE i.inventory_id = ids.inventory_id AND i.archived_at IS NULL)
+	`, pq.Array(ids)).Scan(&missing)
+	if err != nil {
+		return false, err
+	}
+	return missing == 0, nil
+}
+
+// Saves the variant with its recipe, returns the new variant ID
+func (repo *NewMenuRepo) SaveVariant(variant models.MenuVariant) (int, error) {
+	var variantID int
+	err := WithTx(repo.DB, func(tx *sql.Tx) error {
+		err := tx.QueryRow(`INSERT INTO menu_item_variants (menu_item_id, name, price)
+		VALUES ($1, $2, $3) RETURNING variant_id
+		`, variant.MenuItemID, variant.Name, variant.Price).Scan(&variantID)
+		if err != nil {
+			return err
+		}
+		return insertVariantIngredients(tx, variantID, variant.Ingredients)
+	})
+	return variantID, err
+}
+
+// Updates the variant in place and replaces its recipe, a changed price is recorded in price history
+func (repo *NewMenuRepo) UpdateVariant(variant models.MenuVariant) error {
+	return WithTx(repo.DB, func(tx *sql.Tx) error {
+		var oldPrice float64
+		err := tx.QueryRow(`SELECT price FROM menu_item_variants
+		WHERE variant_id=$1
+		FOR UPDATE
+		`, variant.ID).Scan(&oldPrice)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`UPDATE menu_item_variants
+		SET name=$1, price=$2
+		WHERE variant_id=$3
+		`, variant.Name, variant.Price, variant.ID)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`DELETE FROM variant_ingredients WHERE variant_id=$1`, variant.ID)
+		if err != nil {
+			return err
+		}
+		if err := insertVariantIngredients(tx, variant.ID, variant.Ingredients); err != nil {
+			return err
+		}
+		if oldPrice != variant.Price {
+			_, err = tx.Exec(`INSERT INTO price_history (menu_item_id, variant_id, old_price, new_price)
+			VALUES ($1, $2, $3, $4)
+			`, variant.MenuItemID, variant.ID, oldPrice, variant.Price)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Deletes the variant, ordered items keep the variant name
+func (repo *NewMenuRepo) DeleteVariant(variant_id int) error {
+	_, err := repo.DB.Exec(`DELETE FROM menu_item_variants WHERE variant_id=$1`, variant_id)
+	return err
+}
+
+func insertVariantIngredients(tx *sql.Tx, variant_id int, ingredients []models.VariantIngredient) error {
+	for _, ingredient := range ingredients {
+		_, err := tx.Exec(`INSERT INTO variant_ingredients (variant_id, inventory_id, quantity, unit)
+		VALUES ($1, $2, $3, COALESCE(NULLIF($4, ''), (SELECT unit_type FROM inventory WHERE inventory_id=$2)))
+		`, variant_id, ingredient.InventoryID, ingredient.Quantity, ingredient.Unit)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CheckItemVariant checks that the chosen variant belongs to the ordered menu item,
+// a menu item that has variants can only be ordered as one of them
+func (repo *NewOrderRepo) CheckItemVariant(item models.OrderItem) (int, error) {
+	if item.VariantID != 0 {
+		var menuItemID int
+		err := repo.DB.QueryRow(`SELECT menu_item_id FROM menu_item_variants
+		WHERE variant_id=$1
+		`, item.VariantID).Scan(&menuItemID)
+		if err == sql.ErrNoRows || (err == nil && menuItemID != item.MenuItemID) {
+			return http.StatusBadRequest, fmt.Errorf("variant %d is not available for menu item %d", item.VariantID, item.MenuItemID)
+		}
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+		return http.StatusOK, nil
+	}
+	var count int
+	err := repo.DB.QueryRow(`SELECT COUNT(*) FROM menu_item_variants
+	WHERE menu_item_id=$1
+	`, item.MenuItemID).Scan(&count)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if count > 0 {
+		return http.StatusBadRequest, fmt.Errorf("variant_id is required for menu item %d", item.MenuItemID)
+	}
+	return http.StatusOK, nil
+}
+
+// Gets the unit price of the order item before modifiers and the name of its variant,
+// a variant has its own price instead of the menu item price
+func (repo *NewOrderRepo) itemBasePrice(item models.OrderItem) (float64, string, error) {
+	var price float64
+	var variantName string
+	var err error
+	if item.VariantID != 0 {
+		err = repo.DB.QueryRow(`SELECT price, name FROM menu_item_variants
+		WHERE variant_id=$1
+		`, item.VariantID).Scan(&price, &variantName)
+	} else {
+		err = repo.DB.QueryRow(`SELECT price FROM menu_items
+		WHERE menu_item_id=$1
+		`, item.MenuItemID).Scan(&price)
+	}
+	return price, variantName, err
+}
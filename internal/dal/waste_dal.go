@@ -0,0 +1,186 @@
+package dal
+
+import (
+	"database/sql"
+	"frappuccino/models"
+	"strconv"
+)
+
+// Checks is the menu item exist and, when a variant is given, that the variant belongs to it
+func (repo *NewInventRepo) IsWasteMenuItemExist(menu_item_id, variant_id int) (bool, error) {
+	var count int
+	err := repo.DB.QueryRow(`SELECT COUNT(*) FROM menu_items m
+	WHERE m.menu_item_id=$1
+	AND ($2::int = 0 OR EXISTS (SELECT 1 FROM menu_item_variants v WHERE v.variant_id=$2 AND v.menu_item_id=m.menu_item_id))
+	`, menu_item_id, variant_id).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// Deducts the wasted stock and logs it with the current weighted average cost, returns the logged entries.
+// A wasted menu item takes the recipe of its variant or of the item itself times the servings.
+func (repo *NewInventRepo) SaveWaste(waste models.WasteRequest, user string) ([]models.WasteEntry, error) {
+	var entries []models.WasteEntry
+	err := WithTx(repo.DB, func(tx *sql.Tx) error {
+		quantities := make(map[string]float64)
+		if waste.MenuItemID != 0 {
+			serving, err := servingIngredients(tx, models.OrderItem{MenuItemID: waste.MenuItemID, VariantID: waste.VariantID})
+			if err != nil {
+				return err
+			}
+			for ingredientID, quantity := range serving {
+				if quantity > 0 {
+					quantities[ingredientID] = quantity * waste.Quantity
+				}
+			}
+		}
+		if waste.InventoryID != 0 {
+			factor, err := stockUnitFactor(tx, waste.InventoryID, waste.Unit, true)
+			if err != nil {
+				return err
+			}
+			quantities[strconv.Itoa(waste.InventoryID)] = waste.Quantity * factor
+		}
+		// The stock is locked before the costs are read so they match the stock the waste is taken from
+		if _, err := lockInventory(tx, sortedInventoryIDs(quantities)); err != nil {
+			return err
+		}
+		unitCosts, err := getUnitCosts(tx, "weighted_average")
+		if err != nil {
+			return err
+		}
+		for _, ingredientID := range sortedInventoryIDs(quantities) {
+			inventoryID, err := strconv.Atoi(ingredientID)
+			if err != nil {
+				return err
+			}
+			entry := models.WasteEntry{
+				InventoryID: inventoryID,
+				Name:        unitCosts[inventoryID].Name,
+				Quantity:    quantities[ingredientID],
+				UnitCost:    unitCosts[inventoryID].UnitCost,
+				Reason:      waste.Reason,
+				Note:        waste.Note,
+				CreatedBy:   user,
+			}
+			if waste.MenuItemID != 0 {
+				entry.MenuItemID = &waste.MenuItemID
+				entry.Servings = waste.Quantity
+				if waste.VariantID != 0 {
+					entry.VariantID = &waste.VariantID
+				}
+			}
+			err = applyStockMovement(tx, models.StockMovement{
+				InventoryID: inventoryID,
+				Type:        models.MovementWaste,
+				Quantity:    -entry.Quantity,
+				Reason:      waste.Reason,
+				CreatedBy:   user,
+			})
+			if err != nil {
+				return err
+			}
+			if err := insertWaste(tx, &entry); err != nil {
+				return err
+			}
+			entries = append(entries, entry)
+		}
+		return nil
+	})
+	return entries, err
+}
+
+// insertWaste logs the waste entry and fills in its ID, time, unit and cost
+func insertWaste(tx *sql.Tx, entry *models.WasteEntry) error {
+	err := tx.QueryRow(`INSERT INTO waste_log (inventory_id, menu_item_id, variant_id, servings, quantity, unit_cost, unit, reason, note, created_by)
+	SELECT $1, $2, $3, NULLIF($4::numeric, 0), $5, $6, unit_type, $7, NULLIF($8, ''), NULLIF($9, '')
+	FROM inventory
+	WHERE inventory_id=$1
+	RETURNING waste_id, created_at, unit
+	`, entry.InventoryID, entry.MenuItemID, entry.VariantID, entry.Servings, entry.Quantity, entry.UnitCost,
+		entry.Reason, entry.Note, entry.CreatedBy).Scan(&entry.ID, &entry.CreatedAt, &entry.Unit)
+	if err != nil {
+		return err
+	}
+	entry.Cost = roundMoney(entry.Quantity * entry.UnitCost)
+	return nil
+}
+
+// Gets the cost of waste logged in the period by reason, by inventory item and by day, both dates are inclusive
+func (repo *DefReportRepo) GetWasteReport(startDate, endDate string) (models.WasteReport, error) {
+	report := models.WasteReport{
+		StartDate: startDate,
+		EndDate:   endDate,
+		ByReason:  []models.WasteByReason{},
+		ByItem:    []models.WasteByItem{},
+		ByDay:     []models.WasteByDay{},
+	}
+	rows, err := repo.DB.Query(`SELECT reason, COUNT(*), COALESCE(SUM(quantity * unit_cost), 0)
+	FROM waste_log
+	WHERE created_at >= $1::date AND created_at < $2::date + 1
+	GROUP BY reason
+	ORDER BY 3 DESC
+	`, startDate, endDate)
+	if err != nil {
+		return report, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var byReason models.WasteByReason
+		if err := rows.Scan(&byReason.Reason, &byReason.Entries, &byReason.Cost); err != nil {
+			return report, err
+		}
+		report.Cost += byReason.Cost
+		byReason.Cost = roundMoney(byReason.Cost)
+		report.ByReason = append(report.ByReason, byReason)
+	}
+	if err := rows.Err(); err != nil {
+		return report, err
+	}
+	report.Cost = roundMoney(report.Cost)
+
+	itemRows, err := repo.DB.Query(`SELECT w.inventory_id, i.name, SUM(to_stock_unit(w.quantity, w.unit, w.inventory_id)), i.unit_type, SUM(w.quantity * w.unit_cost)
+	FROM waste_log w
+	INNER JOIN inventory i USING(inventory_id)
+	WHERE w.created_at >= $1::date AND w.created_at < $2::date + 1
+	GROUP BY w.inventory_id, i.name, i.unit_type
+	ORDER BY 5 DESC, 1
+	`, startDate, endDate)
+	if err != nil {
+		return report, err
+	}
+	defer itemRows.Close()
+	for itemRows.Next() {
+		var byItem models.WasteByItem
+		if err := itemRows.Scan(&byItem.InventoryID, &byItem.Name, &byItem.Quantity, &byItem.Unit, &byItem.Cost); err != nil {
+			return report, err
+		}
+		byItem.Cost = roundMoney(byItem.Cost)
+		report.ByItem = append(report.ByItem, byItem)
+	}
+	if err := itemRows.Err(); err != nil {
+		return report, err
+	}
+
+	dayRows, err := repo.DB.Query(`SELECT TO_CHAR(created_at, 'YYYY-MM-DD') AS day, COUNT(*), SUM(quantity * unit_cost)
+	FROM waste_log
+	WHERE created_at >= $1::date AND created_at < $2::date + 1
+	GROUP BY day
+	ORDER BY day
+	`, startDate, endDate)
+	if err != nil {
+		return report, err
+	}
+	defer dayRows.Close()
+	for dayRows.Next() {
+		var byDay models.WasteByDay
+		if err := dayRows.Scan(&byDay.Day, &byDay.Entries, &byDay.Cost); err != nil {
+			return report, err
+		}
+		byDay.Cost = roundMoney(byDay.Cost)
+		report.ByDay = append(report.ByDay, byDay)
+	}
+	return report, dayRows.Err()
+}
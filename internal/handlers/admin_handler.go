@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"errors"
+	"frappuccino/internal/service"
+	"frappuccino/internal/utils"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// AdminHandler serves the admin-only endpoints, every request must carry the X-Admin-Token header
+type AdminHandler struct {
+	menuService     service.MenuService
+	customerService service.CustomerService
+	inventService   service.InventService
+	token           string
+}
+
+// NewAdminHandler creates the admin handler, an empty token disables the admin endpoints
+func NewAdminHandler(menuService service.MenuService, customerService service.CustomerService, inventService service.InventService, token string) *AdminHandler {
+	return &AdminHandler{menuService: menuService, customerService: customerService, inventService: inventService, token: token}
+}
+
+// Purge_Handle deletes archived menu items, customers and inventory items for good
+func (h *AdminHandler) Purge_Handle(w http.ResponseWriter, r *http.Request) {
+	splitted := strings.Split(r.URL.Path[1:], "/")
+	if len(splitted) != 3 {
+		slog.Error("Failed to Handle Admin", "error", "invalid URL adress")
+		utils.Log_Err_Handler(errors.New("error URL adress"), http.StatusBadRequest, w)
+		return
+	}
+	if !h.authorized(r) {
+		slog.Error("Failed to Handle Admin", "error", "invalid admin token")
+		utils.Log_Err_Handler(errors.New("admin token is missing or invalid"), http.StatusForbidden, w)
+		return
+	}
+	if r.Method != http.MethodDelete {
+		slog.Info("error method in admin")
+		utils.Log_Err_Handler(errors.New("error method in admin"), http.StatusMethodNotAllowed, w)
+		return
+	}
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		slog.Error("Failed to Handle Admin", "Convertation error: ", err)
+		utils.Log_Err_Handler(err, http.StatusBadRequest, w)
+		return
+	}
+	var code int
+	switch splitted[1] {
+	case "menu":
+		code, err = h.menuService.Purge_Menu(id)
+	case "customers":
+		code, err = h.customerService.PurgeCustomer(id)
+	case "inventory":
+		code, err = h.inventService.Purge_Inventory(id)
+	default:
+		utils.Log_Err_Handler(errors.New("error URL adress"), http.StatusBadRequest, w)
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to Handle Admin", "Purge function: ", err)
+		utils.Log_Err_Handler(err, code, w)
+		return
+	}
+	slog.Info("Purged succesfully", "entity", splitted[1], "id", id)
+	w.WriteHeader(code)
+}
+
+func (h *AdminHandler) authorized(r *http.Request) bool {
+	if h.token == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(r.Header.Get("X-Admin-Token")), []byte(h.token)) == 1
+}
@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"frappuccino/internal/service"
+	"frappuccino/internal/utils"
+	"frappuccino/models"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type CountHandler struct {
+	service service.CountService
+}
+
+func NewCountHandle(service service.CountService) *CountHandler {
+	return &CountHandler{service: service}
+}
+
+// Count_Handle manages stock count sessions, the user opening or posting a count comes from the X-User header
+func (h *CountHandler) Count_Handle(w http.ResponseWriter, r *http.Request) {
+	splitted := strings.Split(r.URL.Path[1:], "/")
+	if len(splitted) < 1 {
+		utils.Log_Err_Handler(errors.New("error URL adress"), http.StatusBadRequest, w)
+		return
+	}
+	var id int
+	if len(splitted) >= 2 {
+		num, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil {
+			slog.Error("Failed to Handle Stock Counts", "Convertation error: ", err)
+			utils.Log_Err_Handler(err, http.StatusBadRequest, w)
+			return
+		}
+		id = num
+	}
+	switch {
+	case r.Method == http.MethodGet && len(splitted) == 1:
+		code, err := h.service.Retrieve_All_Counts(w)
+		if err != nil {
+			slog.Error("Failed to Handle Stock Counts", "Retrieve All Counts function: ", err)
+			utils.Log_Err_Handler(err, code, w)
+			return
+		}
+		slog.Info("All stock counts retrieved succesfully")
+		return
+	case r.Method == http.MethodPost && len(splitted) == 1:
+		note, err := h.Get_Body_Count_Note(r)
+		if err != nil {
+			slog.Error("Failed to Handle Stock Counts", "Get Body Count Note function: ", err)
+			utils.Log_Err_Handler(err, http.StatusBadRequest, w)
+			return
+		}
+		code, err := h.service.Open_Count(note, r.Header.Get("X-User"), w)
+		if err != nil {
+			slog.Error("Failed to Handle Stock Counts", "Open Count function: ", err)
+			utils.Log_Err_Handler(err, code, w)
+			return
+		}
+		slog.Info("Stock count opened succesfully")
+		return
+	case r.Method == http.MethodGet && len(splitted) == 2:
+		code, err := h.service.Retrieve_Count(w, id)
+		if err != nil {
+			slog.Error("Failed to Handle Stock Counts", "Retrieve Count function: ", err)
+			utils.Log_Err_Handler(err, code, w)
+			return
+		}
+		slog.Info("Stock count retrieved succesfully")
+		return
+	case r.Method == http.MethodDelete && len(splitted) == 2:
+		code, err := h.service.Delete_Count(id)
+		if err != nil {
+			slog.Error("Failed to Handle Stock Counts", "Delete Count function: ", err)
+			utils.Log_Err_Handler(err, code, w)
+			return
+		}
+		slog.Info("Stock count deleted succesfully")
+		w.WriteHeader(code)
+		return
+	case r.Method == http.MethodPut && len(splitted) == 3 && splitted[2] == "lines":
+		lines, err := h.Get_Body_Count_Lines(r)
+		if err != nil {
+			slog.Error("Failed to Handle Stock Counts", "Get Body Count Lines function: ", err)
+			utils.Log_Err_Handler(err, http.StatusBadRequest, w)
+			return
+		}
+		code, err := h.service.Save_Count_Lines(id, lines, w)
+		if err != nil {
+			slog.Error("Failed to Handle Stock Counts", "Save Count Lines function: ", err)
+			utils.Log_Err_Handler(err, code, w)
+			return
+		}
+		slog.Info("Stock count lines saved succesfully")
+		return
+	case r.Method == http.MethodPost && len(splitted) == 3 && splitted[2] == "post":
+		code, err := h.service.Post_Count(id, r.Header.Get("X-User"), w)
+		if err != nil {
+			slog.Error("Failed to Handle Stock Counts", "Post Count function: ", err)
+			utils.Log_Err_Handler(err, code, w)
+			return
+		}
+		slog.Info("Stock count posted succesfully")
+		return
+	default:
+		utils.Log_Err_Handler(errors.New("error method in stock counts"), http.StatusMethodNotAllowed, w)
+		return
+	}
+}
+
+// Get_Body_Count_Note reads the optional note of a new count, the body may be empty
+func (h *CountHandler) Get_Body_Count_Note(r *http.Request) (string, error) {
+	var body struct {
+		Note string `json:"note"`
+	}
+	if r.Body == nil || r.ContentLength == 0 {
+		return "", nil
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(body.Note), nil
+}
+
+// Get_Body_Count_Lines reads the counted quantities, every item can be listed once
+func (h *CountHandler) Get_Body_Count_Lines(r *http.Request) ([]models.CountLineRequest, error) {
+	var lines []models.CountLineRequest
+	if r.Body == nil {
+		return lines, errors.New("request body is empty")
+	}
+	if err := json.NewDecoder(r.Body).Decode(&lines); err != nil {
+		return lines, err
+	}
+	if len(lines) == 0 {
+		return lines, errors.New("counted lines are missing")
+	}
+	counted := make(map[int]bool)
+	for _, line := range lines {
+		if line.InventoryID <= 0 {
+			return lines, errors.New("line inventory_id is missing or invalid")
+		}
+		if line.Quantity < 0 {
+			return lines, errors.New("counted quantity cannot be negative")
+		}
+		if counted[line.InventoryID] {
+			return lines, errors.New("inventory item is listed more than once")
+		}
+		counted[line.InventoryID] = true
+	}
+	return lines, nil
+}
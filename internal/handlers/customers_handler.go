@@ -8,8 +8,10 @@ import (
 	"frappuccino/models"
 	"log/slog"
 	"net/http"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type CustomerHandler struct {
@@ -20,6 +22,11 @@ func NewCustomerHandle(service service.CustomerService) *CustomerHandler {
 	return &CustomerHandler{service: service}
 }
 
+var orderStatuses = []string{
+	models.StatusPending, models.StatusActive, models.StatusPreparing, models.StatusReady,
+	models.StatusPickedUp, models.StatusClosed, models.StatusCancelled,
+}
+
 func (h *CustomerHandler) Customers_handle(w http.ResponseWriter, r *http.Request) {
 	splitted := strings.Split(r.URL.Path[1:], "/")
 	if len(splitted) < 1 {
@@ -28,7 +35,7 @@ func (h *CustomerHandler) Customers_handle(w http.ResponseWriter, r *http.Reques
 		return
 	}
 	var id int
-	if len(splitted) == 2 {
+	if len(splitted) >= 2 {
 		num, err := strconv.Atoi(r.PathValue("id"))
 		if err != nil {
 			slog.Error("Failed to Handle Customer", "Convertation error: ", err)
@@ -45,14 +52,13 @@ func (h *CustomerHandler) Customers_handle(w http.ResponseWriter, r *http.Reques
 			utils.Log_Err_Handler(err, http.StatusBadRequest, w)
 			return
 		}
-		code, err := h.service.CreateCustomer(customer)
+		code, err := h.service.CreateCustomer(customer, w)
 		if err != nil {
 			slog.Error("Failed to Handle Customer", "Create Customer function: ", err)
 			utils.Log_Err_Handler(err, code, w)
 			return
 		}
 		slog.Info("Customer created succesfully")
-		w.WriteHeader(code)
 		return
 	case r.Method == http.MethodGet && len(splitted) == 1:
 		code, err := h.service.GetAllCustomers(w)
@@ -102,6 +108,58 @@ func (h *CustomerHandler) Customers_handle(w http.ResponseWriter, r *http.Reques
 		slog.Info("Customer deleted succesfully")
 		w.WriteHeader(code)
 		return
+	case r.Method == http.MethodGet && len(splitted) == 3 && splitted[2] == "orders":
+		query := r.URL.Query()
+		status := query.Get("status")
+		if status != "" && !slices.Contains(orderStatuses, status) {
+			utils.Log_Err_Handler(errors.New("status must be one of "+strings.Join(orderStatuses, ", ")), http.StatusBadRequest, w)
+			return
+		}
+		startDate, endDate := query.Get("startDate"), query.Get("endDate")
+		for _, date := range []string{startDate, endDate} {
+			if date == "" {
+				continue
+			}
+			if _, err := time.Parse("2006-01-02", date); err != nil {
+				slog.Error("Failed to Handle Customer", "date error", err)
+				utils.Log_Err_Handler(errors.New("startDate and endDate must be dates in YYYY-MM-DD"), http.StatusBadRequest, w)
+				return
+			}
+		}
+		page, pageSize := 1, 10
+		if value := query.Get("page"); value != "" {
+			num, err := strconv.Atoi(value)
+			if err != nil || num <= 0 {
+				utils.Log_Err_Handler(errors.New("invalid page number"), http.StatusBadRequest, w)
+				return
+			}
+			page = num
+		}
+		if value := query.Get("pageSize"); value != "" {
+			num, err := strconv.Atoi(value)
+			if err != nil || num <= 0 || num > 100 {
+				utils.Log_Err_Handler(errors.New("pageSize must be a number from 1 to 100"), http.StatusBadRequest, w)
+				return
+			}
+			pageSize = num
+		}
+		code, err := h.service.GetCustomerOrders(w, id, status, startDate, endDate, page, pageSize)
+		if err != nil {
+			slog.Error("Failed to Handle Customer", "Get Customer Orders function: ", err)
+			utils.Log_Err_Handler(err, code, w)
+			return
+		}
+		slog.Info("Customer orders retrieved succesfully")
+		return
+	case r.Method == http.MethodGet && len(splitted) == 3 && splitted[2] == "summary":
+		code, err := h.service.GetCustomerSummary(w, id)
+		if err != nil {
+			slog.Error("Failed to Handle Customer", "Get Customer Summary function: ", err)
+			utils.Log_Err_Handler(err, code, w)
+			return
+		}
+		slog.Info("Customer summary retrieved succesfully")
+		return
 	default:
 		slog.Info("error method in customers")
 		utils.Log_Err_Handler(errors.New("error method in customers"), http.StatusMethodNotAllowed, w)
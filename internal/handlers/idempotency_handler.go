@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"frappuccino/internal/service"
+	"frappuccino/internal/utils"
+	"io"
+	"log/slog"
+	"net/http"
+)
+
+type IdempotencyHandler struct {
+	service service.IdempotencyService
+}
+
+func NewIdempotencyHandler(service service.IdempotencyService) *IdempotencyHandler {
+	return &IdempotencyHandler{service: service}
+}
+
+// responseRecorder keeps a copy of the response written by the wrapped handler
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	rec.status = status
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	rec.body.Write(b)
+	return rec.ResponseWriter.Write(b)
+}
+
+// Idempotent wraps the handler so a POST request carrying an Idempotency-Key header is executed once,
+// retries with the same key and body get the original response back
+func (h *IdempotencyHandler) Idempotent(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Idempotency-Key")
+		if r.Method != http.MethodPost || key == "" {
+			next(w, r)
+			return
+		}
+		if len(key) > 255 {
+			utils.Log_Err_Handler(errors.New("idempotency key must not be longer than 255 characters"), http.StatusBadRequest, w)
+			return
+		}
+		var body []byte
+		if r.Body != nil {
+			var err error
+			body, err = io.ReadAll(r.Body)
+			if err != nil {
+				slog.Error("Failed to Handle Idempotency Key", "Read body error: ", err)
+				utils.Log_Err_Handler(err, http.StatusBadRequest, w)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+		}
+		endpoint := r.Method + " " + r.URL.Path
+		hash := sha256.Sum256(append([]byte(endpoint+"?"+r.URL.RawQuery+"\n"), body...))
+
+		record, code, err := h.service.Claim(key, endpoint, hex.EncodeToString(hash[:]))
+		if err != nil {
+			slog.Error("Failed to Handle Idempotency Key", "Claim function: ", err)
+			utils.Log_Err_Handler(err, code, w)
+			return
+		}
+		if record.StatusCode != 0 {
+			for name, value := range record.Headers {
+				w.Header().Set(name, value)
+			}
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(record.StatusCode)
+			w.Write(record.Body)
+			slog.Info("Idempotent request replayed", "key", key, "endpoint", endpoint)
+			return
+		}
+
+		// The key is released unless the response gets remembered, a panic in the handler or a failed
+		// Complete must not leave it claimed, the client may retry with the same key
+		completed := false
+		defer func() {
+			if completed {
+				return
+			}
+			panicked := recover()
+			if err := h.service.Release(key, endpoint); err != nil {
+				slog.Error("Failed to Handle Idempotency Key", "Release function: ", err)
+			}
+			if panicked != nil {
+				panic(panicked)
+			}
+		}()
+
+		recorder := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		next(recorder, r)
+
+		// Server errors are not remembered, the client may retry them with the same key
+		if recorder.status >= http.StatusInternalServerError {
+			return
+		}
+		record.StatusCode = recorder.status
+		record.Body = recorder.body.Bytes()
+		record.Headers = make(map[string]string)
+		for name := range w.Header() {
+			record.Headers[name] = w.Header().Get(name)
+		}
+		if err := h.service.Complete(record); err != nil {
+			slog.Error("Failed to Handle Idempotency Key", "Complete function: ", err)
+			return
+		}
+		completed = true
+	}
+}
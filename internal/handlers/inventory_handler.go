@@ -3,13 +3,16 @@ package handlers
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"frappuccino/internal/service"
 	"frappuccino/internal/utils"
 	"frappuccino/models"
 	"log/slog"
 	"net/http"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type InventHandler struct {
@@ -44,14 +47,13 @@ func (h *InventHandler) Inventory_Handle(w http.ResponseWriter, r *http.Request)
 			utils.Log_Err_Handler(err, http.StatusBadRequest, w)
 			return
 		}
-		code, err := h.service.Add_Inventory(inventory)
+		code, err := h.service.Add_Inventory(inventory, r.Header.Get("X-User"), w)
 		if err != nil {
 			slog.Error("Failed to Handle Inventory", "Add Inventory function: ", err)
 			utils.Log_Err_Handler(err, code, w)
 			return
 		}
 		slog.Info("Inventory added succesfully")
-		w.WriteHeader(code)
 		return
 	case r.Method == http.MethodGet && len(splitted) == 1:
 		code, err := h.service.Retrieve_All_Inventory(w)
@@ -78,7 +80,7 @@ func (h *InventHandler) Inventory_Handle(w http.ResponseWriter, r *http.Request)
 			utils.Log_Err_Handler(err, http.StatusBadRequest, w)
 			return
 		}
-		code, err := h.service.Update_Inventory(inventory, id)
+		code, err := h.service.Update_Inventory(inventory, id, r.Header.Get("X-User"))
 		if err != nil {
 			slog.Error("Failed to Handle Inventory", "Update Inventory function: ", err)
 			utils.Log_Err_Handler(err, code, w)
@@ -102,6 +104,258 @@ func (h *InventHandler) Inventory_Handle(w http.ResponseWriter, r *http.Request)
 	}
 }
 
+// Movement_Handle lists the stock ledger of an inventory item on GET, from and to are optional dates in YYYY-MM-DD,
+// and records a transfer to or from another location on POST, the user comes from the X-User header
+func (h *InventHandler) Movement_Handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		utils.Log_Err_Handler(errors.New("error method in Inventory Movements"), http.StatusMethodNotAllowed, w)
+		return
+	}
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		slog.Error("Failed to Handle Inventory Movements", "convertation error", err)
+		utils.Log_Err_Handler(err, http.StatusBadRequest, w)
+		return
+	}
+	if r.Method == http.MethodPost {
+		transfer, err := h.Get_Body_Transfer(r)
+		if err != nil {
+			slog.Error("Failed to Handle Inventory Movements", "Get Body Transfer function: ", err)
+			utils.Log_Err_Handler(err, http.StatusBadRequest, w)
+			return
+		}
+		code, err := h.service.Transfer_Stock(id, transfer, r.Header.Get("X-User"), w)
+		if err != nil {
+			slog.Error("Failed to Handle Inventory Movements", "Transfer Stock function: ", err)
+			utils.Log_Err_Handler(err, code, w)
+			return
+		}
+		slog.Info("Inventory transfer recorded succesfully")
+		return
+	}
+	from := r.URL.Query().Get("from")
+	to := r.URL.Query().Get("to")
+	for _, date := range []string{from, to} {
+		if date == "" {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", date); err != nil {
+			slog.Error("Failed to Handle Inventory Movements", "date error", err)
+			utils.Log_Err_Handler(errors.New("from and to must be dates in YYYY-MM-DD"), http.StatusBadRequest, w)
+			return
+		}
+	}
+	code, err := h.service.Retrieve_Stock_Movements(w, id, from, to)
+	if err != nil {
+		slog.Error("Failed to Handle Inventory Movements", "Retrieve Stock Movements function: ", err)
+		utils.Log_Err_Handler(err, code, w)
+		return
+	}
+	slog.Info("Inventory movements retrieved succesfully")
+}
+
+// Consistency_Handle compares stock levels with the ledger on GET and recomputes them from the ledger on POST
+func (h *InventHandler) Consistency_Handle(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		code, err := h.service.Check_Consistency(w)
+		if err != nil {
+			slog.Error("Failed to Handle Inventory Consistency", "Check Consistency function: ", err)
+			utils.Log_Err_Handler(err, code, w)
+			return
+		}
+		slog.Info("Inventory consistency checked succesfully")
+	case http.MethodPost:
+		code, err := h.service.Reconcile_Stock(w)
+		if err != nil {
+			slog.Error("Failed to Handle Inventory Consistency", "Reconcile Stock function: ", err)
+			utils.Log_Err_Handler(err, code, w)
+			return
+		}
+		slog.Info("Inventory stock reconciled succesfully", "user", r.Header.Get("X-User"))
+	default:
+		utils.Log_Err_Handler(errors.New("error method in Inventory Consistency"), http.StatusMethodNotAllowed, w)
+	}
+}
+
+// Reorder_Handle lists reorder suggestions on GET and turns them into draft purchase orders on POST,
+// days is the optional number of days of sales the usage is averaged over, 28 by default
+func (h *InventHandler) Reorder_Handle(w http.ResponseWriter, r *http.Request) {
+	days := 28
+	if value := r.URL.Query().Get("days"); value != "" {
+		num, err := strconv.Atoi(value)
+		if err != nil || num < 1 || num > 365 {
+			utils.Log_Err_Handler(errors.New("days must be a number from 1 to 365"), http.StatusBadRequest, w)
+			return
+		}
+		days = num
+	}
+	switch r.Method {
+	case http.MethodGet:
+		code, err := h.service.Retrieve_Reorder_Suggestions(w, days)
+		if err != nil {
+			slog.Error("Failed to Handle Reorder Suggestions", "Retrieve Reorder Suggestions function: ", err)
+			utils.Log_Err_Handler(err, code, w)
+			return
+		}
+		slog.Info("Reorder suggestions retrieved succesfully")
+	case http.MethodPost:
+		code, err := h.service.Create_Reorder_Drafts(days, r.Header.Get("X-User"), w)
+		if err != nil {
+			slog.Error("Failed to Handle Reorder Suggestions", "Create Reorder Drafts function: ", err)
+			utils.Log_Err_Handler(err, code, w)
+			return
+		}
+		slog.Info("Reorder draft purchase orders created succesfully")
+	default:
+		utils.Log_Err_Handler(errors.New("error method in Reorder Suggestions"), http.StatusMethodNotAllowed, w)
+	}
+}
+
+// Lot_Handle lists the lots of an inventory item still in stock
+func (h *InventHandler) Lot_Handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.Log_Err_Handler(errors.New("error method in Inventory Lots"), http.StatusMethodNotAllowed, w)
+		return
+	}
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		slog.Error("Failed to Handle Inventory Lots", "convertation error", err)
+		utils.Log_Err_Handler(err, http.StatusBadRequest, w)
+		return
+	}
+	code, err := h.service.Retrieve_Lots(w, id)
+	if err != nil {
+		slog.Error("Failed to Handle Inventory Lots", "Retrieve Lots function: ", err)
+		utils.Log_Err_Handler(err, code, w)
+		return
+	}
+	slog.Info("Inventory lots retrieved succesfully")
+}
+
+// Expiring_Handle lists the lots expiring within the days given as within=3d or within=3, 3 days by default
+func (h *InventHandler) Expiring_Handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.Log_Err_Handler(errors.New("error method in Inventory Expiring"), http.StatusMethodNotAllowed, w)
+		return
+	}
+	within := 3
+	if value := r.URL.Query().Get("within"); value != "" {
+		num, err := strconv.Atoi(strings.TrimSuffix(value, "d"))
+		if err != nil || num < 0 {
+			utils.Log_Err_Handler(errors.New("within must be a number of days like 3d"), http.StatusBadRequest, w)
+			return
+		}
+		within = num
+	}
+	code, err := h.service.Retrieve_Expiring_Lots(w, within)
+	if err != nil {
+		slog.Error("Failed to Handle Inventory Expiring", "Retrieve Expiring Lots function: ", err)
+		utils.Log_Err_Handler(err, code, w)
+		return
+	}
+	slog.Info("Expiring lots retrieved succesfully")
+}
+
+// Expired_Handle writes off the expired lots as waste, the user comes from the X-User header
+func (h *InventHandler) Expired_Handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.Log_Err_Handler(errors.New("error method in Inventory Expired"), http.StatusMethodNotAllowed, w)
+		return
+	}
+	code, err := h.service.Write_Off_Expired(r.Header.Get("X-User"), w)
+	if err != nil {
+		slog.Error("Failed to Handle Inventory Expired", "Write Off Expired function: ", err)
+		utils.Log_Err_Handler(err, code, w)
+		return
+	}
+	slog.Info("Expired lots written off succesfully")
+}
+
+// Waste_Handle logs wasted stock, the user comes from the X-User header
+func (h *InventHandler) Waste_Handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.Log_Err_Handler(errors.New("error method in Inventory Waste"), http.StatusMethodNotAllowed, w)
+		return
+	}
+	waste, err := h.Get_Body_Waste(r)
+	if err != nil {
+		slog.Error("Failed to Handle Inventory Waste", "Get Body Waste function: ", err)
+		utils.Log_Err_Handler(err, http.StatusBadRequest, w)
+		return
+	}
+	code, err := h.service.Log_Waste(waste, r.Header.Get("X-User"), w)
+	if err != nil {
+		slog.Error("Failed to Handle Inventory Waste", "Log Waste function: ", err)
+		utils.Log_Err_Handler(err, code, w)
+		return
+	}
+	slog.Info("Waste logged succesfully")
+}
+
+// Pack_Handle manages the pack units an inventory item is bought in
+func (h *InventHandler) Pack_Handle(w http.ResponseWriter, r *http.Request) {
+	splitted := strings.Split(r.URL.Path[1:], "/")
+	if len(splitted) < 3 {
+		utils.Log_Err_Handler(errors.New("error URL adress"), http.StatusBadRequest, w)
+		return
+	}
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		slog.Error("Failed to Handle Inventory Packs", "convertation error", err)
+		utils.Log_Err_Handler(err, http.StatusBadRequest, w)
+		return
+	}
+	var packID int
+	if len(splitted) == 4 {
+		packID, err = strconv.Atoi(r.PathValue("pack_id"))
+		if err != nil {
+			slog.Error("Failed to Handle Inventory Packs", "convertation error", err)
+			utils.Log_Err_Handler(err, http.StatusBadRequest, w)
+			return
+		}
+	}
+	switch {
+	case r.Method == http.MethodGet && len(splitted) == 3:
+		code, err := h.service.Retrieve_Pack_Units(w, id)
+		if err != nil {
+			slog.Error("Failed to Handle Inventory Packs", "Retrieve Pack Units function: ", err)
+			utils.Log_Err_Handler(err, code, w)
+			return
+		}
+		slog.Info("Inventory packs retrieved succesfully")
+		return
+	case r.Method == http.MethodPost && len(splitted) == 3:
+		pack, err := h.Get_Body_Pack_Unit(r)
+		if err != nil {
+			slog.Error("Failed to Handle Inventory Packs", "Get Body Pack Unit function: ", err)
+			utils.Log_Err_Handler(err, http.StatusBadRequest, w)
+			return
+		}
+		code, err := h.service.Add_Pack_Unit(id, pack, w)
+		if err != nil {
+			slog.Error("Failed to Handle Inventory Packs", "Add Pack Unit function: ", err)
+			utils.Log_Err_Handler(err, code, w)
+			return
+		}
+		slog.Info("Inventory pack added succesfully")
+		return
+	case r.Method == http.MethodDelete && len(splitted) == 4:
+		code, err := h.service.Delete_Pack_Unit(id, packID)
+		if err != nil {
+			slog.Error("Failed to Handle Inventory Packs", "Delete Pack Unit function: ", err)
+			utils.Log_Err_Handler(err, code, w)
+			return
+		}
+		slog.Info("Inventory pack deleted succesfully")
+		w.WriteHeader(code)
+		return
+	default:
+		utils.Log_Err_Handler(errors.New("error method in Inventory Packs"), http.StatusMethodNotAllowed, w)
+		return
+	}
+}
+
 func (h *InventHandler) InventoryTransaction_Handle(w http.ResponseWriter, r *http.Request) {
 	splitted := strings.Split(r.URL.Path[1:], "/")
 	if len(splitted) < 1 {
@@ -144,7 +398,7 @@ func (h *InventHandler) InventoryTransaction_Handle(w http.ResponseWriter, r *ht
 			utils.Log_Err_Handler(err, http.StatusBadRequest, w)
 			return
 		}
-		code, err := h.service.FillInventory(transaction)
+		code, err := h.service.FillInventory(transaction, r.Header.Get("X-User"))
 		if err != nil {
 			slog.Error("Failed to Handle Inventory Transaction", "Fill Inventory function: ", err)
 			utils.Log_Err_Handler(err, code, w)
@@ -182,6 +436,17 @@ func (h *InventHandler) Get_Body_InventoryTransaction(r *http.Request) (models.I
 	if !transaction.Transaction_date.IsZero() {
 		return transaction, errors.New("transaction date must be empty")
 	}
+	if transaction.PurchaseQuantity != 0 || transaction.PurchaseUnit != "" {
+		return transaction, errors.New("purchase_quantity and purchase_unit must be empty, give quantity and unit instead")
+	}
+	if transaction.POLineID != nil {
+		return transaction, errors.New("po_line_id must be empty, receive purchase orders on /purchase-orders/{id}/receive")
+	}
+	if transaction.ExpiryDate != "" {
+		if _, err := time.Parse("2006-01-02", transaction.ExpiryDate); err != nil {
+			return transaction, errors.New("expiry_date must be in YYYY-MM-DD format")
+		}
+	}
 	return transaction, nil
 }
 
@@ -205,14 +470,94 @@ func (h *InventHandler) Get_Body_Inventory(r *http.Request) (models.InventoryIte
 	if inventory.StockLevel <= 0 {
 		return inventory, errors.New("stock_level field cannot be negative or empty")
 	}
+	if inventory.Reserved != 0 || inventory.Available != 0 {
+		return inventory, errors.New("reserved and available fields must be empty")
+	}
 	if inventory.UnitType == "" {
 		return inventory, errors.New("unit_type field is missing")
 	}
 	if inventory.ReorderLevel <= 0 {
 		return inventory, errors.New("reorder_level field cannot be negative or empty")
 	}
+	if inventory.ParLevel != 0 && inventory.ParLevel < inventory.ReorderLevel {
+		return inventory, errors.New("par_level field cannot be less than reorder_level")
+	}
+	inventory.Category = strings.ToLower(strings.TrimSpace(inventory.Category))
 	if !inventory.LastUpdated.IsZero() {
 		return inventory, errors.New("last_updated field must be empty")
 	}
 	return inventory, nil
 }
+
+// Get_Body_Pack_Unit reads a pack unit, its content is given as quantity of a registered unit
+func (h *InventHandler) Get_Body_Pack_Unit(r *http.Request) (models.PackUnit, error) {
+	var pack models.PackUnit
+	if r.Body == nil {
+		return pack, errors.New("request body is empty")
+	}
+	if err := json.NewDecoder(r.Body).Decode(&pack); err != nil {
+		return pack, err
+	}
+	if pack.ID != 0 || pack.InventoryID != 0 {
+		return pack, errors.New("pack id and inventory_id must be empty")
+	}
+	if strings.TrimSpace(pack.Name) == "" {
+		return pack, errors.New("pack name is missing")
+	}
+	if pack.Quantity <= 0 {
+		return pack, errors.New("pack quantity must be greater than 0")
+	}
+	if pack.Unit == "" {
+		return pack, errors.New("pack unit is missing")
+	}
+	return pack, nil
+}
+
+// Get_Body_Transfer reads a transfer, the quantity is signed and the reason names the other location
+func (h *InventHandler) Get_Body_Transfer(r *http.Request) (models.TransferRequest, error) {
+	var transfer models.TransferRequest
+	if r.Body == nil {
+		return transfer, errors.New("request body is empty")
+	}
+	if err := json.NewDecoder(r.Body).Decode(&transfer); err != nil {
+		return transfer, err
+	}
+	if transfer.Quantity == 0 {
+		return transfer, errors.New("quantity must not be 0, it is positive when stock comes in and negative when it goes out")
+	}
+	transfer.Reason = strings.TrimSpace(transfer.Reason)
+	if transfer.Reason == "" {
+		return transfer, errors.New("reason field is missing")
+	}
+	return transfer, nil
+}
+
+// Get_Body_Waste reads a waste of either an inventory item or servings of a menu item
+func (h *InventHandler) Get_Body_Waste(r *http.Request) (models.WasteRequest, error) {
+	var waste models.WasteRequest
+	if r.Body == nil {
+		return waste, errors.New("request body is empty")
+	}
+	if err := json.NewDecoder(r.Body).Decode(&waste); err != nil {
+		return waste, err
+	}
+	if (waste.InventoryID == 0) == (waste.MenuItemID == 0) {
+		return waste, errors.New("give either inventory_id or menu_item_id")
+	}
+	if waste.InventoryID < 0 || waste.MenuItemID < 0 || waste.VariantID < 0 {
+		return waste, errors.New("inventory_id, menu_item_id and variant_id must be positive")
+	}
+	if waste.VariantID != 0 && waste.MenuItemID == 0 {
+		return waste, errors.New("variant_id needs menu_item_id")
+	}
+	if waste.Unit != "" && waste.MenuItemID != 0 {
+		return waste, errors.New("unit is only for an inventory item, a menu item is wasted in servings")
+	}
+	if waste.Quantity <= 0 {
+		return waste, errors.New("quantity must be greater than 0")
+	}
+	if !slices.Contains(models.WasteReasons, waste.Reason) {
+		return waste, fmt.Errorf("reason must be one of %s", strings.Join(models.WasteReasons, ", "))
+	}
+	return waste, nil
+}
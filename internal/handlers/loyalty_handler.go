@@ -0,0 +1,226 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"frappuccino/internal/service"
+	"frappuccino/internal/utils"
+	"frappuccino/models"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type LoyaltyHandler struct {
+	service service.LoyaltyService
+}
+
+func NewLoyaltyHandle(service service.LoyaltyService) *LoyaltyHandler {
+	return &LoyaltyHandler{service: service}
+}
+
+// Loyalty_Handle manages the loyalty rule, the rewards and the expiry of points
+func (h *LoyaltyHandler) Loyalty_Handle(w http.ResponseWriter, r *http.Request) {
+	splitted := strings.Split(r.URL.Path[1:], "/")
+	if len(splitted) < 2 {
+		utils.Log_Err_Handler(errors.New("error URL adress"), http.StatusBadRequest, w)
+		return
+	}
+	var id int
+	if len(splitted) == 3 {
+		num, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil {
+			slog.Error("Failed to Handle Loyalty", "Convertation error: ", err)
+			utils.Log_Err_Handler(err, http.StatusBadRequest, w)
+			return
+		}
+		id = num
+	}
+	switch {
+	case r.Method == http.MethodGet && splitted[1] == "settings":
+		code, err := h.service.Retrieve_Settings(w)
+		if err != nil {
+			slog.Error("Failed to Handle Loyalty", "Retrieve Settings function: ", err)
+			utils.Log_Err_Handler(err, code, w)
+			return
+		}
+		slog.Info("Loyalty settings retrieved succesfully")
+		return
+	case r.Method == http.MethodPut && splitted[1] == "settings":
+		settings, err := h.Get_Body_Loyalty_Settings(r)
+		if err != nil {
+			slog.Error("Failed to Handle Loyalty", "Get Body Loyalty Settings function: ", err)
+			utils.Log_Err_Handler(err, http.StatusBadRequest, w)
+			return
+		}
+		code, err := h.service.Update_Settings(settings, w)
+		if err != nil {
+			slog.Error("Failed to Handle Loyalty", "Update Settings function: ", err)
+			utils.Log_Err_Handler(err, code, w)
+			return
+		}
+		slog.Info("Loyalty settings updated succesfully")
+		return
+	case r.Method == http.MethodPost && splitted[1] == "expire":
+		code, err := h.service.Expire_Points(w)
+		if err != nil {
+			slog.Error("Failed to Handle Loyalty", "Expire Points function: ", err)
+			utils.Log_Err_Handler(err, code, w)
+			return
+		}
+		slog.Info("Loyalty points expired succesfully")
+		return
+	case r.Method == http.MethodGet && splitted[1] == "rewards" && len(splitted) == 2:
+		code, err := h.service.Retrieve_All_Rewards(w)
+		if err != nil {
+			slog.Error("Failed to Handle Loyalty", "Retrieve All Rewards function: ", err)
+			utils.Log_Err_Handler(err, code, w)
+			return
+		}
+		slog.Info("All rewards retrieved succesfully")
+		return
+	case r.Method == http.MethodPost && splitted[1] == "rewards" && len(splitted) == 2:
+		reward, err := h.Get_Body_Reward(r)
+		if err != nil {
+			slog.Error("Failed to Handle Loyalty", "Get Body Reward function: ", err)
+			utils.Log_Err_Handler(err, http.StatusBadRequest, w)
+			return
+		}
+		code, err := h.service.Add_Reward(reward, w)
+		if err != nil {
+			slog.Error("Failed to Handle Loyalty", "Add Reward function: ", err)
+			utils.Log_Err_Handler(err, code, w)
+			return
+		}
+		slog.Info("Reward added succesfully")
+		return
+	case r.Method == http.MethodGet && splitted[1] == "rewards" && len(splitted) == 3:
+		code, err := h.service.Retrieve_Reward(w, id)
+		if err != nil {
+			slog.Error("Failed to Handle Loyalty", "Retrieve Reward function: ", err)
+			utils.Log_Err_Handler(err, code, w)
+			return
+		}
+		slog.Info("Reward retrieved succesfully")
+		return
+	case r.Method == http.MethodPut && splitted[1] == "rewards" && len(splitted) == 3:
+		reward, err := h.Get_Body_Reward(r)
+		if err != nil {
+			slog.Error("Failed to Handle Loyalty", "Get Body Reward function: ", err)
+			utils.Log_Err_Handler(err, http.StatusBadRequest, w)
+			return
+		}
+		code, err := h.service.Update_Reward(reward, id)
+		if err != nil {
+			slog.Error("Failed to Handle Loyalty", "Update Reward function: ", err)
+			utils.Log_Err_Handler(err, code, w)
+			return
+		}
+		slog.Info("Reward updated succesfully")
+		return
+	case r.Method == http.MethodDelete && splitted[1] == "rewards" && len(splitted) == 3:
+		code, err := h.service.Delete_Reward(id)
+		if err != nil {
+			slog.Error("Failed to Handle Loyalty", "Delete Reward function: ", err)
+			utils.Log_Err_Handler(err, code, w)
+			return
+		}
+		slog.Info("Reward deleted succesfully")
+		w.WriteHeader(code)
+		return
+	default:
+		utils.Log_Err_Handler(errors.New("error method in loyalty"), http.StatusMethodNotAllowed, w)
+		return
+	}
+}
+
+// Balance_Handle reports the points balance of a customer, or the ledger of the points on /customers/{id}/loyalty/ledger
+func (h *LoyaltyHandler) Balance_Handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.Log_Err_Handler(errors.New("error method in customer loyalty"), http.StatusMethodNotAllowed, w)
+		return
+	}
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		slog.Error("Failed to Handle Customer Loyalty", "Convertation error: ", err)
+		utils.Log_Err_Handler(err, http.StatusBadRequest, w)
+		return
+	}
+	if strings.HasSuffix(r.URL.Path, "/ledger") {
+		code, err := h.service.Retrieve_Ledger(w, id)
+		if err != nil {
+			slog.Error("Failed to Handle Customer Loyalty", "Retrieve Ledger function: ", err)
+			utils.Log_Err_Handler(err, code, w)
+			return
+		}
+		slog.Info("Loyalty ledger retrieved succesfully")
+		return
+	}
+	code, err := h.service.Retrieve_Balance(w, id)
+	if err != nil {
+		slog.Error("Failed to Handle Customer Loyalty", "Retrieve Balance function: ", err)
+		utils.Log_Err_Handler(err, code, w)
+		return
+	}
+	slog.Info("Loyalty balance retrieved succesfully")
+}
+
+// Get_Body_Loyalty_Settings reads the whole loyalty rule, the program is enabled unless enabled is false.
+// Tag multipliers replace the ones set before, leaving them out removes every multiplier
+func (h *LoyaltyHandler) Get_Body_Loyalty_Settings(r *http.Request) (models.LoyaltySettings, error) {
+	settings := models.LoyaltySettings{Enabled: true}
+	if r.Body == nil {
+		return settings, errors.New("request body is empty")
+	}
+	if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
+		return settings, err
+	}
+	if settings.PointsPerUnit < 0 {
+		return settings, errors.New("points_per_unit cannot be negative")
+	}
+	if settings.PointValue <= 0 {
+		return settings, errors.New("point_value is missing or invalid")
+	}
+	if settings.ExpiryDays < 0 {
+		return settings, errors.New("expiry_days cannot be negative, 0 keeps points forever")
+	}
+	multipliers := make(map[string]float64, len(settings.TagMultipliers))
+	for tag, multiplier := range settings.TagMultipliers {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" {
+			return settings, errors.New("tag of a multiplier is empty")
+		}
+		if multiplier <= 0 || multiplier >= 1000 {
+			return settings, errors.New("multiplier of tag " + tag + " must be greater than 0 and less than 1000")
+		}
+		multipliers[tag] = multiplier
+	}
+	settings.TagMultipliers = multipliers
+	return settings, nil
+}
+
+// Get_Body_Reward reads a reward, a reward is active unless active is false
+func (h *LoyaltyHandler) Get_Body_Reward(r *http.Request) (models.LoyaltyReward, error) {
+	reward := models.LoyaltyReward{Active: true}
+	if r.Body == nil {
+		return reward, errors.New("request body is empty")
+	}
+	if err := json.NewDecoder(r.Body).Decode(&reward); err != nil {
+		return reward, err
+	}
+	if reward.ID != 0 {
+		return reward, errors.New("reward id field must be empty")
+	}
+	reward.Name = strings.TrimSpace(reward.Name)
+	if reward.Name == "" {
+		return reward, errors.New("name field is missing")
+	}
+	if reward.MenuItemID <= 0 {
+		return reward, errors.New("menu_item_id field is missing or invalid")
+	}
+	if reward.Points <= 0 {
+		return reward, errors.New("points field cannot be negative or empty")
+	}
+	return reward, nil
+}
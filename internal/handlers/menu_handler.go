@@ -27,7 +27,7 @@ func (h *HandlerMenu) Menu_Handle(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	var id int
-	if len(splitted) == 2 {
+	if len(splitted) >= 2 && splitted[1] != "available" {
 		num, err := strconv.Atoi(r.PathValue("id"))
 		if err != nil {
 			slog.Error("Failed to Handle Menu", "convertation error ", err)
@@ -44,14 +44,13 @@ func (h *HandlerMenu) Menu_Handle(w http.ResponseWriter, r *http.Request) {
 			utils.Log_Err_Handler(err, http.StatusBadRequest, w)
 			return
 		}
-		code, err := h.service.Add_Menu(menu, menu.ItemIngredient)
+		code, err := h.service.Add_Menu(menu, menu.ItemIngredient, w)
 		if err != nil {
 			slog.Error("Failed to Handle Menu", "Add Menu function: ", err)
 			utils.Log_Err_Handler(err, code, w)
 			return
 		}
 		slog.Info("Menu added succesfully")
-		w.WriteHeader(code)
 		return
 	case r.Method == http.MethodGet && len(splitted) == 1:
 		code, err := h.service.Retrieve_All_Menu(w)
@@ -62,6 +61,39 @@ func (h *HandlerMenu) Menu_Handle(w http.ResponseWriter, r *http.Request) {
 		}
 		slog.Info("All menu retrieved succesfully")
 		return
+	case r.Method == http.MethodGet && len(splitted) == 2 && splitted[1] == "available":
+		code, err := h.service.Retrieve_Available_Menu(w)
+		if err != nil {
+			slog.Error("Failed to Handle Menu", "Retrieve Available Menu function: ", err)
+			utils.Log_Err_Handler(err, code, w)
+			return
+		}
+		slog.Info("Available menu retrieved succesfully")
+		return
+	case r.Method == http.MethodPut && len(splitted) == 3 && splitted[2] == "sold-out":
+		soldOut, err := h.Get_Body_Sold_Out(r)
+		if err != nil {
+			slog.Error("Failed to Handle Menu", "Get Body Sold Out function: ", err)
+			utils.Log_Err_Handler(err, http.StatusBadRequest, w)
+			return
+		}
+		code, err := h.service.Set_Sold_Out(id, soldOut, w)
+		if err != nil {
+			slog.Error("Failed to Handle Menu", "Set Sold Out function: ", err)
+			utils.Log_Err_Handler(err, code, w)
+			return
+		}
+		slog.Info("Menu sold out flag updated succesfully")
+		return
+	case r.Method == http.MethodGet && len(splitted) == 3 && splitted[2] == "cost":
+		code, err := h.service.Retrieve_Menu_Cost(w, id, r.URL.Query().Get("method"))
+		if err != nil {
+			slog.Error("Failed to Handle Menu", "Retrieve Menu Cost function: ", err)
+			utils.Log_Err_Handler(err, code, w)
+			return
+		}
+		slog.Info("Menu cost retrieved succesfully")
+		return
 	case r.Method == http.MethodGet && len(splitted) == 2:
 		code, err := h.service.Retrieve_Menu(w, id)
 		if err != nil {
@@ -143,6 +175,160 @@ func (h *HandlerMenu) Menu_Price_History_Handle(w http.ResponseWriter, r *http.R
 	}
 }
 
+func (h *HandlerMenu) Variant_Handle(w http.ResponseWriter, r *http.Request) {
+	splitted := strings.Split(r.URL.Path[1:], "/")
+	if len(splitted) < 3 {
+		utils.Log_Err_Handler(errors.New("error URL adress"), http.StatusBadRequest, w)
+		return
+	}
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		slog.Error("Failed to Handle Menu Variants", "convertation error", err)
+		utils.Log_Err_Handler(err, http.StatusBadRequest, w)
+		return
+	}
+	var variantID int
+	if len(splitted) == 4 {
+		variantID, err = strconv.Atoi(r.PathValue("variant_id"))
+		if err != nil {
+			slog.Error("Failed to Handle Menu Variants", "convertation error", err)
+			utils.Log_Err_Handler(err, http.StatusBadRequest, w)
+			return
+		}
+	}
+	switch {
+	case r.Method == http.MethodGet && len(splitted) == 3:
+		code, err := h.service.Retrieve_Variants(w, id)
+		if err != nil {
+			slog.Error("Failed to Handle Menu Variants", "Retrieve Variants function: ", err)
+			utils.Log_Err_Handler(err, code, w)
+			return
+		}
+		slog.Info("Menu variants retrieved succesfully")
+		return
+	case r.Method == http.MethodPost && len(splitted) == 3:
+		variant, err := h.Get_Body_Variant(r)
+		if err != nil {
+			slog.Error("Failed to Handle Menu Variants", "Get Body Variant function: ", err)
+			utils.Log_Err_Handler(err, http.StatusBadRequest, w)
+			return
+		}
+		code, err := h.service.Add_Variant(id, variant, w)
+		if err != nil {
+			slog.Error("Failed to Handle Menu Variants", "Add Variant function: ", err)
+			utils.Log_Err_Handler(err, code, w)
+			return
+		}
+		slog.Info("Menu variant added succesfully")
+		return
+	case r.Method == http.MethodPut && len(splitted) == 4:
+		variant, err := h.Get_Body_Variant(r)
+		if err != nil {
+			slog.Error("Failed to Handle Menu Variants", "Get Body Variant function: ", err)
+			utils.Log_Err_Handler(err, http.StatusBadRequest, w)
+			return
+		}
+		code, err := h.service.Update_Variant(id, variantID, variant, w)
+		if err != nil {
+			slog.Error("Failed to Handle Menu Variants", "Update Variant function: ", err)
+			utils.Log_Err_Handler(err, code, w)
+			return
+		}
+		slog.Info("Menu variant updated succesfully")
+		return
+	case r.Method == http.MethodDelete && len(splitted) == 4:
+		code, err := h.service.Delete_Variant(id, variantID)
+		if err != nil {
+			slog.Error("Failed to Handle Menu Variants", "Delete Variant function: ", err)
+			utils.Log_Err_Handler(err, code, w)
+			return
+		}
+		slog.Info("Menu variant deleted succesfully")
+		w.WriteHeader(code)
+		return
+	default:
+		utils.Log_Err_Handler(errors.New("error method in Menu Variants"), http.StatusMethodNotAllowed, w)
+		return
+	}
+}
+
+func (h *HandlerMenu) Modifier_Handle(w http.ResponseWriter, r *http.Request) {
+	splitted := strings.Split(r.URL.Path[1:], "/")
+	if len(splitted) < 3 {
+		utils.Log_Err_Handler(errors.New("error URL adress"), http.StatusBadRequest, w)
+		return
+	}
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		slog.Error("Failed to Handle Menu Modifiers", "convertation error", err)
+		utils.Log_Err_Handler(err, http.StatusBadRequest, w)
+		return
+	}
+	var groupID int
+	if len(splitted) == 4 {
+		groupID, err = strconv.Atoi(r.PathValue("group_id"))
+		if err != nil {
+			slog.Error("Failed to Handle Menu Modifiers", "convertation error", err)
+			utils.Log_Err_Handler(err, http.StatusBadRequest, w)
+			return
+		}
+	}
+	switch {
+	case r.Method == http.MethodGet && len(splitted) == 3:
+		code, err := h.service.Retrieve_Modifiers(w, id)
+		if err != nil {
+			slog.Error("Failed to Handle Menu Modifiers", "Retrieve Modifiers function: ", err)
+			utils.Log_Err_Handler(err, code, w)
+			return
+		}
+		slog.Info("Menu modifiers retrieved succesfully")
+		return
+	case r.Method == http.MethodPost && len(splitted) == 3:
+		group, err := h.Get_Body_Modifier_Group(r, false)
+		if err != nil {
+			slog.Error("Failed to Handle Menu Modifiers", "Get Body Modifier Group function: ", err)
+			utils.Log_Err_Handler(err, http.StatusBadRequest, w)
+			return
+		}
+		code, err := h.service.Add_Modifier_Group(id, group, w)
+		if err != nil {
+			slog.Error("Failed to Handle Menu Modifiers", "Add Modifier Group function: ", err)
+			utils.Log_Err_Handler(err, code, w)
+			return
+		}
+		slog.Info("Modifier group added succesfully")
+		return
+	case r.Method == http.MethodPut && len(splitted) == 4:
+		group, err := h.Get_Body_Modifier_Group(r, true)
+		if err != nil {
+			slog.Error("Failed to Handle Menu Modifiers", "Get Body Modifier Group function: ", err)
+			utils.Log_Err_Handler(err, http.StatusBadRequest, w)
+			return
+		}
+		code, err := h.service.Update_Modifier_Group(id, groupID, group, w)
+		if err != nil {
+			slog.Error("Failed to Handle Menu Modifiers", "Update Modifier Group function: ", err)
+			utils.Log_Err_Handler(err, code, w)
+			return
+		}
+		slog.Info("Modifier group updated succesfully")
+		return
+	case r.Method == http.MethodDelete && len(splitted) == 4:
+		code, err := h.service.Delete_Modifier_Group(id, groupID)
+		if err != nil {
+			slog.Error("Failed to Handle Menu Modifiers", "Delete Modifier Group function: ", err)
+			utils.Log_Err_Handler(err, code, w)
+			return
+		}
+		slog.Info("Modifier group deleted succesfully")
+		w.WriteHeader(code)
+		return
+	default:
+		utils.Log_Err_Handler(errors.New("error method in Menu Modifiers"), http.StatusMethodNotAllowed, w)
+		return
+	}
+}
+
 func (h *HandlerMenu) Get_Body_Menu(r *http.Request) (models.Menu, error) {
 	var menu models.Menu
 	if r.Body == nil {
@@ -167,6 +353,12 @@ func (h *HandlerMenu) Get_Body_Menu(r *http.Request) (models.Menu, error) {
 	if len(menu.ItemIngredient) == 0 {
 		return menu, errors.New("menu ingredients field is missing")
 	}
+	if len(menu.Variants) != 0 {
+		return menu, errors.New("variants must be managed through /menu/{id}/variants")
+	}
+	if len(menu.Modifiers) != 0 {
+		return menu, errors.New("modifiers must be managed through /menu/{id}/modifiers")
+	}
 	for _, menuItem := range menu.ItemIngredient {
 		if menuItem.ID != 0 {
 			return menu, errors.New("menu item id field must be empty")
@@ -180,7 +372,131 @@ func (h *HandlerMenu) Get_Body_Menu(r *http.Request) (models.Menu, error) {
 		if menuItem.Quantity <= 0 {
 			return menu, errors.New("menu item quantity field is missing or invalid")
 		}
+		if menuItem.StockQuantity != 0 {
+			return menu, errors.New("menu item stock_quantity field must be empty")
+		}
 	}
 
 	return menu, nil
 }
+
+// Get_Body_Sold_Out reads the sold_out flag of a menu item
+func (h *HandlerMenu) Get_Body_Sold_Out(r *http.Request) (bool, error) {
+	var body struct {
+		SoldOut *bool `json:"sold_out"`
+	}
+	if r.Body == nil {
+		return false, errors.New("request body is empty")
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		return false, err
+	}
+	if body.SoldOut == nil {
+		return false, errors.New("sold_out field is missing")
+	}
+	return *body.SoldOut, nil
+}
+
+// Get_Body_Modifier_Group reads a modifier group, option IDs are allowed only when an existing group is updated
+func (h *HandlerMenu) Get_Body_Modifier_Group(r *http.Request, allowOptionIDs bool) (models.ModifierGroup, error) {
+	var group models.ModifierGroup
+	if r.Body == nil {
+		return group, errors.New("request body is empty")
+	}
+	if err := json.NewDecoder(r.Body).Decode(&group); err != nil {
+		return group, err
+	}
+	if group.ID != 0 || group.MenuItemID != 0 {
+		return group, errors.New("modifier group id and menu_item_id must be empty")
+	}
+	if strings.TrimSpace(group.Name) == "" {
+		return group, errors.New("modifier group name is missing")
+	}
+	if group.MinSelect < 0 || group.MaxSelect < 1 || group.MinSelect > group.MaxSelect {
+		return group, errors.New("min_select must be from 0 to max_select and max_select must be at least 1")
+	}
+	if len(group.Options) == 0 {
+		return group, errors.New("modifier group options field is missing")
+	}
+	if group.MinSelect > len(group.Options) {
+		return group, errors.New("min_select must not be greater than the number of options")
+	}
+	names := make(map[string]bool)
+	for _, option := range group.Options {
+		if option.ID != 0 && !allowOptionIDs {
+			return group, errors.New("modifier option id must be empty")
+		}
+		if option.ID < 0 || option.GroupID != 0 {
+			return group, errors.New("modifier option id is invalid or group_id is not empty")
+		}
+		if strings.TrimSpace(option.Name) == "" {
+			return group, errors.New("modifier option name is missing")
+		}
+		if names[option.Name] {
+			return group, errors.New("modifier option names must be unique within the group")
+		}
+		names[option.Name] = true
+		ingredients := make(map[int]bool)
+		for _, ingredient := range option.Ingredients {
+			if ingredient.ID != 0 || ingredient.OptionID != 0 {
+				return group, errors.New("modifier ingredient id and option_id must be empty")
+			}
+			if ingredient.InventoryID <= 0 {
+				return group, errors.New("modifier ingredient inventory id field is missing or invalid")
+			}
+			if ingredient.Quantity == 0 {
+				return group, errors.New("modifier ingredient quantity must not be 0")
+			}
+			if ingredient.StockQuantity != 0 {
+				return group, errors.New("modifier ingredient stock_quantity must be empty")
+			}
+			if ingredients[ingredient.InventoryID] {
+				return group, errors.New("modifier ingredient is listed more than once in one option")
+			}
+			ingredients[ingredient.InventoryID] = true
+		}
+	}
+	return group, nil
+}
+
+func (h *HandlerMenu) Get_Body_Variant(r *http.Request) (models.MenuVariant, error) {
+	var variant models.MenuVariant
+	if r.Body == nil {
+		return variant, errors.New("request body is empty")
+	}
+	if err := json.NewDecoder(r.Body).Decode(&variant); err != nil {
+		return variant, err
+	}
+	if variant.ID != 0 || variant.MenuItemID != 0 {
+		return variant, errors.New("variant id and menu_item_id must be empty")
+	}
+	if strings.TrimSpace(variant.Name) == "" {
+		return variant, errors.New("variant name is missing")
+	}
+	if variant.Price <= 0 {
+		return variant, errors.New("variant price must be greater than 0")
+	}
+	if len(variant.Ingredients) == 0 {
+		return variant, errors.New("variant ingredients field is missing")
+	}
+	ingredients := make(map[int]bool)
+	for _, ingredient := range variant.Ingredients {
+		if ingredient.ID != 0 || ingredient.VariantID != 0 {
+			return variant, errors.New("variant ingredient id and variant_id must be empty")
+		}
+		if ingredient.InventoryID <= 0 {
+			return variant, errors.New("variant ingredient inventory id field is missing or invalid")
+		}
+		if ingredient.Quantity <= 0 {
+			return variant, errors.New("variant ingredient quantity field is missing or invalid")
+		}
+		if ingredient.StockQuantity != 0 {
+			return variant, errors.New("variant ingredient stock_quantity field must be empty")
+		}
+		if ingredients[ingredient.InventoryID] {
+			return variant, errors.New("variant ingredient is listed more than once")
+		}
+		ingredients[ingredient.InventoryID] = true
+	}
+	return variant, nil
+}
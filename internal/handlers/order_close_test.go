@@ -0,0 +1,142 @@
+package handlers_test
+
+import (
+	"database/sql"
+	"fmt"
+	"frappuccino/internal/dal"
+	"frappuccino/internal/handlers"
+	"frappuccino/internal/service"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	_ "github.com/lib/pq"
+)
+
+// TestConcurrentOrderClose closes orders that compete for one ingredient at the same time, only the orders the stock
+// can serve are closed and the stock level, the movements ledger and the lots stay in line.
+// It runs against a database initialised with init.sql, given by FRAPPUCCINO_TEST_DSN, and leaves its rows behind
+func TestConcurrentOrderClose(t *testing.T) {
+	dsn := os.Getenv("FRAPPUCCINO_TEST_DSN")
+	if dsn == "" {
+		t.Skip("FRAPPUCCINO_TEST_DSN is not set")
+	}
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := db.Ping(); err != nil {
+		t.Fatal(err)
+	}
+
+	const (
+		orders     = 12
+		perOrder   = 2.0
+		startStock = 10.0
+	)
+	affordable := int(startStock / perOrder)
+	suffix := time.Now().Format("20060102150405.000000")
+
+	var inventoryID, menuItemID, customerID int
+	seed := func(query string, args ...any) int {
+		t.Helper()
+		var id int
+		if err := db.QueryRow(query, args...).Scan(&id); err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+	inventoryID = seed(`INSERT INTO inventory (name, stock_level, unit_type, reorder_level)
+	VALUES ($1, $2, 'pcs', 1) RETURNING inventory_id`, "Close test beans "+suffix, startStock)
+	seed(`INSERT INTO stock_movements (inventory_id, movement_type, quantity, balance_after, unit, reason, created_by)
+	VALUES ($1, 'purchase', $2, $2, 'pcs', 'close test stock', 'test') RETURNING movement_id`, inventoryID, startStock)
+	seed(`INSERT INTO inventory_lots (inventory_id, quantity, remaining)
+	VALUES ($1, $2, $2) RETURNING lot_id`, inventoryID, startStock)
+	menuItemID = seed(`INSERT INTO menu_items (name, description, price)
+	VALUES ($1, 'close test item', 3) RETURNING menu_item_id`, "Close test coffee "+suffix)
+	seed(`INSERT INTO menu_item_ingredients (inventory_id, menu_item_id, quantity, unit)
+	VALUES ($1, $2, $3, 'pcs') RETURNING id`, inventoryID, menuItemID, perOrder)
+	customerID = seed(`INSERT INTO customers (name, email)
+	VALUES ('Close test', $1) RETURNING customer_id`, "close-test-"+suffix+"@example.com")
+
+	// The orders hold no reservation, so all of them compete for the stock when they are closed
+	ids := make([]int, orders)
+	for i := range ids {
+		ids[i] = seed(`INSERT INTO orders (customer_id, total_amount, status)
+		VALUES ($1, 3, 'active') RETURNING order_id`, customerID)
+		seed(`INSERT INTO order_items (menu_item_id, order_id, price_at_order_time, quantity)
+		VALUES ($1, $2, 3, 1) RETURNING order_item_id`, menuItemID, ids[i])
+		seed(`INSERT INTO order_status_history (order_id, status) VALUES ($1, 'active') RETURNING id`, ids[i])
+	}
+
+	orderHandler := handlers.NewOrderHandler(service.NewDefaultOrderService(*dal.DefaultOrderRepo(db)))
+	mux := http.NewServeMux()
+	mux.HandleFunc("/orders/{id}/close", orderHandler.Order_Handle)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	codes := make([]int, orders)
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for i, id := range ids {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			response, err := http.Post(fmt.Sprintf("%s/orders/%d/close", server.URL, id), "application/json", nil)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			response.Body.Close()
+			codes[i] = response.StatusCode
+		}()
+	}
+	close(start)
+	wg.Wait()
+
+	closed, conflicts := 0, 0
+	for _, code := range codes {
+		switch code {
+		case http.StatusOK:
+			closed++
+		case http.StatusConflict:
+			conflicts++
+		default:
+			t.Errorf("unexpected status %d", code)
+		}
+	}
+	if closed != affordable || conflicts != orders-affordable {
+		t.Errorf("closed %d and rejected %d orders, want %d and %d", closed, conflicts, affordable, orders-affordable)
+	}
+
+	var stockLevel, ledger, lots float64
+	var closedOrders int
+	err = db.QueryRow(`SELECT i.stock_level,
+		(SELECT COALESCE(SUM(quantity), 0) FROM stock_movements WHERE inventory_id = i.inventory_id),
+		(SELECT COALESCE(SUM(remaining), 0) FROM inventory_lots WHERE inventory_id = i.inventory_id),
+		(SELECT COUNT(*) FROM orders WHERE order_id = ANY(SELECT order_id FROM order_items WHERE menu_item_id = $2) AND status = 'closed')
+	FROM inventory i
+	WHERE i.inventory_id = $1
+	`, inventoryID, menuItemID).Scan(&stockLevel, &ledger, &lots, &closedOrders)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := startStock - float64(closed)*perOrder; math.Abs(stockLevel-want) > 1e-9 {
+		t.Errorf("stock level is %v, want %v", stockLevel, want)
+	}
+	if closedOrders != closed {
+		t.Errorf("%d orders are closed, %d closes succeeded", closedOrders, closed)
+	}
+	if math.Abs(ledger-stockLevel) > 1e-9 {
+		t.Errorf("stock movements add up to %v, stock level is %v", ledger, stockLevel)
+	}
+	if math.Abs(lots-stockLevel) > 1e-9 {
+		t.Errorf("lots hold %v, stock level is %v", lots, stockLevel)
+	}
+}
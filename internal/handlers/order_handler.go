@@ -49,14 +49,13 @@ func (h *OrderHandler) Order_Handle(w http.ResponseWriter, r *http.Request) {
 			utils.Log_Err_Handler(err, http.StatusBadRequest, w)
 			return
 		}
-		code, err := h.service.Create_Order(order)
+		code, err := h.service.Create_Order(order, w)
 		if err != nil {
 			slog.Error("Failed to Handle Order", "Create Order function: ", err)
 			utils.Log_Err_Handler(err, code, w)
 			return
 		}
 		slog.Info("Order created succesfullly")
-		w.WriteHeader(http.StatusCreated)
 		return
 	case r.Method == http.MethodGet && len(splitted) == 1:
 		code, err := h.service.Retrieve_All_Orders(w)
@@ -88,6 +87,10 @@ func (h *OrderHandler) Order_Handle(w http.ResponseWriter, r *http.Request) {
 			utils.Log_Err_Handler(err, http.StatusBadRequest, w)
 			return
 		}
+		if order.Loyalty != nil {
+			utils.Log_Err_Handler(errors.New("loyalty points can only be redeemed when the order is created"), http.StatusBadRequest, w)
+			return
+		}
 		code, err := h.service.Update_Order(order, id)
 		if err != nil {
 			slog.Error("Failed to Handle Order", "Update Order function: ", err)
@@ -96,6 +99,21 @@ func (h *OrderHandler) Order_Handle(w http.ResponseWriter, r *http.Request) {
 		}
 		slog.Info("Order updated succesfully")
 		return
+	case r.Method == http.MethodPatch && len(splitted) == 2:
+		patch, err := h.Get_Body_Patch(r)
+		if err != nil {
+			slog.Error("Failed to Handle Order", "Get Body Patch function: ", err)
+			utils.Log_Err_Handler(err, http.StatusBadRequest, w)
+			return
+		}
+		code, err := h.service.Patch_Order(id, patch, w)
+		if err != nil {
+			slog.Error("Failed to Handle Order", "Patch Order function: ", err)
+			utils.Log_Err_Handler(err, code, w)
+			return
+		}
+		slog.Info("Order patched succesfully")
+		return
 	case r.Method == http.MethodDelete && len(splitted) == 2:
 		code, err := h.service.Delete_Order(id)
 		if err != nil {
@@ -106,7 +124,61 @@ func (h *OrderHandler) Order_Handle(w http.ResponseWriter, r *http.Request) {
 		slog.Info("Order deleted succesfully")
 		w.WriteHeader(code)
 		return
-	case r.Method == http.MethodPost && len(splitted) == 3:
+	case r.Method == http.MethodPost && len(splitted) == 3 && splitted[2] == "status":
+		statusChange, err := h.Get_Body_Status(r)
+		if err != nil {
+			slog.Error("Failed to Handle Order", "Get Body Status function: ", err)
+			utils.Log_Err_Handler(err, http.StatusBadRequest, w)
+			return
+		}
+		code, err := h.service.Change_Order_Status(id, statusChange, w)
+		if err != nil {
+			slog.Error("Failed to Handle Order", "Change Order Status function: ", err)
+			utils.Log_Err_Handler(err, code, w)
+			return
+		}
+		slog.Info("Order status changed succesfully")
+		return
+	case r.Method == http.MethodPost && len(splitted) == 3 && splitted[2] == "cancel":
+		cancel, err := h.Get_Body_Reason(r)
+		if err != nil {
+			slog.Error("Failed to Handle Order", "Get Body Reason function: ", err)
+			utils.Log_Err_Handler(err, http.StatusBadRequest, w)
+			return
+		}
+		code, err := h.service.Cancel_Order(id, cancel.Reason, w)
+		if err != nil {
+			slog.Error("Failed to Handle Order", "Cancel Order function: ", err)
+			utils.Log_Err_Handler(err, code, w)
+			return
+		}
+		slog.Info("Order cancelled succesfully")
+		return
+	case r.Method == http.MethodPost && len(splitted) == 3 && splitted[2] == "refund":
+		refund, err := h.Get_Body_Refund(r)
+		if err != nil {
+			slog.Error("Failed to Handle Order", "Get Body Refund function: ", err)
+			utils.Log_Err_Handler(err, http.StatusBadRequest, w)
+			return
+		}
+		code, err := h.service.Refund_Order(id, refund, w)
+		if err != nil {
+			slog.Error("Failed to Handle Order", "Refund Order function: ", err)
+			utils.Log_Err_Handler(err, code, w)
+			return
+		}
+		slog.Info("Order refunded succesfully")
+		return
+	case r.Method == http.MethodGet && len(splitted) == 3 && splitted[2] == "refunds":
+		code, err := h.service.Retrieve_Refunds(w, id)
+		if err != nil {
+			slog.Error("Failed to Handle Order", "Retrieve Refunds function: ", err)
+			utils.Log_Err_Handler(err, code, w)
+			return
+		}
+		slog.Info("Order refunds retrieved succesfully")
+		return
+	case r.Method == http.MethodPost && len(splitted) == 3 && splitted[2] == "close":
 		code, err := h.service.Close_Order(id, w)
 		if err != nil {
 			slog.Error("Failed to Handle Order", "Close Order function: ", err)
@@ -154,14 +226,32 @@ func (h *OrderHandler) Get_Body_Order(r *http.Request) (models.Order, error) {
 		return order, errors.New("CreatedAt field must be empty")
 	}
 
-	if order.Status != "" {
-		return order, errors.New("status must be empty")
+	if order.Status != "" && order.Status != models.StatusPending && order.Status != models.StatusActive {
+		return order, errors.New("status must be empty, pending or active")
 	}
 
 	if len(order.Items) == 0 {
 		return order, errors.New("order must contain at least one item")
 	}
 
+	if len(order.Discounts) != 0 {
+		return order, errors.New("discounts must be empty")
+	}
+
+	order.PromoCode = strings.TrimSpace(order.PromoCode)
+	if len(order.PromoCode) > 50 {
+		return order, errors.New("promo_code is too long")
+	}
+
+	if order.Loyalty != nil {
+		if order.Loyalty.Points < 0 || order.Loyalty.RewardID < 0 {
+			return order, errors.New("loyalty points and reward_id cannot be negative")
+		}
+		if order.Loyalty.Points == 0 && order.Loyalty.RewardID == 0 {
+			return order, errors.New("loyalty must have points or reward_id")
+		}
+	}
+
 	for _, item := range order.Items {
 		if item.MenuItemID <= 0 {
 			return order, errors.New("menu_item_id is missing or invalid in one of the items")
@@ -175,6 +265,141 @@ func (h *OrderHandler) Get_Body_Order(r *http.Request) (models.Order, error) {
 		if item.PriceAtOrderTime != 0 {
 			return order, errors.New("price_at_order_time must be empty")
 		}
+		if err := checkBodyItemOptions(item); err != nil {
+			return order, err
+		}
 	}
 	return order, nil
 }
+
+// checkBodyItemOptions checks that the order item only references its variant and modifier options,
+// the rest is filled from the menu
+func checkBodyItemOptions(item models.OrderItem) error {
+	if item.VariantID < 0 {
+		return errors.New("variant_id is invalid in one of the items")
+	}
+	if item.VariantName != "" {
+		return errors.New("variant_name must be empty")
+	}
+	for _, modifier := range item.Modifiers {
+		if modifier.OptionID <= 0 {
+			return errors.New("option_id is missing or invalid in one of the modifiers")
+		}
+		if modifier.ID != 0 || modifier.GroupName != "" || modifier.OptionName != "" || modifier.PriceDelta != 0 {
+			return errors.New("only option_id must be set in modifiers")
+		}
+	}
+	return nil
+}
+
+func (h *OrderHandler) Get_Body_Status(r *http.Request) (models.OrderStatusChange, error) {
+	var statusChange models.OrderStatusChange
+	if r.Body == nil {
+		return statusChange, errors.New("request body is empty")
+	}
+	if err := json.NewDecoder(r.Body).Decode(&statusChange); err != nil {
+		return statusChange, err
+	}
+	if statusChange.Status == "" {
+		return statusChange, errors.New("status is missing")
+	}
+	return statusChange, nil
+}
+
+func (h *OrderHandler) Get_Body_Reason(r *http.Request) (models.OrderStatusChange, error) {
+	var change models.OrderStatusChange
+	if r.Body == nil {
+		return change, errors.New("request body is empty")
+	}
+	if err := json.NewDecoder(r.Body).Decode(&change); err != nil {
+		return change, err
+	}
+	if change.Status != "" {
+		return change, errors.New("status must be empty")
+	}
+	if strings.TrimSpace(change.Reason) == "" {
+		return change, errors.New("reason is missing")
+	}
+	return change, nil
+}
+
+func (h *OrderHandler) Get_Body_Refund(r *http.Request) (models.OrderRefund, error) {
+	var refund models.OrderRefund
+	if r.Body == nil {
+		return refund, errors.New("request body is empty")
+	}
+	if err := json.NewDecoder(r.Body).Decode(&refund); err != nil {
+		return refund, err
+	}
+	if refund.ID != 0 || refund.OrderID != 0 {
+		return refund, errors.New("refund id and order_id must be empty")
+	}
+	if strings.TrimSpace(refund.Reason) == "" {
+		return refund, errors.New("reason is missing")
+	}
+	if refund.Amount != 0 {
+		return refund, errors.New("amount must be empty")
+	}
+	if !refund.CreatedAt.IsZero() {
+		return refund, errors.New("created_at must be empty")
+	}
+	for _, item := range refund.Items {
+		if item.ID != 0 {
+			return refund, errors.New("refund item id must be empty")
+		}
+		if item.OrderItemID <= 0 {
+			return refund, errors.New("order_item_id is missing or invalid in one of the items")
+		}
+		if item.Quantity <= 0 {
+			return refund, errors.New("quantity must be greater than 0 in one of the items")
+		}
+		if item.Amount != 0 {
+			return refund, errors.New("amount must be empty in one of the items")
+		}
+	}
+	return refund, nil
+}
+
+func (h *OrderHandler) Get_Body_Patch(r *http.Request) (models.OrderPatch, error) {
+	var patch models.OrderPatch
+	if r.Body == nil {
+		return patch, errors.New("request body is empty")
+	}
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		return patch, err
+	}
+	if len(patch.AddItems) == 0 && len(patch.UpdateItems) == 0 && len(patch.RemoveItems) == 0 && patch.SpecialInstructions == nil {
+		return patch, errors.New("nothing to change in the order")
+	}
+	for _, item := range patch.AddItems {
+		if item.ID != 0 || item.OrderID != 0 {
+			return patch, errors.New("id and order_id must be empty in added items")
+		}
+		if item.MenuItemID <= 0 {
+			return patch, errors.New("menu_item_id is missing or invalid in one of the added items")
+		}
+		if item.Quantity <= 0 {
+			return patch, errors.New("quantity must be greater than 0 in one of the added items")
+		}
+		if item.PriceAtOrderTime != 0 {
+			return patch, errors.New("price_at_order_time must be empty")
+		}
+		if err := checkBodyItemOptions(item); err != nil {
+			return patch, err
+		}
+	}
+	for _, item := range patch.UpdateItems {
+		if item.ID <= 0 {
+			return patch, errors.New("id is missing or invalid in one of the updated items")
+		}
+		if item.Quantity <= 0 {
+			return patch, errors.New("quantity must be greater than 0 in one of the updated items, use remove_items to remove it")
+		}
+	}
+	for _, orderItemID := range patch.RemoveItems {
+		if orderItemID <= 0 {
+			return patch, errors.New("invalid order item id in remove_items")
+		}
+	}
+	return patch, nil
+}
@@ -0,0 +1,216 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"frappuccino/internal/service"
+	"frappuccino/internal/utils"
+	"frappuccino/models"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type PromotionHandler struct {
+	service service.PromotionService
+}
+
+func NewPromotionHandle(service service.PromotionService) *PromotionHandler {
+	return &PromotionHandler{service: service}
+}
+
+var promotionEffects = []string{models.PromotionPercentOff, models.PromotionAmountOff, models.PromotionFreeItem, models.PromotionBundlePrice}
+
+// Promotion_Handle manages the promotions applied when orders are priced
+func (h *PromotionHandler) Promotion_Handle(w http.ResponseWriter, r *http.Request) {
+	splitted := strings.Split(r.URL.Path[1:], "/")
+	if len(splitted) < 1 {
+		utils.Log_Err_Handler(errors.New("error URL adress"), http.StatusBadRequest, w)
+		return
+	}
+	var id int
+	if len(splitted) == 2 {
+		num, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil {
+			slog.Error("Failed to Handle Promotions", "Convertation error: ", err)
+			utils.Log_Err_Handler(err, http.StatusBadRequest, w)
+			return
+		}
+		id = num
+	}
+	switch {
+	case r.Method == http.MethodGet && len(splitted) == 1:
+		code, err := h.service.Retrieve_All_Promotions(w)
+		if err != nil {
+			slog.Error("Failed to Handle Promotions", "Retrieve All Promotions function: ", err)
+			utils.Log_Err_Handler(err, code, w)
+			return
+		}
+		slog.Info("All promotions retrieved succesfully")
+		return
+	case r.Method == http.MethodPost && len(splitted) == 1:
+		promotion, err := h.Get_Body_Promotion(r)
+		if err != nil {
+			slog.Error("Failed to Handle Promotions", "Get Body Promotion function: ", err)
+			utils.Log_Err_Handler(err, http.StatusBadRequest, w)
+			return
+		}
+		code, err := h.service.Add_Promotion(promotion, w)
+		if err != nil {
+			slog.Error("Failed to Handle Promotions", "Add Promotion function: ", err)
+			utils.Log_Err_Handler(err, code, w)
+			return
+		}
+		slog.Info("Promotion added succesfully")
+		return
+	case r.Method == http.MethodGet && len(splitted) == 2:
+		code, err := h.service.Retrieve_Promotion(w, id)
+		if err != nil {
+			slog.Error("Failed to Handle Promotions", "Retrieve Promotion function: ", err)
+			utils.Log_Err_Handler(err, code, w)
+			return
+		}
+		slog.Info("Promotion retrieved succesfully")
+		return
+	case r.Method == http.MethodPut && len(splitted) == 2:
+		promotion, err := h.Get_Body_Promotion(r)
+		if err != nil {
+			slog.Error("Failed to Handle Promotions", "Get Body Promotion function: ", err)
+			utils.Log_Err_Handler(err, http.StatusBadRequest, w)
+			return
+		}
+		code, err := h.service.Update_Promotion(promotion, id)
+		if err != nil {
+			slog.Error("Failed to Handle Promotions", "Update Promotion function: ", err)
+			utils.Log_Err_Handler(err, code, w)
+			return
+		}
+		slog.Info("Promotion updated succesfully")
+		return
+	case r.Method == http.MethodDelete && len(splitted) == 2:
+		code, err := h.service.Delete_Promotion(id)
+		if err != nil {
+			slog.Error("Failed to Handle Promotions", "Delete Promotion function: ", err)
+			utils.Log_Err_Handler(err, code, w)
+			return
+		}
+		slog.Info("Promotion deleted succesfully")
+		w.WriteHeader(code)
+		return
+	default:
+		utils.Log_Err_Handler(errors.New("error method in promotions"), http.StatusMethodNotAllowed, w)
+		return
+	}
+}
+
+// Get_Body_Promotion reads a promotion, a promotion is active unless active is false
+func (h *PromotionHandler) Get_Body_Promotion(r *http.Request) (models.Promotion, error) {
+	promotion := models.Promotion{Active: true}
+	if r.Body == nil {
+		return promotion, errors.New("request body is empty")
+	}
+	if err := json.NewDecoder(r.Body).Decode(&promotion); err != nil {
+		return promotion, err
+	}
+	if promotion.ID != 0 {
+		return promotion, errors.New("promotion id field must be empty")
+	}
+	if !promotion.CreatedAt.IsZero() {
+		return promotion, errors.New("created_at field must be empty")
+	}
+	promotion.Name = strings.TrimSpace(promotion.Name)
+	if promotion.Name == "" {
+		return promotion, errors.New("name field is missing")
+	}
+	promotion.Code = strings.TrimSpace(promotion.Code)
+	if len(promotion.Code) > 50 {
+		return promotion, errors.New("code field is too long")
+	}
+	if !slices.Contains(promotionEffects, promotion.Effect) {
+		return promotion, errors.New("effect must be one of " + strings.Join(promotionEffects, ", "))
+	}
+	switch promotion.Effect {
+	case models.PromotionPercentOff:
+		if promotion.Value <= 0 || promotion.Value > 100 {
+			return promotion, errors.New("value of a percent off must be greater than 0 and at most 100")
+		}
+	case models.PromotionAmountOff:
+		if promotion.Value <= 0 {
+			return promotion, errors.New("value of an amount off must be greater than 0")
+		}
+	case models.PromotionFreeItem:
+		if promotion.Value != 0 {
+			return promotion, errors.New("value must be empty for a free item")
+		}
+		if promotion.BuyQuantity <= 0 || promotion.FreeQuantity <= 0 {
+			return promotion, errors.New("buy_quantity and free_quantity of a free item must be greater than 0")
+		}
+	case models.PromotionBundlePrice:
+		if promotion.Value <= 0 {
+			return promotion, errors.New("value of a bundle price must be greater than 0")
+		}
+		if promotion.BuyQuantity < 2 {
+			return promotion, errors.New("buy_quantity of a bundle must be at least 2")
+		}
+	}
+	if promotion.Effect != models.PromotionFreeItem && promotion.FreeQuantity != 0 {
+		return promotion, errors.New("free_quantity is only used by a free item")
+	}
+	if promotion.Effect != models.PromotionFreeItem && promotion.Effect != models.PromotionBundlePrice && promotion.BuyQuantity != 0 {
+		return promotion, errors.New("buy_quantity is only used by a free item or a bundle")
+	}
+	if promotion.MenuItemIDs == nil {
+		promotion.MenuItemIDs = []int{}
+	}
+	for _, menuItemID := range promotion.MenuItemIDs {
+		if menuItemID <= 0 {
+			return promotion, errors.New("menu_item_ids must be greater than 0")
+		}
+	}
+	tags := []string{}
+	for _, tag := range promotion.Tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" {
+			return promotion, errors.New("tags cannot be empty")
+		}
+		tags = append(tags, tag)
+	}
+	promotion.Tags = tags
+	if promotion.CustomerID < 0 {
+		return promotion, errors.New("customer_id cannot be negative")
+	}
+	if promotion.MinSpend < 0 {
+		return promotion, errors.New("min_spend cannot be negative")
+	}
+	if promotion.DaysOfWeek == nil {
+		promotion.DaysOfWeek = []int{}
+	}
+	for _, day := range promotion.DaysOfWeek {
+		if day < 1 || day > 7 {
+			return promotion, errors.New("days_of_week must be from 1 (Monday) to 7 (Sunday)")
+		}
+	}
+	if (promotion.StartTime == "") != (promotion.EndTime == "") {
+		return promotion, errors.New("start_time and end_time must be given together")
+	}
+	if promotion.StartTime != "" {
+		start, err := time.Parse("15:04", promotion.StartTime)
+		if err != nil {
+			return promotion, errors.New("start_time must be in HH:MM format")
+		}
+		end, err := time.Parse("15:04", promotion.EndTime)
+		if err != nil {
+			return promotion, errors.New("end_time must be in HH:MM format")
+		}
+		if start.Equal(end) {
+			return promotion, errors.New("start_time and end_time cannot be the same")
+		}
+	}
+	if promotion.StartsAt != nil && promotion.EndsAt != nil && !promotion.EndsAt.After(*promotion.StartsAt) {
+		return promotion, errors.New("ends_at must be after starts_at")
+	}
+	return promotion, nil
+}
@@ -0,0 +1,229 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"frappuccino/internal/service"
+	"frappuccino/internal/utils"
+	"frappuccino/models"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type PurchaseOrderHandler struct {
+	service service.PurchaseOrderService
+}
+
+func NewPurchaseOrderHandle(service service.PurchaseOrderService) *PurchaseOrderHandler {
+	return &PurchaseOrderHandler{service: service}
+}
+
+var purchaseOrderStatuses = []string{
+	models.POStatusDraft, models.POStatusSent, models.POStatusPartiallyReceived, models.POStatusReceived, models.POStatusCancelled,
+}
+
+// PurchaseOrder_Handle manages purchase orders to suppliers, the user creating or receiving an order comes from the X-User header
+func (h *PurchaseOrderHandler) PurchaseOrder_Handle(w http.ResponseWriter, r *http.Request) {
+	splitted := strings.Split(r.URL.Path[1:], "/")
+	if len(splitted) < 1 {
+		utils.Log_Err_Handler(errors.New("error URL adress"), http.StatusBadRequest, w)
+		return
+	}
+	var id int
+	if len(splitted) >= 2 {
+		num, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil {
+			slog.Error("Failed to Handle Purchase Orders", "Convertation error: ", err)
+			utils.Log_Err_Handler(err, http.StatusBadRequest, w)
+			return
+		}
+		id = num
+	}
+	switch {
+	case r.Method == http.MethodGet && len(splitted) == 1:
+		status := r.URL.Query().Get("status")
+		if status != "" && !slices.Contains(purchaseOrderStatuses, status) {
+			utils.Log_Err_Handler(errors.New("status must be one of "+strings.Join(purchaseOrderStatuses, ", ")), http.StatusBadRequest, w)
+			return
+		}
+		var supplierID int
+		if value := r.URL.Query().Get("supplier_id"); value != "" {
+			num, err := strconv.Atoi(value)
+			if err != nil || num <= 0 {
+				utils.Log_Err_Handler(errors.New("supplier_id must be a positive number"), http.StatusBadRequest, w)
+				return
+			}
+			supplierID = num
+		}
+		code, err := h.service.Retrieve_All_Purchase_Orders(w, status, supplierID)
+		if err != nil {
+			slog.Error("Failed to Handle Purchase Orders", "Retrieve All Purchase Orders function: ", err)
+			utils.Log_Err_Handler(err, code, w)
+			return
+		}
+		slog.Info("All purchase orders retrieved succesfully")
+		return
+	case r.Method == http.MethodPost && len(splitted) == 1:
+		order, err := h.Get_Body_Purchase_Order(r, true)
+		if err != nil {
+			slog.Error("Failed to Handle Purchase Orders", "Get Body Purchase Order function: ", err)
+			utils.Log_Err_Handler(err, http.StatusBadRequest, w)
+			return
+		}
+		code, err := h.service.Add_Purchase_Order(order, r.Header.Get("X-User"), w)
+		if err != nil {
+			slog.Error("Failed to Handle Purchase Orders", "Add Purchase Order function: ", err)
+			utils.Log_Err_Handler(err, code, w)
+			return
+		}
+		slog.Info("Purchase order added succesfully")
+		return
+	case r.Method == http.MethodGet && len(splitted) == 2:
+		code, err := h.service.Retrieve_Purchase_Order(w, id)
+		if err != nil {
+			slog.Error("Failed to Handle Purchase Orders", "Retrieve Purchase Order function: ", err)
+			utils.Log_Err_Handler(err, code, w)
+			return
+		}
+		slog.Info("Purchase order retrieved succesfully")
+		return
+	case r.Method == http.MethodPut && len(splitted) == 2:
+		order, err := h.Get_Body_Purchase_Order(r, false)
+		if err != nil {
+			slog.Error("Failed to Handle Purchase Orders", "Get Body Purchase Order function: ", err)
+			utils.Log_Err_Handler(err, http.StatusBadRequest, w)
+			return
+		}
+		code, err := h.service.Update_Purchase_Order(order, id, w)
+		if err != nil {
+			slog.Error("Failed to Handle Purchase Orders", "Update Purchase Order function: ", err)
+			utils.Log_Err_Handler(err, code, w)
+			return
+		}
+		slog.Info("Purchase order updated succesfully")
+		return
+	case r.Method == http.MethodPost && len(splitted) == 3 && splitted[2] == "send":
+		code, err := h.service.Send_Purchase_Order(id, w)
+		if err != nil {
+			slog.Error("Failed to Handle Purchase Orders", "Send Purchase Order function: ", err)
+			utils.Log_Err_Handler(err, code, w)
+			return
+		}
+		slog.Info("Purchase order sent succesfully")
+		return
+	case r.Method == http.MethodPost && len(splitted) == 3 && splitted[2] == "cancel":
+		code, err := h.service.Cancel_Purchase_Order(id, w)
+		if err != nil {
+			slog.Error("Failed to Handle Purchase Orders", "Cancel Purchase Order function: ", err)
+			utils.Log_Err_Handler(err, code, w)
+			return
+		}
+		slog.Info("Purchase order cancelled succesfully")
+		return
+	case r.Method == http.MethodPost && len(splitted) == 3 && splitted[2] == "receive":
+		receive, err := h.Get_Body_Receive(r)
+		if err != nil {
+			slog.Error("Failed to Handle Purchase Orders", "Get Body Receive function: ", err)
+			utils.Log_Err_Handler(err, http.StatusBadRequest, w)
+			return
+		}
+		code, err := h.service.Receive_Purchase_Order(id, receive, r.Header.Get("X-User"), w)
+		if err != nil {
+			slog.Error("Failed to Handle Purchase Orders", "Receive Purchase Order function: ", err)
+			utils.Log_Err_Handler(err, code, w)
+			return
+		}
+		slog.Info("Purchase order received succesfully")
+		return
+	default:
+		utils.Log_Err_Handler(errors.New("error method in purchase orders"), http.StatusMethodNotAllowed, w)
+		return
+	}
+}
+
+// Get_Body_Purchase_Order reads a draft purchase order, lines only give the item and the packs ordered,
+// the pack and its price come from the supplier. The supplier is given when the order is created and can not change
+func (h *PurchaseOrderHandler) Get_Body_Purchase_Order(r *http.Request, create bool) (models.PurchaseOrder, error) {
+	var order models.PurchaseOrder
+	if r.Body == nil {
+		return order, errors.New("request body is empty")
+	}
+	if err := json.NewDecoder(r.Body).Decode(&order); err != nil {
+		return order, err
+	}
+	if order.ID != 0 {
+		return order, errors.New("purchase order id field must be empty")
+	}
+	if create && order.SupplierID <= 0 {
+		return order, errors.New("supplier_id field is missing or invalid")
+	}
+	if !create && order.SupplierID != 0 {
+		return order, errors.New("supplier_id can not be changed, create a new purchase order instead")
+	}
+	if order.Status != "" || order.CreatedBy != "" || !order.CreatedAt.IsZero() || order.SentAt != nil || order.ReceivedAt != nil {
+		return order, errors.New("status, created_by, created_at, sent_at and received_at fields must be empty")
+	}
+	if order.ExpectedDate != "" {
+		if _, err := time.Parse("2006-01-02", order.ExpectedDate); err != nil {
+			return order, errors.New("expected_date must be in YYYY-MM-DD format")
+		}
+	}
+	if len(order.Lines) == 0 {
+		return order, errors.New("purchase order lines are missing")
+	}
+	ordered := make(map[int]bool)
+	for _, line := range order.Lines {
+		if line.ID != 0 || line.PacksReceived != 0 || line.PackSize != 0 || line.PackUnit != "" || line.PackPrice != 0 {
+			return order, errors.New("line id, packs_received, pack_size, pack_unit and pack_price must be empty")
+		}
+		if line.InventoryID <= 0 {
+			return order, errors.New("line inventory_id is missing or invalid")
+		}
+		if line.PacksOrdered <= 0 {
+			return order, errors.New("line packs_ordered cannot be negative or empty")
+		}
+		if ordered[line.InventoryID] {
+			return order, errors.New("inventory item is listed more than once")
+		}
+		ordered[line.InventoryID] = true
+	}
+	order.Note = strings.TrimSpace(order.Note)
+	return order, nil
+}
+
+// Get_Body_Receive reads a delivery, every line can be listed once. A delivery may have no lines when it only closes the order
+func (h *PurchaseOrderHandler) Get_Body_Receive(r *http.Request) (models.ReceiveRequest, error) {
+	var receive models.ReceiveRequest
+	if r.Body == nil {
+		return receive, errors.New("request body is empty")
+	}
+	if err := json.NewDecoder(r.Body).Decode(&receive); err != nil {
+		return receive, err
+	}
+	if len(receive.Lines) == 0 && !receive.Complete {
+		return receive, errors.New("received lines are missing")
+	}
+	received := make(map[int]bool)
+	for _, line := range receive.Lines {
+		if line.LineID <= 0 {
+			return receive, errors.New("line_id is missing or invalid")
+		}
+		if line.Packs <= 0 {
+			return receive, errors.New("received packs cannot be negative or empty")
+		}
+		if line.ExpiryDate != "" {
+			if _, err := time.Parse("2006-01-02", line.ExpiryDate); err != nil {
+				return receive, errors.New("line expiry_date must be in YYYY-MM-DD format")
+			}
+		}
+		if received[line.LineID] {
+			return receive, errors.New("purchase order line is listed more than once")
+		}
+		received[line.LineID] = true
+	}
+	return receive, nil
+}
@@ -36,7 +36,7 @@ func (h *ReportHandler) Report_handler(w http.ResponseWriter, r *http.Request) {
 		slog.Info("Total sales received succesfully")
 		return
 	case splitted[1] == "popular-items":
-		code, err := h.service.Popular_Menu_Items(w)
+		code, err := h.service.Popular_Menu_Items(w, r.URL.Query().Get("groupBy"))
 		if err != nil {
 			slog.Error("Failed to Handle Popular Items Report", "Popular Menu Items function: ", err)
 			utils.Log_Err_Handler(err, code, w)
@@ -54,9 +54,9 @@ func (h *ReportHandler) Report_handler(w http.ResponseWriter, r *http.Request) {
 			currentTime := time.Now()
 			endDate = currentTime.Format("2006-01-02")
 		}
-		code, err := h.service.GetOrderedItems(w, startDate, endDate)
+		code, err := h.service.GetOrderedItems(w, startDate, endDate, r.URL.Query().Get("groupBy"))
 		if err != nil {
-			slog.Error("Failed to Handle Number of Ordered Items Report", err)
+			slog.Error("Failed to Handle Number of Ordered Items Report", "error", err)
 			utils.Log_Err_Handler(err, code, w)
 			return
 		}
@@ -66,7 +66,7 @@ func (h *ReportHandler) Report_handler(w http.ResponseWriter, r *http.Request) {
 		var q string
 		q = r.URL.Query().Get("q")
 		if q == "" {
-			slog.Error("Failed to Handle Full Text Search Report", errors.New("the required q key is missing "))
+			slog.Error("Failed to Handle Full Text Search Report", "error", errors.New("the required q key is missing "))
 			utils.Log_Err_Handler(errors.New("the required q key is missing "), http.StatusBadRequest, w)
 			return
 		}
@@ -75,7 +75,7 @@ func (h *ReportHandler) Report_handler(w http.ResponseWriter, r *http.Request) {
 		maxPrice := r.URL.Query().Get("maxPrice")
 		code, err := h.service.FullSearchReport(w, q, filter, minPrice, maxPrice)
 		if err != nil {
-			slog.Error("Failed to Handle Full Text Search Report", err)
+			slog.Error("Failed to Handle Full Text Search Report", "error", err)
 			utils.Log_Err_Handler(err, code, w)
 			return
 		}
@@ -95,13 +95,13 @@ func (h *ReportHandler) Report_handler(w http.ResponseWriter, r *http.Request) {
 				year = "2024"
 			}
 		default:
-			slog.Error("Failed to Handle Ordered Items Period", errors.New("period parameter is empty or invalid"))
+			slog.Error("Failed to Handle Ordered Items Period", "error", errors.New("period parameter is empty or invalid"))
 			utils.Log_Err_Handler(errors.New("period parameter is empty or invalid"), http.StatusBadRequest, w)
 			return
 		}
 		code, err := h.service.OrderedItemsPeriod(w, period, month, year)
 		if err != nil {
-			slog.Error("Failed to Handle Ordered Items Period", err)
+			slog.Error("Failed to Handle Ordered Items Period", "error", err)
 			utils.Log_Err_Handler(err, code, w)
 			return
 		}
@@ -116,7 +116,7 @@ func (h *ReportHandler) Report_handler(w http.ResponseWriter, r *http.Request) {
 			var err error
 			page, err = strconv.Atoi(pageStr)
 			if err != nil || page <= 0 {
-				slog.Error("Failed to Handle LeftOvers report", errors.New("invalid page number"))
+				slog.Error("Failed to Handle LeftOvers report", "error", errors.New("invalid page number"))
 				utils.Log_Err_Handler(errors.New("invalid page number"), http.StatusBadRequest, w)
 				return
 			}
@@ -129,7 +129,7 @@ func (h *ReportHandler) Report_handler(w http.ResponseWriter, r *http.Request) {
 			var err error
 			pageSize, err = strconv.Atoi(pageSizeStr)
 			if err != nil || pageSize <= 0 {
-				slog.Error("Failed to Handle LeftOvers report", errors.New("invalid page size"))
+				slog.Error("Failed to Handle LeftOvers report", "error", errors.New("invalid page size"))
 				utils.Log_Err_Handler(errors.New("invalid page size"), http.StatusBadRequest, w)
 				return
 			}
@@ -143,11 +143,97 @@ func (h *ReportHandler) Report_handler(w http.ResponseWriter, r *http.Request) {
 		}
 		code, err := h.service.GetLeftOvers(w, sortBy, page, pageSize)
 		if err != nil {
-			slog.Error("Failed to Handle Report", err)
+			slog.Error("Failed to Handle Report", "error", err)
 			utils.Log_Err_Handler(err, code, w)
 			return
 		}
 		slog.Info("Leftovers retrieved successfully")
 		return
+	case splitted[1] == "margins":
+		startDate := r.URL.Query().Get("startDate")
+		endDate := r.URL.Query().Get("endDate")
+		if startDate == "" {
+			startDate = "1991-12-16"
+		}
+		if endDate == "" {
+			endDate = time.Now().Format("2006-01-02")
+		}
+		code, err := h.service.Margins(w, r.URL.Query().Get("method"), startDate, endDate)
+		if err != nil {
+			slog.Error("Failed to Handle Margins Report", "Margins function: ", err)
+			utils.Log_Err_Handler(err, code, w)
+			return
+		}
+		slog.Info("Margins report retrieved succesfully")
+		return
+	case splitted[1] == "waste":
+		startDate := r.URL.Query().Get("startDate")
+		endDate := r.URL.Query().Get("endDate")
+		if startDate == "" {
+			startDate = "1991-12-16"
+		}
+		if endDate == "" {
+			endDate = time.Now().Format("2006-01-02")
+		}
+		for _, date := range []string{startDate, endDate} {
+			if _, err := time.Parse("2006-01-02", date); err != nil {
+				slog.Error("Failed to Handle Waste Report", "date error", err)
+				utils.Log_Err_Handler(errors.New("startDate and endDate must be dates in YYYY-MM-DD"), http.StatusBadRequest, w)
+				return
+			}
+		}
+		code, err := h.service.Waste(w, startDate, endDate)
+		if err != nil {
+			slog.Error("Failed to Handle Waste Report", "Waste function: ", err)
+			utils.Log_Err_Handler(err, code, w)
+			return
+		}
+		slog.Info("Waste report retrieved succesfully")
+		return
+	case splitted[1] == "inventory-valuation":
+		asOf := r.URL.Query().Get("as_of")
+		if asOf != "" {
+			if _, err := time.Parse("2006-01-02", asOf); err != nil {
+				slog.Error("Failed to Handle Inventory Valuation Report", "date error", err)
+				utils.Log_Err_Handler(errors.New("as_of must be a date in YYYY-MM-DD"), http.StatusBadRequest, w)
+				return
+			}
+		}
+		code, err := h.service.Inventory_Valuation(w, r.URL.Query().Get("method"), asOf, r.URL.Query().Get("groupBy"))
+		if err != nil {
+			slog.Error("Failed to Handle Inventory Valuation Report", "Inventory Valuation function: ", err)
+			utils.Log_Err_Handler(err, code, w)
+			return
+		}
+		slog.Info("Inventory valuation report retrieved succesfully")
+		return
+	case splitted[1] == "forecast":
+		days, history := 14, 56
+		if value := r.URL.Query().Get("days"); value != "" {
+			num, err := strconv.Atoi(value)
+			if err != nil || num < 1 || num > 90 {
+				slog.Error("Failed to Handle Forecast Report", "error", errors.New("invalid days"))
+				utils.Log_Err_Handler(errors.New("days must be a number from 1 to 90"), http.StatusBadRequest, w)
+				return
+			}
+			days = num
+		}
+		if value := r.URL.Query().Get("history"); value != "" {
+			num, err := strconv.Atoi(value)
+			if err != nil || num < 14 || num > 365 {
+				slog.Error("Failed to Handle Forecast Report", "error", errors.New("invalid history"))
+				utils.Log_Err_Handler(errors.New("history must be a number of days from 14 to 365"), http.StatusBadRequest, w)
+				return
+			}
+			history = num
+		}
+		code, err := h.service.Forecast(w, days, history)
+		if err != nil {
+			slog.Error("Failed to Handle Forecast Report", "Forecast function: ", err)
+			utils.Log_Err_Handler(err, code, w)
+			return
+		}
+		slog.Info("Forecast report retrieved succesfully")
+		return
 	}
 }
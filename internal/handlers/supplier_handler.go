@@ -0,0 +1,202 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"frappuccino/internal/service"
+	"frappuccino/internal/utils"
+	"frappuccino/models"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type SupplierHandler struct {
+	service service.SupplierService
+}
+
+func NewSupplierHandle(service service.SupplierService) *SupplierHandler {
+	return &SupplierHandler{service: service}
+}
+
+// Supplier_Handle manages suppliers and the items they sell
+func (h *SupplierHandler) Supplier_Handle(w http.ResponseWriter, r *http.Request) {
+	splitted := strings.Split(r.URL.Path[1:], "/")
+	if len(splitted) < 1 {
+		utils.Log_Err_Handler(errors.New("error URL adress"), http.StatusBadRequest, w)
+		return
+	}
+	var id, inventoryID int
+	if len(splitted) >= 2 {
+		num, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil {
+			slog.Error("Failed to Handle Suppliers", "Convertation error: ", err)
+			utils.Log_Err_Handler(err, http.StatusBadRequest, w)
+			return
+		}
+		id = num
+	}
+	if len(splitted) == 4 {
+		num, err := strconv.Atoi(r.PathValue("inventory_id"))
+		if err != nil {
+			slog.Error("Failed to Handle Suppliers", "Convertation error: ", err)
+			utils.Log_Err_Handler(err, http.StatusBadRequest, w)
+			return
+		}
+		inventoryID = num
+	}
+	switch {
+	case r.Method == http.MethodGet && len(splitted) == 1:
+		code, err := h.service.Retrieve_All_Suppliers(w)
+		if err != nil {
+			slog.Error("Failed to Handle Suppliers", "Retrieve All Suppliers function: ", err)
+			utils.Log_Err_Handler(err, code, w)
+			return
+		}
+		slog.Info("All suppliers retrieved succesfully")
+		return
+	case r.Method == http.MethodPost && len(splitted) == 1:
+		supplier, err := h.Get_Body_Supplier(r)
+		if err != nil {
+			slog.Error("Failed to Handle Suppliers", "Get Body Supplier function: ", err)
+			utils.Log_Err_Handler(err, http.StatusBadRequest, w)
+			return
+		}
+		code, err := h.service.Add_Supplier(supplier, w)
+		if err != nil {
+			slog.Error("Failed to Handle Suppliers", "Add Supplier function: ", err)
+			utils.Log_Err_Handler(err, code, w)
+			return
+		}
+		slog.Info("Supplier added succesfully")
+		return
+	case r.Method == http.MethodGet && len(splitted) == 2:
+		code, err := h.service.Retrieve_Supplier(w, id)
+		if err != nil {
+			slog.Error("Failed to Handle Suppliers", "Retrieve Supplier function: ", err)
+			utils.Log_Err_Handler(err, code, w)
+			return
+		}
+		slog.Info("Supplier retrieved succesfully")
+		return
+	case r.Method == http.MethodPut && len(splitted) == 2:
+		supplier, err := h.Get_Body_Supplier(r)
+		if err != nil {
+			slog.Error("Failed to Handle Suppliers", "Get Body Supplier function: ", err)
+			utils.Log_Err_Handler(err, http.StatusBadRequest, w)
+			return
+		}
+		code, err := h.service.Update_Supplier(supplier, id)
+		if err != nil {
+			slog.Error("Failed to Handle Suppliers", "Update Supplier function: ", err)
+			utils.Log_Err_Handler(err, code, w)
+			return
+		}
+		slog.Info("Supplier updated succesfully")
+		return
+	case r.Method == http.MethodDelete && len(splitted) == 2:
+		code, err := h.service.Delete_Supplier(id)
+		if err != nil {
+			slog.Error("Failed to Handle Suppliers", "Delete Supplier function: ", err)
+			utils.Log_Err_Handler(err, code, w)
+			return
+		}
+		slog.Info("Supplier deleted succesfully")
+		w.WriteHeader(code)
+		return
+	case r.Method == http.MethodGet && len(splitted) == 3:
+		code, err := h.service.Retrieve_Supplier_Items(w, id)
+		if err != nil {
+			slog.Error("Failed to Handle Suppliers", "Retrieve Supplier Items function: ", err)
+			utils.Log_Err_Handler(err, code, w)
+			return
+		}
+		slog.Info("Supplier items retrieved succesfully")
+		return
+	case r.Method == http.MethodPut && len(splitted) == 4:
+		item, err := h.Get_Body_Supplier_Item(r)
+		if err != nil {
+			slog.Error("Failed to Handle Suppliers", "Get Body Supplier Item function: ", err)
+			utils.Log_Err_Handler(err, http.StatusBadRequest, w)
+			return
+		}
+		item.SupplierID = id
+		item.InventoryID = inventoryID
+		code, err := h.service.Save_Supplier_Item(item, w)
+		if err != nil {
+			slog.Error("Failed to Handle Suppliers", "Save Supplier Item function: ", err)
+			utils.Log_Err_Handler(err, code, w)
+			return
+		}
+		slog.Info("Supplier item saved succesfully")
+		return
+	case r.Method == http.MethodDelete && len(splitted) == 4:
+		code, err := h.service.Delete_Supplier_Item(id, inventoryID)
+		if err != nil {
+			slog.Error("Failed to Handle Suppliers", "Delete Supplier Item function: ", err)
+			utils.Log_Err_Handler(err, code, w)
+			return
+		}
+		slog.Info("Supplier item deleted succesfully")
+		w.WriteHeader(code)
+		return
+	default:
+		utils.Log_Err_Handler(errors.New("error method in suppliers"), http.StatusMethodNotAllowed, w)
+		return
+	}
+}
+
+func (h *SupplierHandler) Get_Body_Supplier(r *http.Request) (models.Supplier, error) {
+	var supplier models.Supplier
+	if r.Body == nil {
+		return supplier, errors.New("request body is empty")
+	}
+	if err := json.NewDecoder(r.Body).Decode(&supplier); err != nil {
+		return supplier, err
+	}
+	if supplier.ID != 0 {
+		return supplier, errors.New("supplier id field must be empty")
+	}
+	supplier.Name = strings.TrimSpace(supplier.Name)
+	if supplier.Name == "" {
+		return supplier, errors.New("name field is missing")
+	}
+	if supplier.LeadTimeDays < 0 {
+		return supplier, errors.New("lead_time_days field cannot be negative")
+	}
+	if !supplier.CreatedAt.IsZero() {
+		return supplier, errors.New("created_at field must be empty")
+	}
+	if len(supplier.Items) != 0 {
+		return supplier, errors.New("items must be empty, set them on /suppliers/{id}/items/{inventory_id}")
+	}
+	return supplier, nil
+}
+
+// Get_Body_Supplier_Item reads the pack an inventory item comes in from the supplier and its price
+func (h *SupplierHandler) Get_Body_Supplier_Item(r *http.Request) (models.SupplierItem, error) {
+	var item models.SupplierItem
+	if r.Body == nil {
+		return item, errors.New("request body is empty")
+	}
+	if err := json.NewDecoder(r.Body).Decode(&item); err != nil {
+		return item, err
+	}
+	if item.SupplierID != 0 || item.InventoryID != 0 {
+		return item, errors.New("supplier_id and inventory_id must be empty, they come from the URL")
+	}
+	if item.PackSize <= 0 {
+		return item, errors.New("pack_size field cannot be negative or empty")
+	}
+	if strings.TrimSpace(item.PackUnit) == "" {
+		return item, errors.New("pack_unit field is missing")
+	}
+	if item.PackPrice <= 0 {
+		return item, errors.New("pack_price field cannot be negative or empty")
+	}
+	if item.StockQuantity != 0 || item.Unit != "" || item.Name != "" {
+		return item, errors.New("name, stock_quantity and unit fields must be empty")
+	}
+	return item, nil
+}
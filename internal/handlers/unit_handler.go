@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"frappuccino/internal/service"
+	"frappuccino/internal/utils"
+	"frappuccino/models"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+type UnitHandler struct {
+	service service.UnitService
+}
+
+func NewUnitHandle(service service.UnitService) *UnitHandler {
+	return &UnitHandler{service: service}
+}
+
+func (h *UnitHandler) Unit_Handle(w http.ResponseWriter, r *http.Request) {
+	splitted := strings.Split(r.URL.Path[1:], "/")
+	if len(splitted) < 1 {
+		utils.Log_Err_Handler(errors.New("error URL adress"), http.StatusBadRequest, w)
+		return
+	}
+	switch {
+	case r.Method == http.MethodGet && len(splitted) == 1:
+		code, err := h.service.Retrieve_All_Units(w)
+		if err != nil {
+			slog.Error("Failed to Handle Units", "Retrieve All Units function: ", err)
+			utils.Log_Err_Handler(err, code, w)
+			return
+		}
+		slog.Info("All units retrieved succesfully")
+		return
+	case r.Method == http.MethodGet && len(splitted) == 2:
+		code, err := h.service.Retrieve_Unit(w, r.PathValue("code"))
+		if err != nil {
+			slog.Error("Failed to Handle Units", "Retrieve Unit function: ", err)
+			utils.Log_Err_Handler(err, code, w)
+			return
+		}
+		slog.Info("Unit retrieved succesfully")
+		return
+	case r.Method == http.MethodPost && len(splitted) == 1:
+		unit, err := h.Get_Body_Unit(r)
+		if err != nil {
+			slog.Error("Failed to Handle Units", "Get Body Unit function: ", err)
+			utils.Log_Err_Handler(err, http.StatusBadRequest, w)
+			return
+		}
+		code, err := h.service.Add_Unit(unit, w)
+		if err != nil {
+			slog.Error("Failed to Handle Units", "Add Unit function: ", err)
+			utils.Log_Err_Handler(err, code, w)
+			return
+		}
+		slog.Info("Unit added succesfully")
+		return
+	default:
+		utils.Log_Err_Handler(errors.New("error method in units"), http.StatusMethodNotAllowed, w)
+		return
+	}
+}
+
+// Get_Body_Unit reads a unit, to_base is its size in g, ml or pcs
+func (h *UnitHandler) Get_Body_Unit(r *http.Request) (models.Unit, error) {
+	var unit models.Unit
+	if r.Body == nil {
+		return unit, errors.New("request body is empty")
+	}
+	if err := json.NewDecoder(r.Body).Decode(&unit); err != nil {
+		return unit, err
+	}
+	if strings.TrimSpace(unit.Code) == "" || len(unit.Code) > 20 || strings.ContainsAny(unit.Code, " /") {
+		return unit, errors.New("unit code is missing or invalid, it must be up to 20 characters without spaces")
+	}
+	if strings.TrimSpace(unit.Name) == "" {
+		return unit, errors.New("unit name is missing")
+	}
+	switch unit.Dimension {
+	case "mass", "volume", "count":
+	default:
+		return unit, errors.New("unit dimension must be mass, volume or count")
+	}
+	if unit.ToBase <= 0 {
+		return unit, errors.New("unit to_base must be greater than 0")
+	}
+	return unit, nil
+}
@@ -0,0 +1,145 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"frappuccino/internal/dal"
+	"frappuccino/internal/utils"
+	"frappuccino/models"
+	"net/http"
+)
+
+type CountService interface {
+	Retrieve_All_Counts(w http.ResponseWriter) (int, error)
+	Retrieve_Count(w http.ResponseWriter, id int) (int, error)
+	Open_Count(note, user string, w http.ResponseWriter) (int, error)
+	Save_Count_Lines(id int, lines []models.CountLineRequest, w http.ResponseWriter) (int, error)
+	Post_Count(id int, user string, w http.ResponseWriter) (int, error)
+	Delete_Count(id int) (int, error)
+}
+
+type DefaultCountService struct {
+	repo dal.CountRepo
+}
+
+func NewDefaultCountService(repo dal.CountRepo) *DefaultCountService {
+	return &DefaultCountService{repo: repo}
+}
+
+// Retrieve_All_Counts retrieves the open and past stock counts with their variance cost
+func (serv *DefaultCountService) Retrieve_All_Counts(w http.ResponseWriter) (int, error) {
+	counts, err := serv.repo.GetCounts()
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	err = utils.Send_Request(counts, w)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusOK, nil
+}
+
+// Retrieve_Count retrieves a stock count with the variance of every counted item
+func (serv *DefaultCountService) Retrieve_Count(w http.ResponseWriter, id int) (int, error) {
+	exist, err := serv.repo.IsCountExist(id)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if !exist {
+		return http.StatusNotFound, errors.New("stock count not found")
+	}
+	count, err := serv.repo.GetCount(id)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	err = utils.Send_Request(count, w)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusOK, nil
+}
+
+// Open_Count opens a new stock count and responds with it
+func (serv *DefaultCountService) Open_Count(note, user string, w http.ResponseWriter) (int, error) {
+	id, err := serv.repo.OpenCount(note, user)
+	if errors.Is(err, dal.ErrCountAlreadyOpen) {
+		return http.StatusConflict, err
+	}
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	count, err := serv.repo.GetCount(id)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	w.Header().Set("Location", fmt.Sprintf("/stock-counts/%d", id))
+	err = utils.Send_Request_Status(count, http.StatusCreated, w)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusCreated, nil
+}
+
+// Save_Count_Lines records counted quantities of the open count and responds with the count to review
+func (serv *DefaultCountService) Save_Count_Lines(id int, lines []models.CountLineRequest, w http.ResponseWriter) (int, error) {
+	exist, err := serv.repo.IsCountExist(id)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if !exist {
+		return http.StatusNotFound, errors.New("stock count not found")
+	}
+	err = serv.repo.SaveCountLines(id, lines)
+	if errors.Is(err, dal.ErrCountNotOpen) {
+		return http.StatusConflict, err
+	}
+	if dal.IsUnitErr(err) {
+		return http.StatusBadRequest, err
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return http.StatusBadRequest, errors.New("counted inventory item does not exist")
+	}
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return serv.Retrieve_Count(w, id)
+}
+
+// Post_Count adjusts the stock of the counted items to the counted quantities and responds with the posted count
+func (serv *DefaultCountService) Post_Count(id int, user string, w http.ResponseWriter) (int, error) {
+	exist, err := serv.repo.IsCountExist(id)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if !exist {
+		return http.StatusNotFound, errors.New("stock count not found")
+	}
+	err = serv.repo.PostCount(id, user)
+	if errors.Is(err, dal.ErrCountNotOpen) || errors.Is(err, dal.ErrCountEmpty) {
+		return http.StatusConflict, err
+	}
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return serv.Retrieve_Count(w, id)
+}
+
+// Delete_Count discards an open stock count, posted counts can not be deleted
+func (serv *DefaultCountService) Delete_Count(id int) (int, error) {
+	exist, err := serv.repo.IsCountExist(id)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if !exist {
+		return http.StatusNotFound, errors.New("stock count not found")
+	}
+	err = serv.repo.DeleteCount(id)
+	if errors.Is(err, dal.ErrCountNotOpen) {
+		return http.StatusConflict, err
+	}
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusNoContent, nil
+}
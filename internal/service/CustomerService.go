@@ -2,6 +2,7 @@ package service
 
 import (
 	"errors"
+	"fmt"
 	"frappuccino/internal/dal"
 	"frappuccino/internal/utils"
 	"frappuccino/models"
@@ -13,18 +14,21 @@ type DefaultCustomerService struct {
 }
 
 type CustomerService interface {
-	CreateCustomer(customer models.Customer) (int, error)
+	CreateCustomer(customer models.Customer, w http.ResponseWriter) (int, error)
 	GetAllCustomers(w http.ResponseWriter) (int, error)
 	GetCustomer(w http.ResponseWriter, id int) (int, error)
 	UpdateCustomer(customer models.Customer, id int) (int, error)
 	DeleteCustomer(id int) (int, error)
+	PurgeCustomer(id int) (int, error)
+	GetCustomerOrders(w http.ResponseWriter, id int, status, startDate, endDate string, page, pageSize int) (int, error)
+	GetCustomerSummary(w http.ResponseWriter, id int) (int, error)
 }
 
 func NewDefaultServiceCustomer(repo dal.NewCustomerRepo) *DefaultCustomerService {
 	return &DefaultCustomerService{repo: repo}
 }
 
-func (serv *DefaultCustomerService) CreateCustomer(customer models.Customer) (int, error) {
+func (serv *DefaultCustomerService) CreateCustomer(customer models.Customer, w http.ResponseWriter) (int, error) {
 	unique, err := serv.repo.IsEmailUnique(customer.Email)
 	if err != nil {
 		return http.StatusInternalServerError, err
@@ -32,7 +36,16 @@ func (serv *DefaultCustomerService) CreateCustomer(customer models.Customer) (in
 	if !unique {
 		return http.StatusBadRequest, errors.New("email must be unique")
 	}
-	err = serv.repo.SaveCustomer(customer)
+	id, err := serv.repo.SaveCustomer(customer)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	created, err := serv.repo.GetCustomerByID(id)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	w.Header().Set("Location", fmt.Sprintf("/customers/%d", id))
+	err = utils.Send_Request_Status(created, http.StatusCreated, w)
 	if err != nil {
 		return http.StatusInternalServerError, err
 	}
@@ -70,6 +83,9 @@ func (serv *DefaultCustomerService) UpdateCustomer(customer models.Customer, id
 	if !serv.repo.IsCustomerExist(id) {
 		return http.StatusNotFound, errors.New("customer is not exist")
 	}
+	if !serv.repo.IsCustomerActive(id) {
+		return http.StatusConflict, errors.New("customer is archived")
+	}
 	unique, err := serv.repo.IsEmailUnique(customer.Email)
 	if err != nil {
 		return http.StatusInternalServerError, err
@@ -84,13 +100,76 @@ func (serv *DefaultCustomerService) UpdateCustomer(customer models.Customer, id
 	return http.StatusOK, nil
 }
 
+// DeleteCustomer archives the customer, the orders of the customer stay in history
 func (serv *DefaultCustomerService) DeleteCustomer(id int) (int, error) {
 	if !serv.repo.IsCustomerExist(id) {
 		return http.StatusNotFound, errors.New("customer is not exist")
 	}
-	err := serv.repo.DeleteCustomer(id)
+	err := serv.repo.ArchiveCustomer(id)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusNoContent, nil
+}
+
+// PurgeCustomer deletes an archived customer for good, a customer with orders can not be purged
+func (serv *DefaultCustomerService) PurgeCustomer(id int) (int, error) {
+	if !serv.repo.IsCustomerExist(id) {
+		return http.StatusNotFound, errors.New("customer is not exist")
+	}
+	if serv.repo.IsCustomerActive(id) {
+		return http.StatusConflict, errors.New("customer must be archived before purge")
+	}
+	err := serv.repo.PurgeCustomer(id)
+	if errors.Is(err, dal.ErrStillReferenced) {
+		return http.StatusConflict, err
+	}
 	if err != nil {
 		return http.StatusInternalServerError, err
 	}
 	return http.StatusNoContent, nil
 }
+
+// GetCustomerOrders sends one page of the orders of the customer, archived customers keep their history
+func (serv *DefaultCustomerService) GetCustomerOrders(w http.ResponseWriter, id int, status, startDate, endDate string, page, pageSize int) (int, error) {
+	if !serv.repo.IsCustomerExist(id) {
+		return http.StatusNotFound, errors.New("customer is not exist")
+	}
+	orders, total, err := serv.repo.GetCustomerOrders(id, status, startDate, endDate, page, pageSize)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	totalPages := (total + pageSize - 1) / pageSize
+	if page > totalPages && total > 0 {
+		return http.StatusBadRequest, errors.New("page does not exist")
+	}
+	response := models.CustomerOrdersResponse{
+		CurrentPage: page,
+		HasNextPage: page < totalPages,
+		PageSize:    pageSize,
+		TotalPages:  totalPages,
+		TotalOrders: total,
+		Data:        orders,
+	}
+	err = utils.Send_Request(response, w)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusOK, nil
+}
+
+// GetCustomerSummary sends the lifetime value of the customer
+func (serv *DefaultCustomerService) GetCustomerSummary(w http.ResponseWriter, id int) (int, error) {
+	if !serv.repo.IsCustomerExist(id) {
+		return http.StatusNotFound, errors.New("customer is not exist")
+	}
+	summary, err := serv.repo.GetCustomerSummary(id)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	err = utils.Send_Request(summary, w)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusOK, nil
+}
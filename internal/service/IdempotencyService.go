@@ -0,0 +1,56 @@
+package service
+
+import (
+	"errors"
+	"frappuccino/internal/dal"
+	"frappuccino/models"
+	"net/http"
+)
+
+type IdempotencyService interface {
+	Claim(key, endpoint, requestHash string) (models.IdempotencyRecord, int, error)
+	Complete(record models.IdempotencyRecord) error
+	Release(key, endpoint string) error
+}
+
+type DefaultIdempotencyService struct {
+	repo dal.NewIdempotencyRepo
+}
+
+func NewIdempotencyService(repo dal.NewIdempotencyRepo) *DefaultIdempotencyService {
+	return &DefaultIdempotencyService{repo: repo}
+}
+
+// Claim reserves the key for a new request. When the key was already used with the same request,
+// the stored record with its response is returned to be replayed
+func (serv *DefaultIdempotencyService) Claim(key, endpoint, requestHash string) (models.IdempotencyRecord, int, error) {
+	record := models.IdempotencyRecord{
+		Key:         key,
+		Endpoint:    endpoint,
+		RequestHash: requestHash,
+	}
+	stored, claimed, err := serv.repo.ClaimKey(record)
+	if err != nil {
+		return record, http.StatusInternalServerError, err
+	}
+	if claimed {
+		return record, http.StatusOK, nil
+	}
+	if stored.RequestHash != requestHash {
+		return stored, http.StatusUnprocessableEntity, errors.New("idempotency key has already been used with a different request")
+	}
+	if stored.StatusCode == 0 {
+		return stored, http.StatusConflict, errors.New("request with this idempotency key is still in progress")
+	}
+	return stored, http.StatusOK, nil
+}
+
+// Complete saves the response of the request made with the claimed key
+func (serv *DefaultIdempotencyService) Complete(record models.IdempotencyRecord) error {
+	return serv.repo.SaveResponse(record)
+}
+
+// Release frees the key after a failed request, so the client can retry it
+func (serv *DefaultIdempotencyService) Release(key, endpoint string) error {
+	return serv.repo.ReleaseKey(key, endpoint)
+}
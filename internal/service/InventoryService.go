@@ -2,6 +2,7 @@ package service
 
 import (
 	"errors"
+	"fmt"
 	"frappuccino/internal/dal"
 	"frappuccino/internal/utils"
 	"frappuccino/models"
@@ -9,14 +10,28 @@ import (
 )
 
 type InventService interface {
-	Add_Inventory(inventory models.InventoryItem) (int, error)
+	Add_Inventory(inventory models.InventoryItem, user string, w http.ResponseWriter) (int, error)
 	Retrieve_All_Inventory(w http.ResponseWriter) (int, error)
 	Retrieve_Inventory(w http.ResponseWriter, id int) (int, error)
-	Update_Inventory(inventory models.InventoryItem, id int) (int, error)
+	Update_Inventory(inventory models.InventoryItem, id int, user string) (int, error)
 	Delete_Inventory(id int) (int, error)
+	Purge_Inventory(id int) (int, error)
 	GetAllTransactionData(w http.ResponseWriter) (int, error)
 	GetInventoryTransaction(w http.ResponseWriter, id int) (int, error)
-	FillInventory(transaction models.InventoryTransaction) (int, error)
+	FillInventory(transaction models.InventoryTransaction, user string) (int, error)
+	Retrieve_Stock_Movements(w http.ResponseWriter, id int, from, to string) (int, error)
+	Transfer_Stock(id int, transfer models.TransferRequest, user string, w http.ResponseWriter) (int, error)
+	Check_Consistency(w http.ResponseWriter) (int, error)
+	Reconcile_Stock(w http.ResponseWriter) (int, error)
+	Log_Waste(waste models.WasteRequest, user string, w http.ResponseWriter) (int, error)
+	Retrieve_Pack_Units(w http.ResponseWriter, id int) (int, error)
+	Add_Pack_Unit(id int, pack models.PackUnit, w http.ResponseWriter) (int, error)
+	Delete_Pack_Unit(id, packID int) (int, error)
+	Retrieve_Reorder_Suggestions(w http.ResponseWriter, days int) (int, error)
+	Create_Reorder_Drafts(days int, user string, w http.ResponseWriter) (int, error)
+	Retrieve_Lots(w http.ResponseWriter, id int) (int, error)
+	Retrieve_Expiring_Lots(w http.ResponseWriter, within int) (int, error)
+	Write_Off_Expired(user string, w http.ResponseWriter) (int, error)
 }
 
 type DefaultInventService struct {
@@ -27,8 +42,8 @@ func NewDefaultInventService(repo dal.InventRepo) *DefaultInventService {
 	return &DefaultInventService{repo: repo}
 }
 
-// Add_Inventory adds a new inventory item
-func (serv *DefaultInventService) Add_Inventory(inventory models.InventoryItem) (int, error) {
+// Add_Inventory adds a new inventory item and responds with the created item, the user opens its stock balance
+func (serv *DefaultInventService) Add_Inventory(inventory models.InventoryItem, user string, w http.ResponseWriter) (int, error) {
 	unique, err := serv.repo.IsInventUnique(inventory.Name)
 	if err != nil {
 		return http.StatusInternalServerError, err
@@ -36,7 +51,23 @@ func (serv *DefaultInventService) Add_Inventory(inventory models.InventoryItem)
 	if !unique {
 		return http.StatusBadRequest, errors.New("inventory name must be unique")
 	}
-	err = serv.repo.Save_Inventory(inventory)
+	dimension, err := serv.repo.GetUnitDimension(inventory.UnitType)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if dimension == "" {
+		return http.StatusBadRequest, fmt.Errorf("unit type is not registered: %s", inventory.UnitType)
+	}
+	id, err := serv.repo.Save_Inventory(inventory, user)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	created, err := serv.repo.GetInventory(id)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	w.Header().Set("Location", fmt.Sprintf("/inventory/%d", id))
+	err = utils.Send_Request_Status(created, http.StatusCreated, w)
 	if err != nil {
 		return http.StatusInternalServerError, err
 	}
@@ -78,8 +109,8 @@ func (serv *DefaultInventService) Retrieve_Inventory(w http.ResponseWriter, id i
 	return http.StatusOK, nil
 }
 
-// Update_Inventory updates an existing inventory item by ID
-func (serv *DefaultInventService) Update_Inventory(inventory models.InventoryItem, id int) (int, error) {
+// Update_Inventory updates an existing inventory item by ID, a stock level change is recorded as made by the user
+func (serv *DefaultInventService) Update_Inventory(inventory models.InventoryItem, id int, user string) (int, error) {
 	unique, err := serv.repo.IsInventUnique(inventory.Name)
 	if err != nil {
 		return http.StatusInternalServerError, err
@@ -94,15 +125,37 @@ func (serv *DefaultInventService) Update_Inventory(inventory models.InventoryIte
 	if !exist {
 		return http.StatusNotFound, errors.New("inventory item not found")
 	}
+	archived, err := serv.repo.IsInventArchived(id)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if archived {
+		return http.StatusConflict, errors.New("inventory item is archived")
+	}
+	// Recipes and purchases are converted to the stock unit, so it may change its size but not what it measures
+	dimension, err := serv.repo.GetUnitDimension(inventory.UnitType)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if dimension == "" {
+		return http.StatusBadRequest, fmt.Errorf("unit type is not registered: %s", inventory.UnitType)
+	}
+	stockDimension, err := serv.repo.GetStockDimension(id)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if dimension != stockDimension {
+		return http.StatusBadRequest, fmt.Errorf("%w: %s is %s, inventory item is counted in %s", dal.ErrUnitDimension, inventory.UnitType, dimension, stockDimension)
+	}
 	inventory.ID = id
-	err = serv.repo.Update_Inventory(inventory)
+	err = serv.repo.Update_Inventory(inventory, user)
 	if err != nil {
 		return http.StatusInternalServerError, err
 	}
 	return http.StatusOK, nil
 }
 
-// Delete_Inventory deletes an inventory item by ID
+// Delete_Inventory archives an inventory item by ID, its purchase history stays
 func (serv *DefaultInventService) Delete_Inventory(id int) (int, error) {
 	exist, err := serv.repo.IsInventExist(id)
 	if err != nil {
@@ -111,7 +164,34 @@ func (serv *DefaultInventService) Delete_Inventory(id int) (int, error) {
 	if !exist {
 		return http.StatusNotFound, errors.New("inventory item not found")
 	}
-	err = serv.repo.Delete_Inventory(id)
+	err = serv.repo.Archive_Inventory(id)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusNoContent, nil
+}
+
+// Purge_Inventory deletes an archived inventory item for good,
+// an item with purchases or used in a recipe can not be purged
+func (serv *DefaultInventService) Purge_Inventory(id int) (int, error) {
+	exist, err := serv.repo.IsInventExist(id)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if !exist {
+		return http.StatusNotFound, errors.New("inventory item not found")
+	}
+	archived, err := serv.repo.IsInventArchived(id)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if !archived {
+		return http.StatusConflict, errors.New("inventory item must be archived before purge")
+	}
+	err = serv.repo.Purge_Inventory(id)
+	if errors.Is(err, dal.ErrStillReferenced) {
+		return http.StatusConflict, err
+	}
 	if err != nil {
 		return http.StatusInternalServerError, err
 	}
@@ -149,7 +229,7 @@ func (serv *DefaultInventService) GetInventoryTransaction(w http.ResponseWriter,
 	return http.StatusOK, nil
 }
 
-func (serv *DefaultInventService) FillInventory(transaction models.InventoryTransaction) (int, error) {
+func (serv *DefaultInventService) FillInventory(transaction models.InventoryTransaction, user string) (int, error) {
 	exist, err := serv.repo.IsInventExist(transaction.Inventory_id)
 	if err != nil {
 		return http.StatusInternalServerError, err
@@ -157,7 +237,295 @@ func (serv *DefaultInventService) FillInventory(transaction models.InventoryTran
 	if !exist {
 		return http.StatusNotFound, errors.New("inventory item is not found")
 	}
-	err = serv.repo.FillInventory(transaction)
+	archived, err := serv.repo.IsInventArchived(transaction.Inventory_id)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if archived {
+		return http.StatusConflict, errors.New("inventory item is archived")
+	}
+	err = serv.repo.FillInventory(transaction, user)
+	if dal.IsUnitErr(err) {
+		return http.StatusBadRequest, err
+	}
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusOK, nil
+}
+
+// Retrieve_Pack_Units retrieves the pack units the inventory item can be bought in
+func (serv *DefaultInventService) Retrieve_Pack_Units(w http.ResponseWriter, id int) (int, error) {
+	exist, err := serv.repo.IsInventExist(id)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if !exist {
+		return http.StatusNotFound, errors.New("inventory item not found")
+	}
+	packs, err := serv.repo.GetPackUnits(id)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if packs == nil {
+		packs = []models.PackUnit{}
+	}
+	err = utils.Send_Request(packs, w)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusOK, nil
+}
+
+// Add_Pack_Unit adds a pack unit to the inventory item and responds with the created pack
+func (serv *DefaultInventService) Add_Pack_Unit(id int, pack models.PackUnit, w http.ResponseWriter) (int, error) {
+	exist, err := serv.repo.IsInventExist(id)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if !exist {
+		return http.StatusNotFound, errors.New("inventory item not found")
+	}
+	archived, err := serv.repo.IsInventArchived(id)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if archived {
+		return http.StatusConflict, errors.New("inventory item is archived")
+	}
+	pack.InventoryID = id
+	pack.ID, err = serv.repo.SavePackUnit(pack)
+	if dal.IsUnitErr(err) {
+		return http.StatusBadRequest, err
+	}
+	if errors.Is(err, dal.ErrPackUnitExists) {
+		return http.StatusConflict, err
+	}
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	w.Header().Set("Location", fmt.Sprintf("/inventory/%d/packs/%d", id, pack.ID))
+	err = utils.Send_Request_Status(pack, http.StatusCreated, w)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusCreated, nil
+}
+
+// Delete_Pack_Unit deletes a pack unit of the inventory item, it is kept while a supplier or an open purchase order is in it
+func (serv *DefaultInventService) Delete_Pack_Unit(id, packID int) (int, error) {
+	exist, err := serv.repo.IsPackUnitExist(id, packID)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if !exist {
+		return http.StatusNotFound, errors.New("pack unit not found")
+	}
+	err = serv.repo.DeletePackUnit(packID)
+	if errors.Is(err, dal.ErrPackUnitInUse) {
+		return http.StatusConflict, err
+	}
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusNoContent, nil
+}
+
+// Retrieve_Stock_Movements retrieves the stock ledger of the inventory item within the dates
+func (serv *DefaultInventService) Retrieve_Stock_Movements(w http.ResponseWriter, id int, from, to string) (int, error) {
+	exist, err := serv.repo.IsInventExist(id)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if !exist {
+		return http.StatusNotFound, errors.New("inventory item not found")
+	}
+	movements, err := serv.repo.GetStockMovements(id, from, to)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	err = utils.Send_Request(movements, w)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusOK, nil
+}
+
+// Transfer_Stock moves stock of the inventory item to or from another location and responds with the recorded movement
+func (serv *DefaultInventService) Transfer_Stock(id int, transfer models.TransferRequest, user string, w http.ResponseWriter) (int, error) {
+	exist, err := serv.repo.IsInventExist(id)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if !exist {
+		return http.StatusNotFound, errors.New("inventory item not found")
+	}
+	archived, err := serv.repo.IsInventArchived(id)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if archived {
+		return http.StatusConflict, errors.New("inventory item is archived")
+	}
+	movement, err := serv.repo.TransferStock(id, transfer, user)
+	if dal.IsUnitErr(err) || errors.Is(err, dal.ErrZeroQuantity) {
+		return http.StatusBadRequest, err
+	}
+	if errors.Is(err, dal.ErrNotEnoughInventory) {
+		return http.StatusConflict, fmt.Errorf("transfer is more than the stock: %w", err)
+	}
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	w.Header().Set("Location", fmt.Sprintf("/inventory/%d/movements", id))
+	err = utils.Send_Request_Status(movement, http.StatusCreated, w)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusCreated, nil
+}
+
+// Check_Consistency lists the inventory items whose stock level does not match their ledger or their lots
+func (serv *DefaultInventService) Check_Consistency(w http.ResponseWriter) (int, error) {
+	discrepancies, err := serv.repo.GetStockDiscrepancies()
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	err = utils.Send_Request(discrepancies, w)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusOK, nil
+}
+
+// Reconcile_Stock recomputes the stock level and the lots of the inconsistent inventory items from their ledger
+// and responds with the corrected items
+func (serv *DefaultInventService) Reconcile_Stock(w http.ResponseWriter) (int, error) {
+	discrepancies, err := serv.repo.ReconcileStock()
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	err = utils.Send_Request(discrepancies, w)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusOK, nil
+}
+
+// Log_Waste deducts wasted stock of an inventory item or of a menu item through its recipe
+// and responds with the logged entries and their cost
+func (serv *DefaultInventService) Log_Waste(waste models.WasteRequest, user string, w http.ResponseWriter) (int, error) {
+	if waste.InventoryID != 0 {
+		exist, err := serv.repo.IsInventExist(waste.InventoryID)
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+		if !exist {
+			return http.StatusNotFound, errors.New("inventory item not found")
+		}
+	} else {
+		exist, err := serv.repo.IsWasteMenuItemExist(waste.MenuItemID, waste.VariantID)
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+		if !exist {
+			return http.StatusNotFound, errors.New("menu item or its variant not found")
+		}
+	}
+	entries, err := serv.repo.SaveWaste(waste, user)
+	if dal.IsUnitErr(err) {
+		return http.StatusBadRequest, err
+	}
+	if errors.Is(err, dal.ErrNotEnoughInventory) {
+		return http.StatusConflict, fmt.Errorf("waste is more than the stock: %w", err)
+	}
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if entries == nil {
+		entries = []models.WasteEntry{}
+	}
+	err = utils.Send_Request_Status(entries, http.StatusCreated, w)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusCreated, nil
+}
+
+// Retrieve_Reorder_Suggestions lists the inventory items to reorder with the supplier and packs to buy,
+// usage is averaged over the last days of sales
+func (serv *DefaultInventService) Retrieve_Reorder_Suggestions(w http.ResponseWriter, days int) (int, error) {
+	suggestions, err := serv.repo.GetReorderSuggestions(days)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	err = utils.Send_Request(models.ReorderSuggestions{UsageDays: days, Suggestions: suggestions}, w)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusOK, nil
+}
+
+// Create_Reorder_Drafts turns the reorder suggestions into draft purchase orders grouped by supplier and responds with them
+func (serv *DefaultInventService) Create_Reorder_Drafts(days int, user string, w http.ResponseWriter) (int, error) {
+	drafts, err := serv.repo.CreateReorderDrafts(days, user)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	code := http.StatusOK
+	if len(drafts.PurchaseOrders) != 0 {
+		code = http.StatusCreated
+	}
+	err = utils.Send_Request_Status(drafts, code, w)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return code, nil
+}
+
+// Retrieve_Lots lists the lots of an inventory item still in stock in the order they are consumed
+func (serv *DefaultInventService) Retrieve_Lots(w http.ResponseWriter, id int) (int, error) {
+	exist, err := serv.repo.IsInventExist(id)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if !exist {
+		return http.StatusNotFound, errors.New("inventory item not found")
+	}
+	lots, err := serv.repo.GetLots(id)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	err = utils.Send_Request(lots, w)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusOK, nil
+}
+
+// Retrieve_Expiring_Lots lists the lots in stock that expire within the days, already expired lots included
+func (serv *DefaultInventService) Retrieve_Expiring_Lots(w http.ResponseWriter, within int) (int, error) {
+	lots, err := serv.repo.GetExpiringLots(within)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	err = utils.Send_Request(lots, w)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusOK, nil
+}
+
+// Write_Off_Expired logs what is left of the expired lots as waste and responds with the logged entries
+func (serv *DefaultInventService) Write_Off_Expired(user string, w http.ResponseWriter) (int, error) {
+	entries, err := serv.repo.WriteOffExpiredLots(user)
+	if errors.Is(err, dal.ErrNotEnoughInventory) {
+		return http.StatusConflict, fmt.Errorf("expired lots are more than the stock, check the inventory consistency: %w", err)
+	}
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	err = utils.Send_Request(entries, w)
 	if err != nil {
 		return http.StatusInternalServerError, err
 	}
@@ -0,0 +1,211 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"frappuccino/internal/dal"
+	"frappuccino/internal/utils"
+	"frappuccino/models"
+	"net/http"
+)
+
+type LoyaltyService interface {
+	Retrieve_Settings(w http.ResponseWriter) (int, error)
+	Update_Settings(settings models.LoyaltySettings, w http.ResponseWriter) (int, error)
+	Retrieve_All_Rewards(w http.ResponseWriter) (int, error)
+	Retrieve_Reward(w http.ResponseWriter, id int) (int, error)
+	Add_Reward(reward models.LoyaltyReward, w http.ResponseWriter) (int, error)
+	Update_Reward(reward models.LoyaltyReward, id int) (int, error)
+	Delete_Reward(id int) (int, error)
+	Retrieve_Balance(w http.ResponseWriter, customerID int) (int, error)
+	Retrieve_Ledger(w http.ResponseWriter, customerID int) (int, error)
+	Expire_Points(w http.ResponseWriter) (int, error)
+}
+
+type DefaultLoyaltyService struct {
+	repo         dal.LoyaltyRepo
+	menuRepo     dal.MenuRepo
+	customerRepo dal.CustomerRepo
+}
+
+func NewDefaultLoyaltyService(repo dal.LoyaltyRepo, menuRepo dal.MenuRepo, customerRepo dal.CustomerRepo) *DefaultLoyaltyService {
+	return &DefaultLoyaltyService{repo: repo, menuRepo: menuRepo, customerRepo: customerRepo}
+}
+
+// Retrieve_Settings retrieves the rule points are earned and redeemed by
+func (serv *DefaultLoyaltyService) Retrieve_Settings(w http.ResponseWriter) (int, error) {
+	settings, err := serv.repo.GetSettings()
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	err = utils.Send_Request(settings, w)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusOK, nil
+}
+
+// Update_Settings replaces the loyalty rule and responds with it
+func (serv *DefaultLoyaltyService) Update_Settings(settings models.LoyaltySettings, w http.ResponseWriter) (int, error) {
+	err := serv.repo.UpdateSettings(settings)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return serv.Retrieve_Settings(w)
+}
+
+// Retrieve_All_Rewards retrieves all rewards
+func (serv *DefaultLoyaltyService) Retrieve_All_Rewards(w http.ResponseWriter) (int, error) {
+	rewards, err := serv.repo.GetRewards()
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	err = utils.Send_Request(rewards, w)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusOK, nil
+}
+
+// Retrieve_Reward retrieves a reward
+func (serv *DefaultLoyaltyService) Retrieve_Reward(w http.ResponseWriter, id int) (int, error) {
+	exist, err := serv.repo.IsRewardExist(id)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if !exist {
+		return http.StatusNotFound, errors.New("reward not found")
+	}
+	reward, err := serv.repo.GetReward(id)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	err = utils.Send_Request(reward, w)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusOK, nil
+}
+
+// Add_Reward adds a reward for a menu item and responds with it
+func (serv *DefaultLoyaltyService) Add_Reward(reward models.LoyaltyReward, w http.ResponseWriter) (int, error) {
+	if code, err := serv.checkRewardItem(reward); err != nil {
+		return code, err
+	}
+	id, err := serv.repo.SaveReward(reward)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	created, err := serv.repo.GetReward(id)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	w.Header().Set("Location", fmt.Sprintf("/loyalty/rewards/%d", id))
+	err = utils.Send_Request_Status(created, http.StatusCreated, w)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusCreated, nil
+}
+
+// Update_Reward updates a reward, discounts already given keep their amount
+func (serv *DefaultLoyaltyService) Update_Reward(reward models.LoyaltyReward, id int) (int, error) {
+	exist, err := serv.repo.IsRewardExist(id)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if !exist {
+		return http.StatusNotFound, errors.New("reward not found")
+	}
+	if code, err := serv.checkRewardItem(reward); err != nil {
+		return code, err
+	}
+	err = serv.repo.UpdateReward(reward, id)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusOK, nil
+}
+
+// Delete_Reward deletes a reward, orders it was redeemed on keep their discount
+func (serv *DefaultLoyaltyService) Delete_Reward(id int) (int, error) {
+	exist, err := serv.repo.IsRewardExist(id)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if !exist {
+		return http.StatusNotFound, errors.New("reward not found")
+	}
+	err = serv.repo.DeleteReward(id)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusNoContent, nil
+}
+
+// checkRewardItem checks that the reward gives away a menu item that can still be ordered
+func (serv *DefaultLoyaltyService) checkRewardItem(reward models.LoyaltyReward) (int, error) {
+	exist, err := serv.menuRepo.IsMenuExist(reward.MenuItemID)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if !exist {
+		return http.StatusBadRequest, errors.New("menu item of the reward does not exist")
+	}
+	archived, err := serv.menuRepo.IsMenuArchived(reward.MenuItemID)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if archived && reward.Active {
+		return http.StatusBadRequest, errors.New("menu item of the reward is archived")
+	}
+	return http.StatusOK, nil
+}
+
+// Retrieve_Balance retrieves the points balance of the customer, due points are expired first
+func (serv *DefaultLoyaltyService) Retrieve_Balance(w http.ResponseWriter, customerID int) (int, error) {
+	if !serv.customerRepo.IsCustomerExist(customerID) {
+		return http.StatusNotFound, errors.New("customer is not exist")
+	}
+	balance, err := serv.repo.GetBalance(customerID)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	err = utils.Send_Request(balance, w)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusOK, nil
+}
+
+// Retrieve_Ledger retrieves every change of the points of the customer
+func (serv *DefaultLoyaltyService) Retrieve_Ledger(w http.ResponseWriter, customerID int) (int, error) {
+	if !serv.customerRepo.IsCustomerExist(customerID) {
+		return http.StatusNotFound, errors.New("customer is not exist")
+	}
+	entries, err := serv.repo.GetLedger(customerID)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	err = utils.Send_Request(entries, w)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusOK, nil
+}
+
+// Expire_Points expires the due points of every customer
+func (serv *DefaultLoyaltyService) Expire_Points(w http.ResponseWriter) (int, error) {
+	expired, err := serv.repo.ExpirePoints()
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	response := struct {
+		Expired int `json:"expired"`
+	}{Expired: expired}
+	err = utils.Send_Request(response, w)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusOK, nil
+}
@@ -2,6 +2,7 @@ package service
 
 import (
 	"errors"
+	"fmt"
 	"frappuccino/internal/dal"
 	"frappuccino/internal/utils"
 	"frappuccino/models"
@@ -9,13 +10,25 @@ import (
 )
 
 type MenuService interface {
-	Add_Menu(Menu models.Menu) (int, error)
+	Add_Menu(Menu models.Menu, ingredients []models.MenuItemIngredient, w http.ResponseWriter) (int, error)
 	Retrieve_All_Menu(w http.ResponseWriter) (int, error)
 	Retrieve_Menu(w http.ResponseWriter, id int) (int, error)
+	Retrieve_Available_Menu(w http.ResponseWriter) (int, error)
+	Set_Sold_Out(id int, soldOut bool, w http.ResponseWriter) (int, error)
+	Retrieve_Menu_Cost(w http.ResponseWriter, id int, method string) (int, error)
 	Update_Menu(Menu models.Menu, id int) (int, error)
 	Delete_Menu(id int) (int, error)
+	Purge_Menu(id int) (int, error)
 	GetAllMenuPriceHistory(w http.ResponseWriter) (int, error)
 	GetMenuPriceHistory(w http.ResponseWriter, id int) (int, error)
+	Retrieve_Variants(w http.ResponseWriter, id int) (int, error)
+	Add_Variant(id int, variant models.MenuVariant, w http.ResponseWriter) (int, error)
+	Update_Variant(id, variantID int, variant models.MenuVariant, w http.ResponseWriter) (int, error)
+	Delete_Variant(id, variantID int) (int, error)
+	Retrieve_Modifiers(w http.ResponseWriter, id int) (int, error)
+	Add_Modifier_Group(id int, group models.ModifierGroup, w http.ResponseWriter) (int, error)
+	Update_Modifier_Group(id, groupID int, group models.ModifierGroup, w http.ResponseWriter) (int, error)
+	Delete_Modifier_Group(id, groupID int) (int, error)
 }
 
 type DefaultMenuService struct {
@@ -26,8 +39,8 @@ func NewDefaultMenuService(repo dal.MenuRepo) *DefaultMenuService {
 	return &DefaultMenuService{repo: repo}
 }
 
-// Add_Menu adds a new menu item
-func (serv *DefaultMenuService) Add_Menu(menu models.Menu, ingredients []models.MenuItemIngredient) (int, error) {
+// Add_Menu adds a new menu item and responds with the created item
+func (serv *DefaultMenuService) Add_Menu(menu models.Menu, ingredients []models.MenuItemIngredient, w http.ResponseWriter) (int, error) {
 	// Check if menu is unique
 	isUnique, err := serv.repo.Check_UniqueMenu(menu.Name)
 	if err != nil {
@@ -43,8 +56,22 @@ func (serv *DefaultMenuService) Add_Menu(menu models.Menu, ingredients []models.
 	if !exist {
 		return http.StatusBadRequest, errors.New("menu item ingredient is not exist in inventory")
 	}
+	for _, ingredient := range ingredients {
+		if code, err := serv.checkRecipeUnit(ingredient.InventoryID, ingredient.Unit); err != nil {
+			return code, err
+		}
+	}
 	// Save the menu and its ingredients
-	err = serv.repo.Save_Menu(menu, ingredients)
+	id, err := serv.repo.Save_Menu(menu, ingredients)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	created, err := serv.repo.GetMenu(id)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	w.Header().Set("Location", fmt.Sprintf("/menu/%d", id))
+	err = utils.Send_Request_Status(created, http.StatusCreated, w)
 	if err != nil {
 		return http.StatusInternalServerError, err
 	}
@@ -84,12 +111,97 @@ func (serv *DefaultMenuService) Retrieve_Menu(w http.ResponseWriter, id int) (in
 	return http.StatusOK, nil
 }
 
+// Retrieve_Available_Menu retrieves the menu items that are on sale and can be made from current stock,
+// only the available variants of them are listed
+func (serv *DefaultMenuService) Retrieve_Available_Menu(w http.ResponseWriter) (int, error) {
+	menus, err := serv.repo.Get_AllMenu()
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	available := []models.Menu{}
+	for _, menu := range menus {
+		if !menu.Available {
+			continue
+		}
+		if len(menu.Variants) != 0 {
+			var variants []models.MenuVariant
+			for _, variant := range menu.Variants {
+				if variant.Available {
+					variants = append(variants, variant)
+				}
+			}
+			menu.Variants = variants
+		}
+		available = append(available, menu)
+	}
+	err = utils.Send_Request(available, w)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusOK, nil
+}
+
+// Set_Sold_Out marks a menu item as sold out or puts it back on sale, responds with the menu item
+func (serv *DefaultMenuService) Set_Sold_Out(id int, soldOut bool, w http.ResponseWriter) (int, error) {
+	exist, err := serv.repo.IsMenuExist(id)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if !exist {
+		return http.StatusNotFound, errors.New("menu not found")
+	}
+	archived, err := serv.repo.IsMenuArchived(id)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if archived {
+		return http.StatusConflict, errors.New("menu item is archived")
+	}
+	err = serv.repo.Set_SoldOut(id, soldOut)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	menu, err := serv.repo.GetMenu(id)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	err = utils.Send_Request(menu, w)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusOK, nil
+}
+
+// Retrieve_Menu_Cost retrieves the recipe cost and margin of a menu item and its variants
+func (serv *DefaultMenuService) Retrieve_Menu_Cost(w http.ResponseWriter, id int, method string) (int, error) {
+	method, err := checkCostMethod(method)
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+	exist, err := serv.repo.IsMenuExist(id)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if !exist {
+		return http.StatusNotFound, errors.New("menu not found")
+	}
+	cost, err := serv.repo.GetMenuCost(id, method)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	err = utils.Send_Request(cost, w)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusOK, nil
+}
+
 // Update_Menu updates a menu item
 func (serv *DefaultMenuService) Update_Menu(menu models.Menu, id int) (int, error) {
 	return serv.repo.Update_Menu(menu, id)
 }
 
-// Delete_Menu deletes a menu item by ID
+// Delete_Menu archives a menu item by ID, its orders stay in history
 func (serv *DefaultMenuService) Delete_Menu(id int) (int, error) {
 	exist, err := serv.repo.IsMenuExist(id)
 	if err != nil {
@@ -98,7 +210,33 @@ func (serv *DefaultMenuService) Delete_Menu(id int) (int, error) {
 	if !exist {
 		return http.StatusNotFound, errors.New("menu not found")
 	}
-	err = serv.repo.Delete_Menu(id)
+	err = serv.repo.Archive_Menu(id)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusNoContent, nil
+}
+
+// Purge_Menu deletes an archived menu item for good, an item that was ever ordered can not be purged
+func (serv *DefaultMenuService) Purge_Menu(id int) (int, error) {
+	exist, err := serv.repo.IsMenuExist(id)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if !exist {
+		return http.StatusNotFound, errors.New("menu not found")
+	}
+	archived, err := serv.repo.IsMenuArchived(id)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if !archived {
+		return http.StatusConflict, errors.New("menu item must be archived before purge")
+	}
+	err = serv.repo.Purge_Menu(id)
+	if errors.Is(err, dal.ErrStillReferenced) {
+		return http.StatusConflict, err
+	}
 	if err != nil {
 		return http.StatusInternalServerError, err
 	}
@@ -135,3 +273,282 @@ func (serv *DefaultMenuService) GetMenuPriceHistory(w http.ResponseWriter, id in
 	}
 	return http.StatusOK, nil
 }
+
+// Retrieve_Variants retrieves the variants of a menu item with their recipes
+func (serv *DefaultMenuService) Retrieve_Variants(w http.ResponseWriter, id int) (int, error) {
+	exist, err := serv.repo.IsMenuExist(id)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if !exist {
+		return http.StatusNotFound, errors.New("menu not found")
+	}
+	variants, err := serv.repo.GetVariants(id)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if variants == nil {
+		variants = []models.MenuVariant{}
+	}
+	err = utils.Send_Request(variants, w)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusOK, nil
+}
+
+// Add_Variant adds a variant with its own price and recipe to a menu item
+func (serv *DefaultMenuService) Add_Variant(id int, variant models.MenuVariant, w http.ResponseWriter) (int, error) {
+	code, err := serv.checkVariant(id, 0, variant)
+	if err != nil {
+		return code, err
+	}
+	variant.MenuItemID = id
+	variantID, err := serv.repo.SaveVariant(variant)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	created, err := serv.repo.GetVariant(variantID)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	w.Header().Set("Location", fmt.Sprintf("/menu/%d/variants/%d", id, variantID))
+	err = utils.Send_Request_Status(created, http.StatusCreated, w)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusCreated, nil
+}
+
+// Update_Variant changes the name, price and recipe of a variant
+func (serv *DefaultMenuService) Update_Variant(id, variantID int, variant models.MenuVariant, w http.ResponseWriter) (int, error) {
+	exist, err := serv.repo.IsVariantExist(id, variantID)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if !exist {
+		return http.StatusNotFound, errors.New("variant not found")
+	}
+	code, err := serv.checkVariant(id, variantID, variant)
+	if err != nil {
+		return code, err
+	}
+	variant.ID = variantID
+	variant.MenuItemID = id
+	err = serv.repo.UpdateVariant(variant)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	updated, err := serv.repo.GetVariant(variantID)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	err = utils.Send_Request(updated, w)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusOK, nil
+}
+
+// Delete_Variant deletes a variant of a menu item
+func (serv *DefaultMenuService) Delete_Variant(id, variantID int) (int, error) {
+	exist, err := serv.repo.IsVariantExist(id, variantID)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if !exist {
+		return http.StatusNotFound, errors.New("variant not found")
+	}
+	err = serv.repo.DeleteVariant(variantID)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusNoContent, nil
+}
+
+// checkVariant checks that the menu item exists and is not archived, the variant name is unique within it
+// and the recipe ingredients exist in inventory
+func (serv *DefaultMenuService) checkVariant(id, variantID int, variant models.MenuVariant) (int, error) {
+	exist, err := serv.repo.IsMenuExist(id)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if !exist {
+		return http.StatusNotFound, errors.New("menu not found")
+	}
+	archived, err := serv.repo.IsMenuArchived(id)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if archived {
+		return http.StatusConflict, errors.New("menu item is archived")
+	}
+	unique, err := serv.repo.IsVariantUnique(id, variantID, variant.Name)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if !unique {
+		return http.StatusBadRequest, errors.New("variant name must be unique for the menu item")
+	}
+	exist, err = serv.repo.Check_Variant_Inventory(variant)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if !exist {
+		return http.StatusBadRequest, errors.New("variant ingredient is not exist in inventory")
+	}
+	for _, ingredient := range variant.Ingredients {
+		if code, err := serv.checkRecipeUnit(ingredient.InventoryID, ingredient.Unit); err != nil {
+			return code, err
+		}
+	}
+	return http.StatusOK, nil
+}
+
+// Retrieve_Modifiers retrieves the modifier groups of a menu item
+func (serv *DefaultMenuService) Retrieve_Modifiers(w http.ResponseWriter, id int) (int, error) {
+	exist, err := serv.repo.IsMenuExist(id)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if !exist {
+		return http.StatusNotFound, errors.New("menu not found")
+	}
+	groups, err := serv.repo.GetModifierGroups(id)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if groups == nil {
+		groups = []models.ModifierGroup{}
+	}
+	err = utils.Send_Request(groups, w)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusOK, nil
+}
+
+// Add_Modifier_Group adds a modifier group with its options to a menu item
+func (serv *DefaultMenuService) Add_Modifier_Group(id int, group models.ModifierGroup, w http.ResponseWriter) (int, error) {
+	code, err := serv.checkModifierGroup(id, 0, group)
+	if err != nil {
+		return code, err
+	}
+	group.MenuItemID = id
+	groupID, err := serv.repo.SaveModifierGroup(group)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	created, err := serv.repo.GetModifierGroup(groupID)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	w.Header().Set("Location", fmt.Sprintf("/menu/%d/modifiers/%d", id, groupID))
+	err = utils.Send_Request_Status(created, http.StatusCreated, w)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusCreated, nil
+}
+
+// Update_Modifier_Group changes a modifier group and its options, orders keep the options they were made with
+func (serv *DefaultMenuService) Update_Modifier_Group(id, groupID int, group models.ModifierGroup, w http.ResponseWriter) (int, error) {
+	exist, err := serv.repo.IsModifierGroupExist(id, groupID)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if !exist {
+		return http.StatusNotFound, errors.New("modifier group not found")
+	}
+	code, err := serv.checkModifierGroup(id, groupID, group)
+	if err != nil {
+		return code, err
+	}
+	group.ID = groupID
+	group.MenuItemID = id
+	err = serv.repo.UpdateModifierGroup(group)
+	if errors.Is(err, dal.ErrModifierOptionNotFound) {
+		return http.StatusBadRequest, err
+	}
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	updated, err := serv.repo.GetModifierGroup(groupID)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	err = utils.Send_Request(updated, w)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusOK, nil
+}
+
+// Delete_Modifier_Group deletes a modifier group of a menu item
+func (serv *DefaultMenuService) Delete_Modifier_Group(id, groupID int) (int, error) {
+	exist, err := serv.repo.IsModifierGroupExist(id, groupID)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if !exist {
+		return http.StatusNotFound, errors.New("modifier group not found")
+	}
+	err = serv.repo.DeleteModifierGroup(groupID)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusNoContent, nil
+}
+
+// checkModifierGroup checks that the menu item exists and is not archived, the group name is unique within it
+// and the option ingredients exist in inventory
+func (serv *DefaultMenuService) checkModifierGroup(id, groupID int, group models.ModifierGroup) (int, error) {
+	exist, err := serv.repo.IsMenuExist(id)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if !exist {
+		return http.StatusNotFound, errors.New("menu not found")
+	}
+	archived, err := serv.repo.IsMenuArchived(id)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if archived {
+		return http.StatusConflict, errors.New("menu item is archived")
+	}
+	unique, err := serv.repo.IsModifierGroupUnique(id, groupID, group.Name)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if !unique {
+		return http.StatusBadRequest, errors.New("modifier group name must be unique for the menu item")
+	}
+	exist, err = serv.repo.Check_Modifier_Inventory(group)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if !exist {
+		return http.StatusBadRequest, errors.New("modifier ingredient is not exist in inventory")
+	}
+	for _, option := range group.Options {
+		for _, ingredient := range option.Ingredients {
+			if code, err := serv.checkRecipeUnit(ingredient.InventoryID, ingredient.Unit); err != nil {
+				return code, err
+			}
+		}
+	}
+	return http.StatusOK, nil
+}
+
+// checkRecipeUnit checks that the recipe quantity unit is registered and measures the same as the stock unit
+func (serv *DefaultMenuService) checkRecipeUnit(inventory_id int, unit string) (int, error) {
+	err := serv.repo.CheckRecipeUnit(inventory_id, unit)
+	if dal.IsUnitErr(err) {
+		return http.StatusBadRequest, err
+	}
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusOK, nil
+}
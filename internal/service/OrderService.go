@@ -1,27 +1,56 @@
 package service
 
 import (
+	"database/sql"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"frappuccino/internal/dal"
 	"frappuccino/internal/utils"
 	"frappuccino/models"
 	"log/slog"
+	"math"
 	"net/http"
 	"strconv"
 	"time"
 )
 
 type OrderService interface {
-	Create_Order(newOrder models.Order) (int, error)
+	Create_Order(newOrder models.Order, w http.ResponseWriter) (int, error)
 	Retrieve_All_Orders(w http.ResponseWriter) (int, error)
 	Retrieve_Order(w http.ResponseWriter, id int) (int, error)
 	Update_Order(order models.Order, id int) (int, error)
+	Patch_Order(id int, patch models.OrderPatch, w http.ResponseWriter) (int, error)
 	Delete_Order(id int) (int, error)
 	Close_Order(id int, w http.ResponseWriter) (int, error)
+	Change_Order_Status(id int, change models.OrderStatusChange, w http.ResponseWriter) (int, error)
+	Cancel_Order(id int, reason string, w http.ResponseWriter) (int, error)
+	Refund_Order(id int, refund models.OrderRefund, w http.ResponseWriter) (int, error)
+	Retrieve_Refunds(w http.ResponseWriter, id int) (int, error)
 	BatchProcessOrders(w http.ResponseWriter, r *http.Request)
 }
 
+// orderTransitions lists the statuses every order status is allowed to move to
+var orderTransitions = map[string][]string{
+	models.StatusPending:   {models.StatusActive, models.StatusCancelled},
+	models.StatusActive:    {models.StatusPreparing, models.StatusClosed, models.StatusCancelled},
+	models.StatusPreparing: {models.StatusReady, models.StatusCancelled},
+	models.StatusReady:     {models.StatusPickedUp, models.StatusClosed},
+	models.StatusPickedUp:  {models.StatusClosed},
+	models.StatusClosed:    {},
+	models.StatusCancelled: {},
+}
+
+// canTransition reports whether an order may move from one status to another
+func canTransition(from, to string) bool {
+	for _, next := range orderTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
 type DefaultOrderService struct {
 	repo dal.NewOrderRepo
 }
@@ -30,32 +59,69 @@ func NewDefaultOrderService(repo dal.NewOrderRepo) *DefaultOrderService {
 	return &DefaultOrderService{repo: repo}
 }
 
-func (s *DefaultOrderService) Create_Order(newOrder models.Order) (int, error) {
+// Create_Order saves the order, reserves its ingredients and responds with the created order.
+// The order starts active unless it is created pending, a pending order holds its reservation until it is activated or cancelled
+func (s *DefaultOrderService) Create_Order(newOrder models.Order, w http.ResponseWriter) (int, error) {
 	date := time.Now()
-	code, err := s.repo.CheckOrder(newOrder)
+	code, err := s.repo.CheckOrder(s.repo.DB, newOrder)
 	if err != nil {
 		return code, err
 	}
 	newOrder.CreatedAt = date
-	newOrder.Status = "active"
+	if newOrder.Status == "" {
+		newOrder.Status = models.StatusActive
+	}
 	err = s.repo.GetPriceAtOrderItems(&newOrder)
 	if err != nil {
 		return http.StatusInternalServerError, err
 	}
 	err = s.repo.GetTotalAmount(&newOrder)
+	if errors.Is(err, dal.ErrPromoCodeNotApplicable) {
+		return http.StatusBadRequest, err
+	}
 	if err != nil {
 		return http.StatusInternalServerError, err
 	}
-	if exist := dal.DefaultCustomerRepo(s.repo.DB).IsCustomerExist(newOrder.CustomerID); !exist {
-		return http.StatusBadRequest, errors.New("customer id is not exist")
+	if exist := dal.DefaultCustomerRepo(s.repo.DB).IsCustomerActive(newOrder.CustomerID); !exist {
+		return http.StatusBadRequest, errors.New("customer id is not exist or archived")
 	}
 
-	err = s.repo.SaveOrder(newOrder)
+	needInventory, err := s.repo.Get_Need_Inventory(newOrder)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	err = dal.WithTx(s.repo.DB, func(tx *sql.Tx) error {
+		newOrder.ID, err = s.repo.SaveOrder(tx, newOrder)
+		if err != nil {
+			return err
+		}
+		if newOrder.Loyalty != nil {
+			if err := s.repo.RedeemLoyalty(tx, newOrder); err != nil {
+				return err
+			}
+		}
+		return dal.DefaultInventRepo(s.repo.DB).ReserveInventory(tx, newOrder.ID, needInventory)
+	})
+	if errors.Is(err, dal.ErrNotEnoughInventory) || errors.Is(err, dal.ErrNotEnoughPoints) || errors.Is(err, dal.ErrLoyaltyDisabled) {
+		return http.StatusConflict, err
+	}
+	if errors.Is(err, dal.ErrRewardNotAvailable) || errors.Is(err, dal.ErrRewardNotInOrder) || errors.Is(err, dal.ErrDiscountOverTotal) {
+		return http.StatusBadRequest, err
+	}
 	if err != nil {
 		slog.Error("Failed to create order", "Save Order function", err)
 		return http.StatusInternalServerError, err
 	}
-	return http.StatusOK, nil
+	created, err := s.repo.GetOrder(newOrder.ID)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	w.Header().Set("Location", fmt.Sprintf("/orders/%d", newOrder.ID))
+	err = utils.Send_Request_Status(created, http.StatusCreated, w)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusCreated, nil
 }
 
 func (s *DefaultOrderService) Retrieve_All_Orders(w http.ResponseWriter) (int, error) {
@@ -94,6 +160,112 @@ func (s *DefaultOrderService) Update_Order(order models.Order, id int) (int, err
 	return s.repo.UpdateOrder(order, id)
 }
 
+// Patch_Order edits single lines of an open order, keeping its ID, creation date and status.
+// Only the changed lines are priced and checked against inventory, changed lines keep their unit price
+func (s *DefaultOrderService) Patch_Order(id int, patch models.OrderPatch, w http.ResponseWriter) (int, error) {
+	exist, err := s.repo.IsOrderExist(id)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if !exist {
+		return http.StatusNotFound, errors.New("order not found")
+	}
+	order, err := s.repo.GetOrder(id)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if order.Status != models.StatusPending && order.Status != models.StatusActive {
+		return http.StatusConflict, dal.ErrOrderNotEditable
+	}
+	lines := make(map[int]models.OrderItem)
+	for _, item := range order.Items {
+		lines[item.ID] = item
+	}
+
+	// changed holds the signed quantity differences used to adjust the reservation
+	var changed models.Order
+	removed := make(map[int]bool)
+	var removedIDs []int
+	for _, orderItemID := range patch.RemoveItems {
+		line, ok := lines[orderItemID]
+		if !ok {
+			return http.StatusBadRequest, errors.New("order item does not belong to the order: " + strconv.Itoa(orderItemID))
+		}
+		if removed[orderItemID] {
+			continue
+		}
+		removed[orderItemID] = true
+		removedIDs = append(removedIDs, orderItemID)
+		changed.Items = append(changed.Items, models.OrderItem{MenuItemID: line.MenuItemID, VariantID: line.VariantID, Quantity: -line.Quantity, Modifiers: line.Modifiers})
+	}
+
+	var updated []models.OrderItem
+	seen := make(map[int]bool)
+	for _, change := range patch.UpdateItems {
+		line, ok := lines[change.ID]
+		if !ok {
+			return http.StatusBadRequest, errors.New("order item does not belong to the order: " + strconv.Itoa(change.ID))
+		}
+		if removed[change.ID] || seen[change.ID] {
+			return http.StatusBadRequest, fmt.Errorf("order item %d is changed more than once", change.ID)
+		}
+		seen[change.ID] = true
+		if change.Quantity == line.Quantity {
+			continue
+		}
+		price := math.Round(line.PriceAtOrderTime/float64(line.Quantity)*float64(change.Quantity)*100) / 100
+		changed.Items = append(changed.Items, models.OrderItem{MenuItemID: line.MenuItemID, VariantID: line.VariantID, Quantity: change.Quantity - line.Quantity, Modifiers: line.Modifiers})
+		line.Quantity = change.Quantity
+		line.PriceAtOrderTime = price
+		updated = append(updated, line)
+	}
+
+	added := models.Order{Items: patch.AddItems}
+	code, err := s.repo.CheckProducts(added)
+	if err != nil {
+		return code, err
+	}
+	err = s.repo.GetPriceAtOrderItems(&added)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	changed.Items = append(changed.Items, added.Items...)
+	if len(order.Items)-len(removedIDs)+len(added.Items) == 0 {
+		return http.StatusBadRequest, errors.New("order must contain at least one item")
+	}
+
+	needInventory, err := s.repo.Get_Need_Inventory(changed)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if patch.SpecialInstructions != nil {
+		order.SpecialInstructions = patch.SpecialInstructions
+	}
+	err = dal.WithTx(s.repo.DB, func(tx *sql.Tx) error {
+		err := s.repo.PatchOrder(tx, order, added.Items, updated, removedIDs)
+		if err != nil {
+			return err
+		}
+		return dal.DefaultInventRepo(s.repo.DB).ReserveInventory(tx, id, needInventory)
+	})
+	if errors.Is(err, dal.ErrNotEnoughInventory) || errors.Is(err, dal.ErrOrderNotEditable) || errors.Is(err, dal.ErrDiscountOverTotal) {
+		return http.StatusConflict, err
+	}
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	patched, err := s.repo.GetOrder(id)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	err = utils.Send_Request(patched, w)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusOK, nil
+}
+
 func (s *DefaultOrderService) Delete_Order(id int) (int, error) {
 	exist, err := s.repo.IsOrderExist(id)
 	if err != nil {
@@ -102,6 +274,13 @@ func (s *DefaultOrderService) Delete_Order(id int) (int, error) {
 	if !exist {
 		return http.StatusNotFound, errors.New("order not found")
 	}
+	order, err := s.repo.GetOrder(id)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if order.Status == models.StatusClosed {
+		return http.StatusConflict, errors.New("closed orders cannot be deleted, refund them instead")
+	}
 	err = s.repo.DeleteOrder(id)
 	if err != nil {
 		return http.StatusInternalServerError, err
@@ -110,6 +289,15 @@ func (s *DefaultOrderService) Delete_Order(id int) (int, error) {
 }
 
 func (s *DefaultOrderService) Close_Order(id int, w http.ResponseWriter) (int, error) {
+	return s.Change_Order_Status(id, models.OrderStatusChange{Status: models.StatusClosed}, w)
+}
+
+// Change_Order_Status moves the order through its lifecycle, rejecting transitions the state machine does not allow
+func (s *DefaultOrderService) Change_Order_Status(id int, change models.OrderStatusChange, w http.ResponseWriter) (int, error) {
+	status := change.Status
+	if _, known := orderTransitions[status]; !known {
+		return http.StatusBadRequest, errors.New("unknown order status: " + status)
+	}
 	exist, err := s.repo.IsOrderExist(id)
 	if err != nil {
 		return http.StatusInternalServerError, err
@@ -121,21 +309,162 @@ func (s *DefaultOrderService) Close_Order(id int, w http.ResponseWriter) (int, e
 	if err != nil {
 		return http.StatusInternalServerError, err
 	}
-	if order.Status == "closed" {
-		return http.StatusBadRequest, errors.New("order is already closed")
+	if order.Status == status {
+		return http.StatusConflict, errors.New("order is already " + status)
+	}
+	if !canTransition(order.Status, status) {
+		return http.StatusConflict, fmt.Errorf("order status cannot be changed from %s to %s", order.Status, status)
+	}
+	if status == models.StatusClosed {
+		return s.closeOrder(order, w)
+	}
+	err = s.repo.ChangeOrderStatus(id, order.Status, status, change.Reason)
+	if errors.Is(err, dal.ErrOrderStatusConflict) {
+		return http.StatusConflict, err
 	}
-	need_invent, err := s.repo.Get_Need_Inventory(order)
 	if err != nil {
 		return http.StatusInternalServerError, err
 	}
-	enough, err := s.repo.Is_Enough(need_invent)
+	order.Status = status
+	err = utils.Send_Request(order, w)
 	if err != nil {
 		return http.StatusInternalServerError, err
 	}
-	if !enough {
-		return http.StatusConflict, errors.New("not enough inventory")
+	return http.StatusOK, nil
+}
+
+// Cancel_Order cancels an order that has not been closed yet and logs the reason
+func (s *DefaultOrderService) Cancel_Order(id int, reason string, w http.ResponseWriter) (int, error) {
+	return s.Change_Order_Status(id, models.OrderStatusChange{Status: models.StatusCancelled, Reason: reason}, w)
+}
+
+// Refund_Order refunds a closed order fully or by line items, returning the used ingredients to inventory.
+// A line is refunded by what was paid for it after discounts and the loyalty points earned on the refund are taken back
+func (s *DefaultOrderService) Refund_Order(id int, refund models.OrderRefund, w http.ResponseWriter) (int, error) {
+	exist, err := s.repo.IsOrderExist(id)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if !exist {
+		return http.StatusNotFound, errors.New("order not found")
+	}
+	order, err := s.repo.GetOrder(id)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if order.Status != models.StatusClosed {
+		return http.StatusConflict, errors.New("only closed orders can be refunded")
+	}
+	refunded, err := s.repo.GetRefundedQuantities(id)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	netAmounts, err := s.repo.GetLineNetAmounts(id)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	orderItems := make(map[int]models.OrderItem)
+	for _, item := range order.Items {
+		orderItems[item.ID] = item
+	}
+
+	// Full refund takes everything that was not refunded before
+	requested := make(map[int]int)
+	var itemOrder []int
+	if len(refund.Items) == 0 {
+		for _, item := range order.Items {
+			if remaining := item.Quantity - refunded[item.ID]; remaining > 0 {
+				requested[item.ID] = remaining
+				itemOrder = append(itemOrder, item.ID)
+			}
+		}
+		if len(requested) == 0 {
+			return http.StatusConflict, errors.New("order is already fully refunded")
+		}
+	}
+	for _, item := range refund.Items {
+		if _, ok := orderItems[item.OrderItemID]; !ok {
+			return http.StatusBadRequest, errors.New("order item does not belong to the order: " + strconv.Itoa(item.OrderItemID))
+		}
+		if _, ok := requested[item.OrderItemID]; !ok {
+			itemOrder = append(itemOrder, item.OrderItemID)
+		}
+		requested[item.OrderItemID] += item.Quantity
+	}
+
+	refund.OrderID = id
+	refund.Items = nil
+	refund.Amount = 0
+	var returned models.Order
+	for _, orderItemID := range itemOrder {
+		orderItem := orderItems[orderItemID]
+		quantity := requested[orderItemID]
+		if quantity > orderItem.Quantity-refunded[orderItemID] {
+			return http.StatusConflict, fmt.Errorf("cannot refund %d of order item %d, only %d left", quantity, orderItemID, orderItem.Quantity-refunded[orderItemID])
+		}
+		amount := -math.Round(netAmounts[orderItemID]*float64(quantity)/float64(orderItem.Quantity)*100) / 100
+		refund.Items = append(refund.Items, models.RefundItem{
+			OrderItemID: orderItemID,
+			Quantity:    quantity,
+			Amount:      amount,
+		})
+		refund.Amount += amount
+		returnedItem := orderItem
+		returnedItem.Quantity = quantity
+		returned.Items = append(returned.Items, returnedItem)
+	}
+	refund.Amount = math.Round(refund.Amount*100) / 100
+
+	needInventory, err := s.repo.Get_Need_Inventory(returned)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	refund.ID, err = s.repo.SaveRefund(refund, needInventory)
+	if errors.Is(err, dal.ErrRefundOverQuantity) || errors.Is(err, dal.ErrOrderStatusConflict) {
+		return http.StatusConflict, err
+	}
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	refund.CreatedAt = time.Now()
+	err = utils.Send_Request_Status(refund, http.StatusCreated, w)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusCreated, nil
+}
+
+// Retrieve_Refunds retrieves every refund made for the order
+func (s *DefaultOrderService) Retrieve_Refunds(w http.ResponseWriter, id int) (int, error) {
+	exist, err := s.repo.IsOrderExist(id)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if !exist {
+		return http.StatusNotFound, errors.New("order not found")
+	}
+	refunds, err := s.repo.GetRefunds(id)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if refunds == nil {
+		refunds = []models.OrderRefund{}
+	}
+	err = utils.Send_Request(refunds, w)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusOK, nil
+}
+
+// closeOrder turns the order reservation into consumption and reports the items that need to be replenished
+func (s *DefaultOrderService) closeOrder(order models.Order, w http.ResponseWriter) (int, error) {
+	err := dal.WithTx(s.repo.DB, func(tx *sql.Tx) error {
+		return s.repo.CloseOrder(tx, order.ID)
+	})
+	if errors.Is(err, dal.ErrOrderStatusConflict) || errors.Is(err, dal.ErrNotEnoughInventory) {
+		return http.StatusConflict, err
 	}
-	err = s.repo.CloseOrder(id)
 	if err != nil {
 		return http.StatusInternalServerError, err
 	}
@@ -160,12 +489,21 @@ func (s *DefaultOrderService) Close_Order(id int, w http.ResponseWriter) (int, e
 	return http.StatusOK, nil
 }
 
+// BatchProcessOrders creates and closes several orders at once.
+// By default the batch is all-or-nothing: one rejected order rolls back the whole batch.
+// With mode=best_effort every accepted order is committed on its own and each outcome is reported.
 func (s *DefaultOrderService) BatchProcessOrders(w http.ResponseWriter, r *http.Request) {
 	var request models.BatchProcessRequest
 	var response models.BatchProcessResponse
-	var totalRevenue float64
-	var accepted, rejected int
-	var inventoryUpdates []models.InventoryUpdate
+
+	mode := r.URL.Query().Get("mode")
+	if mode == "" {
+		mode = models.BatchAllOrNothing
+	}
+	if mode != models.BatchAllOrNothing && mode != models.BatchBestEffort {
+		utils.Log_Err_Handler(errors.New("mode can only be '"+models.BatchAllOrNothing+"' or '"+models.BatchBestEffort+"'"), http.StatusBadRequest, w)
+		return
+	}
 
 	// Decode the request body
 	err := json.NewDecoder(r.Body).Decode(&request)
@@ -174,156 +512,231 @@ func (s *DefaultOrderService) BatchProcessOrders(w http.ResponseWriter, r *http.
 		return
 	}
 
-	// Start a transaction
-	tx, err := s.repo.DB.Begin()
+	if mode == models.BatchAllOrNothing {
+		err = s.processBatchAtomic(request.Orders, &response)
+	} else {
+		err = s.processBatchBestEffort(request.Orders, &response)
+	}
+	if err != nil {
+		utils.Log_Err_Handler(err, http.StatusInternalServerError, w)
+		return
+	}
+	response.Summary.Mode = mode
+	response.Summary.TotalOrders = len(request.Orders)
+
+	// Send response
+	status := http.StatusOK
+	if mode == models.BatchAllOrNothing && response.Summary.Rejected > 0 {
+		status = http.StatusConflict
+	}
+	err = utils.Send_Request_Status(response, status, w)
 	if err != nil {
 		utils.Log_Err_Handler(err, http.StatusInternalServerError, w)
 		return
 	}
+	slog.Info("Order batch process has been succesfully completed", "mode", mode)
+}
+
+// processBatchAtomic runs the whole batch in one transaction, so later orders see the deductions of earlier ones
+func (s *DefaultOrderService) processBatchAtomic(orders []models.Order, response *models.BatchProcessResponse) error {
+	tx, err := s.repo.DB.Begin()
+	if err != nil {
+		return err
+	}
 	defer func() {
 		if r := recover(); r != nil {
 			tx.Rollback()
+			panic(r)
 		}
 	}()
-	for _, order := range request.Orders {
-		status := "accepted"
-		var reason string
-		if len(order.Items) == 0 {
-			status = "rejected"
-			reason = "invalid order:order items is empty"
+	var updates []models.InventoryUpdate
+	for _, order := range orders {
+		processed, orderUpdates, err := s.processBatchOrder(tx, order)
+		if err != nil {
+			tx.Rollback()
+			return err
 		}
-		for _, item := range order.Items {
-			exists, err := s.repo.ProductID_Exists(strconv.Itoa(item.MenuItemID))
-			if err != nil {
-				status = "rejected"
-				reason = "error occured: " + err.Error()
-			}
-			if !exists {
-				status = "rejected"
-				reason = "ordered item does not exist: " + strconv.Itoa(item.MenuItemID)
-			}
+		response.ProcessedOrders = append(response.ProcessedOrders, processed)
+		if processed.Status == "accepted" {
+			response.Summary.Accepted++
+			response.Summary.TotalRevenue += processed.Total
+			updates = append(updates, orderUpdates...)
+		} else {
+			response.Summary.Rejected++
 		}
+	}
+	if response.Summary.Rejected == 0 {
+		response.Summary.InventoryUpdates = updates
+		return tx.Commit()
+	}
+
+	// Nothing is saved when at least one order is rejected
+	if err := tx.Rollback(); err != nil {
+		return err
+	}
+	for i := range response.ProcessedOrders {
+		if response.ProcessedOrders[i].Status == "accepted" {
+			response.ProcessedOrders[i].Status = "rolled_back"
+			response.ProcessedOrders[i].OrderID = 0
+			response.ProcessedOrders[i].Reason = "batch was rolled back because some orders were rejected"
+		}
+	}
+	response.Summary.Accepted = 0
+	response.Summary.TotalRevenue = 0
+	return nil
+}
 
-		// Validate and check inventory
-		needInventory, err := s.repo.Get_Need_Inventory(order)
+// processBatchBestEffort commits every accepted order in its own transaction
+func (s *DefaultOrderService) processBatchBestEffort(orders []models.Order, response *models.BatchProcessResponse) error {
+	for _, order := range orders {
+		tx, err := s.repo.DB.Begin()
 		if err != nil {
-			status = "rejected"
-			reason = "invalid_order"
-		} else {
-			enough, err := s.repo.Is_Enough(needInventory)
-			if err != nil {
-				status = "rejected"
-				reason = "invalid order"
-			}
-			if !enough {
-				status = "rejected"
-				reason = "insufficient_inventory"
-			}
+			return err
 		}
-		if exist := dal.DefaultCustomerRepo(s.repo.DB).IsCustomerExist(order.CustomerID); !exist {
-			status = "rejected"
-			reason = "customer id is not exist"
+		processed, orderUpdates, err := s.processBatchOrder(tx, order)
+		if err != nil {
+			tx.Rollback()
+			return err
 		}
-		// Process the order if valid
-		if status == "accepted" {
-			date := time.Now()
-			code, err := s.repo.CheckOrder(order)
-			if err != nil {
-				tx.Rollback()
-				utils.Log_Err_Handler(err, code, w)
-				return
-			}
-			order.CreatedAt = date
-			order.Status = "active"
-			err = s.repo.GetPriceAtOrderItems(&order)
-			if err != nil {
-				tx.Rollback()
-				utils.Log_Err_Handler(err, http.StatusInternalServerError, w)
-				return
-			}
-			err = s.repo.GetTotalAmount(&order)
-			if err != nil {
-				tx.Rollback()
-				utils.Log_Err_Handler(err, http.StatusInternalServerError, w)
-				return
-			}
-			err = s.repo.SaveOrder(order)
-			if err != nil {
-				tx.Rollback()
-				utils.Log_Err_Handler(err, http.StatusInternalServerError, w)
-				return
-			}
-			order.ID, err = s.repo.GetLastOrderId()
-			if err != nil {
-				tx.Rollback()
-				utils.Log_Err_Handler(err, http.StatusInternalServerError, w)
-				return
-			}
-			// Update inventory
-			err = s.repo.CloseOrder(order.ID)
-			if err != nil {
-				tx.Rollback()
-				utils.Log_Err_Handler(err, http.StatusInternalServerError, w)
-				return
-			}
-
-			// Update revenue and inventory updates
-			totalRevenue += order.TotalAmount
-			for ingredientID, quantityUsed := range needInventory {
-				num, err := strconv.Atoi(ingredientID)
-				if err != nil {
-					tx.Rollback()
-					utils.Log_Err_Handler(err, http.StatusInternalServerError, w)
-					return
-				}
-				inventory, err := dal.DefaultInventRepo(s.repo.DB).GetInventory(num)
-				if err != nil {
-					tx.Rollback()
-					utils.Log_Err_Handler(err, http.StatusInternalServerError, w)
-					return
-				}
-				inventoryUpdates = append(inventoryUpdates, models.InventoryUpdate{
-					IngredientID: ingredientID,
-					QuantityUsed: quantityUsed,
-					Remaining:    inventory.StockLevel, // Retrieve the updated stock from DB if needed
-				})
-			}
-			accepted++
-		} else {
-			rejected++
+		if processed.Status != "accepted" {
+			tx.Rollback()
+			response.Summary.Rejected++
+			response.ProcessedOrders = append(response.ProcessedOrders, processed)
+			continue
 		}
+		if err := tx.Commit(); err != nil {
+			processed.Status = "rejected"
+			processed.OrderID = 0
+			processed.Reason = "failed to save order: " + err.Error()
+			response.Summary.Rejected++
+			response.ProcessedOrders = append(response.ProcessedOrders, processed)
+			continue
+		}
+		response.Summary.Accepted++
+		response.Summary.TotalRevenue += processed.Total
+		response.Summary.InventoryUpdates = append(response.Summary.InventoryUpdates, orderUpdates...)
+		response.ProcessedOrders = append(response.ProcessedOrders, processed)
+	}
+	return nil
+}
 
-		// Add to processed orders
-		response.ProcessedOrders = append(response.ProcessedOrders, models.ProcessedOrder{
-			OrderID:    order.ID,
-			CustomerID: order.CustomerID,
-			Status:     status,
-			Total:      order.TotalAmount,
-			Reason:     reason,
-		})
+// processBatchOrder validates, saves and closes a single order of the batch within the given transaction.
+// Invalid orders are reported as rejected, an error is returned only when the database fails.
+func (s *DefaultOrderService) processBatchOrder(tx *sql.Tx, order models.Order) (models.ProcessedOrder, []models.InventoryUpdate, error) {
+	processed := models.ProcessedOrder{
+		CustomerID: order.CustomerID,
+		Status:     "rejected",
+	}
+	if len(order.Items) == 0 {
+		processed.Reason = "invalid order:order items is empty"
+		return processed, nil, nil
+	}
+	if order.Loyalty != nil {
+		processed.Reason = "invalid order:loyalty points can not be redeemed in a batch"
+		return processed, nil, nil
+	}
+	if order.Status != "" && order.Status != models.StatusActive {
+		processed.Reason = "invalid order:batch orders are closed at once, status must be empty or active"
+		return processed, nil, nil
+	}
+	for _, item := range order.Items {
+		if item.Quantity <= 0 {
+			processed.Reason = "invalid order:quantity must be greater than 0"
+			return processed, nil, nil
+		}
+		exists, err := s.repo.ProductID_Exists(strconv.Itoa(item.MenuItemID))
+		if err != nil {
+			return processed, nil, err
+		}
+		if !exists {
+			processed.Reason = "ordered item does not exist or is archived: " + strconv.Itoa(item.MenuItemID)
+			return processed, nil, nil
+		}
+		soldOut, err := s.repo.IsSoldOut(item.MenuItemID)
+		if err != nil {
+			return processed, nil, err
+		}
+		if soldOut {
+			processed.Reason = "ordered item is sold out: " + strconv.Itoa(item.MenuItemID)
+			return processed, nil, nil
+		}
+		code, err := s.repo.CheckItemVariant(item)
+		if err == nil {
+			code, err = s.repo.CheckItemModifiers(item)
+		}
+		if code == http.StatusInternalServerError {
+			return processed, nil, err
+		}
+		if err != nil {
+			processed.Reason = err.Error()
+			return processed, nil, nil
+		}
+	}
+	if exist := dal.DefaultCustomerRepo(s.repo.DB).IsCustomerActive(order.CustomerID); !exist {
+		processed.Reason = "customer id is not exist or archived"
+		return processed, nil, nil
 	}
 
-	// Commit the transaction
-	if err := tx.Commit(); err != nil {
-		tx.Rollback()
-		utils.Log_Err_Handler(err, http.StatusInternalServerError, w)
-		return
+	// Validate and check inventory, earlier orders of the batch are visible through tx
+	needInventory, err := s.repo.Get_Need_Inventory(order)
+	if err != nil {
+		return processed, nil, err
+	}
+	enough, err := s.repo.Is_Enough(tx, needInventory)
+	if err != nil {
+		return processed, nil, err
+	}
+	if !enough {
+		processed.Reason = "insufficient_inventory"
+		return processed, nil, nil
 	}
 
-	// Prepare the response summary
-	response.Summary = models.BatchProcessSummary{
-		TotalOrders:      len(request.Orders),
-		Accepted:         accepted,
-		Rejected:         rejected,
-		TotalRevenue:     totalRevenue,
-		InventoryUpdates: inventoryUpdates,
+	order.CreatedAt = time.Now()
+	order.Status = models.StatusActive
+	if err := s.repo.GetPriceAtOrderItems(&order); err != nil {
+		return processed, nil, err
+	}
+	err = s.repo.GetTotalAmount(&order)
+	if errors.Is(err, dal.ErrPromoCodeNotApplicable) {
+		processed.Reason = err.Error()
+		return processed, nil, nil
+	}
+	if err != nil {
+		return processed, nil, err
+	}
+	order.ID, err = s.repo.SaveOrder(tx, order)
+	if err != nil {
+		return processed, nil, err
+	}
+	// Update inventory
+	err = s.repo.CloseOrder(tx, order.ID)
+	if errors.Is(err, dal.ErrNotEnoughInventory) {
+		processed.Reason = "insufficient_inventory"
+		return processed, nil, nil
+	}
+	if err != nil {
+		return processed, nil, err
 	}
 
-	// Send response
-	err = utils.Send_Request(response, w)
+	ids := make([]string, 0, len(needInventory))
+	for ingredientID := range needInventory {
+		ids = append(ids, ingredientID)
+	}
+	remaining, err := dal.DefaultInventRepo(s.repo.DB).GetStockLevels(tx, ids)
 	if err != nil {
-		utils.Log_Err_Handler(err, http.StatusInternalServerError, w)
-		return
+		return processed, nil, err
+	}
+	var updates []models.InventoryUpdate
+	for _, ingredientID := range ids {
+		updates = append(updates, models.InventoryUpdate{
+			IngredientID: ingredientID,
+			QuantityUsed: needInventory[ingredientID],
+			Remaining:    remaining[ingredientID],
+		})
 	}
-	slog.Info("Order batch process has been succesfully completed")
+
+	processed.OrderID = order.ID
+	processed.Status = "accepted"
+	processed.Total = order.TotalAmount
+	return processed, updates, nil
 }
@@ -0,0 +1,60 @@
+package service
+
+import (
+	"frappuccino/models"
+	"testing"
+)
+
+func TestCanTransition(t *testing.T) {
+	statuses := []string{
+		models.StatusPending, models.StatusActive, models.StatusPreparing, models.StatusReady,
+		models.StatusPickedUp, models.StatusClosed, models.StatusCancelled,
+	}
+	allowed := map[[2]string]bool{
+		{models.StatusPending, models.StatusActive}:      true,
+		{models.StatusPending, models.StatusCancelled}:   true,
+		{models.StatusActive, models.StatusPreparing}:    true,
+		{models.StatusActive, models.StatusClosed}:       true,
+		{models.StatusActive, models.StatusCancelled}:    true,
+		{models.StatusPreparing, models.StatusReady}:     true,
+		{models.StatusPreparing, models.StatusCancelled}: true,
+		{models.StatusReady, models.StatusPickedUp}:      true,
+		{models.StatusReady, models.StatusClosed}:        true,
+		{models.StatusPickedUp, models.StatusClosed}:     true,
+	}
+	if len(orderTransitions) != len(statuses) {
+		t.Errorf("orderTransitions has %d statuses, want %d", len(orderTransitions), len(statuses))
+	}
+	for _, from := range statuses {
+		for _, to := range statuses {
+			want := allowed[[2]string{from, to}]
+			if got := canTransition(from, to); got != want {
+				t.Errorf("canTransition(%s, %s) = %v, want %v", from, to, got, want)
+			}
+		}
+	}
+}
+
+func TestCanTransitionRejects(t *testing.T) {
+	tests := []struct {
+		name     string
+		from, to string
+	}{
+		{"closed back to preparing", models.StatusClosed, models.StatusPreparing},
+		{"closed to cancelled", models.StatusClosed, models.StatusCancelled},
+		{"cancelled back to active", models.StatusCancelled, models.StatusActive},
+		{"pending straight to closed", models.StatusPending, models.StatusClosed},
+		{"active straight to ready", models.StatusActive, models.StatusReady},
+		{"picked up back to ready", models.StatusPickedUp, models.StatusReady},
+		{"ready cancelled after it was made", models.StatusReady, models.StatusCancelled},
+		{"unknown from status", "lost", models.StatusActive},
+		{"unknown to status", models.StatusActive, "lost"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if canTransition(test.from, test.to) {
+				t.Errorf("canTransition(%s, %s) = true, want false", test.from, test.to)
+			}
+		})
+	}
+}
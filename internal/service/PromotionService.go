@@ -0,0 +1,144 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"frappuccino/internal/dal"
+	"frappuccino/internal/utils"
+	"frappuccino/models"
+	"net/http"
+	"strconv"
+)
+
+type PromotionService interface {
+	Retrieve_All_Promotions(w http.ResponseWriter) (int, error)
+	Retrieve_Promotion(w http.ResponseWriter, id int) (int, error)
+	Add_Promotion(promotion models.Promotion, w http.ResponseWriter) (int, error)
+	Update_Promotion(promotion models.Promotion, id int) (int, error)
+	Delete_Promotion(id int) (int, error)
+}
+
+type DefaultPromotionService struct {
+	repo         dal.PromotionRepo
+	menuRepo     dal.MenuRepo
+	customerRepo dal.CustomerRepo
+}
+
+func NewDefaultPromotionService(repo dal.PromotionRepo, menuRepo dal.MenuRepo, customerRepo dal.CustomerRepo) *DefaultPromotionService {
+	return &DefaultPromotionService{repo: repo, menuRepo: menuRepo, customerRepo: customerRepo}
+}
+
+// Retrieve_All_Promotions retrieves all promotions
+func (serv *DefaultPromotionService) Retrieve_All_Promotions(w http.ResponseWriter) (int, error) {
+	promotions, err := serv.repo.GetPromotions()
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	err = utils.Send_Request(promotions, w)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusOK, nil
+}
+
+// Retrieve_Promotion retrieves a promotion
+func (serv *DefaultPromotionService) Retrieve_Promotion(w http.ResponseWriter, id int) (int, error) {
+	exist, err := serv.repo.IsPromotionExist(id)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if !exist {
+		return http.StatusNotFound, errors.New("promotion not found")
+	}
+	promotion, err := serv.repo.GetPromotion(id)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	err = utils.Send_Request(promotion, w)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusOK, nil
+}
+
+// Add_Promotion adds a promotion and responds with it
+func (serv *DefaultPromotionService) Add_Promotion(promotion models.Promotion, w http.ResponseWriter) (int, error) {
+	if code, err := serv.checkPromotion(promotion, 0); err != nil {
+		return code, err
+	}
+	id, err := serv.repo.SavePromotion(promotion)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	created, err := serv.repo.GetPromotion(id)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	w.Header().Set("Location", fmt.Sprintf("/promotions/%d", id))
+	err = utils.Send_Request_Status(created, http.StatusCreated, w)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusCreated, nil
+}
+
+// Update_Promotion updates a promotion, orders it was applied to keep their discounts
+func (serv *DefaultPromotionService) Update_Promotion(promotion models.Promotion, id int) (int, error) {
+	exist, err := serv.repo.IsPromotionExist(id)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if !exist {
+		return http.StatusNotFound, errors.New("promotion not found")
+	}
+	if code, err := serv.checkPromotion(promotion, id); err != nil {
+		return code, err
+	}
+	err = serv.repo.UpdatePromotion(promotion, id)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusOK, nil
+}
+
+// Delete_Promotion deletes a promotion, orders it was applied to keep their discounts
+func (serv *DefaultPromotionService) Delete_Promotion(id int) (int, error) {
+	exist, err := serv.repo.IsPromotionExist(id)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if !exist {
+		return http.StatusNotFound, errors.New("promotion not found")
+	}
+	err = serv.repo.DeletePromotion(id)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusNoContent, nil
+}
+
+// checkPromotion checks that the promo code is free and the menu items and the customer of the promotion exist
+func (serv *DefaultPromotionService) checkPromotion(promotion models.Promotion, id int) (int, error) {
+	if promotion.Code != "" {
+		taken, err := serv.repo.IsCodeTaken(promotion.Code, id)
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+		if taken {
+			return http.StatusConflict, errors.New("promo code is already used by another promotion")
+		}
+	}
+	for _, menuItemID := range promotion.MenuItemIDs {
+		exist, err := serv.menuRepo.IsMenuExist(menuItemID)
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+		if !exist {
+			return http.StatusBadRequest, errors.New("menu item of the promotion does not exist: " + strconv.Itoa(menuItemID))
+		}
+	}
+	if promotion.CustomerID != 0 && !serv.customerRepo.IsCustomerExist(promotion.CustomerID) {
+		return http.StatusBadRequest, errors.New("customer of the promotion does not exist")
+	}
+	return http.StatusOK, nil
+}
@@ -0,0 +1,178 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"frappuccino/internal/dal"
+	"frappuccino/internal/utils"
+	"frappuccino/models"
+	"net/http"
+)
+
+type PurchaseOrderService interface {
+	Retrieve_All_Purchase_Orders(w http.ResponseWriter, status string, supplierID int) (int, error)
+	Retrieve_Purchase_Order(w http.ResponseWriter, id int) (int, error)
+	Add_Purchase_Order(order models.PurchaseOrder, user string, w http.ResponseWriter) (int, error)
+	Update_Purchase_Order(order models.PurchaseOrder, id int, w http.ResponseWriter) (int, error)
+	Send_Purchase_Order(id int, w http.ResponseWriter) (int, error)
+	Cancel_Purchase_Order(id int, w http.ResponseWriter) (int, error)
+	Receive_Purchase_Order(id int, receive models.ReceiveRequest, user string, w http.ResponseWriter) (int, error)
+}
+
+type DefaultPurchaseOrderService struct {
+	repo         dal.PurchaseOrderRepo
+	supplierRepo dal.SupplierRepo
+}
+
+func NewDefaultPurchaseOrderService(repo dal.PurchaseOrderRepo, supplierRepo dal.SupplierRepo) *DefaultPurchaseOrderService {
+	return &DefaultPurchaseOrderService{repo: repo, supplierRepo: supplierRepo}
+}
+
+// Retrieve_All_Purchase_Orders retrieves purchase orders, optionally only of a status or a supplier
+func (serv *DefaultPurchaseOrderService) Retrieve_All_Purchase_Orders(w http.ResponseWriter, status string, supplierID int) (int, error) {
+	orders, err := serv.repo.GetPurchaseOrders(status, supplierID)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	err = utils.Send_Request(orders, w)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusOK, nil
+}
+
+// Retrieve_Purchase_Order retrieves a purchase order with its lines
+func (serv *DefaultPurchaseOrderService) Retrieve_Purchase_Order(w http.ResponseWriter, id int) (int, error) {
+	exist, err := serv.repo.IsPurchaseOrderExist(id)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if !exist {
+		return http.StatusNotFound, errors.New("purchase order not found")
+	}
+	order, err := serv.repo.GetPurchaseOrder(id)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	err = utils.Send_Request(order, w)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusOK, nil
+}
+
+// Add_Purchase_Order creates a draft purchase order created by the user and responds with it
+func (serv *DefaultPurchaseOrderService) Add_Purchase_Order(order models.PurchaseOrder, user string, w http.ResponseWriter) (int, error) {
+	exist, err := serv.supplierRepo.IsSupplierExist(order.SupplierID)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if !exist {
+		return http.StatusNotFound, errors.New("supplier not found")
+	}
+	order.CreatedBy = user
+	id, err := serv.repo.SavePurchaseOrder(order)
+	if errors.Is(err, dal.ErrItemNotSupplied) {
+		return http.StatusBadRequest, err
+	}
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	created, err := serv.repo.GetPurchaseOrder(id)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	w.Header().Set("Location", fmt.Sprintf("/purchase-orders/%d", id))
+	err = utils.Send_Request_Status(created, http.StatusCreated, w)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusCreated, nil
+}
+
+// Update_Purchase_Order replaces note, expected date and lines of a draft purchase order and responds with it
+func (serv *DefaultPurchaseOrderService) Update_Purchase_Order(order models.PurchaseOrder, id int, w http.ResponseWriter) (int, error) {
+	exist, err := serv.repo.IsPurchaseOrderExist(id)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if !exist {
+		return http.StatusNotFound, errors.New("purchase order not found")
+	}
+	order.ID = id
+	err = serv.repo.UpdatePurchaseOrder(order)
+	if errors.Is(err, dal.ErrPOStatus) {
+		return http.StatusConflict, err
+	}
+	if errors.Is(err, dal.ErrItemNotSupplied) {
+		return http.StatusBadRequest, err
+	}
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return serv.Retrieve_Purchase_Order(w, id)
+}
+
+// Send_Purchase_Order marks a draft purchase order as sent to the supplier and responds with it
+func (serv *DefaultPurchaseOrderService) Send_Purchase_Order(id int, w http.ResponseWriter) (int, error) {
+	exist, err := serv.repo.IsPurchaseOrderExist(id)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if !exist {
+		return http.StatusNotFound, errors.New("purchase order not found")
+	}
+	err = serv.repo.SendPurchaseOrder(id)
+	if errors.Is(err, dal.ErrPOStatus) {
+		return http.StatusConflict, err
+	}
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return serv.Retrieve_Purchase_Order(w, id)
+}
+
+// Cancel_Purchase_Order cancels a purchase order nothing was received for and responds with it
+func (serv *DefaultPurchaseOrderService) Cancel_Purchase_Order(id int, w http.ResponseWriter) (int, error) {
+	exist, err := serv.repo.IsPurchaseOrderExist(id)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if !exist {
+		return http.StatusNotFound, errors.New("purchase order not found")
+	}
+	err = serv.repo.CancelPurchaseOrder(id)
+	if errors.Is(err, dal.ErrPOStatus) {
+		return http.StatusConflict, err
+	}
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return serv.Retrieve_Purchase_Order(w, id)
+}
+
+// Receive_Purchase_Order books a delivery received by the user into inventory and responds with the purchase order
+func (serv *DefaultPurchaseOrderService) Receive_Purchase_Order(id int, receive models.ReceiveRequest, user string, w http.ResponseWriter) (int, error) {
+	exist, err := serv.repo.IsPurchaseOrderExist(id)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if !exist {
+		return http.StatusNotFound, errors.New("purchase order not found")
+	}
+	err = serv.repo.ReceivePurchaseOrder(id, receive, user)
+	if errors.Is(err, dal.ErrPOStatus) || errors.Is(err, dal.ErrOverReceived) {
+		return http.StatusConflict, err
+	}
+	if errors.Is(err, dal.ErrPOLineNotFound) || dal.IsUnitErr(err) {
+		return http.StatusBadRequest, err
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return http.StatusNotFound, errors.New("purchase order not found")
+	}
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return serv.Retrieve_Purchase_Order(w, id)
+}
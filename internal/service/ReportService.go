@@ -8,15 +8,20 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type ReportService interface {
 	Total_Sales(w http.ResponseWriter) (int, error)
-	Popular_Menu_Items(w http.ResponseWriter) (int, error)
-	GetOrderedItems(w http.ResponseWriter, startDate, endDate string) (int, error)
+	Popular_Menu_Items(w http.ResponseWriter, groupBy string) (int, error)
+	GetOrderedItems(w http.ResponseWriter, startDate, endDate, groupBy string) (int, error)
 	FullSearchReport(w http.ResponseWriter, q, filter, minPricestr, maxPricestr string) (int, error)
 	GetLeftOvers(w http.ResponseWriter, sortBy string, page, pageSize int) (int, error)
 	OrderedItemsPeriod(w http.ResponseWriter, period, monthstr, yearstr string) (int, error)
+	Margins(w http.ResponseWriter, method, startDate, endDate string) (int, error)
+	Waste(w http.ResponseWriter, startDate, endDate string) (int, error)
+	Inventory_Valuation(w http.ResponseWriter, method, asOf, groupBy string) (int, error)
+	Forecast(w http.ResponseWriter, days, history int) (int, error)
 }
 
 type DefaultReportService struct {
@@ -39,8 +44,34 @@ func (serv *DefaultReportService) Total_Sales(w http.ResponseWriter) (int, error
 	return http.StatusOK, nil
 }
 
-func (serv *DefaultReportService) Popular_Menu_Items(w http.ResponseWriter) (int, error) {
-	popularitems, err := serv.repo.Get_Popular_List()
+// checkGroupBy checks the groupBy parameter of item reports, items are grouped by menu item by default
+func checkGroupBy(groupBy string) (string, error) {
+	switch groupBy {
+	case "", "item":
+		return "item", nil
+	case "variant":
+		return groupBy, nil
+	}
+	return groupBy, errors.New("groupBy must be item or variant")
+}
+
+// checkCostMethod checks the costing method of ingredients, weighted average is used by default
+func checkCostMethod(method string) (string, error) {
+	switch method {
+	case "", "weighted_average":
+		return "weighted_average", nil
+	case "last_purchase":
+		return method, nil
+	}
+	return method, errors.New("method must be weighted_average or last_purchase")
+}
+
+func (serv *DefaultReportService) Popular_Menu_Items(w http.ResponseWriter, groupBy string) (int, error) {
+	groupBy, err := checkGroupBy(groupBy)
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+	popularitems, err := serv.repo.Get_Popular_List(groupBy)
 	if err != nil {
 		return http.StatusInternalServerError, err
 	}
@@ -54,8 +85,12 @@ func (serv *DefaultReportService) Popular_Menu_Items(w http.ResponseWriter) (int
 	return http.StatusOK, nil
 }
 
-func (serv *DefaultReportService) GetOrderedItems(w http.ResponseWriter, startDate, endDate string) (int, error) {
-	orderedItems, err := serv.repo.GetOrderedItems(startDate, endDate)
+func (serv *DefaultReportService) GetOrderedItems(w http.ResponseWriter, startDate, endDate, groupBy string) (int, error) {
+	groupBy, err := checkGroupBy(groupBy)
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+	orderedItems, err := serv.repo.GetOrderedItems(startDate, endDate, groupBy)
 	if err != nil {
 		return http.StatusInternalServerError, err
 	}
@@ -226,3 +261,80 @@ func (serv *DefaultReportService) OrderedItemsPeriod(w http.ResponseWriter, peri
 
 	return http.StatusOK, nil
 }
+
+// Margins reports price, recipe cost and margin of every menu item and over the volume sold in the period
+func (serv *DefaultReportService) Margins(w http.ResponseWriter, method, startDate, endDate string) (int, error) {
+	method, err := checkCostMethod(method)
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+	report, err := serv.repo.GetMargins(method, startDate, endDate)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if report.Items == nil {
+		report.Items = []models.MarginItem{}
+	}
+	err = utils.Send_Request(report, w)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusOK, nil
+}
+
+// Waste reports the cost of logged waste in the period by reason, by inventory item and by day
+func (serv *DefaultReportService) Waste(w http.ResponseWriter, startDate, endDate string) (int, error) {
+	report, err := serv.repo.GetWasteReport(startDate, endDate)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	err = utils.Send_Request(report, w)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusOK, nil
+}
+
+// Inventory_Valuation reports the money tied up in stock at the end of the as-of day, or now when it is empty,
+// valued by FIFO or weighted average cost and grouped by category or unit type
+func (serv *DefaultReportService) Inventory_Valuation(w http.ResponseWriter, method, asOf, groupBy string) (int, error) {
+	switch method {
+	case "":
+		method = "weighted_average"
+	case "weighted_average", "fifo":
+	default:
+		return http.StatusBadRequest, errors.New("method must be fifo or weighted_average")
+	}
+	switch groupBy {
+	case "":
+		groupBy = "category"
+	case "category", "unit_type":
+	default:
+		return http.StatusBadRequest, errors.New("groupBy must be category or unit_type")
+	}
+	report, err := serv.repo.GetInventoryValuation(method, asOf, groupBy)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if report.AsOf == "" {
+		report.AsOf = time.Now().Format("2006-01-02")
+	}
+	err = utils.Send_Request(report, w)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusOK, nil
+}
+
+// Forecast projects the ingredient usage of the next days from the sales history with a stock-out date per item
+func (serv *DefaultReportService) Forecast(w http.ResponseWriter, days, history int) (int, error) {
+	report, err := serv.repo.GetForecast(days, history)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	err = utils.Send_Request(report, w)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusOK, nil
+}
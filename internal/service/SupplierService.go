@@ -0,0 +1,189 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"frappuccino/internal/dal"
+	"frappuccino/internal/utils"
+	"frappuccino/models"
+	"net/http"
+)
+
+type SupplierService interface {
+	Retrieve_All_Suppliers(w http.ResponseWriter) (int, error)
+	Retrieve_Supplier(w http.ResponseWriter, id int) (int, error)
+	Add_Supplier(supplier models.Supplier, w http.ResponseWriter) (int, error)
+	Update_Supplier(supplier models.Supplier, id int) (int, error)
+	Delete_Supplier(id int) (int, error)
+	Retrieve_Supplier_Items(w http.ResponseWriter, id int) (int, error)
+	Save_Supplier_Item(item models.SupplierItem, w http.ResponseWriter) (int, error)
+	Delete_Supplier_Item(id, inventoryID int) (int, error)
+}
+
+type DefaultSupplierService struct {
+	repo dal.SupplierRepo
+}
+
+func NewDefaultSupplierService(repo dal.SupplierRepo) *DefaultSupplierService {
+	return &DefaultSupplierService{repo: repo}
+}
+
+// Retrieve_All_Suppliers retrieves all suppliers
+func (serv *DefaultSupplierService) Retrieve_All_Suppliers(w http.ResponseWriter) (int, error) {
+	suppliers, err := serv.repo.GetSuppliers()
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	err = utils.Send_Request(suppliers, w)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusOK, nil
+}
+
+// Retrieve_Supplier retrieves a supplier with the items it sells
+func (serv *DefaultSupplierService) Retrieve_Supplier(w http.ResponseWriter, id int) (int, error) {
+	exist, err := serv.repo.IsSupplierExist(id)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if !exist {
+		return http.StatusNotFound, errors.New("supplier not found")
+	}
+	supplier, err := serv.repo.GetSupplier(id)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	err = utils.Send_Request(supplier, w)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusOK, nil
+}
+
+// Add_Supplier adds a new supplier and responds with it
+func (serv *DefaultSupplierService) Add_Supplier(supplier models.Supplier, w http.ResponseWriter) (int, error) {
+	unique, err := serv.repo.IsSupplierUnique(0, supplier.Name)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if !unique {
+		return http.StatusBadRequest, errors.New("supplier name must be unique")
+	}
+	id, err := serv.repo.SaveSupplier(supplier)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	created, err := serv.repo.GetSupplier(id)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	w.Header().Set("Location", fmt.Sprintf("/suppliers/%d", id))
+	err = utils.Send_Request_Status(created, http.StatusCreated, w)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusCreated, nil
+}
+
+// Update_Supplier updates contact info and lead time of a supplier
+func (serv *DefaultSupplierService) Update_Supplier(supplier models.Supplier, id int) (int, error) {
+	exist, err := serv.repo.IsSupplierExist(id)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if !exist {
+		return http.StatusNotFound, errors.New("supplier not found")
+	}
+	unique, err := serv.repo.IsSupplierUnique(id, supplier.Name)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if !unique {
+		return http.StatusBadRequest, errors.New("supplier name must be unique")
+	}
+	supplier.ID = id
+	err = serv.repo.UpdateSupplier(supplier)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusOK, nil
+}
+
+// Delete_Supplier deletes a supplier that has no purchase orders
+func (serv *DefaultSupplierService) Delete_Supplier(id int) (int, error) {
+	exist, err := serv.repo.IsSupplierExist(id)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if !exist {
+		return http.StatusNotFound, errors.New("supplier not found")
+	}
+	err = serv.repo.DeleteSupplier(id)
+	if errors.Is(err, dal.ErrStillReferenced) {
+		return http.StatusConflict, errors.New("supplier has purchase orders")
+	}
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusNoContent, nil
+}
+
+// Retrieve_Supplier_Items retrieves the items a supplier sells with their pack and price
+func (serv *DefaultSupplierService) Retrieve_Supplier_Items(w http.ResponseWriter, id int) (int, error) {
+	exist, err := serv.repo.IsSupplierExist(id)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if !exist {
+		return http.StatusNotFound, errors.New("supplier not found")
+	}
+	items, err := serv.repo.GetSupplierItems(id)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	err = utils.Send_Request(items, w)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusOK, nil
+}
+
+// Save_Supplier_Item sets the pack and price a supplier sells an inventory item in and responds with the supplier items
+func (serv *DefaultSupplierService) Save_Supplier_Item(item models.SupplierItem, w http.ResponseWriter) (int, error) {
+	exist, err := serv.repo.IsSupplierExist(item.SupplierID)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if !exist {
+		return http.StatusNotFound, errors.New("supplier not found")
+	}
+	err = serv.repo.SaveSupplierItem(item)
+	if errors.Is(err, sql.ErrNoRows) {
+		return http.StatusNotFound, errors.New("inventory item not found")
+	}
+	if dal.IsUnitErr(err) {
+		return http.StatusBadRequest, err
+	}
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return serv.Retrieve_Supplier_Items(w, item.SupplierID)
+}
+
+// Delete_Supplier_Item stops buying an inventory item from a supplier
+func (serv *DefaultSupplierService) Delete_Supplier_Item(id, inventoryID int) (int, error) {
+	exist, err := serv.repo.IsSupplierItemExist(id, inventoryID)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if !exist {
+		return http.StatusNotFound, errors.New("supplier does not sell the inventory item")
+	}
+	err = serv.repo.DeleteSupplierItem(id, inventoryID)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusNoContent, nil
+}
@@ -0,0 +1,79 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"frappuccino/internal/dal"
+	"frappuccino/internal/utils"
+	"frappuccino/models"
+	"net/http"
+)
+
+type UnitService interface {
+	Retrieve_All_Units(w http.ResponseWriter) (int, error)
+	Retrieve_Unit(w http.ResponseWriter, code string) (int, error)
+	Add_Unit(unit models.Unit, w http.ResponseWriter) (int, error)
+}
+
+type DefaultUnitService struct {
+	repo dal.UnitRepo
+}
+
+func NewDefaultUnitService(repo dal.UnitRepo) *DefaultUnitService {
+	return &DefaultUnitService{repo: repo}
+}
+
+// Retrieve_All_Units retrieves the unit registry
+func (serv *DefaultUnitService) Retrieve_All_Units(w http.ResponseWriter) (int, error) {
+	units, err := serv.repo.GetUnits()
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	err = utils.Send_Request(units, w)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusOK, nil
+}
+
+// Retrieve_Unit retrieves a unit by its code
+func (serv *DefaultUnitService) Retrieve_Unit(w http.ResponseWriter, code string) (int, error) {
+	exist, err := serv.repo.IsUnitExist(code)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if !exist {
+		return http.StatusNotFound, errors.New("unit not found")
+	}
+	unit, err := serv.repo.GetUnit(code)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	err = utils.Send_Request(unit, w)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusOK, nil
+}
+
+// Add_Unit registers a new unit and responds with it, units are never changed
+// because recipes and purchases are stored in them
+func (serv *DefaultUnitService) Add_Unit(unit models.Unit, w http.ResponseWriter) (int, error) {
+	exist, err := serv.repo.IsUnitExist(unit.Code)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if exist {
+		return http.StatusConflict, errors.New("unit code must be unique")
+	}
+	err = serv.repo.SaveUnit(unit)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	w.Header().Set("Location", fmt.Sprintf("/units/%s", unit.Code))
+	err = utils.Send_Request_Status(unit, http.StatusCreated, w)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusCreated, nil
+}
@@ -36,6 +36,17 @@ func Send_Request(mystruct any, w http.ResponseWriter) error {
 	return nil
 }
 
+// Send_Request_Status sends the JSON response with the given status code
+func Send_Request_Status(mystruct any, status int, w http.ResponseWriter) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(mystruct); err != nil {
+		slog.Error("JSON encode error:", "Send_Request_Status function ", err)
+		return err
+	}
+	return nil
+}
+
 func CheckPort() error {
 	num, err := strconv.Atoi(*models.Port)
 	if err != nil {
@@ -0,0 +1,57 @@
+package models
+
+type IngredientCost struct {
+	InventoryID int     `json:"inventory_id"` // Matches inventory_id
+	Name        string  `json:"name"`         // Matches name in inventory
+	Quantity    float64 `json:"quantity"`     // Recipe quantity of one serving
+	UnitCost    float64 `json:"unit_cost"`    // Cost of one stock unit by the costing method
+	Cost        float64 `json:"cost"`         // Quantity times unit cost
+	Priced      bool    `json:"priced"`       // False when the ingredient was never purchased, so its cost is unknown
+}
+
+type RecipeCost struct {
+	MenuItemID    int              `json:"menu_item_id"`
+	VariantID     int              `json:"variant_id,omitempty"`
+	Name          string           `json:"name"`
+	Variant       string           `json:"variant,omitempty"`
+	Method        string           `json:"method"`
+	Price         float64          `json:"price"`
+	Cost          float64          `json:"cost"`
+	Margin        float64          `json:"margin"`
+	MarginPercent float64          `json:"margin_percent"`
+	Complete      bool             `json:"complete"` // Every ingredient has a known cost
+	Ingredients   []IngredientCost `json:"ingredients,omitempty"`
+	Variants      []RecipeCost     `json:"variants,omitempty"`
+}
+
+type MarginItem struct {
+	MenuItemID        int     `json:"menu_item_id"`
+	VariantID         int     `json:"variant_id,omitempty"`
+	Name              string  `json:"name"`
+	Variant           string  `json:"variant,omitempty"`
+	Price             float64 `json:"price"`
+	Cost              float64 `json:"cost"`
+	Margin            float64 `json:"margin"`
+	MarginPercent     float64 `json:"margin_percent"`
+	Complete          bool    `json:"complete"`
+	SoldQuantity      int     `json:"sold_quantity"`
+	GrossRevenue      float64 `json:"gross_revenue"` // Sold lines before discounts and refunds
+	Discounts         float64 `json:"discounts"`     // Share of the order discounts, negative
+	Revenue           float64 `json:"revenue"`       // What was kept after discounts and refunds
+	SoldCost          float64 `json:"sold_cost"`     // Recipe and modifier ingredients of the sold servings
+	SoldMargin        float64 `json:"sold_margin"`
+	SoldMarginPercent float64 `json:"sold_margin_percent"`
+}
+
+type MarginsReport struct {
+	Method        string       `json:"method"`
+	StartDate     string       `json:"startDate"`
+	EndDate       string       `json:"endDate"`
+	Items         []MarginItem `json:"items"`
+	GrossRevenue  float64      `json:"gross_revenue"`
+	Discounts     float64      `json:"discounts"`
+	Revenue       float64      `json:"revenue"`
+	Cost          float64      `json:"cost"`
+	Margin        float64      `json:"margin"`
+	MarginPercent float64      `json:"margin_percent"`
+}
@@ -1,8 +1,44 @@
 package models
 
+import "time"
+
 type Customer struct {
-	Customer_id int    `json:"id"`     // Matches customer_id
-	Name        string `json:"name"`   // Matches name
-	Email       string `json:"email"`  // Matches email
-	Number      string `json:"number"` // Matches number
+	Customer_id int        `json:"id"`                    // Matches customer_id
+	Name        string     `json:"name"`                  // Matches name
+	Email       string     `json:"email"`                 // Matches email
+	Number      string     `json:"number"`                // Matches number
+	ArchivedAt  *time.Time `json:"archived_at,omitempty"` // Matches archived_at, set once the customer is archived
+}
+
+// CustomerOrdersResponse is one page of the orders of a customer, newest first
+type CustomerOrdersResponse struct {
+	CurrentPage int     `json:"currentPage"`
+	HasNextPage bool    `json:"hasNextPage"`
+	PageSize    int     `json:"pageSize"`
+	TotalPages  int     `json:"totalPages"`
+	TotalOrders int     `json:"totalOrders"`
+	Data        []Order `json:"data"`
+}
+
+// CustomerSummary is what the customer has bought over all time. Spend counts closed orders net of refunds
+type CustomerSummary struct {
+	CustomerID     int             `json:"customer_id"`
+	Name           string          `json:"name"`
+	LifetimeSpend  float64         `json:"lifetime_spend"`
+	Refunded       float64         `json:"refunded"`       // Refunds of closed orders, already taken off the lifetime spend
+	OrderCount     int             `json:"order_count"`    // Closed orders
+	OpenOrders     int             `json:"open_orders"`    // Orders not closed or cancelled yet
+	AverageTicket  float64         `json:"average_ticket"` // Lifetime spend per closed order
+	FirstVisit     *time.Time      `json:"first_visit,omitempty"`
+	LastVisit      *time.Time      `json:"last_visit,omitempty"`
+	FavouriteItems []FavouriteItem `json:"favourite_items"`
+}
+
+// FavouriteItem is a menu item the customer bought most often on closed orders, net of refunds
+type FavouriteItem struct {
+	MenuItemID int     `json:"menu_item_id"`
+	Name       string  `json:"name"`
+	Quantity   int     `json:"quantity"`
+	Orders     int     `json:"orders"` // Closed orders with the item
+	Spend      float64 `json:"spend"`
 }
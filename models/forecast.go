@@ -0,0 +1,29 @@
+package models
+
+// ForecastDay is the usage expected on one day
+type ForecastDay struct {
+	Date     string  `json:"date"`
+	Weekday  string  `json:"weekday"`
+	Quantity float64 `json:"quantity"`
+}
+
+// ItemForecast is the expected usage of an inventory item over the forecast days. Quantities are in the stock unit of the item
+type ItemForecast struct {
+	InventoryID       int           `json:"inventory_id"`
+	Name              string        `json:"name"`
+	Unit              string        `json:"unit"`
+	StockLevel        float64       `json:"stock_level"`
+	AverageDailyUsage float64       `json:"average_daily_usage"` // Moving average of the daily usage
+	WeekdayIndex      [7]float64    `json:"weekday_index"`       // Usage on each weekday from Sunday against the average day
+	ForecastUsage     float64       `json:"forecast_usage"`      // Expected usage over all forecast days
+	StockOutDate      string        `json:"stock_out_date,omitempty"`
+	DaysOfCover       *float64      `json:"days_of_cover,omitempty"` // Days the stock lasts at the average usage, empty without usage
+	Days              []ForecastDay `json:"days"`
+}
+
+type ForecastReport struct {
+	Days          int            `json:"days"`           // Days projected from today
+	HistoryDays   int            `json:"history_days"`   // Days of closed orders the seasonality is taken over
+	AverageWindow int            `json:"average_window"` // Last days of history the moving average is taken over
+	Items         []ItemForecast `json:"items"`
+}
@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+type IdempotencyRecord struct {
+	Key         string            `json:"key"`          // Matches idempotency_key
+	Endpoint    string            `json:"endpoint"`     // Matches endpoint, method and path of the request
+	RequestHash string            `json:"request_hash"` // Matches request_hash, SHA-256 of the request
+	StatusCode  int               `json:"status_code"`  // Matches status_code, 0 while the request is in progress
+	Headers     map[string]string `json:"headers"`      // Matches response_headers (JSONB)
+	Body        []byte            `json:"body"`         // Matches response_body
+	CreatedAt   time.Time         `json:"created_at"`   // Matches created_at
+}
@@ -3,18 +3,29 @@ package models
 import "time"
 
 type InventoryItem struct {
-	ID           int       `json:"id"`            // Matches inventory_id
-	Name         string    `json:"name"`          // Matches name
-	StockLevel   float64   `json:"stock_level"`   // Matches stock_level
-	UnitType     string    `json:"unit_type"`     // Matches unit_type
-	LastUpdated  time.Time `json:"last_updated"`  // Matches last_updated
-	ReorderLevel float64   `json:"reorder_level"` // Matches reorder_level
+	ID           int        `json:"id"`                    // Matches inventory_id
+	Name         string     `json:"name"`                  // Matches name
+	StockLevel   float64    `json:"stock_level"`           // Matches stock_level, the quantity on hand
+	Reserved     float64    `json:"reserved"`              // Sum of inventory_reservations held by open orders
+	Available    float64    `json:"available"`             // stock_level minus reserved
+	UnitType     string     `json:"unit_type"`             // Matches unit_type
+	LastUpdated  time.Time  `json:"last_updated"`          // Matches last_updated
+	ReorderLevel float64    `json:"reorder_level"`         // Matches reorder_level
+	ParLevel     float64    `json:"par_level,omitempty"`   // Matches par_level, the stock to refill up to when reordering
+	Category     string     `json:"category,omitempty"`    // Matches category, e.g. dairy or packaging
+	ArchivedAt   *time.Time `json:"archived_at,omitempty"` // Matches archived_at, set once the item is archived
 }
 
 type InventoryTransaction struct {
-	ID               int       `json:"id"`               // Matches transaction_id
-	Inventory_id     int       `json:"inventory_id"`     // Matches inventory_id
-	Price            float64   `json:"price"`            // Matches price
-	Quantity         float64   `json:"Quantity"`         // Matches quantity
-	Transaction_date time.Time `json:"transaction_date"` // Matches transaction_date
+	ID               int       `json:"id"`                          // Matches transaction_id
+	Inventory_id     int       `json:"inventory_id"`                // Matches inventory_id
+	Price            float64   `json:"price"`                       // Matches price
+	Quantity         float64   `json:"Quantity"`                    // Matches quantity
+	StockUnit        string    `json:"stock_unit,omitempty"`        // Matches unit, the stock unit of quantity when it was bought
+	Transaction_date time.Time `json:"transaction_date"`            // Matches transaction_date
+	Unit             string    `json:"unit,omitempty"`              // Unit or pack of the bought quantity, the stock unit when empty
+	PurchaseQuantity float64   `json:"purchase_quantity,omitempty"` // Matches purchase_quantity, the quantity as bought
+	PurchaseUnit     string    `json:"purchase_unit,omitempty"`     // Matches purchase_unit, the unit or pack as bought
+	POLineID         *int      `json:"po_line_id,omitempty"`        // Matches po_line_id, the purchase order line the delivery was received against
+	ExpiryDate       string    `json:"expiry_date,omitempty"`       // Matches expiry_date in YYYY-MM-DD, the expiry of the lot the purchase opens
 }
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+type InventoryLot struct {
+	ID            int       `json:"id"`                       // Matches lot_id
+	InventoryID   int       `json:"inventory_id"`             // Matches inventory_id
+	Name          string    `json:"name"`                     // Matches name in inventory
+	TransactionID *int      `json:"transaction_id,omitempty"` // Matches transaction_id of the purchase that opened the lot
+	Quantity      float64   `json:"quantity"`                 // Matches quantity, as received in the stock unit
+	Remaining     float64   `json:"remaining"`                // Matches remaining, still in stock
+	Unit          string    `json:"unit"`                     // Stock unit of the inventory item
+	ExpiryDate    string    `json:"expiry_date,omitempty"`    // Matches expiry_date in YYYY-MM-DD
+	DaysLeft      *int      `json:"days_left,omitempty"`      // Days until the expiry date, negative once expired
+	Expired       bool      `json:"expired"`                  // The expiry date has passed
+	UnitCost      float64   `json:"unit_cost"`                // Purchase cost of the lot, the weighted average cost when it has no purchase
+	Value         float64   `json:"value"`                    // Remaining times unit cost
+	ReceivedAt    time.Time `json:"received_at"`              // Matches received_at
+}
@@ -0,0 +1,56 @@
+package models
+
+import "time"
+
+// Loyalty ledger entry types, matching loyalty_entry_enum
+const (
+	LoyaltyEarn    = "earn"
+	LoyaltyRedeem  = "redeem"
+	LoyaltyExpire  = "expire"
+	LoyaltyReverse = "reverse"
+	LoyaltyRestore = "restore"
+)
+
+// LoyaltySettings is the rule points are earned and redeemed by
+type LoyaltySettings struct {
+	PointsPerUnit  float64            `json:"points_per_unit"` // Points earned per currency unit paid
+	PointValue     float64            `json:"point_value"`     // Discount one point is worth
+	ExpiryDays     int                `json:"expiry_days"`     // Days earned points last, 0 when they never expire
+	Enabled        bool               `json:"enabled"`
+	TagMultipliers map[string]float64 `json:"tag_multipliers"` // Bonus multiplier of menu item tags
+}
+
+type LoyaltyReward struct {
+	ID         int    `json:"id"`           // Matches reward_id
+	Name       string `json:"name"`         // Matches name
+	MenuItemID int    `json:"menu_item_id"` // Matches menu_item_id, the item given for free
+	Points     int    `json:"points"`       // Matches points
+	Active     bool   `json:"active"`       // Matches active, only active rewards can be redeemed
+}
+
+type LoyaltyEntry struct {
+	ID         int        `json:"id"`                 // Matches entry_id
+	CustomerID int        `json:"customer_id"`        // Matches customer_id
+	OrderID    *int       `json:"order_id,omitempty"` // Matches order_id
+	Type       string     `json:"type"`               // Matches entry_type ENUM
+	Points     int        `json:"points"`             // Matches points, negative when points are taken
+	Remaining  int        `json:"remaining"`          // Matches remaining, what is left of earned or restored points
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	Note       string     `json:"note,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// LoyaltyBalance is what the customer can redeem now and what expires next
+type LoyaltyBalance struct {
+	CustomerID     int        `json:"customer_id"`
+	Balance        int        `json:"balance"`
+	Value          float64    `json:"value"` // Discount the balance is worth
+	ExpiringPoints int        `json:"expiring_points,omitempty"`
+	NextExpiry     *time.Time `json:"next_expiry,omitempty"`
+}
+
+// LoyaltyRedemption is what the customer redeems on a new order, points as a discount, a reward or both
+type LoyaltyRedemption struct {
+	Points   int `json:"points,omitempty"`
+	RewardID int `json:"reward_id,omitempty"`
+}
@@ -3,26 +3,80 @@ package models
 import "time"
 
 type Menu struct {
-	ID             int                  `json:"id"`          // Matches menu_item_id
-	Name           string               `json:"name"`        // Matches name
-	Description    string               `json:"description"` // Matches description
-	Price          float64              `json:"price"`       // Matches price
-	Tags           []string             `json:"tags"`        // Matches tags
-	ItemIngredient []MenuItemIngredient `json:"menuitems"`   // Matches MenuItems
-	Relevance      float64              `json:"relevance"`   // Matches Relevance
+	ID             int                  `json:"id"`                    // Matches menu_item_id
+	Name           string               `json:"name"`                  // Matches name
+	Description    string               `json:"description"`           // Matches description
+	Price          float64              `json:"price"`                 // Matches price
+	Tags           []string             `json:"tags"`                  // Matches tags
+	ItemIngredient []MenuItemIngredient `json:"menuitems"`             // Matches MenuItems
+	Variants       []MenuVariant        `json:"variants,omitempty"`    // Linked variants from menu_item_variants
+	Modifiers      []ModifierGroup      `json:"modifiers,omitempty"`   // Linked groups from modifier_groups
+	Relevance      float64              `json:"relevance"`             // Matches Relevance
+	SoldOut        bool                 `json:"sold_out"`              // Matches sold_out, set by hand to stop selling the item
+	Available      bool                 `json:"available"`             // The item is on sale and can be made from current stock
+	MaxServings    *int                 `json:"max_servings"`          // Servings makeable from stock not held by open orders, empty when not limited by stock
+	ArchivedAt     *time.Time           `json:"archived_at,omitempty"` // Matches archived_at, set once the item is archived
 }
 
 type MenuItemIngredient struct {
-	ID          int     `json:"id"`           // Matches id in menu_item_ingredients
-	MenuItemID  int     `json:"menu_item_id"` // Matches menu_item_id
-	InventoryID int     `json:"inventory_id"` // Matches inventory_id
-	Quantity    float64 `json:"quantity"`     // Matches quantity
+	ID            int     `json:"id"`             // Matches id in menu_item_ingredients
+	MenuItemID    int     `json:"menu_item_id"`   // Matches menu_item_id
+	InventoryID   int     `json:"inventory_id"`   // Matches inventory_id
+	Quantity      float64 `json:"quantity"`       // Matches quantity
+	Unit          string  `json:"unit"`           // Matches unit, the stock unit of the ingredient when empty
+	StockQuantity float64 `json:"stock_quantity"` // Quantity converted to the stock unit of the ingredient
+}
+
+type MenuVariant struct {
+	ID          int                 `json:"id"`           // Matches variant_id
+	MenuItemID  int                 `json:"menu_item_id"` // Matches menu_item_id
+	Name        string              `json:"name"`         // Matches name
+	Price       float64             `json:"price"`        // Matches price
+	Ingredients []VariantIngredient `json:"ingredients"`  // Linked recipe from variant_ingredients
+	Available   bool                `json:"available"`    // The variant can be made from current stock
+	MaxServings *int                `json:"max_servings"` // Servings makeable from stock not held by open orders, empty when not limited by stock
+}
+
+type VariantIngredient struct {
+	ID            int     `json:"id"`             // Matches id in variant_ingredients
+	VariantID     int     `json:"variant_id"`     // Matches variant_id
+	InventoryID   int     `json:"inventory_id"`   // Matches inventory_id
+	Quantity      float64 `json:"quantity"`       // Matches quantity
+	Unit          string  `json:"unit"`           // Matches unit, the stock unit of the ingredient when empty
+	StockQuantity float64 `json:"stock_quantity"` // Quantity converted to the stock unit of the ingredient
 }
 
 type MenuPriceHistory struct {
-	ID         int       `json:"id"`           // Matches id
-	MenuItemID int       `json:"menu_item_id"` // Matches menu_item_id
-	OldPrice   float64   `json:"old_price"`    // Matches old_price
-	NewPrice   float64   `json:"new_price"`    // Matches new_price
-	ChangedAt  time.Time `json:"changed_at"`   // Matches changed_at
+	ID         int       `json:"id"`                   // Matches id
+	MenuItemID int       `json:"menu_item_id"`         // Matches menu_item_id
+	VariantID  int       `json:"variant_id,omitempty"` // Matches variant_id, empty for the menu item price
+	OldPrice   float64   `json:"old_price"`            // Matches old_price
+	NewPrice   float64   `json:"new_price"`            // Matches new_price
+	ChangedAt  time.Time `json:"changed_at"`           // Matches changed_at
+}
+
+type ModifierGroup struct {
+	ID         int              `json:"id"`           // Matches group_id
+	MenuItemID int              `json:"menu_item_id"` // Matches menu_item_id
+	Name       string           `json:"name"`         // Matches name
+	MinSelect  int              `json:"min_select"`   // Matches min_select
+	MaxSelect  int              `json:"max_select"`   // Matches max_select
+	Options    []ModifierOption `json:"options"`      // Linked options from modifier_options
+}
+
+type ModifierOption struct {
+	ID          int                  `json:"id"`          // Matches option_id
+	GroupID     int                  `json:"group_id"`    // Matches group_id
+	Name        string               `json:"name"`        // Matches name
+	PriceDelta  float64              `json:"price_delta"` // Matches price_delta
+	Ingredients []ModifierIngredient `json:"ingredients"` // Linked ingredients from modifier_option_ingredients
+}
+
+type ModifierIngredient struct {
+	ID            int     `json:"id"`             // Matches id in modifier_option_ingredients
+	OptionID      int     `json:"option_id"`      // Matches option_id
+	InventoryID   int     `json:"inventory_id"`   // Matches inventory_id
+	Quantity      float64 `json:"quantity"`       // Matches quantity, negative when the option uses less than the recipe
+	Unit          string  `json:"unit"`           // Matches unit, the stock unit of the ingredient when empty
+	StockQuantity float64 `json:"stock_quantity"` // Quantity converted to the stock unit of the ingredient
 }
@@ -2,6 +2,17 @@ package models
 
 import "time"
 
+// Order lifecycle statuses, matching order_status_enum
+const (
+	StatusPending   = "pending"
+	StatusActive    = "active"
+	StatusPreparing = "preparing"
+	StatusReady     = "ready"
+	StatusPickedUp  = "picked_up"
+	StatusClosed    = "closed"
+	StatusCancelled = "cancelled"
+)
+
 type Order struct {
 	ID                  int                    `json:"id"`                   // Matches order_id
 	CustomerID          int                    `json:"customer_id"`          // Matches customer_id
@@ -10,25 +21,92 @@ type Order struct {
 	CreatedAt           time.Time              `json:"created_at"`           // Matches order_date
 	SpecialInstructions map[string]interface{} `json:"special_instructions"` // Matches special_instructions (JSONB)
 	Items               []OrderItem            `json:"items"`                // Linked items from order_items
+	Discounts           []OrderDiscount        `json:"discounts,omitempty"`  // Linked discounts from order_discounts
+	Loyalty             *LoyaltyRedemption     `json:"loyalty,omitempty"`    // Points or reward redeemed when the order is created
+	PromoCode           string                 `json:"promo_code,omitempty"` // Matches promo_code
+}
+
+// Discount sources, matching discount_source_enum
+const (
+	DiscountLoyaltyPoints = "loyalty_points"
+	DiscountLoyaltyReward = "loyalty_reward"
+	DiscountPromotion     = "promotion"
+)
+
+type OrderDiscount struct {
+	ID          int     `json:"id"`                      // Matches discount_id
+	OrderItemID int     `json:"order_item_id,omitempty"` // Matches order_item_id, empty for a discount of the whole order
+	Source      string  `json:"source"`                  // Matches source ENUM
+	RewardID    int     `json:"reward_id,omitempty"`     // Matches reward_id
+	PromotionID int     `json:"promotion_id,omitempty"`  // Matches promotion_id
+	Description string  `json:"description"`             // Matches description
+	Amount      float64 `json:"amount"`                  // Matches amount, always negative
+	Points      int     `json:"points,omitempty"`        // Matches points redeemed for the discount
+	Line        int     `json:"-"`                       // Position of the discounted line in the order items from 1, 0 for the whole order
 }
 
 type OrderItem struct {
-	ID               int                    `json:"id"`                  // Matches order_item_id
-	MenuItemID       int                    `json:"menu_item_id"`        // Matches menu_item_id
-	OrderID          int                    `json:"order_id"`            // Matches order_id
-	Customizations   map[string]interface{} `json:"customizations"`      // Matches customizations (JSONB)
-	PriceAtOrderTime float64                `json:"price_at_order_time"` // Matches price_at_order_time
-	Quantity         int                    `json:"quantity"`            // Matches quantity
+	ID               int                    `json:"id"`                     // Matches order_item_id
+	MenuItemID       int                    `json:"menu_item_id"`           // Matches menu_item_id
+	VariantID        int                    `json:"variant_id,omitempty"`   // Matches variant_id
+	VariantName      string                 `json:"variant_name,omitempty"` // Matches variant_name at order time
+	OrderID          int                    `json:"order_id"`               // Matches order_id
+	Customizations   map[string]interface{} `json:"customizations"`         // Matches customizations (JSONB)
+	PriceAtOrderTime float64                `json:"price_at_order_time"`    // Matches price_at_order_time
+	Quantity         int                    `json:"quantity"`               // Matches quantity
+	Modifiers        []OrderItemModifier    `json:"modifiers"`              // Linked modifiers from order_item_modifiers
+}
+
+type OrderItemModifier struct {
+	ID         int     `json:"id"`          // Matches id in order_item_modifiers
+	OptionID   int     `json:"option_id"`   // Matches option_id, 0 when the option was deleted later
+	GroupName  string  `json:"group_name"`  // Matches group_name at order time
+	OptionName string  `json:"option_name"` // Matches option_name at order time
+	PriceDelta float64 `json:"price_delta"` // Matches price_delta at order time
+}
+
+// OrderPatch describes line-item level edits of an open order
+type OrderPatch struct {
+	AddItems            []OrderItem            `json:"add_items"`            // New lines, priced at the current menu price
+	UpdateItems         []OrderItemChange      `json:"update_items"`         // Quantity changes of existing lines
+	RemoveItems         []int                  `json:"remove_items"`         // order_item_id of the lines to remove
+	SpecialInstructions map[string]interface{} `json:"special_instructions"` // Replaces special_instructions when given
+}
 
+type OrderItemChange struct {
+	ID       int `json:"id"`       // Matches order_item_id
+	Quantity int `json:"quantity"` // New quantity of the line
 }
 
 type OrderStatus struct {
 	Id        int       `json:"id"`
 	Order_id  int       `json:"order_id"`
 	Status    string    `json:"status"`
+	Reason    string    `json:"reason,omitempty"`
 	CreatedAt time.Time `json:"created_at"`
 }
 
+type OrderStatusChange struct {
+	Status string `json:"status"`
+	Reason string `json:"reason"`
+}
+
+type OrderRefund struct {
+	ID        int          `json:"id"`         // Matches refund_id
+	OrderID   int          `json:"order_id"`   // Matches order_id
+	Reason    string       `json:"reason"`     // Matches reason
+	Amount    float64      `json:"amount"`     // Matches amount, never positive, what was paid after discounts
+	CreatedAt time.Time    `json:"created_at"` // Matches created_at
+	Items     []RefundItem `json:"items"`      // Linked items from order_refund_items
+}
+
+type RefundItem struct {
+	ID          int     `json:"id"`            // Matches id in order_refund_items
+	OrderItemID int     `json:"order_item_id"` // Matches order_item_id
+	Quantity    int     `json:"quantity"`      // Matches quantity
+	Amount      float64 `json:"amount"`        // Matches amount, never positive, what was paid after discounts
+}
+
 type OrderSearchResult struct {
 	ID           int      `json:"id"`
 	CustomerName string   `json:"customer_name"`
@@ -52,7 +130,14 @@ type InventoryUpdate struct {
 	Remaining    float64 `json:"remaining"`
 }
 
+// Batch processing modes
+const (
+	BatchAllOrNothing = "all_or_nothing"
+	BatchBestEffort   = "best_effort"
+)
+
 type BatchProcessSummary struct {
+	Mode             string            `json:"mode"`
 	TotalOrders      int               `json:"total_orders"`
 	Accepted         int               `json:"accepted"`
 	Rejected         int               `json:"rejected"`
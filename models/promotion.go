@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+// Promotion effects, matching promotion_effect_enum
+const (
+	PromotionPercentOff  = "percent_off"
+	PromotionAmountOff   = "amount_off"
+	PromotionFreeItem    = "free_item"
+	PromotionBundlePrice = "bundle_price"
+)
+
+type Promotion struct {
+	ID           int        `json:"id"`                      // Matches promotion_id
+	Name         string     `json:"name"`                    // Matches name, the description of its discounts
+	Code         string     `json:"code,omitempty"`          // Matches code, the promo code the order must give
+	Effect       string     `json:"effect"`                  // Matches effect ENUM
+	Value        float64    `json:"value"`                   // Matches value, the percent off, amount off or bundle price
+	BuyQuantity  int        `json:"buy_quantity,omitempty"`  // Matches buy_quantity, units bought for the free ones or sold as a bundle
+	FreeQuantity int        `json:"free_quantity,omitempty"` // Matches free_quantity, units given for every buy_quantity bought
+	MenuItemIDs  []int      `json:"menu_item_ids"`           // Matches menu_item_ids, with tags the lines the promotion applies to
+	Tags         []string   `json:"tags"`                    // Matches tags, every line when both are empty
+	CustomerID   int        `json:"customer_id,omitempty"`   // Matches customer_id, the only customer it is for
+	MinSpend     float64    `json:"min_spend,omitempty"`     // Matches min_spend, the order subtotal it needs
+	DaysOfWeek   []int      `json:"days_of_week"`            // Matches days_of_week, 1 is Monday and 7 is Sunday, every day when empty
+	StartTime    string     `json:"start_time,omitempty"`    // Matches start_time, HH:MM
+	EndTime      string     `json:"end_time,omitempty"`      // Matches end_time, HH:MM, the window may pass midnight
+	StartsAt     *time.Time `json:"starts_at,omitempty"`     // Matches starts_at
+	EndsAt       *time.Time `json:"ends_at,omitempty"`       // Matches ends_at
+	Priority     int        `json:"priority"`                // Matches priority, higher is applied first
+	Active       bool       `json:"active"`                  // Matches active
+	CreatedAt    time.Time  `json:"created_at"`              // Matches created_at
+}
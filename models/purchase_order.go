@@ -0,0 +1,51 @@
+package models
+
+import "time"
+
+// Purchase order statuses
+const (
+	POStatusDraft             = "draft"
+	POStatusSent              = "sent"
+	POStatusPartiallyReceived = "partially_received"
+	POStatusReceived          = "received"
+	POStatusCancelled         = "cancelled"
+)
+
+type PurchaseOrder struct {
+	ID           int                 `json:"id"`                      // Matches po_id
+	SupplierID   int                 `json:"supplier_id"`             // Matches supplier_id
+	SupplierName string              `json:"supplier_name"`           // Matches name in suppliers
+	Status       string              `json:"status"`                  // Matches status
+	Note         string              `json:"note,omitempty"`          // Matches note
+	ExpectedDate string              `json:"expected_date,omitempty"` // Matches expected_date in YYYY-MM-DD
+	CreatedBy    string              `json:"created_by,omitempty"`    // Matches created_by
+	CreatedAt    time.Time           `json:"created_at"`              // Matches created_at
+	SentAt       *time.Time          `json:"sent_at,omitempty"`       // Matches sent_at
+	ReceivedAt   *time.Time          `json:"received_at,omitempty"`   // Matches received_at, set when the order is closed as received
+	Total        float64             `json:"total"`                   // Ordered packs times pack price
+	Lines        []PurchaseOrderLine `json:"lines"`                   // Linked lines from purchase_order_lines
+}
+
+type PurchaseOrderLine struct {
+	ID            int     `json:"id"`             // Matches line_id
+	InventoryID   int     `json:"inventory_id"`   // Matches inventory_id
+	Name          string  `json:"name"`           // Matches name in inventory
+	PacksOrdered  float64 `json:"packs_ordered"`  // Matches packs_ordered
+	PacksReceived float64 `json:"packs_received"` // Matches packs_received
+	PackSize      float64 `json:"pack_size"`      // Matches pack_size
+	PackUnit      string  `json:"pack_unit"`      // Matches pack_unit
+	PackPrice     float64 `json:"pack_price"`     // Matches pack_price
+	LineTotal     float64 `json:"line_total"`     // Ordered packs times pack price
+}
+
+// ReceiveRequest is a delivery against a purchase order, complete closes the order even when lines came short
+type ReceiveRequest struct {
+	Lines    []ReceiveLine `json:"lines"`
+	Complete bool          `json:"complete"`
+}
+
+type ReceiveLine struct {
+	LineID     int     `json:"line_id"`
+	Packs      float64 `json:"packs"`                 // Packs delivered now
+	ExpiryDate string  `json:"expiry_date,omitempty"` // Expiry of the delivered lot in YYYY-MM-DD
+}
@@ -0,0 +1,39 @@
+package models
+
+// ReorderSuggestion is an inventory item whose projected stock fell to its reorder point and how much to buy.
+// Quantities are in the stock unit of the item
+type ReorderSuggestion struct {
+	InventoryID       int     `json:"inventory_id"`
+	Name              string  `json:"name"`
+	Unit              string  `json:"unit"`
+	StockLevel        float64 `json:"stock_level"`
+	Reserved          float64 `json:"reserved"`            // Held by open orders
+	OnOrder           float64 `json:"on_order"`            // Still due on draft and sent purchase orders
+	Projected         float64 `json:"projected"`           // Stock level minus reserved plus on order
+	AverageDailyUsage float64 `json:"average_daily_usage"` // Sales usage less refunds over the usage window
+	LeadTimeDays      int     `json:"lead_time_days"`      // Lead time of the chosen supplier
+	ReorderLevel      float64 `json:"reorder_level"`
+	ReorderPoint      float64 `json:"reorder_point"` // Reorder level plus the usage expected during the lead time
+	ParLevel          float64 `json:"par_level"`     // Par level of the item, twice the reorder level when not set
+	TargetLevel       float64 `json:"target_level"`  // Par level plus the usage expected during the lead time
+	SupplierID        int     `json:"supplier_id,omitempty"`
+	SupplierName      string  `json:"supplier_name,omitempty"`
+	PackSize          float64 `json:"pack_size,omitempty"`
+	PackUnit          string  `json:"pack_unit,omitempty"`
+	PackPrice         float64 `json:"pack_price,omitempty"`
+	PackQuantity      float64 `json:"pack_quantity,omitempty"` // One pack in the stock unit
+	Packs             float64 `json:"packs,omitempty"`         // Whole packs to order
+	SuggestedQuantity float64 `json:"suggested_quantity"`      // Packs times pack quantity, or the shortfall when no supplier sells the item
+	EstimatedCost     float64 `json:"estimated_cost,omitempty"`
+}
+
+type ReorderSuggestions struct {
+	UsageDays   int                 `json:"usage_days"` // Days of sales the average daily usage is taken over
+	Suggestions []ReorderSuggestion `json:"suggestions"`
+}
+
+// ReorderDrafts are the draft purchase orders made from the suggestions, one per supplier
+type ReorderDrafts struct {
+	PurchaseOrders  []PurchaseOrder     `json:"purchase_orders"`
+	WithoutSupplier []ReorderSuggestion `json:"without_supplier"` // Suggestions no supplier sells, left to order by hand
+}
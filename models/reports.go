@@ -3,15 +3,22 @@ package models
 type PopularItems struct {
 	Menu_item_id int    `json:"menu_item_id"`
 	Name         string `json:"name"`
+	Variant_id   int    `json:"variant_id,omitempty"`
+	Variant      string `json:"variant,omitempty"`
 	Sale_count   int    `json:"sale_count"`
 }
 
+// TotalSale is what closed orders were paid, the gross sales plus the discounts and refunds, which are negative
 type TotalSale struct {
 	TotalSaleAmount float64 `json:"Total_Sale_Amount"`
+	GrossSaleAmount float64 `json:"Gross_Sale_Amount"` // Order lines before discounts
+	DiscountAmount  float64 `json:"Discount_Amount"`   // Promotions and loyalty redemptions
+	RefundAmount    float64 `json:"Refund_Amount"`
 }
 
 type OrderedItemsNum struct {
 	Name     string `json:"name"`
+	Variant  string `json:"variant,omitempty"`
 	Quantity int    `json:"quantity"`
 }
 
@@ -0,0 +1,43 @@
+package models
+
+import "time"
+
+// Stock count statuses
+const (
+	CountOpen   = "open"
+	CountPosted = "posted"
+)
+
+type StockCount struct {
+	ID           int              `json:"id"`                  // Matches count_id
+	Status       string           `json:"status"`              // Matches status, open or posted
+	Note         string           `json:"note,omitempty"`      // Matches note
+	OpenedBy     string           `json:"opened_by,omitempty"` // Matches opened_by
+	OpenedAt     time.Time        `json:"opened_at"`           // Matches opened_at
+	PostedBy     string           `json:"posted_by,omitempty"` // Matches posted_by
+	PostedAt     *time.Time       `json:"posted_at,omitempty"` // Matches posted_at
+	ItemsCounted int              `json:"items_counted"`       // Number of counted lines
+	VarianceCost float64          `json:"variance_cost"`       // Sum of the line variance costs, negative for missing stock
+	Lines        []StockCountLine `json:"lines,omitempty"`
+}
+
+// StockCountLine compares the counted quantity with the system stock, which is the current stock level
+// while the count is open and the stock level at posting afterwards
+type StockCountLine struct {
+	InventoryID  int       `json:"inventory_id"`      // Matches inventory_id
+	Name         string    `json:"name"`              // Matches name in inventory
+	Unit         string    `json:"unit"`              // Stock unit of the inventory item
+	Counted      float64   `json:"counted_quantity"`  // Matches counted_quantity
+	Expected     float64   `json:"expected_quantity"` // System stock level
+	Variance     float64   `json:"variance"`          // Counted minus expected
+	UnitCost     float64   `json:"unit_cost"`         // Weighted average cost of one stock unit
+	VarianceCost float64   `json:"variance_cost"`     // Variance times unit cost
+	CountedAt    time.Time `json:"counted_at"`        // Matches counted_at
+}
+
+// CountLineRequest is a counted quantity of an inventory item, given in a unit or pack of the item
+type CountLineRequest struct {
+	InventoryID int     `json:"inventory_id"`
+	Quantity    float64 `json:"quantity"`
+	Unit        string  `json:"unit,omitempty"` // The stock unit when empty
+}
@@ -0,0 +1,46 @@
+package models
+
+import "time"
+
+// Stock movement types
+const (
+	MovementPurchase        = "purchase"
+	MovementSaleUsage       = "sale_usage"
+	MovementRefundReturn    = "refund_return"
+	MovementWaste           = "waste"
+	MovementCountAdjustment = "count_adjustment"
+	MovementTransfer        = "transfer"
+)
+
+type StockMovement struct {
+	ID            int       `json:"id"`                       // Matches movement_id
+	InventoryID   int       `json:"inventory_id"`             // Matches inventory_id
+	Type          string    `json:"type"`                     // Matches movement_type
+	Quantity      float64   `json:"quantity"`                 // Matches quantity, negative when stock goes out
+	BalanceAfter  float64   `json:"balance_after"`            // Matches balance_after, the stock level after the movement
+	Unit          string    `json:"unit"`                     // Matches unit, the stock unit of quantity and balance_after when the movement was made
+	OrderID       *int      `json:"order_id,omitempty"`       // Matches order_id of the order that caused the movement
+	TransactionID *int      `json:"transaction_id,omitempty"` // Matches transaction_id of the purchase
+	LotID         *int      `json:"lot_id,omitempty"`         // Matches lot_id of the lot opened by a purchase or written off
+	Reason        string    `json:"reason,omitempty"`         // Matches reason
+	CreatedBy     string    `json:"created_by,omitempty"`     // Matches created_by, the user from the X-User header
+	CreatedAt     time.Time `json:"created_at"`               // Matches created_at
+}
+
+// TransferRequest moves stock of an inventory item to or from another location, given in a unit or pack of the item
+type TransferRequest struct {
+	Quantity float64 `json:"quantity"`       // Positive when stock comes in, negative when it goes out
+	Unit     string  `json:"unit,omitempty"` // The stock unit when empty
+	Reason   string  `json:"reason"`         // The other location or why the stock is moved
+}
+
+// StockDiscrepancy is an inventory item whose stock level differs from the sum of its ledger or from what is left in its lots
+type StockDiscrepancy struct {
+	InventoryID   int     `json:"inventory_id"`
+	Name          string  `json:"name"`
+	StockLevel    float64 `json:"stock_level"`
+	LedgerBalance float64 `json:"ledger_balance"`
+	Difference    float64 `json:"difference"` // stock_level minus ledger_balance
+	LotBalance    float64 `json:"lot_balance"`
+	LotDifference float64 `json:"lot_difference"` // stock_level minus lot_balance
+}
@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+type Supplier struct {
+	ID           int            `json:"id"`                     // Matches supplier_id
+	Name         string         `json:"name"`                   // Matches name
+	ContactName  string         `json:"contact_name,omitempty"` // Matches contact_name
+	Email        string         `json:"email,omitempty"`        // Matches email
+	Phone        string         `json:"phone,omitempty"`        // Matches phone
+	LeadTimeDays int            `json:"lead_time_days"`         // Matches lead_time_days, days from sending an order to delivery
+	CreatedAt    time.Time      `json:"created_at"`             // Matches created_at
+	Items        []SupplierItem `json:"items,omitempty"`        // Linked items from supplier_items
+}
+
+// SupplierItem is an inventory item the supplier sells and the pack it comes in
+type SupplierItem struct {
+	SupplierID    int     `json:"supplier_id"`    // Matches supplier_id
+	InventoryID   int     `json:"inventory_id"`   // Matches inventory_id
+	Name          string  `json:"name"`           // Matches name in inventory
+	PackSize      float64 `json:"pack_size"`      // Matches pack_size
+	PackUnit      string  `json:"pack_unit"`      // Matches pack_unit, a registered unit, a pack of the inventory item is kept as the unit it holds
+	PackPrice     float64 `json:"pack_price"`     // Matches pack_price
+	StockQuantity float64 `json:"stock_quantity"` // One pack in the stock unit
+	Unit          string  `json:"unit"`           // Stock unit of the inventory item
+}
@@ -0,0 +1,16 @@
+package models
+
+type Unit struct {
+	Code      string  `json:"code"`      // Matches unit_code
+	Name      string  `json:"name"`      // Matches name
+	Dimension string  `json:"dimension"` // Matches dimension: mass, volume or count
+	ToBase    float64 `json:"to_base"`   // Matches to_base, one unit in g, ml or pcs
+}
+
+type PackUnit struct {
+	ID          int     `json:"id"`           // Matches pack_id
+	InventoryID int     `json:"inventory_id"` // Matches inventory_id
+	Name        string  `json:"name"`         // Matches name, e.g. bag or case
+	Quantity    float64 `json:"quantity"`     // Matches quantity of unit in one pack
+	Unit        string  `json:"unit"`         // Matches unit_code
+}
@@ -0,0 +1,29 @@
+package models
+
+// ValuationItem is the stock of an inventory item valued by the costing method
+type ValuationItem struct {
+	InventoryID int     `json:"inventory_id"`
+	Name        string  `json:"name"`
+	Category    string  `json:"category"`
+	UnitType    string  `json:"unit_type"`
+	Quantity    float64 `json:"quantity"`  // Stock level at the valuation date in the stock unit
+	UnitCost    float64 `json:"unit_cost"` // Value divided by quantity
+	Value       float64 `json:"value"`
+	Priced      bool    `json:"priced"` // False when the item was never purchased, so its value is unknown
+}
+
+type ValuationGroup struct {
+	Group    string          `json:"group"`              // Category or unit type
+	Quantity float64         `json:"quantity,omitempty"` // Total quantity, only when grouped by unit type
+	Value    float64         `json:"value"`
+	Items    []ValuationItem `json:"items"`
+}
+
+type ValuationReport struct {
+	Method   string           `json:"method"`
+	AsOf     string           `json:"as_of"` // Valuation date in YYYY-MM-DD, stock at the end of that day
+	GroupBy  string           `json:"group_by"`
+	Total    float64          `json:"total"`
+	Complete bool             `json:"complete"` // Every item in stock has a known cost
+	Groups   []ValuationGroup `json:"groups"`
+}
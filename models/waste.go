@@ -0,0 +1,63 @@
+package models
+
+import "time"
+
+// Waste reason codes
+var WasteReasons = []string{"spilled", "expired", "remade", "damaged", "quality", "other"}
+
+// WasteRequest is a waste of either an inventory item or servings of a menu item, the menu item is expanded through its recipe
+type WasteRequest struct {
+	InventoryID int     `json:"inventory_id,omitempty"` // Wasted inventory item
+	MenuItemID  int     `json:"menu_item_id,omitempty"` // Wasted menu item
+	VariantID   int     `json:"variant_id,omitempty"`   // Variant of the wasted menu item, its recipe is used instead
+	Quantity    float64 `json:"quantity"`               // Quantity of the inventory item or servings of the menu item
+	Unit        string  `json:"unit,omitempty"`         // Unit or pack of the inventory item quantity, the stock unit when empty
+	Reason      string  `json:"reason"`                 // One of WasteReasons
+	Note        string  `json:"note,omitempty"`
+}
+
+type WasteEntry struct {
+	ID          int       `json:"id"`                     // Matches waste_id
+	InventoryID int       `json:"inventory_id"`           // Matches inventory_id
+	Name        string    `json:"name"`                   // Matches name in inventory
+	MenuItemID  *int      `json:"menu_item_id,omitempty"` // Matches menu_item_id when a menu item was wasted
+	VariantID   *int      `json:"variant_id,omitempty"`   // Matches variant_id
+	Servings    float64   `json:"servings,omitempty"`     // Matches servings of the wasted menu item
+	Quantity    float64   `json:"quantity"`               // Matches quantity
+	Unit        string    `json:"unit"`                   // Matches unit, the stock unit of the inventory item when it was wasted
+	UnitCost    float64   `json:"unit_cost"`              // Matches unit_cost
+	Cost        float64   `json:"cost"`                   // Quantity times unit cost
+	Reason      string    `json:"reason"`                 // Matches reason
+	Note        string    `json:"note,omitempty"`         // Matches note
+	CreatedBy   string    `json:"created_by,omitempty"`   // Matches created_by
+	CreatedAt   time.Time `json:"created_at"`             // Matches created_at
+}
+
+type WasteByReason struct {
+	Reason  string  `json:"reason"`
+	Entries int     `json:"entries"`
+	Cost    float64 `json:"cost"`
+}
+
+type WasteByItem struct {
+	InventoryID int     `json:"inventory_id"`
+	Name        string  `json:"name"`
+	Quantity    float64 `json:"quantity"`
+	Unit        string  `json:"unit"`
+	Cost        float64 `json:"cost"`
+}
+
+type WasteByDay struct {
+	Day     string  `json:"day"`
+	Entries int     `json:"entries"`
+	Cost    float64 `json:"cost"`
+}
+
+type WasteReport struct {
+	StartDate string          `json:"start_date"`
+	EndDate   string          `json:"end_date"`
+	Cost      float64         `json:"cost"`
+	ByReason  []WasteByReason `json:"by_reason"`
+	ByItem    []WasteByItem   `json:"by_item"`
+	ByDay     []WasteByDay    `json:"by_day"`
+}